@@ -1,15 +1,17 @@
 package main
 
 import (
+	"context"
 	"log"
-	"os"
-	"path/filepath"
 
 	"lauraai-backend/internal/config"
 	"lauraai-backend/internal/handler"
+	"lauraai-backend/internal/llm"
 	"lauraai-backend/internal/middleware"
+	"lauraai-backend/internal/ratelimit"
 	"lauraai-backend/internal/repository"
 	"lauraai-backend/internal/service"
+	"lauraai-backend/internal/storage"
 
 	"github.com/gin-gonic/gin"
 )
@@ -23,48 +25,80 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
-	// 确保上传目录存在
-	if err := os.MkdirAll(config.AppConfig.UploadsDir, 0755); err != nil {
-		log.Fatalf("Failed to create upload directory: %v", err)
+	// 初始化图片存储（本地目录或 S3 兼容对象存储）
+	if err := storage.InitImageStore(); err != nil {
+		log.Fatalf("Failed to initialize image store: %v", err)
 	}
 
-	// 初始化 Gemini 服务
-	chatService, err := service.NewGeminiChatService()
+	// 初始化 AI 模型（Gemini、OpenAI 兼容接口或离线的 fake）
+	var chatService *service.ChatService
+	var imagenService *service.ImagenService
+	var visionService *service.VisionService
+	var reportService *service.ReportService
+	models, err := llm.New()
 	if err != nil {
-		log.Printf("警告: Gemini Chat 服务初始化失败: %v", err)
-		chatService = nil
+		log.Printf("警告: AI 模型初始化失败: %v", err)
+	} else {
+		// 只配置了部分功能的提供方时，其余功能不可用
+		if models.Chat != nil {
+			chatService = service.NewChatService(models.Chat)
+		}
+		if models.Image != nil {
+			imagenService = service.NewImagenService(models.Image)
+		}
+		if models.Vision != nil {
+			visionService = service.NewVisionService(models.Vision)
+		}
+		if models.Text != nil {
+			reportService = service.NewReportService(models.Text)
+		}
 	}
 
-	imagenService, err := service.NewGeminiImagenService()
+	// 加载价格目录
+	pricingService, err := service.NewPricingService()
 	if err != nil {
-		log.Printf("警告: Gemini Imagen 服务初始化失败: %v", err)
-		imagenService = nil
+		log.Fatalf("Failed to load pricing catalog: %v", err)
 	}
 
-	visionService, err := service.NewGeminiVisionService()
+	// AI 生成并发控制，订阅用户优先排队
+	generationGate := service.NewGenerationGate(config.AppConfig.AIMaxConcurrency)
+	// 每日对话额度
+	quotaService := service.NewQuotaService()
+	// 高成本接口按用户限流
+	limiter, err := ratelimit.New()
 	if err != nil {
-		log.Printf("警告: Gemini Vision 服务初始化失败: %v", err)
-		visionService = nil
+		log.Fatalf("Failed to initialize rate limiter: %v", err)
 	}
 
-	reportService, err := service.NewGeminiReportService()
-	if err != nil {
-		log.Printf("警告: Gemini Report 服务初始化失败: %v", err)
-		reportService = nil
+	// 持久化后台任务队列：报告生成、图片生成、Telegram 通知
+	jobQueue := service.NewJobQueue()
+	notifier := service.NewNotifier(jobQueue)
+	reportJobs := service.NewReportJobs(jobQueue, reportService, generationGate, notifier)
+	var memoryService *service.MemoryService
+	if models != nil && models.Text != nil {
+		memoryService = service.NewMemoryService(jobQueue, models.Text, generationGate)
 	}
+	var generationJobRunner *service.GenerationJobRunner
+	if imagenService != nil && reportService != nil {
+		generationJobRunner = service.NewGenerationJobRunner(jobQueue, imagenService, reportService, generationGate, notifier)
+	}
+	jobQueue.Start(context.Background(), config.AppConfig.JobWorkers)
 
 	// 初始化 Gin
 	r := gin.Default()
 
-	// 静态文件服务
-	r.Static("/uploads", config.AppConfig.UploadsDir)
+	// 生成图片：完全模糊图公开，半模糊图和清晰图需要签名 URL
+	uploadsHandler := handler.NewUploadsHandler()
+	r.GET("/uploads/:filename", uploadsHandler.Serve)
+	r.HEAD("/uploads/:filename", uploadsHandler.Serve)
 
 	// CORS 中间件
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Telegram-Init-Data, Accept-Language")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -82,21 +116,6 @@ func main() {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
-	// 调试端点：修复空share_code的记录
-	r.POST("/debug/fix-share-codes", func(c *gin.Context) {
-		if c.GetHeader("X-Debug-Key") != "lauraai-clear-2026" {
-			c.JSON(403, gin.H{"error": "Forbidden"})
-			return
-		}
-		// 为所有空share_code的记录生成新的share_code
-		result := repository.DB.Exec("UPDATE characters SET share_code = CONCAT('SC', FLOOR(RANDOM() * 900000 + 100000)::TEXT, FLOOR(RANDOM() * 1000)::TEXT) WHERE share_code = '' OR share_code IS NULL")
-		if result.Error != nil {
-			c.JSON(500, gin.H{"error": result.Error.Error()})
-			return
-		}
-		c.JSON(200, gin.H{"message": "Fixed", "rows_affected": result.RowsAffected})
-	})
-
 	// 调试端点：清空所有数据（用于测试）
 	r.POST("/debug/clear-all-data", func(c *gin.Context) {
 		if c.GetHeader("X-Debug-Key") != "lauraai-clear-2026" {
@@ -108,7 +127,45 @@ func main() {
 		var errors []string
 		var deletedFiles int
 
-		// 1. 删除消息
+		// 0. 删除优惠码使用记录、助力和解锁记录、订阅和支付记录
+		if result := repository.DB.Exec("DELETE FROM promo_redemptions"); result.Error != nil {
+			errors = append(errors, "promo_redemptions: "+result.Error.Error())
+		}
+		if result := repository.DB.Exec("UPDATE promo_codes SET redemption_count = 0"); result.Error != nil {
+			errors = append(errors, "promo_codes: "+result.Error.Error())
+		}
+		if result := repository.DB.Exec("DELETE FROM jobs"); result.Error != nil {
+			errors = append(errors, "jobs: "+result.Error.Error())
+		}
+		if result := repository.DB.Exec("DELETE FROM generation_jobs"); result.Error != nil {
+			errors = append(errors, "generation_jobs: "+result.Error.Error())
+		}
+		if result := repository.DB.Exec("DELETE FROM share_links"); result.Error != nil {
+			errors = append(errors, "share_links: "+result.Error.Error())
+		}
+		if result := repository.DB.Exec("DELETE FROM unlock_helps"); result.Error != nil {
+			errors = append(errors, "unlock_helps: "+result.Error.Error())
+		}
+		if result := repository.DB.Exec("DELETE FROM unlock_events"); result.Error != nil {
+			errors = append(errors, "unlock_events: "+result.Error.Error())
+		}
+		if result := repository.DB.Exec("DELETE FROM subscriptions"); result.Error != nil {
+			errors = append(errors, "subscriptions: "+result.Error.Error())
+		}
+		if result := repository.DB.Exec("DELETE FROM payments"); result.Error != nil {
+			errors = append(errors, "payments: "+result.Error.Error())
+		}
+
+		// 1. 删除对话用量、记忆和消息
+		if result := repository.DB.Exec("DELETE FROM chat_usage"); result.Error != nil {
+			errors = append(errors, "chat_usage: "+result.Error.Error())
+		}
+		if result := repository.DB.Exec("DELETE FROM memory_facts"); result.Error != nil {
+			errors = append(errors, "memory_facts: "+result.Error.Error())
+		}
+		if result := repository.DB.Exec("DELETE FROM conversation_summaries"); result.Error != nil {
+			errors = append(errors, "conversation_summaries: "+result.Error.Error())
+		}
 		if result := repository.DB.Exec("DELETE FROM messages"); result.Error != nil {
 			errors = append(errors, "messages: "+result.Error.Error())
 		}
@@ -124,32 +181,24 @@ func main() {
 		}
 
 		// 4. 删除所有上传的文件
-		uploadsDir := config.AppConfig.UploadsDir
-		if uploadsDir != "" {
-			err := filepath.Walk(uploadsDir, func(path string, info os.FileInfo, err error) error {
-				if err != nil {
-					return err
-				}
-				// 跳过目录本身
-				if path == uploadsDir {
-					return nil
-				}
-				// 只删除文件，不删除目录
-				if !info.IsDir() {
-					if err := os.Remove(path); err != nil {
-						errors = append(errors, "file "+path+": "+err.Error())
-						return nil // 继续处理其他文件
-					}
-					deletedFiles++
-				}
-				return nil
-			})
-			if err != nil {
-				errors = append(errors, "walk uploads dir: "+err.Error())
-			}
+		deleted, err := storage.Images.DeleteAll(c.Request.Context())
+		deletedFiles += deleted
+		if err != nil {
+			errors = append(errors, "delete images: "+err.Error())
 		}
 
 		// 5. 重置序列（可选）
+		repository.DB.Exec("ALTER SEQUENCE chat_usage_id_seq RESTART WITH 1")
+		repository.DB.Exec("ALTER SEQUENCE memory_facts_id_seq RESTART WITH 1")
+		repository.DB.Exec("ALTER SEQUENCE conversation_summaries_id_seq RESTART WITH 1")
+		repository.DB.Exec("ALTER SEQUENCE promo_redemptions_id_seq RESTART WITH 1")
+		repository.DB.Exec("ALTER SEQUENCE jobs_id_seq RESTART WITH 1")
+		repository.DB.Exec("ALTER SEQUENCE generation_jobs_id_seq RESTART WITH 1")
+		repository.DB.Exec("ALTER SEQUENCE share_links_id_seq RESTART WITH 1")
+		repository.DB.Exec("ALTER SEQUENCE unlock_helps_id_seq RESTART WITH 1")
+		repository.DB.Exec("ALTER SEQUENCE unlock_events_id_seq RESTART WITH 1")
+		repository.DB.Exec("ALTER SEQUENCE subscriptions_id_seq RESTART WITH 1")
+		repository.DB.Exec("ALTER SEQUENCE payments_id_seq RESTART WITH 1")
 		repository.DB.Exec("ALTER SEQUENCE messages_id_seq RESTART WITH 1")
 		repository.DB.Exec("ALTER SEQUENCE characters_id_seq RESTART WITH 1")
 		repository.DB.Exec("ALTER SEQUENCE users_id_seq RESTART WITH 1")
@@ -161,7 +210,7 @@ func main() {
 
 		c.JSON(200, gin.H{
 			"message":       "所有数据已清空",
-			"tables_cleared": []string{"messages", "characters", "users"},
+			"tables_cleared": []string{"promo_redemptions", "jobs", "generation_jobs", "share_links", "unlock_helps", "unlock_events", "subscriptions", "payments", "chat_usage", "memory_facts", "conversation_summaries", "messages", "characters", "users"},
 			"deleted_files": deletedFiles,
 		})
 	})
@@ -173,12 +222,12 @@ func main() {
 		api.POST("/auth/telegram", authHandler.TelegramAuth)
 
 		// 分享链接公开接口（无需认证）
-		unlockHandler := handler.NewUnlockHandler(reportService)
+		unlockHandler := handler.NewUnlockHandler(reportJobs, pricingService)
 		api.GET("/share/:code", unlockHandler.GetShareInfo)
 	}
 
 	// Telegram Bot Webhook（公开，由 Telegram 服务器调用）
-	telegramWebhookHandler := handler.NewTelegramWebhookHandler()
+	telegramWebhookHandler := handler.NewTelegramWebhookHandler(reportJobs, pricingService)
 	r.POST("/webhook/telegram", telegramWebhookHandler.HandleWebhook)
 
 	// 需要认证的路由
@@ -205,32 +254,82 @@ func main() {
 		apiAuth.POST("/invite/bind", inviteHandler.BindInviter)
 
 		// 解锁相关
-		unlockHandler := handler.NewUnlockHandler(reportService)
+		unlockHandler := handler.NewUnlockHandler(reportJobs, pricingService)
 		apiAuth.POST("/characters/:id/help-unlock", unlockHandler.HelpUnlock)
 		apiAuth.POST("/characters/:id/unlock", unlockHandler.Unlock)
+		apiAuth.POST("/characters/:id/unlock/ton/verify", unlockHandler.VerifyTonPayment)
 		apiAuth.GET("/characters/:id/unlock-price", unlockHandler.GetUnlockPrice)
-		apiAuth.POST("/characters/:id/report/retry", unlockHandler.RetryReport)
+		apiAuth.POST("/characters/:id/unlock-price", unlockHandler.GetUnlockPrice)
+		apiAuth.POST("/characters/:id/report/retry", middleware.RateLimitMiddleware(limiter, ratelimit.GroupReportRetry), unlockHandler.RetryReport)
+		apiAuth.POST("/characters/:id/share-code", unlockHandler.RegenerateShareCode)
+
+		// 支付记录
+		paymentHandler := handler.NewPaymentHandler()
+		apiAuth.GET("/payments", paymentHandler.List)
+
+		// 订阅相关
+		subscriptionHandler := handler.NewSubscriptionHandler(pricingService)
+		apiAuth.GET("/subscription", subscriptionHandler.Get)
+		apiAuth.POST("/subscription", subscriptionHandler.Subscribe)
+		apiAuth.POST("/subscription/cancel", subscriptionHandler.Cancel)
+
+		// 今日对话用量和额度
+		usageHandler := handler.NewUsageHandler(quotaService)
+		apiAuth.GET("/usage", usageHandler.Get)
 
 		// 聊天相关
 		if chatService != nil {
-			chatHandler := handler.NewChatHandler(chatService)
-			apiAuth.POST("/characters/:id/chat", chatHandler.SendMessage)
+			replyService := service.NewReplyService(chatService, memoryService, generationGate, quotaService)
+			chatHandler := handler.NewChatHandler(replyService)
+			apiAuth.POST("/characters/:id/chat", middleware.RateLimitMiddleware(limiter, ratelimit.GroupChat), chatHandler.SendMessage)
+			apiAuth.POST("/characters/:id/chat/cancel", chatHandler.CancelGeneration)
 			apiAuth.GET("/characters/:id/messages", chatHandler.GetMessages)
+			apiAuth.PATCH("/characters/:id/messages/:msgId", chatHandler.EditMessage)
+			apiAuth.DELETE("/characters/:id/messages/:msgId", chatHandler.DeleteMessage)
+			apiAuth.POST("/characters/:id/messages/:msgId/regenerate", middleware.RateLimitMiddleware(limiter, ratelimit.GroupChat), chatHandler.Regenerate)
+			apiAuth.GET("/characters/:id/messages/:msgId/versions", chatHandler.GetVersions)
+			apiAuth.POST("/characters/:id/messages/:msgId/select", chatHandler.SelectVersion)
+
+			// WebSocket 对话（initData 通过 ?initData= 传递）
+			wsHandler := handler.NewWSHandler(replyService, limiter)
+			apiAuth.GET("/ws", wsHandler.Connect)
 		}
 
-		// 图片生成相关
-		if imagenService != nil && reportService != nil {
-			imageHandler := handler.NewImageHandler(imagenService, reportService)
-			apiAuth.POST("/characters/:id/generate-image", imageHandler.GenerateImage)
+		// 角色记忆（用户事实和早期聊天摘要）
+		memoryHandler := handler.NewMemoryHandler()
+		apiAuth.GET("/characters/:id/memory", memoryHandler.Get)
+		apiAuth.DELETE("/characters/:id/memory", memoryHandler.Forget)
+		apiAuth.DELETE("/characters/:id/memory/facts/:factId", memoryHandler.DeleteFact)
+
+		// 图片生成相关（异步任务）
+		if generationJobRunner != nil {
+			imageHandler := handler.NewImageHandler(generationJobRunner)
+			apiAuth.POST("/characters/:id/generate-image", middleware.RateLimitMiddleware(limiter, ratelimit.GroupGenerateImage), imageHandler.GenerateImage)
 		}
 
+		// 生成任务进度
+		jobHandler := handler.NewJobHandler()
+		apiAuth.GET("/jobs/:id", jobHandler.Get)
+		apiAuth.GET("/jobs/:id/events", jobHandler.Events)
+
 		// Mini Me 相关
 		if visionService != nil && imagenService != nil {
-			miniMeHandler := handler.NewMiniMeHandler(visionService, imagenService)
-			apiAuth.POST("/minime/generate", miniMeHandler.UploadAndGenerateMiniMe)
+			miniMeHandler := handler.NewMiniMeHandler(visionService, imagenService, generationGate)
+			apiAuth.POST("/minime/generate", middleware.RateLimitMiddleware(limiter, ratelimit.GroupMiniMe), miniMeHandler.UploadAndGenerateMiniMe)
 		}
 	}
 
+	// 管理接口（需要 X-Admin-Key）
+	admin := r.Group("/api/admin")
+	admin.Use(middleware.AdminAuthMiddleware())
+	{
+		paymentHandler := handler.NewPaymentHandler()
+		admin.POST("/payments/:id/refund", paymentHandler.Refund)
+
+		promoHandler := handler.NewPromoHandler()
+		admin.POST("/promo-codes", promoHandler.Create)
+	}
+
 	// 启动服务器
 	port := config.AppConfig.Port
 	log.Printf("Server starting on port %s", port)
@@ -1,8 +1,12 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -15,6 +19,78 @@ type Config struct {
 	DevMode          bool
 	BaseURL          string
 	UploadsDir       string
+
+	// AI 模型提供方：gemini 或 fake（离线确定性实现），为空时按是否配置 GEMINI_API_KEY 自动选择
+	LLMProvider string
+	// 对话和报告可单独指定提供方（gemini、openai、fake），为空时使用 LLMProvider
+	ChatProvider   string
+	ReportProvider string
+	// OpenAI 兼容接口（OpenAI、vLLM、Ollama 等），BaseURL 包含 /v1 前缀
+	OpenAIBaseURL     string
+	OpenAIAPIKey      string
+	OpenAIModel       string
+	OpenAIReportModel string
+	// AI 调用重试和熔断：每个模型最多尝试次数、连续失败多少次熔断、熔断持续时间，0 使用默认值
+	AIRetryAttempts    int
+	AIBreakerThreshold int
+	AIBreakerCooldown  time.Duration
+
+	// Telegram Bot API 地址（可指向本地模拟服务器）
+	TelegramAPIBaseURL string
+	// Webhook 密钥，对应 setWebhook 的 secret_token
+	TelegramWebhookSecret string
+
+	// TON 收款配置
+	TonWalletAddress string
+	TonAPIBaseURL    string // toncenter 兼容的 HTTP API
+	TonAPIKey        string
+	TonMemoSecret    string // 转账备注的 HMAC 密钥
+
+	// 管理接口密钥（X-Admin-Key），为空时禁用管理接口
+	AdminAPIKey string
+
+	// 价格目录 JSON 文件路径，为空时使用内置默认价格
+	PricingFile string
+
+	// 同时进行的 AI 生成请求上限，超出时排队（订阅用户优先），0 表示不限制
+	AIMaxConcurrency int
+	// 后台任务队列 worker 数量
+	JobWorkers int
+
+	// 每个用户每天（UTC）的对话额度：回复条数和 token 数，按免费用户和订阅用户分别配置，0 表示不限制
+	ChatDailyMessagesFree    int
+	ChatDailyTokensFree      int64
+	ChatDailyMessagesPremium int
+	ChatDailyTokensPremium   int64
+
+	// 接口限流：每个用户每类接口一个令牌桶，格式为 "次数/时长"（如 20/1m，次数同时是允许连续请求的上限），空或 0 表示不限制
+	RateLimitChat          string
+	RateLimitGenerateImage string
+	RateLimitMiniMe        string
+	RateLimitReportRetry   string
+	// 限流存储后端：memory（单实例）、postgres 或 redis（多实例共享，兼容 Redis 协议的服务均可）
+	RateLimitStore    string
+	RateLimitRedisURL string // redis://[:password@]host:port[/db]，TLS 使用 rediss://
+
+	// 好友助力解锁阈值：达到 HelpHalfThreshold 人半解锁，达到 HelpFullThreshold 人完全解锁（0 表示助力不能完全解锁）
+	HelpHalfThreshold int
+	HelpFullThreshold int
+	// 各解锁阶段的模糊程度（高斯模糊 sigma），完全解锁为清晰原图
+	BlurSigmaLocked float64
+	BlurSigmaHalf   float64
+
+	// 清晰图、半模糊图签名 URL 的 HMAC 密钥和有效期，完全模糊图不签名、可公开缓存
+	ImageURLSecret string
+	ImageURLTTL    time.Duration
+
+	// 图片存储后端：local（UploadsDir）或 s3（S3 兼容对象存储，如 MinIO）
+	ImageStore  string
+	S3Endpoint  string
+	S3AccessKey string
+	S3SecretKey string
+	S3Bucket    string
+	S3Region    string
+	S3UseSSL    bool
 }
 
 var AppConfig *Config
@@ -37,11 +113,93 @@ func LoadConfig() {
 		DevMode:          getEnv("DEV_MODE", "false") == "true",
 		BaseURL:          getEnv("BASE_URL", "https://lauraai-backend.fly.dev"),
 		UploadsDir:       getEnv("UPLOADS_DIR", "./uploads"),
+
+		LLMProvider:       getEnv("LLM_PROVIDER", ""),
+		ChatProvider:      getEnv("CHAT_PROVIDER", ""),
+		ReportProvider:    getEnv("REPORT_PROVIDER", ""),
+		OpenAIBaseURL:     getEnv("OPENAI_BASE_URL", "https://api.openai.com/v1"),
+		OpenAIAPIKey:      getEnv("OPENAI_API_KEY", ""),
+		OpenAIModel:       getEnv("OPENAI_MODEL", "gpt-4o-mini"),
+		OpenAIReportModel: getEnv("OPENAI_REPORT_MODEL", ""),
+
+		AIRetryAttempts:    getEnvInt("AI_RETRY_ATTEMPTS", 0),
+		AIBreakerThreshold: getEnvInt("AI_BREAKER_THRESHOLD", 0),
+		AIBreakerCooldown:  time.Duration(getEnvInt("AI_BREAKER_COOLDOWN_SECONDS", 0)) * time.Second,
+
+		TelegramAPIBaseURL:    getEnv("TELEGRAM_API_BASE_URL", "https://api.telegram.org"),
+		TelegramWebhookSecret: getEnv("TELEGRAM_WEBHOOK_SECRET", ""),
+
+		TonWalletAddress: getEnv("TON_WALLET_ADDRESS", ""),
+		TonAPIBaseURL:    getEnv("TON_API_BASE_URL", "https://toncenter.com/api/v2"),
+		TonAPIKey:        getEnv("TON_API_KEY", ""),
+		TonMemoSecret:    getEnv("TON_MEMO_SECRET", ""),
+
+		AdminAPIKey: getEnv("ADMIN_API_KEY", ""),
+
+		PricingFile: getEnv("PRICING_FILE", ""),
+
+		AIMaxConcurrency: getEnvInt("AI_MAX_CONCURRENCY", 4),
+		JobWorkers:       getEnvInt("JOB_WORKERS", 4),
+
+		ChatDailyMessagesFree:    getEnvInt("CHAT_DAILY_MESSAGES_FREE", 50),
+		ChatDailyTokensFree:      int64(getEnvInt("CHAT_DAILY_TOKENS_FREE", 200000)),
+		ChatDailyMessagesPremium: getEnvInt("CHAT_DAILY_MESSAGES_PREMIUM", 1000),
+		ChatDailyTokensPremium:   int64(getEnvInt("CHAT_DAILY_TOKENS_PREMIUM", 5000000)),
+
+		RateLimitChat:          getEnv("RATE_LIMIT_CHAT", "20/1m"),
+		RateLimitGenerateImage: getEnv("RATE_LIMIT_GENERATE_IMAGE", "5/1m"),
+		RateLimitMiniMe:        getEnv("RATE_LIMIT_MINIME", "3/1m"),
+		RateLimitReportRetry:   getEnv("RATE_LIMIT_REPORT_RETRY", "3/10m"),
+		RateLimitStore:         getEnv("RATE_LIMIT_STORE", "memory"),
+		RateLimitRedisURL:      getEnv("RATE_LIMIT_REDIS_URL", ""),
+
+		HelpHalfThreshold: getEnvInt("HELP_HALF_THRESHOLD", 1),
+		HelpFullThreshold: getEnvInt("HELP_FULL_THRESHOLD", 3),
+		BlurSigmaLocked:   getEnvFloat("BLUR_SIGMA_LOCKED", 30),
+		BlurSigmaHalf:     getEnvFloat("BLUR_SIGMA_HALF", 6),
+
+		ImageURLSecret: getEnv("IMAGE_URL_SECRET", ""),
+		ImageURLTTL:    time.Duration(getEnvInt("IMAGE_URL_TTL_SECONDS", 3600)) * time.Second,
+
+		ImageStore:  getEnv("IMAGE_STORE", "local"),
+		S3Endpoint:  getEnv("S3_ENDPOINT", ""),
+		S3AccessKey: getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey: getEnv("S3_SECRET_KEY", ""),
+		S3Bucket:    getEnv("S3_BUCKET", "lauraai-images"),
+		S3Region:    getEnv("S3_REGION", ""),
+		S3UseSSL:    getEnv("S3_USE_SSL", "true") == "true",
+	}
+
+	if AppConfig.HelpHalfThreshold < 1 {
+		AppConfig.HelpHalfThreshold = 1
+	}
+	if AppConfig.HelpFullThreshold != 0 && AppConfig.HelpFullThreshold <= AppConfig.HelpHalfThreshold {
+		log.Printf("警告: HELP_FULL_THRESHOLD (%d) 必须大于 HELP_HALF_THRESHOLD (%d)，已禁用助力完全解锁",
+			AppConfig.HelpFullThreshold, AppConfig.HelpHalfThreshold)
+		AppConfig.HelpFullThreshold = 0
+	}
+
+	if AppConfig.ImageURLTTL <= 0 {
+		AppConfig.ImageURLTTL = time.Hour
+	}
+	if AppConfig.ImageURLSecret == "" {
+		// 未配置时使用随机密钥：重启或多实例部署后已签发的图片 URL 会失效
+		AppConfig.ImageURLSecret = randomSecret()
+		log.Println("警告: IMAGE_URL_SECRET 未设置，已使用随机密钥签名图片 URL")
+	}
+
+	if AppConfig.TonMemoSecret == "" {
+		// 备注保存在支付记录中，使用随机密钥不影响已创建的支付
+		AppConfig.TonMemoSecret = randomSecret()
+		log.Println("警告: TON_MEMO_SECRET 未设置，已使用随机密钥生成转账备注")
 	}
 
 	if AppConfig.TelegramBotToken == "" {
 		log.Println("警告: TELEGRAM_BOT_TOKEN 未设置")
 	}
+	if AppConfig.TelegramWebhookSecret == "" {
+		log.Println("警告: TELEGRAM_WEBHOOK_SECRET 未设置，无法校验 Webhook 请求来源，Stars 支付已停用")
+	}
 	if AppConfig.GeminiAPIKey == "" {
 		log.Println("警告: GEMINI_API_KEY 未设置")
 	}
@@ -57,3 +215,25 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func randomSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -16,12 +16,14 @@ import (
 )
 
 type CharacterHandler struct {
-	characterRepo *repository.CharacterRepository
+	characterRepo    *repository.CharacterRepository
+	subscriptionRepo *repository.SubscriptionRepository
 }
 
 func NewCharacterHandler() *CharacterHandler {
 	return &CharacterHandler{
-		characterRepo: repository.NewCharacterRepository(),
+		characterRepo:    repository.NewCharacterRepository(),
+		subscriptionRepo: repository.NewSubscriptionRepository(),
 	}
 }
 
@@ -93,8 +95,9 @@ func (h *CharacterHandler) Create(c *gin.Context) {
 		return
 	}
 
+	applySubscription(h.subscriptionRepo, user.ID, character)
 	locale := middleware.GetLocaleFromContext(c)
-	response.Success(c, character.ToSafeResponse(string(locale)))
+	response.Success(c, characterResponse(character, string(locale)))
 }
 
 // List 获取用户的所有角色
@@ -105,17 +108,25 @@ func (h *CharacterHandler) List(c *gin.Context) {
 		return
 	}
 
-	characters, err := h.characterRepo.GetByUserID(user.ID)
+	// 生成任务未完成的角色暂不展示
+	characters, err := h.characterRepo.GetVisibleByUserID(user.ID)
 	if err != nil {
 		response.Error(c, 500, "Failed to query: "+err.Error())
 		return
 	}
 
+	// 订阅有效期内所有角色视为完全解锁
+	if h.subscriptionRepo.IsActive(user.ID) {
+		for i := range characters {
+			characters[i].SubscriptionUnlocked = true
+		}
+	}
+
 	// 转换为安全响应，过滤敏感图片URL
 	locale := middleware.GetLocaleFromContext(c)
 	safeCharacters := make([]map[string]interface{}, len(characters))
 	for i, char := range characters {
-		safeResponse := char.ToSafeResponse(string(locale))
+		safeResponse := characterResponse(&char, string(locale))
 		// 记录返回的图片URL（包括原始值和规范化后的值）
 		if i < 3 { // 只记录前3个，避免日志过多
 			log.Printf("[Character] 返回角色图片URL - ID: %d, type: %s, unlock_status: %d", char.ID, char.Type, char.UnlockStatus)
@@ -158,8 +169,9 @@ func (h *CharacterHandler) GetByID(c *gin.Context) {
 		return
 	}
 
+	applySubscription(h.subscriptionRepo, user.ID, character)
 	locale := middleware.GetLocaleFromContext(c)
-	response.Success(c, character.ToSafeResponse(string(locale)))
+	response.Success(c, characterResponse(character, string(locale)))
 }
 
 // CleanupEmpty 清理没有图片的角色
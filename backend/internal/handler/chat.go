@@ -1,9 +1,9 @@
 package handler
 
 import (
+	"errors"
 	"log"
 	"strconv"
-	"strings"
 
 	"lauraai-backend/internal/middleware"
 	"lauraai-backend/internal/model"
@@ -14,27 +14,20 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// escapeJSON 转义 JSON 字符串中的特殊字符
-func escapeJSON(s string) string {
-	s = strings.ReplaceAll(s, "\\", "\\\\")
-	s = strings.ReplaceAll(s, "\"", "\\\"")
-	s = strings.ReplaceAll(s, "\n", "\\n")
-	s = strings.ReplaceAll(s, "\r", "\\r")
-	s = strings.ReplaceAll(s, "\t", "\\t")
-	return s
-}
+// maxMessagePageSize 聊天历史单页最多返回的消息数
+const maxMessagePageSize = 100
 
 type ChatHandler struct {
 	characterRepo *repository.CharacterRepository
 	messageRepo   *repository.MessageRepository
-	chatService   *service.GeminiChatService
+	replyService  *service.ReplyService
 }
 
-func NewChatHandler(chatService *service.GeminiChatService) *ChatHandler {
+func NewChatHandler(replyService *service.ReplyService) *ChatHandler {
 	return &ChatHandler{
 		characterRepo: repository.NewCharacterRepository(),
 		messageRepo:   repository.NewMessageRepository(),
-		chatService:   chatService,
+		replyService:  replyService,
 	}
 }
 
@@ -42,134 +35,406 @@ func NewChatHandler(chatService *service.GeminiChatService) *ChatHandler {
 func (h *ChatHandler) SendMessage(c *gin.Context) {
 	log.Printf("SendMessage: 开始处理请求")
 
-	user, exists := middleware.GetUserFromContext(c)
-	if !exists {
-		log.Printf("SendMessage: 用户未认证")
-		response.Error(c, 401, "Unauthorized")
+	character, ok := loadOwnedCharacter(c, h.characterRepo)
+	if !ok {
 		return
 	}
-	log.Printf("SendMessage: 用户ID=%d", user.ID)
+	log.Printf("SendMessage: 用户ID=%d", character.UserID)
+
+	var req struct {
+		Message string `json:"message" binding:"required"`
+	}
 
-	idStr := c.Param("id")
-	characterID, err := strconv.ParseUint(idStr, 10, 64)
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, 400, "Invalid request parameters: "+err.Error())
+		return
+	}
+
+	quota, ok := h.reserveQuota(c, character.UserID)
+	if !ok {
+		return
+	}
+
+	userMessage, historyMessages, err := saveUserTurn(h.messageRepo, character, req.Message)
 	if err != nil {
-		response.Error(c, 400, "Invalid character ID")
+		h.replyService.ReleaseQuota(quota)
+		response.Error(c, 500, "Failed to save message: "+err.Error())
 		return
 	}
 
-	// 获取角色
-	character, err := h.characterRepo.GetByID(characterID)
+	h.streamReply(c, service.ReplyRequest{
+		Character: character,
+		History:   historyMessages,
+		Prompt:    userMessage,
+		Locale:    middleware.GetLocaleFromContext(c),
+		Quota:     quota,
+	})
+}
+
+// CancelGeneration 取消与角色之间进行中的回复生成，已生成的部分回复会保存并标记为 interrupted
+func (h *ChatHandler) CancelGeneration(c *gin.Context) {
+	character, ok := loadOwnedCharacter(c, h.characterRepo)
+	if !ok {
+		return
+	}
+
+	canceled := h.replyService.CancelCharacter(character.UserID, character.ID)
+	response.Success(c, gin.H{"canceled": canceled})
+}
+
+// Regenerate 重新生成回复（流式响应）
+// msgId 为最后一条角色回复时生成一个新版本，旧回复保留为可切换的版本；
+// 为最后一条用户消息（例如编辑后还没有回复）时直接生成回复
+func (h *ChatHandler) Regenerate(c *gin.Context) {
+	character, ok := loadOwnedCharacter(c, h.characterRepo)
+	if !ok {
+		return
+	}
+	message, ok := h.loadMessage(c, character.ID)
+	if !ok {
+		return
+	}
+
+	latest, err := h.messageRepo.GetLatest(character.ID)
+	if err != nil || latest.ID != message.ID {
+		response.Error(c, 409, "Only the latest message can be regenerated")
+		return
+	}
+
+	history, _, err := h.messageRepo.ListPage(character.ID, message.ID, 0, service.ChatHistoryWindow)
 	if err != nil {
-		response.Error(c, 404, "Character not found")
+		response.Error(c, 500, "Failed to query: "+err.Error())
 		return
 	}
 
-	// 验证角色属于当前用户
-	if character.UserID != user.ID {
-		response.Error(c, 403, "Access denied")
+	// 找到要回复的用户消息
+	prompt := message
+	if message.SenderType != model.SenderTypeUser {
+		if len(history) == 0 || history[len(history)-1].SenderType != model.SenderTypeUser {
+			response.Error(c, 409, "No user message to reply to")
+			return
+		}
+		prompt = &history[len(history)-1]
+		history = history[:len(history)-1]
+	}
+
+	quota, ok := h.reserveQuota(c, character.UserID)
+	if !ok {
+		return
+	}
+
+	req := service.ReplyRequest{
+		Character: character,
+		History:   history,
+		Prompt:    prompt,
+		Locale:    middleware.GetLocaleFromContext(c),
+		Quota:     quota,
+	}
+	if message.SenderType != model.SenderTypeUser {
+		req.Save = func(reply *model.Message) error {
+			return h.messageRepo.AddVersion(message, reply)
+		}
+	}
+	h.streamReply(c, req)
+}
+
+// EditMessage 修改用户消息
+// mode=truncate（默认）直接修改并删除之后的对话；mode=branch 保留原消息和之后的对话作为可切换的版本
+func (h *ChatHandler) EditMessage(c *gin.Context) {
+	character, ok := loadOwnedCharacter(c, h.characterRepo)
+	if !ok {
+		return
+	}
+	message, ok := h.loadMessage(c, character.ID)
+	if !ok {
 		return
 	}
 
 	var req struct {
 		Message string `json:"message" binding:"required"`
+		Mode    string `json:"mode"`
 	}
-
 	if err := c.ShouldBindJSON(&req); err != nil {
 		response.Error(c, 400, "Invalid request parameters: "+err.Error())
 		return
 	}
 
-	// 保存用户消息
-	userMessage := &model.Message{
-		UserID:      user.ID,
-		CharacterID: characterID,
-		SenderType:  model.SenderTypeUser,
-		Content:     req.Message,
+	if message.SenderType != model.SenderTypeUser {
+		response.Error(c, 400, "Only user messages can be edited")
+		return
 	}
-	if err := h.messageRepo.Create(userMessage); err != nil {
-		response.Error(c, 500, "Failed to save message: "+err.Error())
+	if message.Inactive {
+		response.Error(c, 409, "Message is not in the current conversation")
 		return
 	}
 
-	// 获取历史消息（最近 20 条）
-	historyMessages, _ := h.messageRepo.GetRecentByCharacterID(characterID, 20)
+	switch req.Mode {
+	case "", "truncate":
+		if err := h.messageRepo.Rewrite(message, req.Message); err != nil {
+			response.Error(c, 500, "Failed to edit message: "+err.Error())
+			return
+		}
+	case "branch":
+		edited := &model.Message{
+			UserID:      character.UserID,
+			CharacterID: character.ID,
+			SenderType:  model.SenderTypeUser,
+			Content:     req.Message,
+		}
+		if err := h.messageRepo.AddVersion(message, edited); err != nil {
+			response.Error(c, 500, "Failed to edit message: "+err.Error())
+			return
+		}
+		message = edited
+	default:
+		response.Error(c, 400, "Invalid mode")
+		return
+	}
 
-	// 设置 SSE 响应头
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-	c.Header("X-Accel-Buffering", "no") // 禁用 Nginx 缓存
-	c.Header("Access-Control-Allow-Origin", "*")
+	response.Success(c, message)
+}
 
-	// 使用流式响应
-	ctx := c.Request.Context()
-	locale := middleware.GetLocaleFromContext(c)
-	stream, err := h.chatService.ChatStream(ctx, character, historyMessages, req.Message, locale)
+// DeleteMessage 删除消息，当前对话中的消息连同其所有版本一起删除
+func (h *ChatHandler) DeleteMessage(c *gin.Context) {
+	character, ok := loadOwnedCharacter(c, h.characterRepo)
+	if !ok {
+		return
+	}
+	message, ok := h.loadMessage(c, character.ID)
+	if !ok {
+		return
+	}
+
+	if err := h.messageRepo.Delete(message); err != nil {
+		response.Error(c, 500, "Failed to delete message: "+err.Error())
+		return
+	}
+	response.Success(c, gin.H{"deleted": true})
+}
+
+// GetVersions 获取消息所在位置的所有版本，用于左右切换
+func (h *ChatHandler) GetVersions(c *gin.Context) {
+	character, ok := loadOwnedCharacter(c, h.characterRepo)
+	if !ok {
+		return
+	}
+	message, ok := h.loadMessage(c, character.ID)
+	if !ok {
+		return
+	}
+
+	versions, err := h.messageRepo.ListVersions(message)
 	if err != nil {
-		response.Error(c, 500, "Failed to generate response: "+err.Error())
+		response.Error(c, 500, "Failed to query: "+err.Error())
 		return
 	}
 
-	// 流式发送响应
-	var fullResponse string
-	for chunk := range stream {
-		fullResponse += chunk
-		// 直接写入 SSE 格式，与前端期望匹配
-		c.Writer.WriteString("data: {\"chunk\":\"" + escapeJSON(chunk) + "\"}\n\n")
-		c.Writer.Flush()
+	var activeID uint64
+	for _, v := range versions {
+		if !v.Inactive {
+			activeID = v.ID
+		}
 	}
+	response.Success(c, gin.H{
+		"versions":  versions,
+		"active_id": activeID,
+	})
+}
 
-	// 保存角色回复
-	if fullResponse != "" {
-		characterMessage := &model.Message{
-			UserID:      user.ID,
-			CharacterID: characterID,
-			SenderType:  model.SenderTypeCharacter,
-			Content:     fullResponse,
+// SelectVersion 切换到消息的这个版本，之后的对话也切换为该版本下的对话
+func (h *ChatHandler) SelectVersion(c *gin.Context) {
+	character, ok := loadOwnedCharacter(c, h.characterRepo)
+	if !ok {
+		return
+	}
+	target, ok := h.loadMessage(c, character.ID)
+	if !ok {
+		return
+	}
+	if !target.Inactive {
+		response.Success(c, target)
+		return
+	}
+
+	versions, err := h.messageRepo.ListVersions(target)
+	if err != nil {
+		response.Error(c, 500, "Failed to query: "+err.Error())
+		return
+	}
+	var current *model.Message
+	for i := range versions {
+		if !versions[i].Inactive {
+			current = &versions[i]
 		}
-		h.messageRepo.Create(characterMessage)
 	}
+	if current == nil {
+		response.Error(c, 409, "Message is not in the current conversation")
+		return
+	}
+
+	if err := h.messageRepo.SelectVersion(current, target); err != nil {
+		response.Error(c, 500, "Failed to switch version: "+err.Error())
+		return
+	}
+	target.Inactive = false
+	response.Success(c, target)
+}
 
-	c.Writer.WriteString("data: [DONE]\n\n")
-	c.Writer.Flush()
+// streamReply 以 SSE 流式生成回复，客户端断开时停止生成（已生成的部分回复会保存并标记为 interrupted）
+// 事件依次为 message_start → delta… → message_end；失败时发送 error 事件并结束
+func (h *ChatHandler) streamReply(c *gin.Context, req service.ReplyRequest) {
+	ctx := c.Request.Context()
+	generation := h.replyService.Start(ctx, req)
+
+	sse, stop := startSSE(c)
+	defer stop()
+	sse.Send(sseEventMessageStart, gin.H{
+		"stream_id":       generation.ID,
+		"user_message_id": generation.UserMessageID,
+	})
+
+	offset := 0
+	for {
+		text, next, result, err := generation.Next(ctx, offset)
+		if err != nil {
+			// 客户端已断开
+			return
+		}
+		if text != "" {
+			sse.Send(sseEventDelta, gin.H{"text": text, "offset": next})
+			offset = next
+		}
+		if result != nil {
+			if result.ErrCode != "" {
+				sse.Send(sseEventError, result)
+			} else {
+				sse.Send(sseEventMessageEnd, result)
+			}
+			return
+		}
+	}
+}
+
+// loadMessage 加载路径中属于该角色的消息
+func (h *ChatHandler) loadMessage(c *gin.Context, characterID uint64) (*model.Message, bool) {
+	messageID, err := strconv.ParseUint(c.Param("msgId"), 10, 64)
+	if err != nil {
+		response.Error(c, 400, "Invalid message ID")
+		return nil, false
+	}
+
+	message, err := h.messageRepo.GetByID(characterID, messageID)
+	if err != nil {
+		response.Error(c, 404, "Message not found")
+		return nil, false
+	}
+	return message, true
 }
 
 // GetMessages 获取聊天历史
 func (h *ChatHandler) GetMessages(c *gin.Context) {
+	character, ok := loadOwnedCharacter(c, h.characterRepo)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+	limit = min(limit, maxMessagePageSize)
+
+	// before_id 向前翻页（加载更早的消息），after_id 向后翻页（加载新消息），都不传时返回最新的消息
+	var beforeID, afterID uint64
+	if v := c.Query("before_id"); v != "" {
+		if beforeID, err = strconv.ParseUint(v, 10, 64); err != nil {
+			response.Error(c, 400, "Invalid before_id")
+			return
+		}
+	}
+	if v := c.Query("after_id"); v != "" {
+		if afterID, err = strconv.ParseUint(v, 10, 64); err != nil {
+			response.Error(c, 400, "Invalid after_id")
+			return
+		}
+	}
+	if beforeID > 0 && afterID > 0 {
+		response.Error(c, 400, "before_id and after_id cannot be used together")
+		return
+	}
+
+	messages, hasMore, err := h.messageRepo.ListPage(character.ID, beforeID, afterID, limit)
+	if err != nil {
+		response.Error(c, 500, "Failed to query: "+err.Error())
+		return
+	}
+
+	// 消息按时间正序返回，has_more 表示沿翻页方向是否还有更多消息
+	response.Success(c, gin.H{
+		"messages": messages,
+		"has_more": hasMore,
+	})
+}
+
+// loadOwnedCharacter 加载路径中的角色并校验属于当前用户，失败时已写入错误响应
+func loadOwnedCharacter(c *gin.Context, characterRepo *repository.CharacterRepository) (*model.Character, bool) {
 	user, exists := middleware.GetUserFromContext(c)
 	if !exists {
 		response.Error(c, 401, "Unauthorized")
-		return
+		return nil, false
 	}
 
-	idStr := c.Param("id")
-	characterID, err := strconv.ParseUint(idStr, 10, 64)
+	characterID, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
 		response.Error(c, 400, "Invalid character ID")
-		return
+		return nil, false
 	}
 
 	// 获取角色
-	character, err := h.characterRepo.GetByID(characterID)
+	character, err := characterRepo.GetByID(characterID)
 	if err != nil {
 		response.Error(c, 404, "Character not found")
-		return
+		return nil, false
 	}
 
 	// 验证角色属于当前用户
 	if character.UserID != user.ID {
 		response.Error(c, 403, "Access denied")
-		return
+		return nil, false
+	}
+	return character, true
+}
+
+// reserveQuota 占用用户的一条每日回复额度，超出时返回 QUOTA_EXCEEDED（data 含用量和重置时间）
+func (h *ChatHandler) reserveQuota(c *gin.Context, userID uint64) (*service.QuotaReservation, bool) {
+	quota, err := h.replyService.ReserveQuota(userID)
+	if err == nil {
+		return quota, true
 	}
+	var quotaErr *service.QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		response.ErrorWithCodeData(c, 429, service.ErrorCodeQuotaExceeded, "Daily chat quota exceeded", quotaErr.Status)
+		return nil, false
+	}
+	response.Error(c, 500, "Failed to check quota: "+err.Error())
+	return nil, false
+}
 
-	limitStr := c.DefaultQuery("limit", "50")
-	limit, _ := strconv.Atoi(limitStr)
+// saveUserTurn 保存用户消息，并获取这条消息之前的历史消息（最近 20 条，时间正序），更早的内容通过长期记忆提供
+func saveUserTurn(messageRepo *repository.MessageRepository, character *model.Character, text string) (*model.Message, []model.Message, error) {
+	userMessage := &model.Message{
+		UserID:      character.UserID,
+		CharacterID: character.ID,
+		SenderType:  model.SenderTypeUser,
+		Content:     text,
+	}
+	if err := messageRepo.Create(userMessage); err != nil {
+		return nil, nil, err
+	}
 
-	messages, err := h.messageRepo.GetRecentByCharacterID(characterID, limit)
+	history, _, err := messageRepo.ListPage(character.ID, userMessage.ID, 0, service.ChatHistoryWindow)
 	if err != nil {
-		response.Error(c, 500, "Failed to query: "+err.Error())
-		return
+		log.Printf("获取历史消息失败: %v", err)
 	}
-
-	response.Success(c, messages)
+	return userMessage, history, nil
 }
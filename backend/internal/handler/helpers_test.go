@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"lauraai-backend/internal/config"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/repository/repotest"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// fakeBotAPI 模拟 Telegram Bot API，记录收到的调用
+type fakeBotAPI struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	calls map[string][]map[string]any
+}
+
+func newFakeBotAPI(t *testing.T) *fakeBotAPI {
+	t.Helper()
+	api := &fakeBotAPI{calls: make(map[string][]map[string]any)}
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 路径为 /bot<token>/<method>
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 2 || parts[0] != "bot"+config.AppConfig.TelegramBotToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"ok":false,"error_code":401,"description":"Unauthorized"}`)
+			return
+		}
+		method := parts[1]
+
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		api.mu.Lock()
+		api.calls[method] = append(api.calls[method], payload)
+		api.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch method {
+		case "createInvoiceLink":
+			io.WriteString(w, `{"ok":true,"result":"https://t.me/$test-invoice"}`)
+		default:
+			io.WriteString(w, `{"ok":true,"result":true}`)
+		}
+	}))
+	t.Cleanup(api.Close)
+	return api
+}
+
+// Calls 返回某个方法收到的请求
+func (api *fakeBotAPI) Calls(method string) []map[string]any {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	return api.calls[method]
+}
+
+// testWebhookSecret 测试使用的 Webhook secret_token
+const testWebhookSecret = "test-webhook-secret"
+
+// setupHandlerTest 准备测试数据库、模拟 Bot API 和默认配置
+func setupHandlerTest(t *testing.T) *fakeBotAPI {
+	t.Helper()
+	repotest.Open(t)
+	api := newFakeBotAPI(t)
+	config.AppConfig.TelegramAPIBaseURL = api.URL
+	config.AppConfig.TelegramBotToken = "test-token"
+	config.AppConfig.TelegramWebhookSecret = testWebhookSecret
+	return api
+}
+
+// createTestUser 创建用户
+func createTestUser(t *testing.T, telegramID int64, name string) *model.User {
+	t.Helper()
+	user := &model.User{TelegramID: telegramID, Name: name, InviteCode: repository.GenerateInviteCode()}
+	if err := repository.DB.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+// createTestCharacter 创建报告已生成的角色
+func createTestCharacter(t *testing.T, owner *model.User, status model.UnlockStatus) *model.Character {
+	t.Helper()
+	character := &model.Character{
+		UserID:           owner.ID,
+		Type:             model.CharacterTypeSoulmate,
+		Title:            "Soulmate",
+		DescriptionEn:    "ready",
+		FullBlurImageURL: "/uploads/full.png",
+		HalfBlurImageURL: "/uploads/half.png",
+		ClearImageURL:    "/uploads/clear.png",
+		FullBlurImageKey: "full.png",
+		HalfBlurImageKey: "half.png",
+		ClearImageKey:    "clear.png",
+		UnlockStatus:     status,
+		ShareCode:        repository.GenerateInviteCode(),
+	}
+	if err := repository.DB.Create(character).Error; err != nil {
+		t.Fatalf("create character: %v", err)
+	}
+	return character
+}
+
+// reloadCharacter 重新读取角色
+func reloadCharacter(t *testing.T, id uint64) *model.Character {
+	t.Helper()
+	character, err := repository.NewCharacterRepository().GetByID(id)
+	if err != nil {
+		t.Fatalf("reload character: %v", err)
+	}
+	return character
+}
+
+// testContext 创建绑定到 recorder 的 gin.Context
+func testContext(method string, target string, body string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, target, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	return c, w
+}
+
+// testResponse 统一响应结构
+type testResponse struct {
+	Code      int             `json:"code"`
+	Message   string          `json:"message"`
+	ErrorCode string          `json:"error_code"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// decodeResponse 解析统一响应，data 解析到 data（可为 nil）
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder, data any) testResponse {
+	t.Helper()
+	var resp testResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response %q: %v", w.Body.String(), err)
+	}
+	if data != nil && len(resp.Data) > 0 {
+		if err := json.Unmarshal(resp.Data, data); err != nil {
+			t.Fatalf("decode data %s: %v", resp.Data, err)
+		}
+	}
+	return resp
+}
@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"log"
 	"strconv"
 
 	"lauraai-backend/internal/middleware"
@@ -14,21 +13,20 @@ import (
 
 type ImageHandler struct {
 	characterRepo *repository.CharacterRepository
-	userRepo      *repository.UserRepository
-	imagenService *service.GeminiImagenService
-	reportService *service.GeminiReportService
+	jobRepo       *repository.GenerationJobRepository
+	jobRunner     *service.GenerationJobRunner
 }
 
-func NewImageHandler(imagenService *service.GeminiImagenService, reportService *service.GeminiReportService) *ImageHandler {
+func NewImageHandler(jobRunner *service.GenerationJobRunner) *ImageHandler {
 	return &ImageHandler{
 		characterRepo: repository.NewCharacterRepository(),
-		userRepo:      repository.NewUserRepository(),
-		imagenService: imagenService,
-		reportService: reportService,
+		jobRepo:       repository.NewGenerationJobRepository(),
+		jobRunner:     jobRunner,
 	}
 }
 
-// GenerateImage 生成角色图片
+// GenerateImage 创建角色图片生成任务，立即返回任务 ID
+// 图片和报告在后台生成，通过 GET /api/jobs/:id 或 /api/jobs/:id/events 获取进度
 func (h *ImageHandler) GenerateImage(c *gin.Context) {
 	user, exists := middleware.GetUserFromContext(c)
 	if !exists {
@@ -56,6 +54,12 @@ func (h *ImageHandler) GenerateImage(c *gin.Context) {
 		return
 	}
 
+	// 已有进行中的任务时直接返回该任务，避免重复生成
+	if job, err := h.jobRepo.GetActiveByCharacterID(character.ID); err == nil {
+		response.Success(c, jobResponse(job))
+		return
+	}
+
 	// 检查角色是否已经生成过图片
 	// 只要有任何一张图片 URL 存在，就认为已经生成过，不允许重复生成
 	if character.ClearImageURL != "" || character.FullBlurImageURL != "" || character.HalfBlurImageURL != "" {
@@ -63,65 +67,11 @@ func (h *ImageHandler) GenerateImage(c *gin.Context) {
 		return
 	}
 
-	// 生成图片（会同时生成3张：清晰、半模糊、完全模糊）
-	ctx := c.Request.Context()
-	_, err = h.imagenService.GenerateImage(ctx, character)
-	if err != nil {
-		response.Error(c, 500, "Failed to generate image: "+err.Error())
-		return
-	}
-
-	// 获取完整的用户信息用于生成报告
-	fullUser, err := h.userRepo.GetByID(user.ID)
+	job, err := h.jobRunner.Enqueue(user.ID, character.ID)
 	if err != nil {
-		log.Printf("[Image] 获取用户信息失败: %v", err)
-		fullUser = user // 使用 context 中的用户信息作为后备
-	}
-
-	// 生成 AI 多语言报告（一次生成三种语言，确保内容一致）
-	// 注意：这里仍然尝试生成，如果失败（如429），则留空，由 UnlockHandler 补生成
-	report, err := h.reportService.GenerateMultiLangReport(ctx, fullUser, character)
-	if err != nil {
-		log.Printf("[Image] 生成报告失败: %v (将在解锁时重试)", err)
-		// 报告生成失败不影响图片生成，继续执行
-	} else {
-		// 存储三种语言的 7 项报告内容
-		character.DescriptionEn = report.DescriptionEn
-		character.DescriptionZh = report.DescriptionZh
-		character.DescriptionRu = report.DescriptionRu
-		character.CareerEn = report.CareerEn
-		character.CareerZh = report.CareerZh
-		character.CareerRu = report.CareerRu
-		character.PersonalityEn = report.PersonalityEn
-		character.PersonalityZh = report.PersonalityZh
-		character.PersonalityRu = report.PersonalityRu
-		character.MeetingTimeEn = report.MeetingTimeEn
-		character.MeetingTimeZh = report.MeetingTimeZh
-		character.MeetingTimeRu = report.MeetingTimeRu
-		character.DistanceEn = report.DistanceEn
-		character.DistanceZh = report.DistanceZh
-		character.DistanceRu = report.DistanceRu
-		character.StrengthEn = report.StrengthEn
-		character.StrengthZh = report.StrengthZh
-		character.StrengthRu = report.StrengthRu
-		character.WeaknessEn = report.WeaknessEn
-		character.WeaknessZh = report.WeaknessZh
-		character.WeaknessRu = report.WeaknessRu
-	}
-
-	// 设置 ImageURL 为当前应显示的图片（根据解锁状态）
-	character.ImageURL = character.GetDisplayImageURL()
-
-	// 更新角色的所有图片字段
-	if err := h.characterRepo.Update(character); err != nil {
-		response.Error(c, 500, "Failed to update character: "+err.Error())
+		response.Error(c, 500, "Failed to create generation job: "+err.Error())
 		return
 	}
 
-	// 使用安全响应，根据用户语言返回对应的报告
-	locale := middleware.GetLocaleFromContext(c)
-	safeResponse := character.ToSafeResponse(string(locale))
-	
-	// 只返回安全响应，不单独暴露图片URL字段
-	response.Success(c, safeResponse)
+	response.Success(c, jobResponse(job))
 }
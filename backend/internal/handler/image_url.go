@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"strings"
+	"time"
+
+	"lauraai-backend/internal/config"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/storage"
+	"lauraai-backend/pkg/signedurl"
+)
+
+// imageVariant 角色图片的版本
+type imageVariant string
+
+const (
+	imageVariantFullBlur imageVariant = "full_blur"
+	imageVariantHalfBlur imageVariant = "half_blur"
+	imageVariantClear    imageVariant = "clear"
+)
+
+// imageVariantOf 返回图片 key 对应的版本，不属于该角色时返回空字符串
+// 旧数据中多个字段可能指向同一张图，此时按限制最严的版本处理，避免清晰图被公开访问
+func imageVariantOf(character *model.Character, key string) imageVariant {
+	switch key {
+	case character.ClearImageKey:
+		return imageVariantClear
+	case character.HalfBlurImageKey:
+		return imageVariantHalfBlur
+	case character.FullBlurImageKey:
+		return imageVariantFullBlur
+	}
+	return ""
+}
+
+// signImageURL 规范化图片 URL，并为 uploads 下的图片追加 HMAC 签名和过期时间
+// 清晰图和半模糊图只能通过签名 URL 访问，占位图和 base64 图片原样返回
+func signImageURL(url string) string {
+	normalized := model.NormalizeImageURL(url)
+	if !strings.HasPrefix(normalized, storage.URLPrefix) {
+		return normalized
+	}
+	return signedurl.Sign(normalized, config.AppConfig.ImageURLSecret, config.AppConfig.ImageURLTTL, time.Now())
+}
+
+// characterResponse 返回角色的安全响应数据，并为当前解锁状态可见的半模糊图和清晰图签名
+func characterResponse(character *model.Character, locale string) map[string]interface{} {
+	result := character.ToSafeResponse(locale)
+	for _, field := range []string{"half_blur_image_url", "clear_image_url"} {
+		if url, ok := result[field].(string); ok {
+			result[field] = signImageURL(url)
+		}
+	}
+	if character.EffectiveUnlockStatus() != model.UnlockStatusLocked {
+		result["image_url"] = signImageURL(result["image_url"].(string))
+	}
+	return result
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"lauraai-backend/internal/middleware"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// jobPollInterval SSE 推送进度时查询任务状态的间隔
+const jobPollInterval = time.Second
+
+type JobHandler struct {
+	jobRepo          *repository.GenerationJobRepository
+	characterRepo    *repository.CharacterRepository
+	subscriptionRepo *repository.SubscriptionRepository
+}
+
+func NewJobHandler() *JobHandler {
+	return &JobHandler{
+		jobRepo:          repository.NewGenerationJobRepository(),
+		characterRepo:    repository.NewCharacterRepository(),
+		subscriptionRepo: repository.NewSubscriptionRepository(),
+	}
+}
+
+// Get 查询生成任务状态，完成后同时返回角色信息
+func (h *JobHandler) Get(c *gin.Context) {
+	job, ok := h.loadJob(c)
+	if !ok {
+		return
+	}
+
+	result := jobResponse(job)
+	if job.Status == model.GenerationJobCompleted {
+		if character, err := h.characterRepo.GetByID(job.CharacterID); err == nil {
+			applySubscription(h.subscriptionRepo, job.UserID, character)
+			locale := middleware.GetLocaleFromContext(c)
+			result["character"] = characterResponse(character, string(locale))
+		}
+	}
+	response.Success(c, result)
+}
+
+// Events 以 SSE 推送任务进度，阶段依次为 image → blur → report_en → report_zh → report_ru
+// 每次阶段或状态变化推送一条 data，任务结束后推送 [DONE] 并关闭连接
+func (h *JobHandler) Events(c *gin.Context) {
+	job, ok := h.loadJob(c)
+	if !ok {
+		return
+	}
+
+	// 设置 SSE 响应头
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 禁用 Nginx 缓存
+
+	ctx := c.Request.Context()
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	var lastStatus model.GenerationJobStatus
+	var lastStage model.GenerationJobStage
+	for {
+		if job.Status != lastStatus || job.Stage != lastStage {
+			data, _ := json.Marshal(jobResponse(job))
+			c.Writer.WriteString("data: " + string(data) + "\n\n")
+			c.Writer.Flush()
+			lastStatus, lastStage = job.Status, job.Stage
+		}
+		if job.IsFinished() {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		latest, err := h.jobRepo.GetByID(job.ID)
+		if err != nil {
+			continue
+		}
+		job = latest
+	}
+
+	c.Writer.WriteString("data: [DONE]\n\n")
+	c.Writer.Flush()
+}
+
+// loadJob 读取路径中的任务并校验归属，失败时已写入响应
+func (h *JobHandler) loadJob(c *gin.Context) (*model.GenerationJob, bool) {
+	user, exists := middleware.GetUserFromContext(c)
+	if !exists {
+		response.Error(c, 401, "Unauthorized")
+		return nil, false
+	}
+
+	jobID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.Error(c, 400, "Invalid job ID")
+		return nil, false
+	}
+
+	job, err := h.jobRepo.GetByID(jobID)
+	if err != nil || job.UserID != user.ID {
+		response.Error(c, 404, "Job not found")
+		return nil, false
+	}
+	return job, true
+}
+
+// jobResponse 任务的公开信息
+func jobResponse(job *model.GenerationJob) gin.H {
+	result := gin.H{
+		"job_id":       job.ID,
+		"character_id": job.CharacterID,
+		"status":       job.Status,
+		"stage":        job.Stage,
+		"progress":     job.Progress(),
+		"created_at":   job.CreatedAt,
+	}
+	if job.Error != "" {
+		result["error"] = job.Error
+	}
+	return result
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"lauraai-backend/internal/middleware"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// jobStatus 轮询接口返回的任务状态
+type jobStatus struct {
+	JobID     uint64                    `json:"job_id"`
+	Status    model.GenerationJobStatus `json:"status"`
+	Stage     model.GenerationJobStage  `json:"stage"`
+	Progress  int                       `json:"progress"`
+	Error     string                    `json:"error"`
+	Character *struct {
+		ID uint64 `json:"id"`
+	} `json:"character"`
+}
+
+// getJob 以 user 的身份查询任务状态
+func getJob(t *testing.T, user *model.User, jobID uint64) (testResponse, jobStatus) {
+	t.Helper()
+	c, w := testContext(http.MethodGet, "/", "")
+	c.Set(middleware.UserContextKey, user)
+	c.Params = gin.Params{{Key: "id", Value: strconv.FormatUint(jobID, 10)}}
+	NewJobHandler().Get(c)
+	var data jobStatus
+	resp := decodeResponse(t, w, &data)
+	return resp, data
+}
+
+func TestJobStatusPolling(t *testing.T) {
+	setupHandlerTest(t)
+	jobs := repository.NewGenerationJobRepository()
+	owner := createTestUser(t, 5001, "Owner")
+	character := createTestCharacter(t, owner, model.UnlockStatusLocked)
+	job := &model.GenerationJob{UserID: owner.ID, CharacterID: character.ID, Status: model.GenerationJobPending, Stage: model.GenerationStageQueued}
+	if err := jobs.Create(job); err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+
+	steps := []struct {
+		name         string
+		update       func() error
+		wantStatus   model.GenerationJobStatus
+		wantStage    model.GenerationJobStage
+		wantProgress int
+	}{
+		{"queued", func() error { return nil }, model.GenerationJobPending, model.GenerationStageQueued, 0},
+		{"running", func() error { return jobs.MarkRunning(job.ID) }, model.GenerationJobRunning, model.GenerationStageQueued, 0},
+		{"blur", func() error { return jobs.UpdateStage(job.ID, model.GenerationStageBlur) }, model.GenerationJobRunning, model.GenerationStageBlur, 33},
+		{"report", func() error { return jobs.UpdateStage(job.ID, model.GenerationStageReportZh) }, model.GenerationJobRunning, model.GenerationStageReportZh, 66},
+		{"completed", func() error { return jobs.MarkCompleted(job.ID) }, model.GenerationJobCompleted, model.GenerationStageDone, 100},
+	}
+	for _, step := range steps {
+		if err := step.update(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		resp, data := getJob(t, owner, job.ID)
+		if resp.Code != 0 || data.JobID != job.ID || data.Status != step.wantStatus || data.Stage != step.wantStage || data.Progress != step.wantProgress {
+			t.Errorf("%s: response %+v, job %+v", step.name, resp, data)
+		}
+		// 完成后才返回角色
+		if finished := step.wantStatus == model.GenerationJobCompleted; (data.Character != nil) != finished {
+			t.Errorf("%s: character = %+v", step.name, data.Character)
+		}
+	}
+	if _, data := getJob(t, owner, job.ID); data.Character == nil || data.Character.ID != character.ID {
+		t.Errorf("completed job character = %+v", data.Character)
+	}
+}
+
+func TestJobStatusFailed(t *testing.T) {
+	setupHandlerTest(t)
+	jobs := repository.NewGenerationJobRepository()
+	owner := createTestUser(t, 5001, "Owner")
+	character := createTestCharacter(t, owner, model.UnlockStatusLocked)
+	job := &model.GenerationJob{UserID: owner.ID, CharacterID: character.ID, Status: model.GenerationJobPending, Stage: model.GenerationStageQueued}
+	jobs.Create(job)
+	jobs.MarkRunning(job.ID)
+	jobs.UpdateStage(job.ID, model.GenerationStageImage)
+	jobs.MarkFailed(job.ID, "image model unavailable")
+
+	_, data := getJob(t, owner, job.ID)
+	if data.Status != model.GenerationJobFailed || data.Error != "image model unavailable" || data.Character != nil {
+		t.Errorf("failed job = %+v", data)
+	}
+
+	// 其他用户看不到任务
+	other := createTestUser(t, 5002, "Other")
+	if resp, _ := getJob(t, other, job.ID); resp.Code != 404 {
+		t.Errorf("other user: %+v, want 404", resp)
+	}
+	if resp, _ := getJob(t, owner, job.ID+1); resp.Code != 404 {
+		t.Errorf("missing job: %+v, want 404", resp)
+	}
+}
+
+func TestJobEventsFinished(t *testing.T) {
+	setupHandlerTest(t)
+	jobs := repository.NewGenerationJobRepository()
+	owner := createTestUser(t, 5001, "Owner")
+	character := createTestCharacter(t, owner, model.UnlockStatusLocked)
+	job := &model.GenerationJob{UserID: owner.ID, CharacterID: character.ID, Status: model.GenerationJobPending, Stage: model.GenerationStageQueued}
+	jobs.Create(job)
+	jobs.MarkCompleted(job.ID)
+
+	// 已结束的任务推送一次最终状态后结束
+	c, w := testContext(http.MethodGet, "/", "")
+	c.Set(middleware.UserContextKey, owner)
+	c.Params = gin.Params{{Key: "id", Value: strconv.FormatUint(job.ID, 10)}}
+	NewJobHandler().Events(c)
+
+	events := strings.Split(strings.TrimSuffix(w.Body.String(), "\n\n"), "\n\n")
+	if len(events) != 2 || !strings.Contains(events[0], `"status":"completed"`) || events[1] != "data: [DONE]" {
+		t.Errorf("events = %q", events)
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q", got)
+	}
+}
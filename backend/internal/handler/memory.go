@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"strconv"
+
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MemoryHandler 查看和删除角色记住的内容（用户事实和早期聊天摘要）
+type MemoryHandler struct {
+	characterRepo *repository.CharacterRepository
+	memoryRepo    *repository.MemoryRepository
+}
+
+func NewMemoryHandler() *MemoryHandler {
+	return &MemoryHandler{
+		characterRepo: repository.NewCharacterRepository(),
+		memoryRepo:    repository.NewMemoryRepository(),
+	}
+}
+
+// Get 获取角色记住的事实和聊天摘要
+func (h *MemoryHandler) Get(c *gin.Context) {
+	character, ok := loadOwnedCharacter(c, h.characterRepo)
+	if !ok {
+		return
+	}
+
+	summary, err := h.memoryRepo.GetSummary(character.UserID, character.ID)
+	if err != nil {
+		response.Error(c, 500, "Failed to query: "+err.Error())
+		return
+	}
+	facts, err := h.memoryRepo.ListFacts(character.ID)
+	if err != nil {
+		response.Error(c, 500, "Failed to query: "+err.Error())
+		return
+	}
+
+	result := gin.H{
+		"summary": summary.Summary,
+		"facts":   facts,
+	}
+	if summary.ID != 0 {
+		result["summary_updated_at"] = summary.UpdatedAt
+	}
+	response.Success(c, result)
+}
+
+// DeleteFact 删除一条记住的事实
+func (h *MemoryHandler) DeleteFact(c *gin.Context) {
+	character, ok := loadOwnedCharacter(c, h.characterRepo)
+	if !ok {
+		return
+	}
+
+	factID, err := strconv.ParseUint(c.Param("factId"), 10, 64)
+	if err != nil {
+		response.Error(c, 400, "Invalid fact ID")
+		return
+	}
+
+	found, err := h.memoryRepo.DeleteFact(character.ID, factID)
+	if err != nil {
+		response.Error(c, 500, "Failed to delete fact: "+err.Error())
+		return
+	}
+	if !found {
+		response.Error(c, 404, "Fact not found")
+		return
+	}
+	response.Success(c, gin.H{"deleted": true})
+}
+
+// Forget 删除角色的全部记忆（所有事实和聊天摘要），聊天记录本身保留
+func (h *MemoryHandler) Forget(c *gin.Context) {
+	character, ok := loadOwnedCharacter(c, h.characterRepo)
+	if !ok {
+		return
+	}
+
+	if err := h.memoryRepo.Forget(character.ID); err != nil {
+		response.Error(c, 500, "Failed to clear memory: "+err.Error())
+		return
+	}
+	response.Success(c, gin.H{"deleted": true})
+}
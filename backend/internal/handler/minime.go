@@ -14,16 +14,20 @@ import (
 )
 
 type MiniMeHandler struct {
-	characterRepo *repository.CharacterRepository
-	visionService *service.GeminiVisionService
-	imagenService *service.GeminiImagenService
+	characterRepo    *repository.CharacterRepository
+	subscriptionRepo *repository.SubscriptionRepository
+	visionService    *service.VisionService
+	imagenService    *service.ImagenService
+	generationGate   *service.GenerationGate
 }
 
-func NewMiniMeHandler(visionService *service.GeminiVisionService, imagenService *service.GeminiImagenService) *MiniMeHandler {
+func NewMiniMeHandler(visionService *service.VisionService, imagenService *service.ImagenService, generationGate *service.GenerationGate) *MiniMeHandler {
 	return &MiniMeHandler{
-		characterRepo: repository.NewCharacterRepository(),
-		visionService: visionService,
-		imagenService: imagenService,
+		characterRepo:    repository.NewCharacterRepository(),
+		subscriptionRepo: repository.NewSubscriptionRepository(),
+		visionService:    visionService,
+		imagenService:    imagenService,
+		generationGate:   generationGate,
 	}
 }
 
@@ -60,6 +64,15 @@ func (h *MiniMeHandler) UploadAndGenerateMiniMe(c *gin.Context) {
 
 	// 2. 调用 Vision API 分析图片
 	ctx := c.Request.Context()
+
+	// 占用 AI 生成名额，订阅用户优先
+	release, err := acquireGeneration(ctx, h.generationGate, h.subscriptionRepo, user.ID)
+	if err != nil {
+		response.Error(c, 503, "Request canceled while waiting for generation")
+		return
+	}
+	defer release()
+
 	description, err := h.visionService.AnalyzeImage(ctx, fileBytes, mimeType)
 	if err != nil {
 		response.Error(c, 500, "Failed to analyze image: "+err.Error())
@@ -98,9 +111,11 @@ func (h *MiniMeHandler) UploadAndGenerateMiniMe(c *gin.Context) {
 		return
 	}
 
+	applySubscription(h.subscriptionRepo, user.ID, character)
 	locale := middleware.GetLocaleFromContext(c)
+	safeResponse := characterResponse(character, string(locale))
 	response.Success(c, gin.H{
-		"character": character.ToSafeResponse(string(locale)),
-		"image_url": character.GetDisplayImageURL(),
+		"character": safeResponse,
+		"image_url": safeResponse["image_url"],
 	})
 }
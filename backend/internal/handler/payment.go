@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"lauraai-backend/internal/middleware"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/service"
+	"lauraai-backend/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PaymentHandler struct {
+	paymentRepo  *repository.PaymentRepository
+	userRepo     *repository.UserRepository
+	botClient    *service.TelegramBotClient
+	stateMachine *service.UnlockStateMachine
+}
+
+func NewPaymentHandler() *PaymentHandler {
+	return &PaymentHandler{
+		paymentRepo:  repository.NewPaymentRepository(),
+		userRepo:     repository.NewUserRepository(),
+		botClient:    service.NewTelegramBotClient(),
+		stateMachine: service.NewUnlockStateMachine(),
+	}
+}
+
+// List 获取当前用户的支付记录
+// TON 支付的 amount 单位为 nanoTON
+func (h *PaymentHandler) List(c *gin.Context) {
+	user, exists := middleware.GetUserFromContext(c)
+	if !exists {
+		response.Error(c, 401, "Unauthorized")
+		return
+	}
+
+	payments, err := h.paymentRepo.GetByUserID(user.ID)
+	if err != nil {
+		response.Error(c, 500, "Failed to query payments: "+err.Error())
+		return
+	}
+
+	if payments == nil {
+		payments = []model.Payment{}
+	}
+
+	response.Success(c, gin.H{
+		"payments": payments,
+		"count":    len(payments),
+	})
+}
+
+// Refund 管理接口：退还一笔 Stars 支付，并将角色恢复到支付前的解锁状态
+func (h *PaymentHandler) Refund(c *gin.Context) {
+	idStr := c.Param("id")
+	paymentID, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		response.Error(c, 400, "Invalid payment ID")
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	_ = c.ShouldBindJSON(&req)
+
+	payment, err := h.paymentRepo.GetByID(paymentID)
+	if err != nil {
+		response.Error(c, 404, "Payment not found")
+		return
+	}
+	if payment.Method != model.PaymentMethodStars {
+		response.Error(c, 400, "Only Stars payments can be refunded")
+		return
+	}
+
+	user, err := h.userRepo.GetByID(payment.UserID)
+	if err != nil {
+		response.Error(c, 404, "User not found")
+		return
+	}
+
+	ctx := c.Request.Context()
+	refunded, character, err := h.stateMachine.Refund(paymentID, req.Reason, model.UnlockActorAdmin, func(p *model.Payment) error {
+		if p.ExternalTxID == nil {
+			return fmt.Errorf("payment %d has no charge id", p.ID)
+		}
+		return h.botClient.RefundStarPayment(ctx, user.TelegramID, *p.ExternalTxID)
+	})
+	if errors.Is(err, repository.ErrPaymentNotRefundable) {
+		response.ErrorWithCode(c, 400, "NOT_REFUNDABLE", err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("[Refund] 退款失败 payment=%d: %v", paymentID, err)
+		response.Error(c, 500, "Failed to refund: "+err.Error())
+		return
+	}
+
+	log.Printf("[Refund] 支付 %d 已退款，角色 %d 恢复为状态 %d", refunded.ID, character.ID, character.UnlockStatus)
+	response.Success(c, gin.H{
+		"payment":       refunded,
+		"character_id":  character.ID,
+		"unlock_status": character.UnlockStatus,
+	})
+}
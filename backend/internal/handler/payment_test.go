@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// refund 调用管理接口退还支付
+func refund(t *testing.T, paymentID uint64) testResponse {
+	t.Helper()
+	c, w := testContext(http.MethodPost, "/", `{"reason":"requested by user"}`)
+	c.Params = gin.Params{{Key: "id", Value: strconv.FormatUint(paymentID, 10)}}
+	NewPaymentHandler().Refund(c)
+	return decodeResponse(t, w, nil)
+}
+
+func TestRefundRelocks(t *testing.T) {
+	for _, from := range []model.UnlockStatus{model.UnlockStatusLocked, model.UnlockStatusHalfUnlocked} {
+		t.Run(strconv.Itoa(int(from)), func(t *testing.T) {
+			env := newStarsTestEnv(t)
+			repository.DB.Model(env.character).Update("unlock_status", from)
+			env.character.UnlockStatus = from
+			env.payment = env.createInvoice(t)
+			if w := env.postWebhook(t, env.successfulPaymentUpdate("charge-1"), testWebhookSecret); w.Code != http.StatusOK {
+				t.Fatalf("webhook status %d: %s", w.Code, w.Body.String())
+			}
+
+			if resp := refund(t, env.payment.ID); resp.Code != 0 {
+				t.Fatalf("refund failed: %+v", resp)
+			}
+			// 恢复到支付前的状态
+			if got := reloadCharacter(t, env.character.ID).UnlockStatus; got != from {
+				t.Errorf("unlock status = %d, want %d", got, from)
+			}
+			payment, _ := env.webhook.paymentRepo.GetByID(env.payment.ID)
+			if payment.Status != model.PaymentStatusRefunded || payment.RefundedAt == nil || payment.RefundReason != "requested by user" {
+				t.Errorf("payment = %+v", payment)
+			}
+			calls := env.api.Calls("refundStarPayment")
+			if len(calls) != 1 || calls[0]["telegram_payment_charge_id"] != "charge-1" || calls[0]["user_id"] != float64(env.user.TelegramID) {
+				t.Errorf("refundStarPayment calls = %v", calls)
+			}
+		})
+	}
+}
+
+func TestRefundTwice(t *testing.T) {
+	env := newStarsTestEnv(t)
+	if w := env.postWebhook(t, env.successfulPaymentUpdate("charge-1"), testWebhookSecret); w.Code != http.StatusOK {
+		t.Fatalf("webhook status %d: %s", w.Code, w.Body.String())
+	}
+	if resp := refund(t, env.payment.ID); resp.Code != 0 {
+		t.Fatalf("refund failed: %+v", resp)
+	}
+
+	// 第二次退款被拒绝，不再调用 Telegram
+	if resp := refund(t, env.payment.ID); resp.Code != 400 || resp.ErrorCode != "NOT_REFUNDABLE" {
+		t.Errorf("second refund = %+v, want NOT_REFUNDABLE", resp)
+	}
+	if calls := env.api.Calls("refundStarPayment"); len(calls) != 1 {
+		t.Errorf("refundStarPayment called %d times, want 1", len(calls))
+	}
+}
+
+func TestRefundPendingPayment(t *testing.T) {
+	env := newStarsTestEnv(t)
+
+	if resp := refund(t, env.payment.ID); resp.Code != 400 || resp.ErrorCode != "NOT_REFUNDABLE" {
+		t.Errorf("refund of pending payment = %+v, want NOT_REFUNDABLE", resp)
+	}
+	if calls := env.api.Calls("refundStarPayment"); len(calls) != 0 {
+		t.Errorf("refundStarPayment calls = %v", calls)
+	}
+}
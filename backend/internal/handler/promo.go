@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"errors"
+	"time"
+
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/service"
+	"lauraai-backend/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type PromoHandler struct {
+	promoRepo *repository.PromoRepository
+}
+
+func NewPromoHandler() *PromoHandler {
+	return &PromoHandler{
+		promoRepo: repository.NewPromoRepository(),
+	}
+}
+
+// Create 管理接口：创建优惠码
+func (h *PromoHandler) Create(c *gin.Context) {
+	var req struct {
+		Code           string                  `json:"code" binding:"required"`
+		DiscountType   model.PromoDiscountType `json:"discount_type" binding:"required"` // "percent" or "fixed"
+		PercentOff     int                     `json:"percent_off"`
+		FixedOffStars  int64                   `json:"fixed_off_stars"`
+		FixedOffTON    float64                 `json:"fixed_off_ton"` // 单位 TON
+		MaxRedemptions int                     `json:"max_redemptions"`
+		PerUserLimit   *int                    `json:"per_user_limit"` // 默认 1
+		ExpiresAt      *time.Time              `json:"expires_at"`
+		CharacterTypes []model.CharacterType   `json:"character_types"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, 400, "Invalid request parameters")
+		return
+	}
+
+	switch req.DiscountType {
+	case model.PromoDiscountPercent:
+		if req.PercentOff <= 0 || req.PercentOff > 100 {
+			response.Error(c, 400, "percent_off must be between 1 and 100")
+			return
+		}
+	case model.PromoDiscountFixed:
+		if req.FixedOffStars <= 0 && req.FixedOffTON <= 0 {
+			response.Error(c, 400, "fixed discount requires fixed_off_stars or fixed_off_ton")
+			return
+		}
+	default:
+		response.Error(c, 400, "Unsupported discount type")
+		return
+	}
+	if req.MaxRedemptions < 0 || (req.PerUserLimit != nil && *req.PerUserLimit < 0) {
+		response.Error(c, 400, "Limits must not be negative")
+		return
+	}
+
+	promo := &model.PromoCode{
+		Code:           req.Code,
+		DiscountType:   req.DiscountType,
+		PercentOff:     req.PercentOff,
+		FixedOffStars:  req.FixedOffStars,
+		FixedOffTON:    int64(req.FixedOffTON * float64(service.NanoTonPerTon)),
+		MaxRedemptions: req.MaxRedemptions,
+		PerUserLimit:   1,
+		ExpiresAt:      req.ExpiresAt,
+		CharacterTypes: req.CharacterTypes,
+		Active:         true,
+	}
+	if req.PerUserLimit != nil {
+		promo.PerUserLimit = *req.PerUserLimit
+	}
+
+	if err := h.promoRepo.Create(promo); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			response.ErrorWithCode(c, 400, "PROMO_EXISTS", "Promo code already exists")
+			return
+		}
+		response.Error(c, 500, "Failed to create promo code: "+err.Error())
+		return
+	}
+
+	response.Success(c, promo)
+}
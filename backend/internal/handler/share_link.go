@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"lauraai-backend/internal/middleware"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxShareLinkHours 分享链接有效期上限（30 天）
+const maxShareLinkHours = 30 * 24
+
+// RegenerateShareCodeRequest 重新生成分享码请求，字段均为可选，不传表示不限期、不限次数
+type RegenerateShareCodeRequest struct {
+	ExpiresInHours int `json:"expires_in_hours"`
+	MaxUses        int `json:"max_uses"`
+}
+
+// RegenerateShareCode 撤销角色当前的分享码并生成新的分享码（仅角色所有者）
+func (h *UnlockHandler) RegenerateShareCode(c *gin.Context) {
+	user, exists := middleware.GetUserFromContext(c)
+	if !exists {
+		response.Error(c, 401, "Unauthorized")
+		return
+	}
+
+	characterID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.Error(c, 400, "Invalid character ID")
+		return
+	}
+
+	var req RegenerateShareCodeRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Error(c, 400, "Invalid request: "+err.Error())
+			return
+		}
+	}
+	if req.ExpiresInHours < 0 || req.ExpiresInHours > maxShareLinkHours {
+		response.Error(c, 400, "expires_in_hours must be between 0 and 720")
+		return
+	}
+	if req.MaxUses < 0 {
+		response.Error(c, 400, "max_uses must not be negative")
+		return
+	}
+
+	character, err := h.characterRepo.GetByID(characterID)
+	if err != nil {
+		response.Error(c, 404, "Character not found")
+		return
+	}
+	if character.UserID != user.ID {
+		response.Error(c, 403, "Access denied")
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInHours > 0 {
+		t := time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+		expiresAt = &t
+	}
+
+	link, err := h.shareLinkRepo.Rotate(character.ID, expiresAt, req.MaxUses)
+	if err != nil {
+		response.Error(c, 500, "Failed to regenerate share code: "+err.Error())
+		return
+	}
+
+	response.Success(c, shareLinkInfo(link))
+}
+
+// resolveShareLink 查找分享码对应的分享链接并检查是否已撤销或过期，失败时已写入响应
+// 使用次数上限只限制助力，次数用完的链接仍然可以查看
+func (h *UnlockHandler) resolveShareLink(c *gin.Context, code string) (*model.ShareLink, bool) {
+	link, err := h.shareLinkRepo.Resolve(code)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response.ErrorWithCode(c, 404, "SHARE_NOT_FOUND", "Share link not found")
+		return nil, false
+	}
+	if err != nil {
+		response.Error(c, 500, "Failed to get share link: "+err.Error())
+		return nil, false
+	}
+	if err := repository.CheckShareLinkActive(link); err != nil {
+		respondShareLinkError(c, err)
+		return nil, false
+	}
+	return link, true
+}
+
+// respondShareLinkError 将分享链接不可用的原因转换为前端可区分的错误码
+func respondShareLinkError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrShareRevoked):
+		response.ErrorWithCode(c, 410, "SHARE_REVOKED", "Share link has been revoked")
+	case errors.Is(err, repository.ErrShareExpired):
+		response.ErrorWithCode(c, 410, "SHARE_EXPIRED", "Share link has expired")
+	case errors.Is(err, repository.ErrShareExhausted):
+		response.ErrorWithCode(c, 410, "SHARE_EXHAUSTED", "Share link has reached its usage limit")
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response.ErrorWithCode(c, 404, "SHARE_NOT_FOUND", "Share link not found")
+	default:
+		response.Error(c, 500, "Failed to use share link: "+err.Error())
+	}
+}
+
+// shareLinkInfo 分享链接的公开信息
+func shareLinkInfo(link *model.ShareLink) gin.H {
+	return gin.H{
+		"share_code": link.Code,
+		"expires_at": link.ExpiresAt,
+		"max_uses":   link.MaxUses,
+		"use_count":  link.UseCount,
+		"exhausted":  link.IsExhausted(), // 次数已用完，不能再助力
+		"created_at": link.CreatedAt,
+	}
+}
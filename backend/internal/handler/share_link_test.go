@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"lauraai-backend/internal/middleware"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newShareTestHandler(t *testing.T) *UnlockHandler {
+	t.Helper()
+	setupHandlerTest(t)
+	pricing, err := service.NewPricingService()
+	if err != nil {
+		t.Fatalf("pricing: %v", err)
+	}
+	return NewUnlockHandler(nil, pricing)
+}
+
+// helpUnlock 以 helper 身份请求助力，body 为请求体
+func helpUnlock(t *testing.T, h *UnlockHandler, helper *model.User, character *model.Character, body string) testResponse {
+	t.Helper()
+	c, w := testContext(http.MethodPost, "/", body)
+	c.Set(middleware.UserContextKey, helper)
+	c.Params = gin.Params{{Key: "id", Value: strconv.FormatUint(character.ID, 10)}}
+	h.HelpUnlock(c)
+	return decodeResponse(t, w, nil)
+}
+
+func getShareInfo(t *testing.T, h *UnlockHandler, code string) (testResponse, map[string]any) {
+	t.Helper()
+	c, w := testContext(http.MethodGet, "/", "")
+	c.Params = gin.Params{{Key: "code", Value: code}}
+	h.GetShareInfo(c)
+	var data map[string]any
+	return decodeResponse(t, w, &data), data
+}
+
+func TestHelpUnlockRequiresShareCode(t *testing.T) {
+	h := newShareTestHandler(t)
+	owner := createTestUser(t, 3001, "Owner")
+	character := createTestCharacter(t, owner, model.UnlockStatusLocked)
+	other := createTestCharacter(t, owner, model.UnlockStatusLocked)
+	helper := createTestUser(t, 3002, "Helper")
+
+	if resp := helpUnlock(t, h, helper, character, ""); resp.ErrorCode != "SHARE_CODE_REQUIRED" {
+		t.Fatalf("without share code: %+v", resp)
+	}
+	// 未通过分享链接的请求不会绑定邀请人
+	if user, _ := repository.NewUserRepository().GetByID(helper.ID); user.InviterID != nil {
+		t.Errorf("inviter bound without a share link: %v", *user.InviterID)
+	}
+
+	// 其他角色的分享码不能用于该角色
+	if resp := helpUnlock(t, h, helper, character, `{"share_code":"`+other.ShareCode+`"}`); resp.ErrorCode != "SHARE_NOT_FOUND" {
+		t.Fatalf("share code of another character: %+v", resp)
+	}
+
+	if resp := helpUnlock(t, h, helper, character, `{"share_code":"`+character.ShareCode+`"}`); resp.Code != 0 {
+		t.Fatalf("help with share code: %+v", resp)
+	}
+	if got := reloadCharacter(t, character.ID).UnlockStatus; got == model.UnlockStatusLocked {
+		t.Errorf("help not applied")
+	}
+}
+
+func TestShareLinkMaxUses(t *testing.T) {
+	h := newShareTestHandler(t)
+	owner := createTestUser(t, 3101, "Owner")
+	character := createTestCharacter(t, owner, model.UnlockStatusLocked)
+	link, err := repository.NewShareLinkRepository().Rotate(character.ID, nil, 1)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	body := `{"share_code":"` + link.Code + `"}`
+
+	if resp := helpUnlock(t, h, createTestUser(t, 3102, "First"), character, body); resp.Code != 0 {
+		t.Fatalf("first help: %+v", resp)
+	}
+	if resp := helpUnlock(t, h, createTestUser(t, 3103, "Second"), character, body); resp.Code != 410 || resp.ErrorCode != "SHARE_EXHAUSTED" {
+		t.Fatalf("help over max uses: %+v", resp)
+	}
+
+	// 次数用完只限制助力，分享页仍然可以查看
+	resp, data := getShareInfo(t, h, link.Code)
+	if resp.Code != 0 {
+		t.Fatalf("share info of exhausted link: %+v", resp)
+	}
+	if shareLink, _ := data["share_link"].(map[string]any); shareLink["exhausted"] != true {
+		t.Errorf("share_link = %v, want exhausted", data["share_link"])
+	}
+
+	// 撤销的链接仍然返回 410
+	if _, err := repository.NewShareLinkRepository().Rotate(character.ID, nil, 0); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if resp, _ := getShareInfo(t, h, link.Code); resp.Code != 410 || resp.ErrorCode != "SHARE_REVOKED" {
+		t.Errorf("share info of revoked link: %+v", resp)
+	}
+}
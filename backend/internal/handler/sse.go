@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"lauraai-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseHeartbeatInterval 没有事件时发送心跳注释的间隔，防止代理因空闲断开连接（测试中可缩短）
+var sseHeartbeatInterval = 15 * time.Second
+
+// 对话流的事件类型
+const (
+	sseEventMessageStart = "message_start" // 开始生成，data 含用户消息 ID
+	sseEventDelta        = "delta"         // 一段回复内容
+	sseEventMessageEnd   = "message_end"   // 回复已保存，data 含回复 ID 和 token 用量
+	sseEventError        = "error"         // 生成失败，data 含错误码（service.ReplyError*），之后连接关闭
+)
+
+// sseStream 写入 SSE 事件，可与心跳并发使用
+type sseStream struct {
+	c  *gin.Context
+	mu sync.Mutex
+}
+
+// startSSE 写入 SSE 响应头并开始发送心跳，ctx 结束或调用 stop 后停止心跳
+func startSSE(c *gin.Context) (stream *sseStream, stop func()) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 禁用 Nginx 缓存
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Status(200)
+
+	stream = &sseStream{c: c}
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(sseHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				stream.write(": ping\n\n")
+			}
+		}
+	}()
+
+	stop = func() {
+		cancel()
+		<-done
+	}
+	return stream, stop
+}
+
+// Send 发送一个事件，data 编码为 JSON
+func (s *sseStream) Send(event string, data any) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		payload, _ = json.Marshal(gin.H{"code": service.ReplyErrorGenerationFailed, "message": err.Error()})
+		event = sseEventError
+	}
+	s.write(fmt.Sprintf("event: %s\ndata: %s\n\n", event, payload))
+}
+
+func (s *sseStream) write(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.c.Writer.WriteString(text)
+	s.c.Writer.Flush()
+}
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"lauraai-backend/internal/llm"
+	"lauraai-backend/internal/middleware"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseEvent 解析后的一个 SSE 事件，心跳注释的 Event 为空
+type sseEvent struct {
+	Event   string
+	Data    map[string]any
+	Comment string
+}
+
+// parseSSE 按空行拆分事件，每个事件的 data 必须是一行合法的 JSON
+func parseSSE(t *testing.T, body string) []sseEvent {
+	t.Helper()
+	if !strings.HasSuffix(body, "\n\n") {
+		t.Fatalf("body does not end with a blank line: %q", body)
+	}
+	var events []sseEvent
+	for _, frame := range strings.Split(strings.TrimSuffix(body, "\n\n"), "\n\n") {
+		var event sseEvent
+		for _, line := range strings.Split(frame, "\n") {
+			switch {
+			case strings.HasPrefix(line, ": "):
+				event.Comment = strings.TrimPrefix(line, ": ")
+			case strings.HasPrefix(line, "event: "):
+				event.Event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.Data); err != nil {
+					t.Fatalf("data is not JSON: %q: %v", line, err)
+				}
+			default:
+				t.Fatalf("unexpected line %q in frame %q", line, frame)
+			}
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// sendMessage 用 llm.Fake 的回复调用 SendMessage，返回解析后的事件
+func sendMessage(t *testing.T, fakeResponse llm.FakeResponse) (*model.Character, []sseEvent) {
+	t.Helper()
+	setupHandlerTest(t)
+	owner := createTestUser(t, 6001, "Owner")
+	character := createTestCharacter(t, owner, model.UnlockStatusFullUnlocked)
+
+	fake := llm.NewFake()
+	fake.StreamInterval = 0
+	fake.StreamChunkSize = 4
+	fake.Script(llm.FakeMethodChatStream, fakeResponse)
+	h := NewChatHandler(service.NewReplyService(service.NewChatService(fake), nil, service.NewGenerationGate(0), service.NewQuotaService()))
+
+	c, w := testContext(http.MethodPost, "/", `{"message":"hi"}`)
+	c.Set(middleware.UserContextKey, owner)
+	c.Params = gin.Params{{Key: "id", Value: strconv.FormatUint(character.ID, 10)}}
+	h.SendMessage(c)
+
+	if got := w.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, body %s", got, w.Body.String())
+	}
+	return character, parseSSE(t, w.Body.String())
+}
+
+func TestSendMessageEvents(t *testing.T) {
+	// 引号和换行经过 JSON 编码，不会破坏事件格式
+	reply := "Hi \"friend\",\nnice to see you."
+	character, events := sendMessage(t, llm.FakeResponse{Text: reply})
+
+	if len(events) < 3 || events[0].Event != sseEventMessageStart || events[len(events)-1].Event != sseEventMessageEnd {
+		t.Fatalf("events = %+v", events)
+	}
+	start := events[0].Data
+	latest, _ := repository.NewMessageRepository().GetRecentByCharacterID(character.ID, 2)
+	if start["stream_id"] == "" || start["user_message_id"] != float64(latest[0].ID) {
+		t.Errorf("message_start = %v, user message %d", start, latest[0].ID)
+	}
+
+	var text string
+	var offset float64
+	for _, event := range events[1 : len(events)-1] {
+		if event.Event != sseEventDelta {
+			t.Fatalf("unexpected event %+v between start and end", event)
+		}
+		text += event.Data["text"].(string)
+		// offset 为已输出的字符数，用于断线续传
+		if next := event.Data["offset"].(float64); next <= offset {
+			t.Errorf("offset %v after %v", next, offset)
+		} else {
+			offset = next
+		}
+	}
+	if text != reply || int(offset) != len([]rune(reply)) {
+		t.Errorf("deltas = %q (offset %v), want %q", text, offset, reply)
+	}
+
+	end := events[len(events)-1].Data
+	if end["message_id"] != float64(latest[1].ID) || end["usage"] == nil || end["code"] != nil {
+		t.Errorf("message_end = %v, reply %d", end, latest[1].ID)
+	}
+	if latest[1].Content != reply {
+		t.Errorf("saved reply = %q", latest[1].Content)
+	}
+}
+
+func TestSendMessageErrorEvent(t *testing.T) {
+	_, events := sendMessage(t, llm.FakeResponse{Err: errors.New("model rejected the prompt")})
+
+	if len(events) != 2 || events[0].Event != sseEventMessageStart || events[1].Event != sseEventError {
+		t.Fatalf("events = %+v", events)
+	}
+	if events[1].Data["code"] != service.ReplyErrorGenerationFailed || events[1].Data["message_id"] != nil {
+		t.Errorf("error = %v", events[1].Data)
+	}
+}
+
+func TestSSEHeartbeat(t *testing.T) {
+	saved := sseHeartbeatInterval
+	sseHeartbeatInterval = 10 * time.Millisecond
+	t.Cleanup(func() { sseHeartbeatInterval = saved })
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	stream, stop := startSSE(c)
+	stream.Send(sseEventDelta, gin.H{"text": "a"})
+	time.Sleep(50 * time.Millisecond)
+	stop()
+
+	// 停止后不再发送心跳
+	body := w.Body.String()
+	time.Sleep(30 * time.Millisecond)
+	if w.Body.String() != body {
+		t.Errorf("heartbeat written after stop")
+	}
+
+	events := parseSSE(t, body)
+	pings := 0
+	for _, event := range events {
+		if event.Comment == "ping" && event.Event == "" && event.Data == nil {
+			pings++
+		}
+	}
+	if events[0].Event != sseEventDelta || pings == 0 || pings != len(events)-1 {
+		t.Errorf("events = %+v", events)
+	}
+}
+
+func TestSSESendUnencodable(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	stream, stop := startSSE(c)
+	stream.Send(sseEventMessageEnd, gin.H{"bad": func() {}})
+	stop()
+
+	// 无法编码的数据以 error 事件发出
+	events := parseSSE(t, w.Body.String())
+	if len(events) != 1 || events[0].Event != sseEventError || events[0].Data["code"] != service.ReplyErrorGenerationFailed {
+		t.Errorf("events = %+v", events)
+	}
+}
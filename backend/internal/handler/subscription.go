@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"lauraai-backend/internal/middleware"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/service"
+	"lauraai-backend/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// subscriptionPayloadPrefix 订阅发票 payload 前缀，格式 sub:<plan>:<userID>
+// 自动续费时 Telegram 会使用同一个 payload 推送 successful_payment
+const subscriptionPayloadPrefix = "sub"
+
+type SubscriptionHandler struct {
+	subscriptionRepo *repository.SubscriptionRepository
+	userRepo         *repository.UserRepository
+	botClient        *service.TelegramBotClient
+	pricing          *service.PricingService
+}
+
+func NewSubscriptionHandler(pricing *service.PricingService) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		subscriptionRepo: repository.NewSubscriptionRepository(),
+		userRepo:         repository.NewUserRepository(),
+		botClient:        service.NewTelegramBotClient(),
+		pricing:          pricing,
+	}
+}
+
+// Get 获取当前用户的订阅状态和价格
+func (h *SubscriptionHandler) Get(c *gin.Context) {
+	user, exists := middleware.GetUserFromContext(c)
+	if !exists {
+		response.Error(c, 401, "Unauthorized")
+		return
+	}
+
+	price, err := h.pricing.SubscriptionPrice(model.SubscriptionPlanPremium)
+	if err != nil {
+		response.Error(c, 500, "Failed to get price: "+err.Error())
+		return
+	}
+
+	result := gin.H{
+		"active":      false,
+		"plan":        model.SubscriptionPlanPremium,
+		"price_stars": price,
+		"period_days": service.StarSubscriptionPeriod / (24 * 60 * 60),
+	}
+	if subscription, err := h.subscriptionRepo.GetByUserID(user.ID); err == nil {
+		result["active"] = h.subscriptionRepo.IsActive(user.ID)
+		result["subscription"] = subscription
+	}
+	response.Success(c, result)
+}
+
+// Subscribe 创建 Stars 订阅发票链接，订阅在 Webhook 收到 successful_payment 后生效
+func (h *SubscriptionHandler) Subscribe(c *gin.Context) {
+	user, exists := middleware.GetUserFromContext(c)
+	if !exists {
+		response.Error(c, 401, "Unauthorized")
+		return
+	}
+	if !starsPaymentsEnabled() {
+		response.Error(c, 503, "Stars payments are not available")
+		return
+	}
+
+	if subscription, err := h.subscriptionRepo.GetByUserID(user.ID); err == nil &&
+		subscription.Status == model.SubscriptionStatusActive && h.subscriptionRepo.IsActive(user.ID) {
+		response.ErrorWithCode(c, 400, "ALREADY_SUBSCRIBED", "Subscription already active")
+		return
+	}
+
+	plan := model.SubscriptionPlanPremium
+	price, err := h.pricing.SubscriptionPrice(plan)
+	if err != nil {
+		response.Error(c, 500, "Failed to get price: "+err.Error())
+		return
+	}
+
+	link, err := h.botClient.CreateInvoiceLink(c.Request.Context(), service.InvoiceLinkRequest{
+		Title:              "Laura AI Premium",
+		Description:        "Every character fully unlocked and priority AI generation, renewed monthly",
+		Payload:            buildSubscriptionPayload(plan, user.ID),
+		Currency:           service.StarsCurrency,
+		Prices:             []service.LabeledPrice{{Label: "Premium", Amount: int(price)}},
+		SubscriptionPeriod: service.StarSubscriptionPeriod,
+	})
+	if err != nil {
+		log.Printf("[Subscription] 创建订阅发票失败: %v", err)
+		response.Error(c, 502, "Failed to create invoice: "+err.Error())
+		return
+	}
+
+	response.Success(c, gin.H{
+		"status":       "pending",
+		"plan":         plan,
+		"invoice_link": link,
+		"price":        price,
+		"currency":     "stars",
+	})
+}
+
+// Cancel 取消自动续费，当前周期结束前订阅仍然有效
+func (h *SubscriptionHandler) Cancel(c *gin.Context) {
+	user, exists := middleware.GetUserFromContext(c)
+	if !exists {
+		response.Error(c, 401, "Unauthorized")
+		return
+	}
+
+	subscription, err := h.subscriptionRepo.GetByUserID(user.ID)
+	if err != nil || subscription.Status != model.SubscriptionStatusActive {
+		response.Error(c, 404, "No active subscription")
+		return
+	}
+
+	if err := h.botClient.EditUserStarSubscription(c.Request.Context(), user.TelegramID, subscription.LastChargeID, true); err != nil {
+		log.Printf("[Subscription] 取消续费失败: %v", err)
+		response.Error(c, 502, "Failed to cancel subscription: "+err.Error())
+		return
+	}
+
+	if err := h.subscriptionRepo.SetStatus(user.ID, model.SubscriptionStatusCanceled); err != nil {
+		response.Error(c, 500, "Failed to cancel subscription: "+err.Error())
+		return
+	}
+
+	response.Success(c, gin.H{
+		"message":    "Subscription canceled",
+		"expires_at": subscription.ExpiresAt,
+	})
+}
+
+// buildSubscriptionPayload 生成订阅发票 payload
+func buildSubscriptionPayload(plan model.SubscriptionPlan, userID uint64) string {
+	return fmt.Sprintf("%s:%s:%d", subscriptionPayloadPrefix, plan, userID)
+}
+
+// parseSubscriptionPayload 解析订阅发票 payload
+func parseSubscriptionPayload(payload string) (plan model.SubscriptionPlan, userID uint64, err error) {
+	parts := strings.Split(payload, ":")
+	if len(parts) != 3 || parts[0] != subscriptionPayloadPrefix {
+		return "", 0, fmt.Errorf("invalid subscription payload: %q", payload)
+	}
+	userID, err = strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid user id in payload: %v", err)
+	}
+	return model.SubscriptionPlan(parts[1]), userID, nil
+}
+
+// isSubscriptionPayload payload 是否属于订阅发票
+func isSubscriptionPayload(payload string) bool {
+	return strings.HasPrefix(payload, subscriptionPayloadPrefix+":")
+}
+
+// applySubscription 订阅有效期内将用户的角色视为完全解锁（只影响响应，不修改存储的解锁状态）
+func applySubscription(subscriptionRepo *repository.SubscriptionRepository, userID uint64, characters ...*model.Character) {
+	if len(characters) == 0 || !subscriptionRepo.IsActive(userID) {
+		return
+	}
+	for _, character := range characters {
+		if character.UserID == userID {
+			character.SubscriptionUnlocked = true
+		}
+	}
+}
+
+// acquireGeneration 占用一个 AI 生成名额，订阅用户优先排队
+func acquireGeneration(ctx context.Context, gate *service.GenerationGate, subscriptionRepo *repository.SubscriptionRepository, userID uint64) (func(), error) {
+	priority := service.GenerationPriorityNormal
+	if subscriptionRepo.IsActive(userID) {
+		priority = service.GenerationPriorityHigh
+	}
+	return gate.Acquire(ctx, priority)
+}
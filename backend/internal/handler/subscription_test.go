@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"lauraai-backend/internal/i18n"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+)
+
+// subscriptionPaymentUpdate 构造订阅扣款的 successful_payment Webhook 请求体
+func (env *starsTestEnv) subscriptionPaymentUpdate(chargeID string, expiresAt time.Time) string {
+	return fmt.Sprintf(`{"update_id":1,"message":{"message_id":10,"from":{"id":%d,"first_name":"Alice"},
+		"successful_payment":{"currency":"XTR","total_amount":1000,"invoice_payload":%q,"telegram_payment_charge_id":%q,
+		"subscription_expiration_date":%d,"is_recurring":true}}}`,
+		env.user.TelegramID, buildSubscriptionPayload(model.SubscriptionPlanPremium, env.user.ID), chargeID, expiresAt.Unix())
+}
+
+// subscribedView 按订阅状态渲染角色响应
+func subscribedView(t *testing.T, userID uint64, character *model.Character) map[string]interface{} {
+	t.Helper()
+	applySubscription(repository.NewSubscriptionRepository(), userID, character)
+	return characterResponse(character, string(i18n.LocaleEn))
+}
+
+func TestSubscriptionUnlocksAll(t *testing.T) {
+	env := newStarsTestEnv(t)
+	expiresAt := time.Now().Add(30 * 24 * time.Hour).Truncate(time.Second)
+	if w := env.postWebhook(t, env.subscriptionPaymentUpdate("sub-charge-1", expiresAt), testWebhookSecret); w.Code != http.StatusOK {
+		t.Fatalf("webhook status %d: %s", w.Code, w.Body.String())
+	}
+
+	subscriptions := repository.NewSubscriptionRepository()
+	subscription, err := subscriptions.GetByUserID(env.user.ID)
+	if err != nil {
+		t.Fatalf("subscription not created: %v", err)
+	}
+	if subscription.Status != model.SubscriptionStatusActive || !subscription.ExpiresAt.Equal(expiresAt) || !subscriptions.IsActive(env.user.ID) {
+		t.Errorf("subscription = %+v", subscription)
+	}
+
+	// 订阅期间自己的角色都按完全解锁返回，存储的解锁状态不变
+	character := reloadCharacter(t, env.character.ID)
+	view := subscribedView(t, env.user.ID, character)
+	if view["unlock_status"] != model.UnlockStatusFullUnlocked || view["clear_image_url"] == nil || view["subscription_unlocked"] != true {
+		t.Errorf("subscribed view = %v", view)
+	}
+	if got := reloadCharacter(t, env.character.ID).UnlockStatus; got != model.UnlockStatusLocked {
+		t.Errorf("stored unlock status = %d, want locked", got)
+	}
+
+	// 其他用户的角色不受影响
+	other := createTestUser(t, 1002, "Bob")
+	otherCharacter := createTestCharacter(t, other, model.UnlockStatusLocked)
+	applySubscription(subscriptions, env.user.ID, otherCharacter)
+	if otherCharacter.SubscriptionUnlocked {
+		t.Errorf("subscription unlocked another user's character")
+	}
+}
+
+func TestSubscriptionExpiry(t *testing.T) {
+	env := newStarsTestEnv(t)
+	subscriptions := repository.NewSubscriptionRepository()
+	if _, err := subscriptions.Renew(env.user.ID, model.SubscriptionPlanPremium, "sub-charge-1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("renew: %v", err)
+	}
+
+	// 到期后恢复为存储的解锁状态
+	repository.DB.Model(&model.Subscription{}).Where("user_id = ?", env.user.ID).Update("expires_at", time.Now().Add(-time.Second))
+	if subscriptions.IsActive(env.user.ID) {
+		t.Fatalf("expired subscription still active")
+	}
+	view := subscribedView(t, env.user.ID, reloadCharacter(t, env.character.ID))
+	if view["unlock_status"] != model.UnlockStatusLocked || view["clear_image_url"] != nil {
+		t.Errorf("expired view = %v", view)
+	}
+
+	// 到期后续费重新开始计算
+	renewed, err := subscriptions.Renew(env.user.ID, model.SubscriptionPlanPremium, "sub-charge-2", time.Now().Add(time.Hour))
+	if err != nil || !subscriptions.IsActive(env.user.ID) || time.Since(renewed.StartedAt) > time.Minute {
+		t.Fatalf("renew after expiry = %+v, %v", renewed, err)
+	}
+
+	// 取消续费后到期前仍然有效，退款立即失效
+	subscriptions.SetStatus(env.user.ID, model.SubscriptionStatusCanceled)
+	if !subscriptions.IsActive(env.user.ID) {
+		t.Errorf("canceled subscription inactive before expiry")
+	}
+	if refunded, err := subscriptions.RefundCharge("sub-charge-1"); err != nil || refunded {
+		t.Errorf("refund of an older charge = %v, %v; want ignored", refunded, err)
+	}
+	if refunded, err := subscriptions.RefundCharge("sub-charge-2"); err != nil || !refunded {
+		t.Fatalf("refund = %v, %v", refunded, err)
+	}
+	if subscriptions.IsActive(env.user.ID) {
+		t.Errorf("refunded subscription still active")
+	}
+}
+
+func TestSubscriptionRenewReplay(t *testing.T) {
+	env := newStarsTestEnv(t)
+	expiresAt := time.Now().Add(30 * 24 * time.Hour).Truncate(time.Second)
+	body := env.subscriptionPaymentUpdate("sub-charge-1", expiresAt)
+
+	// 重复投递同一笔扣款，有效期不变
+	for i := 0; i < 2; i++ {
+		if w := env.postWebhook(t, body, testWebhookSecret); w.Code != http.StatusOK {
+			t.Fatalf("delivery %d: status %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+	subscription, _ := repository.NewSubscriptionRepository().GetByUserID(env.user.ID)
+	if !subscription.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("expires_at = %v, want %v", subscription.ExpiresAt, expiresAt)
+	}
+	var count int64
+	repository.DB.Model(&model.Subscription{}).Where("user_id = ?", env.user.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("subscriptions = %d, want 1", count)
+	}
+}
@@ -1,16 +1,19 @@
 package handler
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"log"
-	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"lauraai-backend/internal/config"
+	"lauraai-backend/internal/model"
 	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/service"
 	"lauraai-backend/pkg/response"
 
 	"github.com/gin-gonic/gin"
@@ -18,21 +21,61 @@ import (
 
 // TelegramWebhookHandler 处理 Telegram Bot Webhook 请求
 type TelegramWebhookHandler struct {
-	characterRepo *repository.CharacterRepository
-	userRepo      *repository.UserRepository
+	characterRepo    *repository.CharacterRepository
+	userRepo         *repository.UserRepository
+	paymentRepo      *repository.PaymentRepository
+	subscriptionRepo *repository.SubscriptionRepository
+	botClient        *service.TelegramBotClient
+	unlockHandler    *UnlockHandler
 }
 
-func NewTelegramWebhookHandler() *TelegramWebhookHandler {
+func NewTelegramWebhookHandler(reportJobs *service.ReportJobs, pricing *service.PricingService) *TelegramWebhookHandler {
 	return &TelegramWebhookHandler{
-		characterRepo: repository.NewCharacterRepository(),
-		userRepo:      repository.NewUserRepository(),
+		characterRepo:    repository.NewCharacterRepository(),
+		userRepo:         repository.NewUserRepository(),
+		paymentRepo:      repository.NewPaymentRepository(),
+		subscriptionRepo: repository.NewSubscriptionRepository(),
+		botClient:        service.NewTelegramBotClient(),
+		unlockHandler:    NewUnlockHandler(reportJobs, pricing),
 	}
 }
 
 // TelegramUpdate represents a Telegram webhook update
 type TelegramUpdate struct {
-	UpdateID    int64            `json:"update_id"`
-	InlineQuery *TelegramInlineQuery `json:"inline_query,omitempty"`
+	UpdateID         int64                     `json:"update_id"`
+	Message          *TelegramMessage          `json:"message,omitempty"`
+	InlineQuery      *TelegramInlineQuery      `json:"inline_query,omitempty"`
+	PreCheckoutQuery *TelegramPreCheckoutQuery `json:"pre_checkout_query,omitempty"`
+}
+
+// TelegramMessage represents a message (only the fields we use)
+type TelegramMessage struct {
+	MessageID         int64                      `json:"message_id"`
+	From              *TelegramFrom              `json:"from,omitempty"`
+	SuccessfulPayment *TelegramSuccessfulPayment `json:"successful_payment,omitempty"`
+	RefundedPayment   *TelegramRefundedPayment   `json:"refunded_payment,omitempty"`
+}
+
+// TelegramPreCheckoutQuery represents an incoming pre-checkout query
+type TelegramPreCheckoutQuery struct {
+	ID             string       `json:"id"`
+	From           TelegramFrom `json:"from"`
+	Currency       string       `json:"currency"`
+	TotalAmount    int          `json:"total_amount"`
+	InvoicePayload string       `json:"invoice_payload"`
+}
+
+// TelegramSuccessfulPayment represents a successful payment service message
+type TelegramSuccessfulPayment struct {
+	Currency                string `json:"currency"`
+	TotalAmount             int    `json:"total_amount"`
+	InvoicePayload          string `json:"invoice_payload"`
+	TelegramPaymentChargeID string `json:"telegram_payment_charge_id"`
+	ProviderPaymentChargeID string `json:"provider_payment_charge_id"`
+	// 订阅支付才有：本周期到期时间（Unix 时间戳）
+	SubscriptionExpirationDate int64 `json:"subscription_expiration_date,omitempty"`
+	IsRecurring                bool  `json:"is_recurring,omitempty"`
+	IsFirstRecurring           bool  `json:"is_first_recurring,omitempty"`
 }
 
 // TelegramInlineQuery represents an inline query
@@ -74,8 +117,28 @@ type InlineKeyboardButton struct {
 	URL  string `json:"url,omitempty"`
 }
 
+// TelegramRefundedPayment represents a refunded payment service message
+type TelegramRefundedPayment struct {
+	Currency                string `json:"currency"`
+	TotalAmount             int    `json:"total_amount"`
+	InvoicePayload          string `json:"invoice_payload"`
+	TelegramPaymentChargeID string `json:"telegram_payment_charge_id"`
+}
+
 // HandleWebhook 处理 Telegram Webhook
 func (h *TelegramWebhookHandler) HandleWebhook(c *gin.Context) {
+	// 校验 setWebhook 时设置的 secret_token，防止伪造支付回调
+	// 未配置时无法确认请求来源，下面拒绝所有支付相关的更新
+	if secret := config.AppConfig.TelegramWebhookSecret; secret != "" {
+		got := c.GetHeader("X-Telegram-Bot-Api-Secret-Token")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(secret)) != 1 {
+			log.Printf("Telegram Webhook: secret token 校验失败")
+			response.ErrorWithStatus(c, 403, 403, "Forbidden")
+			return
+		}
+	}
+	paymentsEnabled := starsPaymentsEnabled()
+
 	var update TelegramUpdate
 	if err := c.ShouldBindJSON(&update); err != nil {
 		log.Printf("Telegram Webhook: 解析请求失败: %v", err)
@@ -88,6 +151,41 @@ func (h *TelegramWebhookHandler) HandleWebhook(c *gin.Context) {
 		h.handleInlineQuery(update.InlineQuery)
 	}
 
+	// 处理支付前确认
+	if update.PreCheckoutQuery != nil {
+		if paymentsEnabled {
+			h.handlePreCheckoutQuery(update.PreCheckoutQuery)
+		} else {
+			log.Printf("Telegram PreCheckout: TELEGRAM_WEBHOOK_SECRET 未设置，拒绝支付")
+			h.answerPreCheckoutQuery(update.PreCheckoutQuery.ID, false, "Payments are temporarily unavailable.")
+		}
+	}
+
+	if !paymentsEnabled && update.Message != nil && (update.Message.SuccessfulPayment != nil || update.Message.RefundedPayment != nil) {
+		log.Printf("Telegram Webhook: TELEGRAM_WEBHOOK_SECRET 未设置，忽略支付更新 update_id=%d", update.UpdateID)
+		c.JSON(200, gin.H{"ok": true})
+		return
+	}
+
+	// 处理支付成功
+	if update.Message != nil && update.Message.SuccessfulPayment != nil {
+		if err := h.handleSuccessfulPayment(update.Message); err != nil {
+			log.Printf("Telegram Webhook: 处理 successful_payment 失败: %v", err)
+			// 返回 500 让 Telegram 重试投递
+			response.ErrorWithStatus(c, 500, 500, "Failed to process payment")
+			return
+		}
+	}
+
+	// 处理退款（例如在 Telegram 侧发起的退款）
+	if update.Message != nil && update.Message.RefundedPayment != nil {
+		if err := h.handleRefundedPayment(update.Message.RefundedPayment); err != nil {
+			log.Printf("Telegram Webhook: 处理 refunded_payment 失败: %v", err)
+			response.ErrorWithStatus(c, 500, 500, "Failed to process refund")
+			return
+		}
+	}
+
 	// 返回成功（Telegram 要求快速响应）
 	c.JSON(200, gin.H{"ok": true})
 }
@@ -158,34 +256,239 @@ func (h *TelegramWebhookHandler) handleInlineQuery(query *TelegramInlineQuery) {
 
 // answerInlineQuery 发送 inline query 响应
 func (h *TelegramWebhookHandler) answerInlineQuery(queryID string, results []interface{}) {
-	botToken := strings.TrimSpace(config.AppConfig.TelegramBotToken)
-	botToken = strings.Trim(botToken, `"'`)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// 缓存 60 秒
+	if err := h.botClient.AnswerInlineQuery(ctx, queryID, results, 60, true); err != nil {
+		log.Printf("Telegram answerInlineQuery: %v", err)
+		return
+	}
+	log.Printf("Telegram answerInlineQuery: 成功响应 queryID=%s", queryID)
+}
+
+// handlePreCheckoutQuery 校验发票是否仍然有效，并响应 pre_checkout_query
+func (h *TelegramWebhookHandler) handlePreCheckoutQuery(query *TelegramPreCheckoutQuery) {
+	log.Printf("Telegram PreCheckout: id=%s, from=%d, payload=%s, amount=%d %s",
+		query.ID, query.From.ID, query.InvoicePayload, query.TotalAmount, query.Currency)
+
+	ok := true
+	errorMessage := ""
+	if err := h.validatePreCheckout(query); err != nil {
+		log.Printf("Telegram PreCheckout: 拒绝支付: %v", err)
+		ok = false
+		errorMessage = "This unlock is no longer available. Please reopen the app and try again."
+	}
+
+	h.answerPreCheckoutQuery(query.ID, ok, errorMessage)
+}
 
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/answerInlineQuery", botToken)
+// answerPreCheckoutQuery 回复支付前确认，Telegram 要求在 10 秒内回复
+func (h *TelegramWebhookHandler) answerPreCheckoutQuery(queryID string, ok bool, errorMessage string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := h.botClient.AnswerPreCheckoutQuery(ctx, queryID, ok, errorMessage); err != nil {
+		log.Printf("Telegram answerPreCheckoutQuery: %v", err)
+	}
+}
+
+// starsPaymentsEnabled 只有配置了 Webhook secret_token 才接受 Stars 支付，否则无法区分伪造的支付回调
+func starsPaymentsEnabled() bool {
+	return config.AppConfig.TelegramWebhookSecret != ""
+}
 
-	payload := map[string]interface{}{
-		"inline_query_id": queryID,
-		"results":         results,
-		"cache_time":      60, // 缓存 60 秒
-		"is_personal":     true,
+// validatePreCheckout 支付前确认：发票仍待支付、角色未解锁、价格（扣除优惠码后）未变化
+func (h *TelegramWebhookHandler) validatePreCheckout(query *TelegramPreCheckoutQuery) error {
+	if isSubscriptionPayload(query.InvoicePayload) {
+		_, err := h.loadSubscriptionPayment(query.From.ID, query.InvoicePayload, query.Currency, query.TotalAmount)
+		return err
 	}
 
-	jsonPayload, err := json.Marshal(payload)
+	payment, character, err := h.loadUnlockPayment(query.From.ID, query.InvoicePayload, query.Currency, query.TotalAmount)
 	if err != nil {
-		log.Printf("Telegram answerInlineQuery: 序列化失败: %v", err)
-		return
+		return err
+	}
+	if payment.Status != model.PaymentStatusPending {
+		return fmt.Errorf("payment %d is %s", payment.ID, payment.Status)
+	}
+	if character.UnlockStatus == model.UnlockStatusFullUnlocked {
+		return fmt.Errorf("character %d already fully unlocked", character.ID)
+	}
+	// 发票创建后解锁状态可能变化（例如好友助力），价格随之改变
+	quote, err := h.unlockHandler.pricing.Quote(character.Type, character.UnlockStatus, model.PaymentMethodStars)
+	if err != nil {
+		return err
+	}
+	expected := quote.Amount
+	if redemption, err := h.unlockHandler.promoRepo.GetRedemptionByPaymentID(payment.ID); err == nil {
+		expected -= redemption.Discount
+	}
+	if payment.Amount != expected {
+		return fmt.Errorf("invoice amount %d is stale, current price %d", payment.Amount, expected)
+	}
+	// 发票创建后优惠码可能已停用、过期或被其他支付用完次数
+	if err := h.unlockHandler.promoRepo.CheckRedemption(payment.ID, payment.UserID, character.Type); err != nil {
+		return fmt.Errorf("promo code no longer valid: %w", err)
+	}
+	return nil
+}
+
+// handleSuccessfulPayment 支付成功后结算支付记录并完成解锁
+func (h *TelegramWebhookHandler) handleSuccessfulPayment(message *TelegramMessage) error {
+	sp := message.SuccessfulPayment
+	if message.From == nil {
+		return fmt.Errorf("successful_payment without sender")
+	}
+	log.Printf("Telegram SuccessfulPayment: from=%d, payload=%s, amount=%d %s, charge=%s",
+		message.From.ID, sp.InvoicePayload, sp.TotalAmount, sp.Currency, sp.TelegramPaymentChargeID)
+
+	if isSubscriptionPayload(sp.InvoicePayload) {
+		return h.handleSubscriptionPayment(message.From.ID, sp)
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonPayload))
+	payment, character, err := h.loadUnlockPayment(message.From.ID, sp.InvoicePayload, sp.Currency, sp.TotalAmount)
 	if err != nil {
-		log.Printf("Telegram answerInlineQuery: 请求失败: %v", err)
-		return
+		// 无法关联到支付记录，只记录日志，不让 Telegram 重试
+		log.Printf("Telegram SuccessfulPayment: 忽略无效支付 charge=%s: %v", sp.TelegramPaymentChargeID, err)
+		return nil
+	}
+
+	// 已扣款但角色已通过其他方式完全解锁，记为 failed 供客服处理
+	if payment.Status == model.PaymentStatusPending && character.UnlockStatus == model.UnlockStatusFullUnlocked {
+		log.Printf("Telegram SuccessfulPayment: 角色 %d 已解锁，支付 %d 记为 failed", character.ID, payment.ID)
+		_, _, err := h.paymentRepo.Settle(payment.ID, sp.TelegramPaymentChargeID, model.PaymentStatusFailed)
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		log.Printf("Telegram answerInlineQuery: 响应状态: %d", resp.StatusCode)
-	} else {
-		log.Printf("Telegram answerInlineQuery: 成功响应 queryID=%s", queryID)
+	if _, err := h.unlockHandler.settlePayment(payment.ID, sp.TelegramPaymentChargeID); err != nil {
+		return err
+	}
+	log.Printf("Telegram SuccessfulPayment: 支付 %d 已结算，角色 %d 已完全解锁", payment.ID, character.ID)
+	return nil
+}
+
+// handleRefundedPayment 退款已在 Telegram 侧完成，只需记录并恢复解锁状态
+func (h *TelegramWebhookHandler) handleRefundedPayment(rp *TelegramRefundedPayment) error {
+	log.Printf("Telegram RefundedPayment: payload=%s, amount=%d %s, charge=%s",
+		rp.InvoicePayload, rp.TotalAmount, rp.Currency, rp.TelegramPaymentChargeID)
+
+	if isSubscriptionPayload(rp.InvoicePayload) {
+		refunded, err := h.subscriptionRepo.RefundCharge(rp.TelegramPaymentChargeID)
+		if err != nil {
+			return err
+		}
+		log.Printf("Telegram RefundedPayment: 订阅扣款 charge=%s 已退款，订阅失效=%v", rp.TelegramPaymentChargeID, refunded)
+		return nil
+	}
+
+	payment, err := h.paymentRepo.GetByExternalTxID(rp.TelegramPaymentChargeID)
+	if err != nil {
+		log.Printf("Telegram RefundedPayment: 找不到支付记录 charge=%s: %v", rp.TelegramPaymentChargeID, err)
+		return nil
+	}
+
+	_, character, err := h.unlockHandler.stateMachine.Refund(payment.ID, "refunded via Telegram", model.UnlockActorTelegram, nil)
+	if errors.Is(err, repository.ErrPaymentNotRefundable) {
+		// 重复投递或已通过管理接口退款
+		log.Printf("Telegram RefundedPayment: %v", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Telegram RefundedPayment: 支付 %d 已退款，角色 %d 恢复为状态 %d", payment.ID, character.ID, character.UnlockStatus)
+	return nil
+}
+
+// loadUnlockPayment 根据 payload 加载支付记录，并校验付款人、币种和金额
+func (h *TelegramWebhookHandler) loadUnlockPayment(fromTelegramID int64, payload string, currency string, amount int) (*model.Payment, *model.Character, error) {
+	characterID, userID, paymentID, err := parseUnlockPayload(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	if currency != service.StarsCurrency {
+		return nil, nil, fmt.Errorf("unexpected currency %q", currency)
+	}
+
+	payment, err := h.paymentRepo.GetByID(paymentID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("payment %d not found: %v", paymentID, err)
+	}
+	if payment.Payload != payload || payment.Method != model.PaymentMethodStars ||
+		payment.UserID != userID || payment.CharacterID != characterID {
+		return nil, nil, fmt.Errorf("payload does not match payment %d", paymentID)
+	}
+	if int64(amount) != payment.Amount {
+		return nil, nil, fmt.Errorf("amount %d does not match payment amount %d", amount, payment.Amount)
+	}
+
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("user %d not found: %v", userID, err)
+	}
+	if user.TelegramID != fromTelegramID {
+		return nil, nil, fmt.Errorf("payer %d does not match user %d", fromTelegramID, userID)
+	}
+
+	character, err := h.characterRepo.GetByID(characterID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("character %d not found: %v", characterID, err)
+	}
+	return payment, character, nil
+}
+
+// handleSubscriptionPayment 首次订阅或自动续费扣款成功，延长订阅有效期
+func (h *TelegramWebhookHandler) handleSubscriptionPayment(fromTelegramID int64, sp *TelegramSuccessfulPayment) error {
+	plan, err := h.loadSubscriptionPayment(fromTelegramID, sp.InvoicePayload, sp.Currency, sp.TotalAmount)
+	if err != nil {
+		// 续费时价格可能已调整，只要付款人和 payload 匹配仍然延长订阅
+		if plan == "" {
+			log.Printf("Telegram SuccessfulPayment: 忽略无效订阅支付 charge=%s: %v", sp.TelegramPaymentChargeID, err)
+			return nil
+		}
+		log.Printf("Telegram SuccessfulPayment: 订阅支付校验警告 charge=%s: %v", sp.TelegramPaymentChargeID, err)
+	}
+	_, userID, _ := parseSubscriptionPayload(sp.InvoicePayload)
+
+	expiresAt := time.Now().Add(service.StarSubscriptionPeriod * time.Second)
+	if sp.SubscriptionExpirationDate > 0 {
+		expiresAt = time.Unix(sp.SubscriptionExpirationDate, 0)
+	}
+
+	subscription, err := h.subscriptionRepo.Renew(userID, plan, sp.TelegramPaymentChargeID, expiresAt)
+	if err != nil {
+		return err
+	}
+	log.Printf("Telegram SuccessfulPayment: 用户 %d 订阅 %s 有效期至 %s (recurring=%v)",
+		userID, subscription.Plan, subscription.ExpiresAt.Format(time.RFC3339), sp.IsRecurring)
+	return nil
+}
+
+// loadSubscriptionPayment 校验订阅发票的 payload、付款人和金额
+// payload 和付款人匹配但金额不一致时返回 plan 和错误
+func (h *TelegramWebhookHandler) loadSubscriptionPayment(fromTelegramID int64, payload string, currency string, amount int) (model.SubscriptionPlan, error) {
+	plan, userID, err := parseSubscriptionPayload(payload)
+	if err != nil {
+		return "", err
+	}
+	if currency != service.StarsCurrency {
+		return "", fmt.Errorf("unexpected currency %q", currency)
+	}
+
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		return "", fmt.Errorf("user %d not found: %v", userID, err)
+	}
+	if user.TelegramID != fromTelegramID {
+		return "", fmt.Errorf("payer %d does not match user %d", fromTelegramID, userID)
+	}
+
+	price, err := h.unlockHandler.pricing.SubscriptionPrice(plan)
+	if err != nil {
+		return "", err
+	}
+	if int64(amount) != price {
+		return plan, fmt.Errorf("amount %d does not match subscription price %d", amount, price)
 	}
+	return plan, nil
 }
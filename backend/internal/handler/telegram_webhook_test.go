@@ -0,0 +1,370 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"lauraai-backend/internal/config"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// starsTestEnv Stars 支付测试环境：一个用户、一个未解锁的角色和一张已创建的发票
+type starsTestEnv struct {
+	api       *fakeBotAPI
+	webhook   *TelegramWebhookHandler
+	user      *model.User
+	character *model.Character
+	payment   *model.Payment
+}
+
+func newStarsTestEnv(t *testing.T) *starsTestEnv {
+	t.Helper()
+	api := setupHandlerTest(t)
+	pricing, err := service.NewPricingService()
+	if err != nil {
+		t.Fatalf("pricing: %v", err)
+	}
+	env := &starsTestEnv{
+		api:     api,
+		webhook: NewTelegramWebhookHandler(nil, pricing),
+		user:    createTestUser(t, 1001, "Alice"),
+	}
+	env.character = createTestCharacter(t, env.user, model.UnlockStatusLocked)
+	env.payment = env.createInvoice(t)
+	return env
+}
+
+// createInvoice 通过 createStarsInvoice 创建发票，返回对应的支付记录
+func (env *starsTestEnv) createInvoice(t *testing.T) *model.Payment {
+	t.Helper()
+	c, w := testContext(http.MethodPost, "/", "")
+	env.webhook.unlockHandler.createStarsInvoice(c, env.user, env.character, "")
+
+	var data struct {
+		Status      string `json:"status"`
+		PaymentID   uint64 `json:"payment_id"`
+		InvoiceLink string `json:"invoice_link"`
+		Price       int64  `json:"price"`
+	}
+	resp := decodeResponse(t, w, &data)
+	if resp.Code != 0 {
+		t.Fatalf("createStarsInvoice failed: %+v", resp)
+	}
+	if data.Status != "pending" || data.InvoiceLink != "https://t.me/$test-invoice" {
+		t.Fatalf("unexpected invoice response: %+v", data)
+	}
+
+	payment, err := repository.NewPaymentRepository().GetByID(data.PaymentID)
+	if err != nil {
+		t.Fatalf("payment not created: %v", err)
+	}
+	if payment.Amount != data.Price {
+		t.Fatalf("payment amount %d, response price %d", payment.Amount, data.Price)
+	}
+	return payment
+}
+
+// preCheckout 构造与发票一致的 pre_checkout_query
+func (env *starsTestEnv) preCheckout() *TelegramPreCheckoutQuery {
+	return &TelegramPreCheckoutQuery{
+		ID:             "pcq-1",
+		From:           TelegramFrom{ID: env.user.TelegramID},
+		Currency:       service.StarsCurrency,
+		TotalAmount:    int(env.payment.Amount),
+		InvoicePayload: env.payment.Payload,
+	}
+}
+
+// successfulPaymentUpdate 构造 successful_payment Webhook 请求体
+func (env *starsTestEnv) successfulPaymentUpdate(chargeID string) string {
+	return fmt.Sprintf(`{"update_id":1,"message":{"message_id":10,"from":{"id":%d,"first_name":"Alice"},
+		"successful_payment":{"currency":"XTR","total_amount":%d,"invoice_payload":%q,"telegram_payment_charge_id":%q}}}`,
+		env.user.TelegramID, env.payment.Amount, env.payment.Payload, chargeID)
+}
+
+// postWebhook 通过路由发送 Webhook 请求
+func (env *starsTestEnv) postWebhook(t *testing.T, body string, secret string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := gin.New()
+	r.POST("/webhook", env.webhook.HandleWebhook)
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCreateStarsInvoice(t *testing.T) {
+	env := newStarsTestEnv(t)
+
+	calls := env.api.Calls("createInvoiceLink")
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 createInvoiceLink call, got %d", len(calls))
+	}
+	call := calls[0]
+	wantPayload := buildUnlockPayload(env.character.ID, env.user.ID, env.payment.ID)
+	if call["payload"] != wantPayload || env.payment.Payload != wantPayload {
+		t.Errorf("payload = %v (stored %q), want %q", call["payload"], env.payment.Payload, wantPayload)
+	}
+	if call["currency"] != service.StarsCurrency {
+		t.Errorf("currency = %v", call["currency"])
+	}
+	if call["provider_token"] != "" {
+		t.Errorf("provider_token must be empty for Stars, got %v", call["provider_token"])
+	}
+	prices, _ := call["prices"].([]any)
+	if len(prices) != 1 || prices[0].(map[string]any)["amount"] != float64(env.payment.Amount) {
+		t.Errorf("prices = %v, want one item of %d", call["prices"], env.payment.Amount)
+	}
+
+	if env.payment.Status != model.PaymentStatusPending {
+		t.Errorf("payment status = %s, want pending", env.payment.Status)
+	}
+	// 创建发票不改变解锁状态
+	if got := reloadCharacter(t, env.character.ID).UnlockStatus; got != model.UnlockStatusLocked {
+		t.Errorf("unlock status = %d, want locked", got)
+	}
+}
+
+func TestCreateStarsInvoiceReusesPending(t *testing.T) {
+	env := newStarsTestEnv(t)
+
+	// 重复点击支付复用同一条待支付记录
+	again := env.createInvoice(t)
+	if again.ID != env.payment.ID || again.Payload != env.payment.Payload {
+		t.Errorf("second invoice created payment %d (%q), want %d (%q)", again.ID, again.Payload, env.payment.ID, env.payment.Payload)
+	}
+	var pending int64
+	repository.DB.Model(&model.Payment{}).Where("status = ?", model.PaymentStatusPending).Count(&pending)
+	if pending != 1 {
+		t.Errorf("pending payments = %d, want 1", pending)
+	}
+
+	// 解锁状态变化后价格不同，创建新的记录
+	repository.DB.Model(env.character).Update("unlock_status", model.UnlockStatusHalfUnlocked)
+	env.character.UnlockStatus = model.UnlockStatusHalfUnlocked
+	if half := env.createInvoice(t); half.ID == env.payment.ID {
+		t.Errorf("half unlocked character reused payment %d", half.ID)
+	}
+}
+
+func TestValidatePreCheckout(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(t *testing.T, env *starsTestEnv, q *TelegramPreCheckoutQuery)
+		wantErr bool
+	}{
+		{name: "valid"},
+		{
+			name:    "other payer",
+			mutate:  func(t *testing.T, env *starsTestEnv, q *TelegramPreCheckoutQuery) { q.From.ID = 9999 },
+			wantErr: true,
+		},
+		{
+			name:    "wrong amount",
+			mutate:  func(t *testing.T, env *starsTestEnv, q *TelegramPreCheckoutQuery) { q.TotalAmount-- },
+			wantErr: true,
+		},
+		{
+			name:    "wrong currency",
+			mutate:  func(t *testing.T, env *starsTestEnv, q *TelegramPreCheckoutQuery) { q.Currency = "USD" },
+			wantErr: true,
+		},
+		{
+			name: "tampered payload",
+			mutate: func(t *testing.T, env *starsTestEnv, q *TelegramPreCheckoutQuery) {
+				q.InvoicePayload = buildUnlockPayload(env.character.ID+1, env.user.ID, env.payment.ID)
+			},
+			wantErr: true,
+		},
+		{
+			name: "already paid",
+			mutate: func(t *testing.T, env *starsTestEnv, q *TelegramPreCheckoutQuery) {
+				if _, _, err := env.webhook.paymentRepo.Settle(env.payment.ID, "charge-x", model.PaymentStatusSucceeded); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: true,
+		},
+		{
+			name: "character unlocked meanwhile",
+			mutate: func(t *testing.T, env *starsTestEnv, q *TelegramPreCheckoutQuery) {
+				repository.DB.Model(env.character).Update("unlock_status", model.UnlockStatusFullUnlocked)
+			},
+			wantErr: true,
+		},
+		{
+			// 好友助力后半解锁，价格下降，旧发票作废
+			name: "stale price",
+			mutate: func(t *testing.T, env *starsTestEnv, q *TelegramPreCheckoutQuery) {
+				repository.DB.Model(env.character).Update("unlock_status", model.UnlockStatusHalfUnlocked)
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newStarsTestEnv(t)
+			query := env.preCheckout()
+			if tt.mutate != nil {
+				tt.mutate(t, env, query)
+			}
+			err := env.webhook.validatePreCheckout(query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validatePreCheckout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPreCheckoutAnswered(t *testing.T) {
+	env := newStarsTestEnv(t)
+	body := fmt.Sprintf(`{"update_id":1,"pre_checkout_query":{"id":"pcq-1","from":{"id":%d,"first_name":"Alice"},"currency":"XTR","total_amount":%d,"invoice_payload":%q}}`,
+		env.user.TelegramID, env.payment.Amount-1, env.payment.Payload)
+	if w := env.postWebhook(t, body, testWebhookSecret); w.Code != http.StatusOK {
+		t.Fatalf("webhook status %d: %s", w.Code, w.Body.String())
+	}
+
+	calls := env.api.Calls("answerPreCheckoutQuery")
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 answerPreCheckoutQuery call, got %d", len(calls))
+	}
+	if calls[0]["pre_checkout_query_id"] != "pcq-1" || calls[0]["ok"] != false || calls[0]["error_message"] == nil {
+		t.Errorf("amount mismatch should be rejected, got %v", calls[0])
+	}
+}
+
+func TestHandleSuccessfulPayment(t *testing.T) {
+	env := newStarsTestEnv(t)
+
+	if w := env.postWebhook(t, env.successfulPaymentUpdate("charge-1"), testWebhookSecret); w.Code != http.StatusOK {
+		t.Fatalf("webhook status %d: %s", w.Code, w.Body.String())
+	}
+
+	payment, _ := env.webhook.paymentRepo.GetByID(env.payment.ID)
+	if payment.Status != model.PaymentStatusSucceeded || payment.ExternalTxID == nil || *payment.ExternalTxID != "charge-1" || payment.PaidAt == nil {
+		t.Fatalf("payment not settled: %+v", payment)
+	}
+	if got := reloadCharacter(t, env.character.ID).UnlockStatus; got != model.UnlockStatusFullUnlocked {
+		t.Fatalf("unlock status = %d, want full", got)
+	}
+}
+
+func TestHandleSuccessfulPaymentReplay(t *testing.T) {
+	env := newStarsTestEnv(t)
+	body := env.successfulPaymentUpdate("charge-1")
+
+	// Telegram 重试投递同一条更新
+	for i := 0; i < 3; i++ {
+		if w := env.postWebhook(t, body, testWebhookSecret); w.Code != http.StatusOK {
+			t.Fatalf("delivery %d: status %d: %s", i, w.Code, w.Body.String())
+		}
+	}
+
+	var events int64
+	repository.DB.Model(&model.UnlockEvent{}).Where("payment_id = ?", env.payment.ID).Count(&events)
+	if events != 1 {
+		t.Errorf("expected 1 unlock event for replayed payment, got %d", events)
+	}
+	var succeeded int64
+	repository.DB.Model(&model.Payment{}).Where("status = ?", model.PaymentStatusSucceeded).Count(&succeeded)
+	if succeeded != 1 {
+		t.Errorf("expected 1 succeeded payment, got %d", succeeded)
+	}
+
+	// 同一笔扣款号用于另一张发票，不会解锁第二个角色
+	other := createTestCharacter(t, env.user, model.UnlockStatusLocked)
+	env.character = other
+	env.payment = env.createInvoice(t)
+	if w := env.postWebhook(t, env.successfulPaymentUpdate("charge-1"), testWebhookSecret); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if got := reloadCharacter(t, other.ID).UnlockStatus; got != model.UnlockStatusLocked {
+		t.Errorf("replayed charge unlocked another character: status %d", got)
+	}
+}
+
+func TestHandleSuccessfulPaymentAlreadyUnlocked(t *testing.T) {
+	env := newStarsTestEnv(t)
+	repository.DB.Model(env.character).Update("unlock_status", model.UnlockStatusFullUnlocked)
+
+	if w := env.postWebhook(t, env.successfulPaymentUpdate("charge-1"), testWebhookSecret); w.Code != http.StatusOK {
+		t.Fatalf("webhook status %d: %s", w.Code, w.Body.String())
+	}
+	payment, _ := env.webhook.paymentRepo.GetByID(env.payment.ID)
+	if payment.Status != model.PaymentStatusFailed {
+		t.Errorf("payment status = %s, want failed", payment.Status)
+	}
+}
+
+func TestHandleSuccessfulPaymentForgedPayer(t *testing.T) {
+	env := newStarsTestEnv(t)
+	body := strings.Replace(env.successfulPaymentUpdate("charge-1"), fmt.Sprintf(`"id":%d`, env.user.TelegramID), `"id":4242`, 1)
+
+	if w := env.postWebhook(t, body, testWebhookSecret); w.Code != http.StatusOK {
+		t.Fatalf("webhook status %d: %s", w.Code, w.Body.String())
+	}
+	payment, _ := env.webhook.paymentRepo.GetByID(env.payment.ID)
+	if payment.Status != model.PaymentStatusPending {
+		t.Errorf("payment status = %s, want pending", payment.Status)
+	}
+}
+
+func TestWebhookSecretToken(t *testing.T) {
+	env := newStarsTestEnv(t)
+	config.AppConfig.TelegramWebhookSecret = "s3cret"
+
+	if w := env.postWebhook(t, env.successfulPaymentUpdate("charge-1"), "wrong"); w.Code != http.StatusForbidden {
+		t.Fatalf("wrong secret: status %d, want 403", w.Code)
+	}
+	if got := reloadCharacter(t, env.character.ID).UnlockStatus; got != model.UnlockStatusLocked {
+		t.Fatalf("forged webhook unlocked character")
+	}
+	if w := env.postWebhook(t, env.successfulPaymentUpdate("charge-1"), "s3cret"); w.Code != http.StatusOK {
+		t.Fatalf("correct secret: status %d", w.Code)
+	}
+}
+
+func TestWebhookSecretUnset(t *testing.T) {
+	env := newStarsTestEnv(t)
+	config.AppConfig.TelegramWebhookSecret = ""
+
+	// 无法校验来源时不处理支付回调
+	if w := env.postWebhook(t, env.successfulPaymentUpdate("charge-1"), ""); w.Code != http.StatusOK {
+		t.Fatalf("webhook status %d: %s", w.Code, w.Body.String())
+	}
+	if got := reloadCharacter(t, env.character.ID).UnlockStatus; got != model.UnlockStatusLocked {
+		t.Fatalf("unverified webhook unlocked character")
+	}
+	payment, _ := env.webhook.paymentRepo.GetByID(env.payment.ID)
+	if payment.Status != model.PaymentStatusPending {
+		t.Errorf("payment status = %s, want pending", payment.Status)
+	}
+
+	body := fmt.Sprintf(`{"update_id":2,"pre_checkout_query":{"id":"pcq-1","from":{"id":%d,"first_name":"Alice"},"currency":"XTR","total_amount":%d,"invoice_payload":%q}}`,
+		env.user.TelegramID, env.payment.Amount, env.payment.Payload)
+	if w := env.postWebhook(t, body, ""); w.Code != http.StatusOK {
+		t.Fatalf("webhook status %d: %s", w.Code, w.Body.String())
+	}
+	if calls := env.api.Calls("answerPreCheckoutQuery"); len(calls) != 1 || calls[0]["ok"] != false {
+		t.Errorf("pre-checkout should be rejected, got %v", calls)
+	}
+
+	// 也不再创建新的发票
+	c, w := testContext(http.MethodPost, "/", "")
+	env.webhook.unlockHandler.createStarsInvoice(c, env.user, env.character, "")
+	if resp := decodeResponse(t, w, nil); resp.Code != 503 {
+		t.Errorf("createStarsInvoice code = %d, want 503", resp.Code)
+	}
+}
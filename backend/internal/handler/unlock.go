@@ -2,9 +2,12 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
+	"time"
 
 	"lauraai-backend/internal/middleware"
 	"lauraai-backend/internal/model"
@@ -15,25 +18,41 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// 价格配置
-const (
-	FullUnlockPriceStars = 300 // 全价解锁（星星）
-	FullUnlockPriceTON   = 3   // 全价解锁（TON）
-	HalfUnlockPriceStars = 100 // 半价解锁（星星）
-	HalfUnlockPriceTON   = 1   // 半价解锁（TON）
-)
+// tonVerifyTimeout 单次确认请求查询链上交易的最长时间，未到账时立即返回，由客户端轮询
+const tonVerifyTimeout = 10 * time.Second
+
+// unlockPayloadPrefix Stars 发票 payload 前缀，格式 unlock:<characterID>:<userID>:<paymentID>
+const unlockPayloadPrefix = "unlock"
 
 type UnlockHandler struct {
-	characterRepo *repository.CharacterRepository
-	userRepo      *repository.UserRepository
-	reportService *service.GeminiReportService
+	characterRepo    *repository.CharacterRepository
+	userRepo         *repository.UserRepository
+	paymentRepo      *repository.PaymentRepository
+	promoRepo        *repository.PromoRepository
+	subscriptionRepo *repository.SubscriptionRepository
+	unlockHelpRepo   *repository.UnlockHelpRepository
+	shareLinkRepo    *repository.ShareLinkRepository
+	stateMachine     *service.UnlockStateMachine
+	reportJobs       *service.ReportJobs
+	botClient        *service.TelegramBotClient
+	tonVerifier      *service.TonPaymentVerifier
+	pricing          *service.PricingService
 }
 
-func NewUnlockHandler(reportService *service.GeminiReportService) *UnlockHandler {
+func NewUnlockHandler(reportJobs *service.ReportJobs, pricing *service.PricingService) *UnlockHandler {
 	return &UnlockHandler{
-		characterRepo: repository.NewCharacterRepository(),
-		userRepo:      repository.NewUserRepository(),
-		reportService: reportService,
+		characterRepo:    repository.NewCharacterRepository(),
+		userRepo:         repository.NewUserRepository(),
+		paymentRepo:      repository.NewPaymentRepository(),
+		promoRepo:        repository.NewPromoRepository(),
+		subscriptionRepo: repository.NewSubscriptionRepository(),
+		unlockHelpRepo:   repository.NewUnlockHelpRepository(),
+		shareLinkRepo:    repository.NewShareLinkRepository(),
+		stateMachine:     service.NewUnlockStateMachine(),
+		reportJobs:       reportJobs,
+		botClient:        service.NewTelegramBotClient(),
+		tonVerifier:      service.NewTonPaymentVerifier(service.NewToncenterClient()),
+		pricing:          pricing,
 	}
 }
 
@@ -45,9 +64,16 @@ func (h *UnlockHandler) GetShareInfo(c *gin.Context) {
 		return
 	}
 
-	character, err := h.characterRepo.GetByShareCode(shareCode)
+	// 过期、撤销的分享码返回不同的错误码，前端据此区分"已失效"和"不存在"
+	// 次数用完的分享码仍返回角色信息，由 share_link.exhausted 提示不能再助力
+	link, ok := h.resolveShareLink(c, shareCode)
+	if !ok {
+		return
+	}
+
+	character, err := h.characterRepo.GetByID(link.CharacterID)
 	if err != nil {
-		response.Error(c, 404, "Share link invalid or expired")
+		response.ErrorWithCode(c, 404, "SHARE_NOT_FOUND", "Share link not found")
 		return
 	}
 
@@ -58,20 +84,30 @@ func (h *UnlockHandler) GetShareInfo(c *gin.Context) {
 		return
 	}
 
+	helpers, err := h.unlockHelpRepo.CountByCharacterID(character.ID)
+	if err != nil {
+		response.Error(c, 500, "Failed to get help progress")
+		return
+	}
+
 	// 返回公开信息
-	// 半模糊图也是模糊的，可以公开返回（用于助力成功后显示）
+	// 半模糊图也是模糊的，解锁到半模糊阶段后以签名 URL 返回（用于助力成功后显示）
 	charInfo := gin.H{
 		"id":                  character.ID,
 		"title":               character.Title,
 		"type":                character.Type,
 		"full_blur_image_url": character.FullBlurImageURL,
-		"half_blur_image_url": character.HalfBlurImageURL,
 		"unlock_status":       character.UnlockStatus,
-		"share_code":          character.ShareCode,
+		"share_code":          link.Code,
+	}
+	if character.UnlockStatus != model.UnlockStatusLocked {
+		charInfo["half_blur_image_url"] = signImageURL(character.HalfBlurImageURL)
 	}
 
 	response.Success(c, gin.H{
-		"character": charInfo,
+		"character":     charInfo,
+		"share_link":    shareLinkInfo(link),
+		"help_progress": helpProgress(helpers, character.UnlockStatus, service.DefaultHelpUnlockPolicy()),
 		"owner": gin.H{
 			"id":   owner.ID,
 			"name": owner.Name,
@@ -79,8 +115,15 @@ func (h *UnlockHandler) GetShareInfo(c *gin.Context) {
 	})
 }
 
-// HelpUnlock 好友帮助解锁（将解锁状态从0改为1）
+// HelpUnlockRequest 助力请求，share_code 为好友打开的分享码（必填，也可以通过 query 传入）
+type HelpUnlockRequest struct {
+	ShareCode string `json:"share_code"`
+}
+
+// HelpUnlock 好友帮助解锁
+// 助力人数达到 HELP_HALF_THRESHOLD 时半解锁，达到 HELP_FULL_THRESHOLD 时完全解锁
 // 条件：帮助者必须是角色所有者邀请的用户，且只能帮助邀请者解锁一次
+// 分享码过期、被撤销或达到使用次数上限时不能助力
 func (h *UnlockHandler) HelpUnlock(c *gin.Context) {
 	helper, exists := middleware.GetUserFromContext(c)
 	if !exists {
@@ -107,6 +150,32 @@ func (h *UnlockHandler) HelpUnlock(c *gin.Context) {
 		return
 	}
 
+	// 必须通过有效的分享链接助力：分享码属于该角色，且未撤销、未过期、未达到使用次数上限
+	var req HelpUnlockRequest
+	if c.Request.ContentLength > 0 {
+		_ = c.ShouldBindJSON(&req)
+	}
+	shareCode := req.ShareCode
+	if shareCode == "" {
+		shareCode = c.Query("share_code")
+	}
+	if shareCode == "" {
+		response.ErrorWithCode(c, 400, "SHARE_CODE_REQUIRED", "Share code is required")
+		return
+	}
+	link, ok := h.resolveShareLink(c, shareCode)
+	if !ok {
+		return
+	}
+	if link.CharacterID != character.ID {
+		response.ErrorWithCode(c, 404, "SHARE_NOT_FOUND", "Share link not found")
+		return
+	}
+	if err := repository.CheckShareLinkUsable(link); err != nil {
+		respondShareLinkError(c, err)
+		return
+	}
+
 	// 检查帮助者是否是角色所有者邀请的用户
 	// 1. 检查 InviterID 是否匹配
 	isInvitedByOwner := helper.InviterID != nil && *helper.InviterID == character.UserID
@@ -125,7 +194,7 @@ func (h *UnlockHandler) HelpUnlock(c *gin.Context) {
 	}
 
 	// 检查帮助者是否曾经帮助过这个用户的任何角色
-	hasHelped, err := h.characterRepo.HasUserHelpedOwner(helper.ID, character.UserID)
+	hasHelped, err := h.unlockHelpRepo.HasHelpedOwner(helper.ID, character.UserID)
 	if err != nil {
 		response.Error(c, 500, "Failed to check help record: "+err.Error())
 		return
@@ -135,27 +204,83 @@ func (h *UnlockHandler) HelpUnlock(c *gin.Context) {
 		return
 	}
 
-	// 只有未解锁状态才能帮忙解锁
-	if character.UnlockStatus != model.UnlockStatusLocked {
-		response.Error(c, 400, "Character already unlocked or already helped")
+	// 已完全解锁的角色不再需要助力
+	if character.UnlockStatus == model.UnlockStatusFullUnlocked {
+		response.Error(c, 400, "Character already fully unlocked")
+		return
+	}
+
+	// 占用一次使用次数，助力失败时归还
+	if err := h.shareLinkRepo.ConsumeUse(link.ID); err != nil {
+		respondShareLinkError(c, err)
 		return
 	}
 
-	// 更新解锁状态为半解锁
-	helperID := helper.ID
-	if err := h.characterRepo.UpdateUnlockStatus(characterID, model.UnlockStatusHalfUnlocked, &helperID); err != nil {
+	// 记录助力并按人数推进解锁阶段
+	// 在行锁内重新检查助力记录，同一好友并发请求只会计数一次
+	policy := service.DefaultHelpUnlockPolicy()
+	result, err := h.stateMachine.ApplyHelp(characterID, helper.ID, policy)
+	if err != nil {
+		if releaseErr := h.shareLinkRepo.ReleaseUse(link.ID); releaseErr != nil {
+			log.Printf("HelpUnlock: 归还分享码 %s 使用次数失败: %v", link.Code, releaseErr)
+		}
+	}
+	if errors.Is(err, service.ErrAlreadyHelped) {
+		response.ErrorWithCode(c, 400, "ALREADY_HELPED", "You have already helped this user")
+		return
+	}
+	if errors.Is(err, service.ErrInvalidUnlockTransition) {
+		response.Error(c, 400, "Character already fully unlocked")
+		return
+	}
+	if err != nil {
 		response.Error(c, 500, "Failed to unlock: "+err.Error())
 		return
 	}
 
+	character = result.Character
+	if result.Changed && character.UnlockStatus == model.UnlockStatusFullUnlocked && character.DescriptionEn == "" {
+		h.generateReportAsync(character.ID, character.UserID, "HelpUnlock")
+	}
+
+	// 助力者只能看到模糊图，完全解锁后的清晰图只返回给所有者
+	imageURL := signImageURL(character.HalfBlurImageURL)
+	if character.UnlockStatus == model.UnlockStatusLocked {
+		imageURL = character.FullBlurImageURL
+	}
+
 	response.Success(c, gin.H{
 		"message":       "帮助解锁成功",
-		"unlock_status": model.UnlockStatusHalfUnlocked,
-		"image_url":     character.HalfBlurImageURL,
+		"unlock_status": character.UnlockStatus,
+		"image_url":     imageURL,
+		"help_progress": helpProgress(result.Helpers, character.UnlockStatus, policy),
 	})
 }
 
+// helpProgress 助力进度，例如 "2/3 friends helped"
+func helpProgress(helpers int64, status model.UnlockStatus, policy service.HelpUnlockPolicy) gin.H {
+	required := int64(policy.Required())
+	progress := gin.H{
+		"helpers":        helpers,
+		"required":       required,
+		"half_threshold": policy.HalfThreshold,
+		"full_threshold": policy.FullThreshold,
+		"display":        fmt.Sprintf("%d/%d friends helped", min(helpers, required), required),
+	}
+	// 距离下一阶段还需要的人数
+	switch {
+	case status == model.UnlockStatusLocked:
+		progress["remaining"] = max(int64(policy.HalfThreshold)-helpers, 0)
+	case status == model.UnlockStatusHalfUnlocked && policy.FullThreshold > 0:
+		progress["remaining"] = max(int64(policy.FullThreshold)-helpers, 0)
+	}
+	return progress
+}
+
 // Unlock 付费解锁角色
+// Stars 支付：创建发票链接并返回，真正的解锁在 Webhook 收到 successful_payment 后完成
+// TON 支付：返回转账信息，用户转账后调用 VerifyTonPayment 确认
+// 携带已处理过的 transaction_id 重放时直接返回原结果，不会重复扣款或解锁
 func (h *UnlockHandler) Unlock(c *gin.Context) {
 	user, exists := middleware.GetUserFromContext(c)
 	if !exists {
@@ -182,133 +307,477 @@ func (h *UnlockHandler) Unlock(c *gin.Context) {
 		return
 	}
 
+	var req struct {
+		PaymentMethod string `json:"payment_method" binding:"required"` // "stars" or "ton"
+		TransactionID string `json:"transaction_id"`                    // 外部交易号，用于幂等重放
+		PromoCode     string `json:"promo_code"`                        // 可选优惠码
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, 400, "Invalid request parameters")
+		return
+	}
+	if req.PromoCode == "" {
+		req.PromoCode = c.Query("promo")
+	}
+
+	// 重放已处理的交易：返回原结果
+	if req.TransactionID != "" {
+		payment, err := h.paymentRepo.GetByExternalTxID(req.TransactionID)
+		if err == nil && payment.UserID == user.ID && payment.CharacterID == character.ID {
+			h.respondPaymentResult(c, payment, character)
+			return
+		}
+	}
+
 	// 已完全解锁
 	if character.UnlockStatus == model.UnlockStatusFullUnlocked {
 		response.Error(c, 400, "Character already fully unlocked")
 		return
 	}
 
-	var req struct {
-		PaymentMethod string `json:"payment_method" binding:"required"` // "stars" or "ton"
-		TransactionID string `json:"transaction_id"`                    // 支付凭证（简化处理）
+	switch req.PaymentMethod {
+	case string(model.PaymentMethodStars):
+		h.createStarsInvoice(c, user, character, req.PromoCode)
+	case string(model.PaymentMethodTON):
+		h.createTonPaymentRequest(c, user, character, req.PromoCode)
+	default:
+		response.Error(c, 400, "Unsupported payment method")
 	}
+}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		response.Error(c, 400, "Invalid request parameters")
+// createStarsInvoice 为角色解锁创建待支付记录和 Telegram Stars 发票链接
+// 此时不修改解锁状态，等待 Webhook 的 successful_payment
+func (h *UnlockHandler) createStarsInvoice(c *gin.Context, user *model.User, character *model.Character, promoCode string) {
+	if !starsPaymentsEnabled() {
+		response.Error(c, 503, "Stars payments are not available")
 		return
 	}
 
-	// 计算价格
-	var expectedPrice int
-	if character.UnlockStatus == model.UnlockStatusHalfUnlocked {
-		// 半价
-		if req.PaymentMethod == "stars" {
-			expectedPrice = HalfUnlockPriceStars
-		} else {
-			expectedPrice = HalfUnlockPriceTON
+	starsPayload := func(payment *model.Payment) string {
+		return buildUnlockPayload(character.ID, user.ID, payment.ID)
+	}
+
+	var payment *model.Payment
+	var redemption *model.PromoRedemption
+	var err error
+	if promoCode == "" {
+		payment, err = h.pendingPayment(user.ID, character, model.PaymentMethodStars, starsPayload)
+	} else {
+		var quote *service.PriceQuote
+		quote, err = h.pricing.Quote(character.Type, character.UnlockStatus, model.PaymentMethodStars)
+		if err == nil {
+			payment, redemption, err = h.createPendingPayment(user.ID, character, quote, promoCode)
+		}
+		if err == nil && payment.Amount > 0 {
+			payment.Payload = starsPayload(payment)
+			err = h.paymentRepo.SetPayload(payment.ID, payment.Payload)
+		}
+	}
+	if err != nil {
+		if !respondPromoError(c, err) {
+			response.Error(c, 500, "Failed to create payment: "+err.Error())
 		}
+		return
+	}
+
+	// 优惠码全额抵扣时无需发票，直接解锁
+	if payment.Amount == 0 {
+		h.completeFreeUnlock(c, payment)
+		return
+	}
+
+	// 复用的待支付记录沿用原来的 payload，重新生成的发票链接对应同一条记录
+	link, err := h.botClient.CreateInvoiceLink(c.Request.Context(), service.InvoiceLinkRequest{
+		Title:       fmt.Sprintf("Unlock %s", character.Title),
+		Description: fmt.Sprintf("Reveal the clear portrait and full report of your %s", character.Title),
+		Payload:     payment.Payload,
+		Currency:    service.StarsCurrency,
+		Prices:      []service.LabeledPrice{{Label: "Unlock", Amount: int(payment.Amount)}},
+	})
+	if err != nil {
+		log.Printf("[Unlock] 创建 Stars 发票失败: %v", err)
+		response.Error(c, 502, "Failed to create invoice: "+err.Error())
+		return
+	}
+
+	result := gin.H{
+		"status":        "pending",
+		"payment_id":    payment.ID,
+		"invoice_link":  link,
+		"unlock_status": character.UnlockStatus,
+		"price":         payment.Amount,
+		"currency":      "stars",
+	}
+	if redemption != nil {
+		result["promo_code"] = repository.NormalizePromoCode(promoCode)
+		result["promo_discount"] = redemption.Discount
+	}
+	response.Success(c, result)
+}
+
+// createTonPaymentRequest 返回 TON 转账信息（钱包地址、金额、专属备注）
+// 用户转账后调用 VerifyTonPayment 确认到账
+func (h *UnlockHandler) createTonPaymentRequest(c *gin.Context, user *model.User, character *model.Character, promoCode string) {
+	if !h.tonVerifier.Enabled() {
+		response.Error(c, 503, "TON payments are not available")
+		return
+	}
+
+	var payment *model.Payment
+	var redemption *model.PromoRedemption
+	var err error
+	if promoCode == "" {
+		payment, err = h.pendingPayment(user.ID, character, model.PaymentMethodTON, func(payment *model.Payment) string {
+			return h.tonVerifier.PaymentMemo(payment.ID)
+		})
 	} else {
-		// 全价
-		if req.PaymentMethod == "stars" {
-			expectedPrice = FullUnlockPriceStars
-		} else {
-			expectedPrice = FullUnlockPriceTON
+		var quote *service.PriceQuote
+		quote, err = h.pricing.Quote(character.Type, character.UnlockStatus, model.PaymentMethodTON)
+		if err == nil {
+			payment, redemption, err = h.createPendingPayment(user.ID, character, quote, promoCode)
+		}
+		if err == nil && payment.Amount > 0 && payment.Payload == "" {
+			payment.Payload = h.tonVerifier.PaymentMemo(payment.ID)
+			err = h.paymentRepo.SetPayload(payment.ID, payment.Payload)
+		}
+	}
+	if err != nil {
+		if !respondPromoError(c, err) {
+			response.Error(c, 500, "Failed to create payment: "+err.Error())
+		}
+		return
+	}
+
+	if payment.Amount == 0 {
+		h.completeFreeUnlock(c, payment)
+		return
+	}
+
+	result := gin.H{
+		"status":        "pending",
+		"payment_id":    payment.ID,
+		"unlock_status": character.UnlockStatus,
+		"price":         service.FormatTON(payment.Amount),
+		"currency":      "ton",
+		"wallet":        h.tonVerifier.Wallet(),
+		"amount_nano":   strconv.FormatInt(payment.Amount, 10),
+		"memo":          payment.Payload,
+		"payment_link":  h.tonVerifier.PaymentLink(payment.Payload, payment.Amount),
+	}
+	if redemption != nil {
+		result["promo_code"] = repository.NormalizePromoCode(promoCode)
+		result["promo_discount"] = service.FormatTON(redemption.Discount)
+	}
+	response.Success(c, result)
+}
+
+// createPendingPayment 按报价创建待支付记录
+// 带优惠码时在同一事务中核销优惠码并扣减金额，并发请求不会超出使用次数
+func (h *UnlockHandler) createPendingPayment(userID uint64, character *model.Character, quote *service.PriceQuote, promoCode string) (*model.Payment, *model.PromoRedemption, error) {
+	payment := &model.Payment{
+		UserID:      userID,
+		CharacterID: character.ID,
+		Method:      quote.Currency,
+		Amount:      quote.Amount,
+		Status:      model.PaymentStatusPending,
+
+		PreviousUnlockStatus: character.UnlockStatus,
+	}
+
+	if promoCode == "" {
+		if err := h.paymentRepo.Create(payment); err != nil {
+			return nil, nil, err
 		}
+		return payment, nil, nil
 	}
 
-	// TODO: 实际验证支付（这里简化处理，假设支付成功）
-	// 在生产环境中，应该调用 Telegram Stars API 或 TON 区块链验证支付
+	redemption, err := h.promoRepo.RedeemWithPayment(promoCode, character.Type, payment)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("[Unlock] 使用优惠码 %s: payment=%d, discount=%d", repository.NormalizePromoCode(promoCode), payment.ID, redemption.Discount)
+	return payment, redemption, nil
+}
 
-	// 更新解锁状态为完全解锁
-	if err := h.characterRepo.UpdateUnlockStatus(characterID, model.UnlockStatusFullUnlocked, nil); err != nil {
+// completeFreeUnlock 优惠码抵扣后金额为 0，直接结算并解锁
+func (h *UnlockHandler) completeFreeUnlock(c *gin.Context, payment *model.Payment) {
+	settled, err := h.settlePayment(payment.ID, fmt.Sprintf("promo:%d", payment.ID))
+	if err != nil {
 		response.Error(c, 500, "Failed to unlock: "+err.Error())
 		return
 	}
 
-	// 更新 ImageURL 为清晰图片
-	character.UnlockStatus = model.UnlockStatusFullUnlocked
-	character.ImageURL = character.ClearImageURL
-	if err := h.characterRepo.Update(character); err != nil {
-		response.Error(c, 500, "Failed to update character: "+err.Error())
+	character, err := h.characterRepo.GetByID(settled.CharacterID)
+	if err != nil {
+		response.Error(c, 500, "Failed to get character: "+err.Error())
 		return
 	}
+	h.respondPaymentResult(c, settled, character)
+}
 
-	// 如果报告尚未生成（例如创建时失败），在解锁时异步生成
-	// 注意：这里不会阻塞响应，前端需要处理报告为空的情况（显示加载动画）
-	if character.DescriptionEn == "" {
-		go func(charID uint64, userID uint64) {
-			// 创建新的上下文，因为请求上下文会随请求结束而取消
-			ctx := context.Background()
-			
-			// 重新获取最新数据
-			char, err := h.characterRepo.GetByID(charID)
-			if err != nil {
-				log.Printf("[Unlock] 异步生成报告失败: 获取角色失败 %v", err)
-				return
-			}
-			
-			user, err := h.userRepo.GetByID(userID)
-			if err != nil {
-				log.Printf("[Unlock] 异步生成报告失败: 获取用户失败 %v", err)
-				return
-			}
+// respondPromoError 将优惠码校验错误转换为带错误码的响应，不是优惠码错误时返回 false
+func respondPromoError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, repository.ErrPromoInvalid):
+		response.ErrorWithCode(c, 400, "PROMO_INVALID", "Promo code is invalid")
+	case errors.Is(err, repository.ErrPromoExpired):
+		response.ErrorWithCode(c, 400, "PROMO_EXPIRED", "Promo code has expired")
+	case errors.Is(err, repository.ErrPromoExhausted):
+		response.ErrorWithCode(c, 400, "PROMO_EXHAUSTED", "Promo code has been fully redeemed")
+	case errors.Is(err, repository.ErrPromoUserLimit):
+		response.ErrorWithCode(c, 400, "PROMO_USER_LIMIT", "You have already used this promo code")
+	case errors.Is(err, repository.ErrPromoNotApplicable):
+		response.ErrorWithCode(c, 400, "PROMO_NOT_APPLICABLE", "Promo code does not apply to this character")
+	default:
+		return false
+	}
+	return true
+}
+
+// pendingPayment 获取或创建不带优惠码的待支付记录，payloadOf 生成发票 payload 或转账备注
+// 最近一条待支付记录金额和解锁状态与当前报价一致时复用，重复点击支付不会产生多条待支付记录
+func (h *UnlockHandler) pendingPayment(userID uint64, character *model.Character, method model.PaymentMethod, payloadOf func(*model.Payment) string) (*model.Payment, error) {
+	quote, err := h.pricing.Quote(character.Type, character.UnlockStatus, method)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := h.paymentRepo.GetLatestPending(userID, character.ID, method)
+	if err == nil && existing.Amount == quote.Amount && existing.PreviousUnlockStatus == character.UnlockStatus && existing.Payload != "" {
+		return existing, nil
+	}
+
+	payment, _, err := h.createPendingPayment(userID, character, quote, "")
+	if err != nil {
+		return nil, err
+	}
+
+	payment.Payload = payloadOf(payment)
+	if err := h.paymentRepo.SetPayload(payment.ID, payment.Payload); err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// VerifyTonPayment 查询链上是否已收到该角色的 TON 转账，确认后完全解锁
+func (h *UnlockHandler) VerifyTonPayment(c *gin.Context) {
+	user, exists := middleware.GetUserFromContext(c)
+	if !exists {
+		response.Error(c, 401, "Unauthorized")
+		return
+	}
+
+	idStr := c.Param("id")
+	characterID, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		response.Error(c, 400, "Invalid character ID")
+		return
+	}
+
+	character, err := h.characterRepo.GetByID(characterID)
+	if err != nil {
+		response.Error(c, 404, "Character not found")
+		return
+	}
+
+	// 验证角色属于当前用户
+	if character.UserID != user.ID {
+		response.Error(c, 403, "Access denied")
+		return
+	}
 
-			log.Printf("[Unlock] 开始为角色 %d 补生成报告...", charID)
-			report, err := h.reportService.GenerateMultiLangReport(ctx, user, char)
-			if err != nil {
-				log.Printf("[Unlock] 补生成报告失败: %v", err)
+	if !h.tonVerifier.Enabled() {
+		response.Error(c, 503, "TON payments are not available")
+		return
+	}
+
+	// 角色已解锁时仍然确认待支付的转账：用户可能在解锁前已经转账，需要记录下来供退款处理
+	// 默认确认最近一次创建的转账信息，也可以通过 payment_id 指定
+	var payment *model.Payment
+	if paymentIDStr := c.Query("payment_id"); paymentIDStr != "" {
+		paymentID, err := strconv.ParseUint(paymentIDStr, 10, 64)
+		if err != nil {
+			response.Error(c, 400, "Invalid payment ID")
+			return
+		}
+		payment, err = h.paymentRepo.GetByID(paymentID)
+		if err != nil || payment.UserID != user.ID || payment.CharacterID != character.ID || payment.Method != model.PaymentMethodTON {
+			response.Error(c, 404, "Payment not found")
+			return
+		}
+	} else {
+		payment, err = h.paymentRepo.GetLatestPending(user.ID, character.ID, model.PaymentMethodTON)
+		if err != nil {
+			if character.UnlockStatus == model.UnlockStatusFullUnlocked {
+				response.Error(c, 400, "Character already fully unlocked")
 				return
 			}
+			response.Error(c, 404, "Payment not found")
+			return
+		}
+	}
 
-			// 保存 7 项报告内容
-			char.DescriptionEn = report.DescriptionEn
-			char.DescriptionZh = report.DescriptionZh
-			char.DescriptionRu = report.DescriptionRu
-			char.CareerEn = report.CareerEn
-			char.CareerZh = report.CareerZh
-			char.CareerRu = report.CareerRu
-			char.PersonalityEn = report.PersonalityEn
-			char.PersonalityZh = report.PersonalityZh
-			char.PersonalityRu = report.PersonalityRu
-			char.MeetingTimeEn = report.MeetingTimeEn
-			char.MeetingTimeZh = report.MeetingTimeZh
-			char.MeetingTimeRu = report.MeetingTimeRu
-			char.DistanceEn = report.DistanceEn
-			char.DistanceZh = report.DistanceZh
-			char.DistanceRu = report.DistanceRu
-			char.StrengthEn = report.StrengthEn
-			char.StrengthZh = report.StrengthZh
-			char.StrengthRu = report.StrengthRu
-			char.WeaknessEn = report.WeaknessEn
-			char.WeaknessZh = report.WeaknessZh
-			char.WeaknessRu = report.WeaknessRu
-
-			if err := h.characterRepo.Update(char); err != nil {
-				log.Printf("[Unlock] 保存补生成的报告失败: %v", err)
-			} else {
-				log.Printf("[Unlock] 成功补生成报告")
-			}
-		}(character.ID, user.ID)
+	// 只查询一次链上交易，不在请求内等待：链上确认需要时间，未到账时客户端稍后重试
+	ctx, cancel := context.WithTimeout(c.Request.Context(), tonVerifyTimeout)
+	defer cancel()
+
+	tx, err := h.tonVerifier.FindPayment(ctx, payment.Payload, payment.Amount, payment.CreatedAt)
+	if errors.Is(err, service.ErrTonPaymentNotFound) {
+		response.ErrorWithCodeData(c, 402, "PAYMENT_PENDING", "Payment not found yet, please try again later", gin.H{
+			"status":     "pending",
+			"payment_id": payment.ID,
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("[Unlock] 查询 TON 交易失败: %v", err)
+		response.Error(c, 502, "Failed to verify payment: "+err.Error())
+		return
+	}
+
+	log.Printf("[Unlock] 收到 TON 支付: character=%d, tx=%s, value=%d", character.ID, tx.Hash, tx.ValueNano)
+
+	// 已收款但角色已通过其他方式完全解锁，与 Stars 一样记为 failed 供客服退款
+	character, err = h.characterRepo.GetByID(character.ID)
+	if err != nil {
+		response.Error(c, 500, "Failed to get character: "+err.Error())
+		return
+	}
+	if payment.Status == model.PaymentStatusPending && character.UnlockStatus == model.UnlockStatusFullUnlocked {
+		failed, _, err := h.paymentRepo.Settle(payment.ID, tx.Hash, model.PaymentStatusFailed)
+		if err != nil {
+			response.Error(c, 500, "Failed to record payment: "+err.Error())
+			return
+		}
+		log.Printf("[Unlock] 角色 %d 已解锁，TON 支付 %d 记为 %s", character.ID, failed.ID, failed.Status)
+		response.ErrorWithCodeData(c, 409, "ALREADY_UNLOCKED", "Character already fully unlocked, the payment has been recorded for a refund", gin.H{
+			"payment_id":     failed.ID,
+			"payment_status": failed.Status,
+			"transaction_id": tx.Hash,
+		})
+		return
 	}
 
+	settled, err := h.settlePayment(payment.ID, tx.Hash)
+	if err != nil {
+		response.Error(c, 500, "Failed to unlock: "+err.Error())
+		return
+	}
+
+	character, err = h.characterRepo.GetByID(settled.CharacterID)
+	if err != nil {
+		response.Error(c, 500, "Failed to get character: "+err.Error())
+		return
+	}
+	h.respondPaymentResult(c, settled, character)
+}
+
+// settlePayment 结算支付并完全解锁角色
+// 幂等：交易号已处理过时返回原支付记录，不会重复解锁
+func (h *UnlockHandler) settlePayment(paymentID uint64, externalTxID string) (*model.Payment, error) {
+	payment, settled, err := h.paymentRepo.Settle(paymentID, externalTxID, model.PaymentStatusSucceeded)
+	if err != nil {
+		return nil, err
+	}
+	if !settled {
+		log.Printf("[Unlock] 交易 %s 已处理过 (payment=%d, status=%s)", externalTxID, payment.ID, payment.Status)
+	}
+
+	// 交易号属于其他支付，或该支付已退款/失败时不做解锁
+	if payment.ID != paymentID || payment.Status != model.PaymentStatusSucceeded {
+		return payment, nil
+	}
+
+	// 上次结算后解锁失败（例如 Webhook 重试）时在这里补完
+	character, err := h.characterRepo.GetByID(payment.CharacterID)
+	if err != nil {
+		return nil, err
+	}
+	if character.UnlockStatus != model.UnlockStatusFullUnlocked {
+		if err := h.fulfillFullUnlock(payment); err != nil {
+			return nil, err
+		}
+	}
+	return payment, nil
+}
+
+// respondPaymentResult 返回支付对应的解锁结果
+func (h *UnlockHandler) respondPaymentResult(c *gin.Context, payment *model.Payment, character *model.Character) {
+	applySubscription(h.subscriptionRepo, payment.UserID, character)
 	locale := middleware.GetLocaleFromContext(c)
-	response.Success(c, gin.H{
-		"message":       "解锁成功",
-		"unlock_status": model.UnlockStatusFullUnlocked,
-		"image_url":     character.ClearImageURL,
-		"description":   character.GetDescription(string(locale)),
-		"career":        character.GetCareer(string(locale)),
-		"personality":   character.GetPersonality(string(locale)),
-		"meeting_time":  character.GetMeetingTime(string(locale)),
-		"distance":      character.GetDistance(string(locale)),
-		"strength":      character.GetStrength(string(locale)),
-		"weakness":      character.GetWeakness(string(locale)),
-		"price_paid":    expectedPrice,
-		"currency":      req.PaymentMethod,
+	result := characterResponse(character, string(locale))
+	result["message"] = "解锁成功"
+	result["payment_id"] = payment.ID
+	result["payment_status"] = payment.Status
+	result["price_paid"] = paymentDisplayAmount(payment)
+	result["currency"] = payment.Method
+	if payment.ExternalTxID != nil {
+		result["transaction_id"] = *payment.ExternalTxID
+	}
+	response.Success(c, result)
+}
+
+// paymentDisplayAmount 将支付金额转换为展示单位（TON 以 nanoTON 存储）
+func paymentDisplayAmount(payment *model.Payment) interface{} {
+	if payment.Method == model.PaymentMethodTON {
+		return service.FormatTON(payment.Amount)
+	}
+	return payment.Amount
+}
+
+// fulfillFullUnlock 将支付对应的角色置为完全解锁（同时切换为清晰图片），报告缺失时异步补生成
+func (h *UnlockHandler) fulfillFullUnlock(payment *model.Payment) error {
+	userID := payment.UserID
+	paymentID := payment.ID
+	character, err := h.stateMachine.Transition(service.UnlockTransition{
+		CharacterID: payment.CharacterID,
+		To:          model.UnlockStatusFullUnlocked,
+		ActorType:   model.UnlockActorPayment,
+		ActorID:     &userID,
+		Reason:      fmt.Sprintf("%s payment", payment.Method),
+		PaymentID:   &paymentID,
 	})
+	if errors.Is(err, service.ErrInvalidUnlockTransition) {
+		// 并发结算时已被另一个请求解锁
+		log.Printf("[Unlock] 支付 %d: %v", payment.ID, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// 如果报告尚未生成（例如创建时失败），在解锁时异步生成
+	// 注意：这里不会阻塞响应，前端需要处理报告为空的情况（显示加载动画）
+	if character.DescriptionEn == "" {
+		h.generateReportAsync(character.ID, character.UserID, "Unlock")
+	}
+	return nil
+}
+
+// buildUnlockPayload 生成发票 payload，将支付绑定到具体角色、用户和支付记录
+func buildUnlockPayload(characterID, userID, paymentID uint64) string {
+	return fmt.Sprintf("%s:%d:%d:%d", unlockPayloadPrefix, characterID, userID, paymentID)
+}
+
+// parseUnlockPayload 解析发票 payload
+func parseUnlockPayload(payload string) (characterID uint64, userID uint64, paymentID uint64, err error) {
+	parts := strings.Split(payload, ":")
+	if len(parts) != 4 || parts[0] != unlockPayloadPrefix {
+		return 0, 0, 0, fmt.Errorf("invalid unlock payload: %q", payload)
+	}
+	ids := make([]uint64, 3)
+	for i, part := range parts[1:] {
+		ids[i], err = strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid id in payload: %v", err)
+		}
+	}
+	return ids[0], ids[1], ids[2], nil
 }
 
 // GetUnlockPrice 获取解锁价格
+// 支持 ?promo= 预览优惠码折扣（只校验不核销，真正核销在 Unlock 中完成）
 func (h *UnlockHandler) GetUnlockPrice(c *gin.Context) {
 	idStr := c.Param("id")
 	characterID, err := strconv.ParseUint(idStr, 10, 64)
@@ -323,31 +792,78 @@ func (h *UnlockHandler) GetUnlockPrice(c *gin.Context) {
 		return
 	}
 
-	var priceStars, priceTON int
-	var priceType string
+	if character.UnlockStatus == model.UnlockStatusFullUnlocked {
+		response.Success(c, gin.H{
+			"unlock_status": character.UnlockStatus,
+			"price_type":    "free",
+			"price_stars":   0,
+			"price_ton":     0,
+			"price_display": "0 Stars / 0 TON",
+		})
+		return
+	}
+
+	starsQuote, err := h.pricing.Quote(character.Type, character.UnlockStatus, model.PaymentMethodStars)
+	if err != nil {
+		response.Error(c, 500, "Failed to get price: "+err.Error())
+		return
+	}
+	tonQuote, err := h.pricing.Quote(character.Type, character.UnlockStatus, model.PaymentMethodTON)
+	if err != nil {
+		response.Error(c, 500, "Failed to get price: "+err.Error())
+		return
+	}
 
-	switch character.UnlockStatus {
-	case model.UnlockStatusFullUnlocked:
-		priceStars = 0
-		priceTON = 0
-		priceType = "free"
-	case model.UnlockStatusHalfUnlocked:
-		priceStars = HalfUnlockPriceStars
-		priceTON = HalfUnlockPriceTON
+	priceType := "full"
+	if starsQuote.Tier == service.PriceTierHalf {
 		priceType = "discounted"
-	default:
-		priceStars = FullUnlockPriceStars
-		priceTON = FullUnlockPriceTON
-		priceType = "full"
 	}
 
-	response.Success(c, gin.H{
+	var promo *model.PromoCode
+	if promoCode := c.Query("promo"); promoCode != "" {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			response.Error(c, 401, "Unauthorized")
+			return
+		}
+		promo, err = h.promoRepo.CheckPromo(promoCode, user.ID, character.Type)
+		if err != nil {
+			if !respondPromoError(c, err) {
+				response.Error(c, 500, "Failed to check promo code: "+err.Error())
+			}
+			return
+		}
+	}
+
+	priceStars := starsQuote.Amount
+	priceNano := tonQuote.Amount
+	if promo != nil {
+		priceStars -= promo.Discount(model.PaymentMethodStars, priceStars)
+		priceNano -= promo.Discount(model.PaymentMethodTON, priceNano)
+	}
+
+	priceTON := service.FormatTON(priceNano)
+	result := gin.H{
 		"unlock_status": character.UnlockStatus,
 		"price_type":    priceType,
 		"price_stars":   priceStars,
 		"price_ton":     priceTON,
-		"price_display": fmt.Sprintf("%d Stars / %d TON", priceStars, priceTON),
-	})
+		"price_display": fmt.Sprintf("%d Stars / %s TON", priceStars, strconv.FormatFloat(priceTON, 'f', -1, 64)),
+	}
+	if starsQuote.Sale != "" || tonQuote.Sale != "" {
+		result["sale"] = starsQuote.Sale
+	}
+	if starsQuote.Sale != "" || tonQuote.Sale != "" || promo != nil {
+		result["original_price_stars"] = starsQuote.BaseAmount
+		result["original_price_ton"] = service.FormatTON(tonQuote.BaseAmount)
+	}
+	if promo != nil {
+		result["promo_code"] = promo.Code
+		result["promo_discount_stars"] = starsQuote.Amount - priceStars
+		result["promo_discount_ton"] = service.FormatTON(tonQuote.Amount - priceNano)
+	}
+
+	response.Success(c, result)
 }
 
 // RetryReport 手动触发重新生成报告
@@ -377,64 +893,22 @@ func (h *UnlockHandler) RetryReport(c *gin.Context) {
 		return
 	}
 
-	// 只有完全解锁且报告为空时才允许重试
-	if character.UnlockStatus != model.UnlockStatusFullUnlocked {
+	// 只有完全解锁（含订阅有效期内）时才允许重试
+	applySubscription(h.subscriptionRepo, user.ID, character)
+	if character.EffectiveUnlockStatus() != model.UnlockStatusFullUnlocked {
 		response.Error(c, 400, "Character not unlocked yet")
 		return
 	}
 
 	// 异步生成报告
-	go func(charID uint64, userID uint64) {
-		ctx := context.Background()
-		
-		char, err := h.characterRepo.GetByID(charID)
-		if err != nil {
-			log.Printf("[Retry] 获取角色失败: %v", err)
-			return
-		}
-		
-		u, err := h.userRepo.GetByID(userID)
-		if err != nil {
-			log.Printf("[Retry] 获取用户失败: %v", err)
-			return
-		}
-
-		log.Printf("[Retry] 开始重试生成报告 %d...", charID)
-		report, err := h.reportService.GenerateMultiLangReport(ctx, u, char)
-		if err != nil {
-			log.Printf("[Retry] 生成报告失败: %v", err)
-			return
-		}
-
-		// 保存 7 项报告内容
-		char.DescriptionEn = report.DescriptionEn
-		char.DescriptionZh = report.DescriptionZh
-		char.DescriptionRu = report.DescriptionRu
-		char.CareerEn = report.CareerEn
-		char.CareerZh = report.CareerZh
-		char.CareerRu = report.CareerRu
-		char.PersonalityEn = report.PersonalityEn
-		char.PersonalityZh = report.PersonalityZh
-		char.PersonalityRu = report.PersonalityRu
-		char.MeetingTimeEn = report.MeetingTimeEn
-		char.MeetingTimeZh = report.MeetingTimeZh
-		char.MeetingTimeRu = report.MeetingTimeRu
-		char.DistanceEn = report.DistanceEn
-		char.DistanceZh = report.DistanceZh
-		char.DistanceRu = report.DistanceRu
-		char.StrengthEn = report.StrengthEn
-		char.StrengthZh = report.StrengthZh
-		char.StrengthRu = report.StrengthRu
-		char.WeaknessEn = report.WeaknessEn
-		char.WeaknessZh = report.WeaknessZh
-		char.WeaknessRu = report.WeaknessRu
-
-		if err := h.characterRepo.Update(char); err != nil {
-			log.Printf("[Retry] 保存报告失败: %v", err)
-		} else {
-			log.Printf("[Retry] 报告生成成功")
-		}
-	}(character.ID, user.ID)
+	h.generateReportAsync(character.ID, user.ID, "Retry")
 
 	response.Success(c, gin.H{"message": "Report generation started"})
 }
+
+// generateReportAsync 将报告生成加入持久化任务队列，失败会自动重试，同一角色不会重复生成
+func (h *UnlockHandler) generateReportAsync(characterID uint64, userID uint64, tag string) {
+	if err := h.reportJobs.Enqueue(characterID, userID, tag); err != nil {
+		log.Printf("[%s] 报告任务入队失败: %v", tag, err)
+	}
+}
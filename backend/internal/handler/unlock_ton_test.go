@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"lauraai-backend/internal/config"
+	"lauraai-backend/internal/middleware"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stubTonChain 返回固定交易列表的模拟链，不翻页
+type stubTonChain struct {
+	transactions []service.TonTransaction
+}
+
+func (s *stubTonChain) GetTransactions(ctx context.Context, address string, limit int, lt string, hash string) ([]service.TonTransaction, error) {
+	if lt != "" {
+		return nil, nil
+	}
+	return s.transactions, nil
+}
+
+// tonTestEnv TON 支付测试环境：一个用户、一个未解锁的角色和一笔待支付的 TON 转账
+type tonTestEnv struct {
+	unlock    *UnlockHandler
+	chain     *stubTonChain
+	user      *model.User
+	character *model.Character
+	payment   *model.Payment
+}
+
+func newTonTestEnv(t *testing.T) *tonTestEnv {
+	t.Helper()
+	setupHandlerTest(t)
+	config.AppConfig.TonWalletAddress = "EQwallet"
+	config.AppConfig.TonMemoSecret = "memo-secret"
+	pricing, err := service.NewPricingService()
+	if err != nil {
+		t.Fatalf("pricing: %v", err)
+	}
+
+	env := &tonTestEnv{
+		unlock: NewUnlockHandler(nil, pricing),
+		chain:  &stubTonChain{},
+		user:   createTestUser(t, 2001, "Bob"),
+	}
+	env.unlock.tonVerifier = service.NewTonPaymentVerifier(env.chain)
+	env.character = createTestCharacter(t, env.user, model.UnlockStatusLocked)
+
+	c, w := testContext(http.MethodPost, "/", "")
+	env.unlock.createTonPaymentRequest(c, env.user, env.character, "")
+	var data struct {
+		PaymentID uint64 `json:"payment_id"`
+		Memo      string `json:"memo"`
+	}
+	if resp := decodeResponse(t, w, &data); resp.Code != 0 {
+		t.Fatalf("createTonPaymentRequest failed: %+v", resp)
+	}
+	env.payment, err = repository.NewPaymentRepository().GetByID(data.PaymentID)
+	if err != nil {
+		t.Fatalf("payment not created: %v", err)
+	}
+	if env.payment.Payload != data.Memo || data.Memo != env.unlock.tonVerifier.PaymentMemo(env.payment.ID) {
+		t.Fatalf("memo %q does not match payment %+v", data.Memo, env.payment)
+	}
+	return env
+}
+
+// pay 在模拟链上放入与待支付记录匹配的转账
+func (env *tonTestEnv) pay(hash string) {
+	env.chain.transactions = append(env.chain.transactions, service.TonTransaction{
+		Hash:      hash,
+		LT:        "100",
+		Utime:     time.Now().Unix(),
+		Source:    "EQpayer",
+		ValueNano: env.payment.Amount,
+		Comment:   env.payment.Payload,
+	})
+}
+
+// verify 调用 VerifyTonPayment
+func (env *tonTestEnv) verify(t *testing.T) testResponse {
+	t.Helper()
+	c, w := testContext(http.MethodPost, "/", "")
+	c.Set(middleware.UserContextKey, env.user)
+	c.Params = gin.Params{{Key: "id", Value: strconv.FormatUint(env.character.ID, 10)}}
+	env.unlock.VerifyTonPayment(c)
+	return decodeResponse(t, w, nil)
+}
+
+func TestVerifyTonPayment(t *testing.T) {
+	env := newTonTestEnv(t)
+	env.pay("tx-ton-1")
+
+	if resp := env.verify(t); resp.Code != 0 {
+		t.Fatalf("VerifyTonPayment failed: %+v", resp)
+	}
+	if got := reloadCharacter(t, env.character.ID).UnlockStatus; got != model.UnlockStatusFullUnlocked {
+		t.Errorf("unlock status = %v, want full unlocked", got)
+	}
+	payment, _ := repository.NewPaymentRepository().GetByID(env.payment.ID)
+	if payment.Status != model.PaymentStatusSucceeded || payment.ExternalTxID == nil || *payment.ExternalTxID != "tx-ton-1" {
+		t.Errorf("payment = %+v", payment)
+	}
+
+	// 再次确认同一笔转账不会重复处理
+	if resp := env.verify(t); resp.Code != 400 {
+		t.Errorf("second verify: %+v", resp)
+	}
+}
+
+func TestVerifyTonPaymentAlreadyUnlocked(t *testing.T) {
+	env := newTonTestEnv(t)
+	env.pay("tx-ton-2")
+
+	// 转账期间角色已通过其他方式完全解锁
+	if err := repository.DB.Model(&model.Character{}).Where("id = ?", env.character.ID).
+		Update("unlock_status", model.UnlockStatusFullUnlocked).Error; err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+
+	resp := env.verify(t)
+	if resp.Code != 409 || resp.ErrorCode != "ALREADY_UNLOCKED" {
+		t.Fatalf("response = %+v, want 409 ALREADY_UNLOCKED", resp)
+	}
+	payment, _ := repository.NewPaymentRepository().GetByID(env.payment.ID)
+	if payment.Status != model.PaymentStatusFailed || payment.ExternalTxID == nil || *payment.ExternalTxID != "tx-ton-2" {
+		t.Errorf("payment should be recorded as failed for a refund: %+v", payment)
+	}
+}
+
+func TestVerifyTonPaymentPending(t *testing.T) {
+	env := newTonTestEnv(t)
+
+	// 还没有到账时立即返回，不在请求内等待
+	start := time.Now()
+	resp := env.verify(t)
+	if resp.Code != 402 || resp.ErrorCode != "PAYMENT_PENDING" {
+		t.Fatalf("response = %+v, want 402 PAYMENT_PENDING", resp)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("verify blocked for %v", elapsed)
+	}
+
+	// 到账后再次确认即可解锁
+	env.pay("tx-ton-3")
+	if resp := env.verify(t); resp.Code != 0 {
+		t.Fatalf("VerifyTonPayment failed: %+v", resp)
+	}
+	if got := reloadCharacter(t, env.character.ID).UnlockStatus; got != model.UnlockStatusFullUnlocked {
+		t.Errorf("unlock status = %v, want full unlocked", got)
+	}
+}
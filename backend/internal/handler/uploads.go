@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"lauraai-backend/internal/config"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/storage"
+	"lauraai-backend/pkg/response"
+	"lauraai-backend/pkg/signedurl"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadFilenamePattern 生成图片的文件名格式，拒绝目录穿越等非法路径
+var uploadFilenamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+\.[A-Za-z0-9]+$`)
+
+type UploadsHandler struct {
+	characterRepo    *repository.CharacterRepository
+	subscriptionRepo *repository.SubscriptionRepository
+}
+
+func NewUploadsHandler() *UploadsHandler {
+	return &UploadsHandler{
+		characterRepo:    repository.NewCharacterRepository(),
+		subscriptionRepo: repository.NewSubscriptionRepository(),
+	}
+}
+
+// Serve 提供生成图片的访问
+// 完全模糊图公开访问并允许缓存（用于分享预览）
+// 半模糊图和清晰图必须携带有效的签名参数（exp、sig），并且角色当前的解锁状态允许查看
+func (h *UploadsHandler) Serve(c *gin.Context) {
+	filename := c.Param("filename")
+	if !uploadFilenamePattern.MatchString(filename) {
+		response.ErrorWithStatus(c, 404, 404, "Not found")
+		return
+	}
+	path := storage.URLPrefix + filename
+
+	character, err := h.characterRepo.GetByImageKey(filename)
+	if err != nil {
+		response.ErrorWithStatus(c, 404, 404, "Not found")
+		return
+	}
+
+	variant := imageVariantOf(character, filename)
+	if variant == imageVariantFullBlur {
+		h.serveImage(c, filename, "public, max-age=86400")
+		return
+	}
+
+	expiresAt, err := signedurl.Verify(path, c.Query("exp"), c.Query("sig"), config.AppConfig.ImageURLSecret, time.Now())
+	if err != nil {
+		response.ErrorWithStatus(c, 403, 403, "Forbidden")
+		return
+	}
+
+	// 签名之后角色可能被退款重新锁定，访问时按当前解锁状态再检查一次
+	applySubscription(h.subscriptionRepo, character.UserID, character)
+	status := character.EffectiveUnlockStatus()
+	allowed := false
+	switch variant {
+	case imageVariantClear:
+		allowed = status == model.UnlockStatusFullUnlocked
+	case imageVariantHalfBlur:
+		allowed = status != model.UnlockStatusLocked
+	}
+	if !allowed {
+		log.Printf("[Uploads] 拒绝访问角色 %d 的 %s 图片（解锁状态 %d）", character.ID, variant, status)
+		response.ErrorWithStatus(c, 403, 403, "Forbidden")
+		return
+	}
+
+	maxAge := int(time.Until(expiresAt).Seconds())
+	h.serveImage(c, filename, fmt.Sprintf("private, max-age=%d", maxAge))
+}
+
+// serveImage 从图片存储读取并返回图片
+func (h *UploadsHandler) serveImage(c *gin.Context, key string, cacheControl string) {
+	reader, info, err := storage.Images.Get(c.Request.Context(), key)
+	if errors.Is(err, storage.ErrImageNotFound) {
+		response.ErrorWithStatus(c, 404, 404, "Not found")
+		return
+	}
+	if err != nil {
+		log.Printf("[Uploads] 读取图片 %s 失败: %v", key, err)
+		response.ErrorWithStatus(c, 500, 500, "Failed to read image")
+		return
+	}
+	defer reader.Close()
+
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.DataFromReader(200, info.Size, contentType, reader, map[string]string{
+		"Cache-Control": cacheControl,
+		"Last-Modified": info.LastModified.UTC().Format(http.TimeFormat),
+	})
+}
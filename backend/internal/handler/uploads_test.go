@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useLocalImageStore 测试期间使用临时目录作为图片存储，写入角色的三张图片
+func useLocalImageStore(t *testing.T, keys ...string) {
+	t.Helper()
+	store, err := storage.NewLocalImageStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("local store: %v", err)
+	}
+	previous := storage.Images
+	storage.Images = store
+	t.Cleanup(func() { storage.Images = previous })
+	for _, key := range keys {
+		if err := store.Put(context.Background(), key, []byte("image "+key), "image/png"); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+}
+
+// serveUpload 请求 /uploads/<filename>，rawURL 为带签名参数的访问路径
+func serveUpload(h *UploadsHandler, filename string, rawURL string) int {
+	c, w := testContext(http.MethodGet, rawURL, "")
+	c.Params = gin.Params{{Key: "filename", Value: filename}}
+	h.Serve(c)
+	return w.Code
+}
+
+func TestServeUploadsExactKey(t *testing.T) {
+	setupHandlerTest(t)
+	useLocalImageStore(t, "full.png", "half.png", "clear.png", "xfull.png")
+	h := NewUploadsHandler()
+	owner := createTestUser(t, 4001, "Owner")
+	character := createTestCharacter(t, owner, model.UnlockStatusLocked)
+
+	if code := serveUpload(h, "full.png", "/uploads/full.png"); code != 200 {
+		t.Errorf("full blur image: %d, want 200", code)
+	}
+	// 只按完整 key 匹配，文件名后缀相同的图片不属于该角色
+	if code := serveUpload(h, "xfull.png", "/uploads/xfull.png"); code != 404 {
+		t.Errorf("unrelated image with the same suffix: %d, want 404", code)
+	}
+
+	// 清晰图需要签名，并且按当前解锁状态检查
+	if code := serveUpload(h, "clear.png", "/uploads/clear.png"); code != 403 {
+		t.Errorf("unsigned clear image: %d, want 403", code)
+	}
+	signed := signImageURL(character.ClearImageURL)
+	if code := serveUpload(h, "clear.png", signed); code != 403 {
+		t.Errorf("signed clear image of a locked character: %d, want 403", code)
+	}
+	repository.DB.Model(character).Update("unlock_status", model.UnlockStatusFullUnlocked)
+	if code := serveUpload(h, "clear.png", signed); code != 200 {
+		t.Errorf("signed clear image of an unlocked character: %d, want 200", code)
+	}
+
+	// 签名绑定路径，不能用于其他图片
+	u, _ := url.Parse(signed)
+	if code := serveUpload(h, "half.png", "/uploads/half.png?"+u.RawQuery); code != 403 {
+		t.Errorf("signature reused for another image: %d, want 403", code)
+	}
+}
+
+func TestServeUploadsAliasedKey(t *testing.T) {
+	setupHandlerTest(t)
+	useLocalImageStore(t, "clear.png")
+	h := NewUploadsHandler()
+	owner := createTestUser(t, 4002, "Owner")
+	character := createTestCharacter(t, owner, model.UnlockStatusLocked)
+
+	// 旧数据中模糊图字段指向清晰图时，仍然按清晰图要求签名和解锁
+	repository.DB.Model(character).Updates(map[string]any{"full_blur_image_key": "clear.png", "half_blur_image_key": "clear.png"})
+	if code := serveUpload(h, "clear.png", "/uploads/clear.png"); code != 403 {
+		t.Errorf("unsigned aliased clear image: %d, want 403", code)
+	}
+}
+
+func TestBackfillImageKeys(t *testing.T) {
+	setupHandlerTest(t)
+	owner := createTestUser(t, 4101, "Owner")
+	legacy := &model.Character{
+		UserID:           owner.ID,
+		Type:             model.CharacterTypeSoulmate,
+		FullBlurImageURL: "https://api.example.com/uploads/legacy-full.jpg",
+		HalfBlurImageURL: "/uploads/legacy-half.jpg",
+		ClearImageURL:    "/uploads/legacy-clear.jpg",
+		ShareCode:        repository.GenerateShareCode(),
+	}
+	if err := repository.DB.Create(legacy).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	if err := repository.BackfillImageKeys(); err != nil {
+		t.Fatalf("backfill: %v", err)
+	}
+	found, err := repository.NewCharacterRepository().GetByImageKey("legacy-full.jpg")
+	if err != nil || found.ID != legacy.ID {
+		t.Fatalf("GetByImageKey after backfill: %v", err)
+	}
+	if imageVariantOf(found, "legacy-clear.jpg") != imageVariantClear {
+		t.Errorf("clear key = %q", found.ClearImageKey)
+	}
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"lauraai-backend/internal/middleware"
+	"lauraai-backend/internal/service"
+	"lauraai-backend/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UsageHandler 查看每日对话用量
+type UsageHandler struct {
+	quotaService *service.QuotaService
+}
+
+func NewUsageHandler(quotaService *service.QuotaService) *UsageHandler {
+	return &UsageHandler{quotaService: quotaService}
+}
+
+// Get 获取当前用户今天（UTC）的回复条数、token 用量、额度和重置时间
+func (h *UsageHandler) Get(c *gin.Context) {
+	user, exists := middleware.GetUserFromContext(c)
+	if !exists {
+		response.Error(c, 401, "Unauthorized")
+		return
+	}
+
+	status, err := h.quotaService.Status(user.ID)
+	if err != nil {
+		response.Error(c, 500, "Failed to query usage: "+err.Error())
+		return
+	}
+	response.Success(c, status)
+}
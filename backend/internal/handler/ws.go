@@ -0,0 +1,390 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"lauraai-backend/internal/i18n"
+	"lauraai-backend/internal/middleware"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/ratelimit"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/service"
+	"lauraai-backend/pkg/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteTimeout   = 10 * time.Second
+	wsPongTimeout    = 60 * time.Second
+	wsPingInterval   = 25 * time.Second
+	wsMaxMessageSize = 16 * 1024
+	// wsSendBuffer 每个连接待发送消息的缓冲，写满说明客户端读得太慢，断开连接
+	wsSendBuffer = 256
+)
+
+// WebSocket 消息类型，每条消息为带 type 字段的 JSON 对象
+const (
+	// 客户端 → 服务端
+	wsTypeChat   = "chat"   // 发送消息 {request_id, character_id, message}
+	wsTypeCancel = "cancel" // 取消生成 {stream_id}
+	wsTypeResume = "resume" // 断线重连后继续接收 {stream_id, offset}
+	wsTypeTyping = "typing" // 用户正在输入 {character_id}，转发给该用户的其他连接
+
+	// 服务端 → 客户端（另有与 SSE 相同的 message_start、delta、message_end、error）
+	wsTypeReady    = "ready"    // 连接建立 {streams: 进行中的生成}
+	wsTypePresence = "presence" // 用户的在线连接数变化 {connections}
+)
+
+// 请求错误的错误码，生成过程中的错误码见 service.ReplyError*
+const (
+	wsErrorBadRequest     = "bad_request"
+	wsErrorNotFound       = "not_found"
+	wsErrorStreamNotFound = "stream_not_found"
+	wsErrorSaveFailed     = "save_failed"
+	wsErrorRateLimited    = "rate_limited" // 发送过于频繁，retry_after 为需要等待的秒数
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	// 与 HTTP 接口一致允许任意来源，身份由 Telegram initData 验证
+	CheckOrigin: func(r *http.Request) bool { return true },
+	// 客户端通过认证子协议传递 initData 时需要选中该子协议，否则浏览器会关闭连接
+	Subprotocols: []string{middleware.WSAuthProtocol},
+}
+
+// wsInbound 客户端发送的消息
+type wsInbound struct {
+	Type        string `json:"type"`
+	RequestID   string `json:"request_id"`
+	CharacterID uint64 `json:"character_id"`
+	Message     string `json:"message"`
+	StreamID    string `json:"stream_id"`
+	Offset      int    `json:"offset"`
+}
+
+// wsConn 一个 WebSocket 连接，所有写入经由 send 通道交给写协程
+type wsConn struct {
+	user   *model.User
+	locale i18n.Locale
+	conn   *websocket.Conn
+	send   chan []byte
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Send 发送一条消息，连接已关闭时丢弃
+func (c *wsConn) Send(msgType string, data gin.H) {
+	msg := gin.H{"type": msgType}
+	for k, v := range data {
+		msg[k] = v
+	}
+	c.sendJSON(msg)
+}
+
+// sendJSON 编码并发送一条完整的消息（需包含 type 字段）
+func (c *wsConn) sendJSON(msg any) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("[WS] 编码消息失败: %v", err)
+		return
+	}
+
+	select {
+	case c.send <- payload:
+	case <-c.ctx.Done():
+	default:
+		log.Printf("[WS] 用户 %d 的连接发送缓冲已满，断开连接", c.user.ID)
+		c.cancel()
+	}
+}
+
+// writeLoop 发送消息和心跳，连接结束后关闭底层连接
+func (c *wsConn) writeLoop() {
+	ticker := time.NewTicker(wsPingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case payload := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := c.conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				c.cancel()
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.cancel()
+				return
+			}
+		case <-c.ctx.Done():
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		}
+	}
+}
+
+// wsHub 按用户登记在线连接，用于推送输入状态和在线状态
+type wsHub struct {
+	mu    sync.Mutex
+	conns map[uint64]map[*wsConn]struct{}
+}
+
+func (h *wsHub) add(c *wsConn) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conns[c.user.ID] == nil {
+		h.conns[c.user.ID] = make(map[*wsConn]struct{})
+	}
+	h.conns[c.user.ID][c] = struct{}{}
+	return len(h.conns[c.user.ID])
+}
+
+func (h *wsHub) remove(c *wsConn) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.conns[c.user.ID], c)
+	n := len(h.conns[c.user.ID])
+	if n == 0 {
+		delete(h.conns, c.user.ID)
+	}
+	return n
+}
+
+// broadcast 发送给用户的所有连接，except 不为空时跳过该连接
+func (h *wsHub) broadcast(userID uint64, msgType string, data gin.H, except *wsConn) {
+	h.mu.Lock()
+	targets := make([]*wsConn, 0, len(h.conns[userID]))
+	for c := range h.conns[userID] {
+		if c != except {
+			targets = append(targets, c)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, c := range targets {
+		c.Send(msgType, data)
+	}
+}
+
+// WSHandler WebSocket 对话：一个连接可以与用户的任意角色对话、接收输入状态和在线状态、取消生成，
+// 断线重连后可以从收到的最后位置继续接收回复
+type WSHandler struct {
+	characterRepo *repository.CharacterRepository
+	messageRepo   *repository.MessageRepository
+	replyService  *service.ReplyService
+	limiter       *ratelimit.Limiter
+	hub           *wsHub
+}
+
+func NewWSHandler(replyService *service.ReplyService, limiter *ratelimit.Limiter) *WSHandler {
+	return &WSHandler{
+		characterRepo: repository.NewCharacterRepository(),
+		messageRepo:   repository.NewMessageRepository(),
+		replyService:  replyService,
+		limiter:       limiter,
+		hub:           &wsHub{conns: make(map[uint64]map[*wsConn]struct{})},
+	}
+}
+
+// Connect 建立 WebSocket 连接，浏览器无法设置请求头，initData 通过 Sec-WebSocket-Protocol 传递（见 middleware.WSAuthProtocol）
+func (h *WSHandler) Connect(c *gin.Context) {
+	user, exists := middleware.GetUserFromContext(c)
+	if !exists {
+		response.Error(c, 401, "Unauthorized")
+		return
+	}
+
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade 已写入错误响应
+		log.Printf("[WS] 升级连接失败: %v", err)
+		return
+	}
+
+	// 连接的生命周期与 HTTP 请求无关
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &wsConn{
+		user:   user,
+		locale: middleware.GetLocaleFromContext(c),
+		conn:   conn,
+		send:   make(chan []byte, wsSendBuffer),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	go client.writeLoop()
+
+	streams := []gin.H{}
+	for _, g := range h.replyService.Active(user.ID) {
+		streams = append(streams, gin.H{
+			"stream_id":       g.ID,
+			"character_id":    g.CharacterID,
+			"user_message_id": g.UserMessageID,
+		})
+	}
+	client.Send(wsTypeReady, gin.H{"streams": streams})
+
+	n := h.hub.add(client)
+	h.hub.broadcast(user.ID, wsTypePresence, gin.H{"connections": n}, nil)
+	log.Printf("[WS] 用户 %d 已连接（%d 个连接）", user.ID, n)
+
+	h.readLoop(client)
+
+	cancel()
+	n = h.hub.remove(client)
+	h.hub.broadcast(user.ID, wsTypePresence, gin.H{"connections": n}, nil)
+	log.Printf("[WS] 用户 %d 已断开（剩余 %d 个连接）", user.ID, n)
+}
+
+// readLoop 读取并处理客户端消息，直到连接断开
+func (h *WSHandler) readLoop(client *wsConn) {
+	conn := client.conn
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	for {
+		var msg wsInbound
+		if err := conn.ReadJSON(&msg); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				client.Send(sseEventError, gin.H{"code": wsErrorBadRequest, "message": "Invalid message"})
+				continue
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+
+		switch msg.Type {
+		case wsTypeChat:
+			h.chat(client, msg)
+		case wsTypeCancel:
+			if g, ok := h.replyService.Get(client.user.ID, msg.StreamID); ok {
+				g.Cancel()
+			} else {
+				client.Send(sseEventError, gin.H{"stream_id": msg.StreamID, "code": wsErrorStreamNotFound, "message": "Stream not found"})
+			}
+		case wsTypeResume:
+			if g, ok := h.replyService.Get(client.user.ID, msg.StreamID); ok {
+				go h.follow(client, g, msg.Offset, msg.RequestID)
+			} else {
+				client.Send(sseEventError, gin.H{"request_id": msg.RequestID, "stream_id": msg.StreamID, "code": wsErrorStreamNotFound, "message": "Stream not found"})
+			}
+		case wsTypeTyping:
+			h.hub.broadcast(client.user.ID, wsTypeTyping, gin.H{"character_id": msg.CharacterID, "sender": model.SenderTypeUser}, client)
+		default:
+			client.Send(sseEventError, gin.H{"request_id": msg.RequestID, "code": wsErrorBadRequest, "message": "Unknown message type"})
+		}
+	}
+}
+
+// chat 保存用户消息并开始生成回复
+// 生成与连接无关，断线后继续进行，重连后可以通过 resume 继续接收
+func (h *WSHandler) chat(client *wsConn, msg wsInbound) {
+	text := strings.TrimSpace(msg.Message)
+	if text == "" {
+		client.Send(sseEventError, gin.H{"request_id": msg.RequestID, "code": wsErrorBadRequest, "message": "Message is required"})
+		return
+	}
+
+	character, err := h.characterRepo.GetByID(msg.CharacterID)
+	if err != nil || character.UserID != client.user.ID {
+		client.Send(sseEventError, gin.H{"request_id": msg.RequestID, "code": wsErrorNotFound, "message": "Character not found"})
+		return
+	}
+
+	// 与 HTTP 发送消息共用限流
+	if result := h.limiter.Allow(client.ctx, ratelimit.GroupChat, client.user.ID); !result.Allowed {
+		client.Send(sseEventError, gin.H{"request_id": msg.RequestID, "code": wsErrorRateLimited, "message": "Too many requests, please try again later", "retry_after": middleware.RetryAfterSeconds(result)})
+		return
+	}
+
+	quota, err := h.replyService.ReserveQuota(client.user.ID)
+	if err != nil {
+		var quotaErr *service.QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			client.Send(sseEventError, gin.H{"request_id": msg.RequestID, "code": service.ErrorCodeQuotaExceeded, "message": "Daily chat quota exceeded", "quota": quotaErr.Status})
+			return
+		}
+		client.Send(sseEventError, gin.H{"request_id": msg.RequestID, "code": service.ReplyErrorGenerationFailed, "message": "Failed to check quota"})
+		return
+	}
+
+	userMessage, history, err := saveUserTurn(h.messageRepo, character, text)
+	if err != nil {
+		h.replyService.ReleaseQuota(quota)
+		client.Send(sseEventError, gin.H{"request_id": msg.RequestID, "code": wsErrorSaveFailed, "message": "Failed to save message"})
+		return
+	}
+
+	generation := h.replyService.Start(context.Background(), service.ReplyRequest{
+		Character: character,
+		History:   history,
+		Prompt:    userMessage,
+		Locale:    client.locale,
+		Quota:     quota,
+	})
+
+	// 角色输入状态推送给用户的所有连接
+	h.hub.broadcast(client.user.ID, wsTypeTyping, gin.H{"character_id": character.ID, "sender": model.SenderTypeCharacter, "typing": true}, nil)
+	go func() {
+		<-generation.Done()
+		h.hub.broadcast(client.user.ID, wsTypeTyping, gin.H{"character_id": character.ID, "sender": model.SenderTypeCharacter, "typing": false}, nil)
+	}()
+
+	go h.follow(client, generation, 0, msg.RequestID)
+}
+
+// follow 从 offset 开始把生成的输出推送给连接，直到生成结束或连接断开
+func (h *WSHandler) follow(client *wsConn, generation *service.ReplyGeneration, offset int, requestID string) {
+	client.Send(sseEventMessageStart, gin.H{
+		"request_id":      requestID,
+		"stream_id":       generation.ID,
+		"character_id":    generation.CharacterID,
+		"user_message_id": generation.UserMessageID,
+		"offset":          offset,
+	})
+
+	for {
+		text, next, result, err := generation.Next(client.ctx, offset)
+		if err != nil {
+			return
+		}
+		if text != "" {
+			client.Send(sseEventDelta, gin.H{"stream_id": generation.ID, "text": text, "offset": next})
+			offset = next
+		}
+		if result != nil {
+			msgType := sseEventMessageEnd
+			if result.ErrCode != "" {
+				msgType = sseEventError
+			}
+			client.sendJSON(wsReplyResult{Type: msgType, ReplyResult: result, StreamID: generation.ID})
+			return
+		}
+	}
+}
+
+// wsReplyResult 生成结果的消息内容，字段与 SSE 的 message_end、error 事件相同（含 interrupted、reason），另加 stream_id
+type wsReplyResult struct {
+	Type string `json:"type"`
+	*service.ReplyResult
+	StreamID string `json:"stream_id"`
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"lauraai-backend/internal/i18n"
+	"lauraai-backend/internal/llm"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/ratelimit"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/service"
+)
+
+// followReply 用 llm.Fake 生成一条回复，返回 follow 推送给连接的全部消息
+func followReply(t *testing.T, response llm.FakeResponse) []map[string]any {
+	t.Helper()
+	setupHandlerTest(t)
+	owner := createTestUser(t, 4001, "Owner")
+	character := createTestCharacter(t, owner, model.UnlockStatusFullUnlocked)
+
+	fake := llm.NewFake()
+	fake.StreamInterval = 0
+	fake.Script(llm.FakeMethodChatStream, response)
+	replyService := service.NewReplyService(service.NewChatService(fake), nil, service.NewGenerationGate(0), service.NewQuotaService())
+	h := NewWSHandler(replyService, nil)
+
+	prompt := &model.Message{UserID: owner.ID, CharacterID: character.ID, SenderType: model.SenderTypeUser, Content: "hi"}
+	generation := replyService.Start(context.Background(), service.ReplyRequest{Character: character, Prompt: prompt, Locale: i18n.LocaleEn})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &wsConn{user: owner, send: make(chan []byte, wsSendBuffer), ctx: ctx, cancel: cancel}
+	h.follow(client, generation, 0, "req-1")
+	close(client.send)
+
+	var messages []map[string]any
+	for payload := range client.send {
+		var msg map[string]any
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			t.Fatalf("decode %s: %v", payload, err)
+		}
+		messages = append(messages, msg)
+	}
+	if len(messages) < 2 || messages[0]["type"] != sseEventMessageStart || messages[0]["request_id"] != "req-1" {
+		t.Fatalf("messages = %v", messages)
+	}
+	return messages
+}
+
+func TestWSFollowMessageEnd(t *testing.T) {
+	messages := followReply(t, llm.FakeResponse{Text: "hello!"})
+	end := messages[len(messages)-1]
+	if end["type"] != sseEventMessageEnd || end["stream_id"] != messages[0]["stream_id"] {
+		t.Fatalf("end = %v", end)
+	}
+	if end["message_id"] == nil || end["usage"] == nil || end["interrupted"] != nil {
+		t.Errorf("end = %v", end)
+	}
+}
+
+func TestWSFollowInterrupted(t *testing.T) {
+	messages := followReply(t, llm.FakeResponse{Text: "hel", Err: llm.ErrFakeEOF})
+	// 中途断开的部分回复同样带 interrupted 和 reason，与 SSE 一致
+	end := messages[len(messages)-1]
+	if end["type"] != sseEventMessageEnd || end["interrupted"] != true || end["reason"] != service.ReplyErrorStreamInterrupted {
+		t.Errorf("end = %v", end)
+	}
+	if end["message_id"] == nil || end["usage"] == nil {
+		t.Errorf("end = %v", end)
+	}
+}
+
+func TestWSChatSavesTrimmedMessage(t *testing.T) {
+	setupHandlerTest(t)
+	owner := createTestUser(t, 4001, "Owner")
+	character := createTestCharacter(t, owner, model.UnlockStatusFullUnlocked)
+
+	fake := llm.NewFake()
+	fake.StreamInterval = 0
+	replyService := service.NewReplyService(service.NewChatService(fake), nil, service.NewGenerationGate(0), service.NewQuotaService())
+	h := NewWSHandler(replyService, ratelimit.NewLimiter(ratelimit.NewMemoryStore(), nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &wsConn{user: owner, send: make(chan []byte, wsSendBuffer), ctx: ctx, cancel: cancel}
+	h.chat(client, wsInbound{Type: wsTypeChat, RequestID: "req-1", CharacterID: character.ID, Message: "  hello there \n"})
+	for _, g := range replyService.Active(owner.ID) {
+		<-g.Done()
+	}
+
+	// 保存和发给模型的都是去掉首尾空白的内容
+	messages, _ := repository.NewMessageRepository().GetRecentByCharacterID(character.ID, 2)
+	if len(messages) == 0 || messages[0].SenderType != model.SenderTypeUser || messages[0].Content != "hello there" {
+		t.Fatalf("messages = %+v", messages)
+	}
+	calls := fake.CallsOf(llm.FakeMethodChatStream)
+	if len(calls) != 1 || calls[0].Messages[len(calls[0].Messages)-1].Text != "hello there" {
+		t.Errorf("chat stream calls = %+v", calls)
+	}
+}
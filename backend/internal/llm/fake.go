@@ -0,0 +1,306 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// Fake 调用的方法名，用于 Script 和 CallsOf
+const (
+	FakeMethodChat       = "chat"
+	FakeMethodChatStream = "chat_stream"
+	FakeMethodText       = "text"
+	FakeMethodImage      = "image"
+	FakeMethodVision     = "vision"
+)
+
+// 模拟上游常见的错误，与 Gemini SDK 返回的错误类型一致
+var (
+	ErrFakeRateLimited = genai.APIError{Code: 429, Message: "Resource has been exhausted (e.g. check quota).", Status: "RESOURCE_EXHAUSTED"}
+	ErrFakeEOF         = fmt.Errorf("fake transport: %w", io.ErrUnexpectedEOF)
+)
+
+// FakeResponse 预设的一次调用结果
+type FakeResponse struct {
+	Text  string
+	Image *Image
+	// Err 非空时调用返回该错误；流式调用会先输出 Text 再返回 Err，用于模拟中途断开
+	Err error
+	// Delay 返回前的等待时间，ctx 取消时提前返回 ctx.Err()
+	Delay time.Duration
+}
+
+// FakeCall 一次调用的记录
+type FakeCall struct {
+	Method      string
+	System      string
+	Messages    []Message
+	Prompt      string
+	Image       *Image
+	Temperature float32
+}
+
+// Fake 确定性的模型实现，不访问网络
+// 按方法预设的结果依次返回，用完后返回根据输入生成的固定内容；所有调用都会被记录
+type Fake struct {
+	// StreamChunkSize 流式输出每段的字符数
+	StreamChunkSize int
+	// StreamInterval 流式输出每段之间的间隔
+	StreamInterval time.Duration
+
+	mu      sync.Mutex
+	scripts map[string][]FakeResponse
+	calls   []FakeCall
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		StreamChunkSize: 5,
+		StreamInterval:  100 * time.Millisecond,
+		scripts:         make(map[string][]FakeResponse),
+	}
+}
+
+// Script 为方法追加预设结果，按调用顺序依次使用
+func (f *Fake) Script(method string, responses ...FakeResponse) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scripts[method] = append(f.scripts[method], responses...)
+}
+
+// FailNext 让方法接下来的几次调用依次返回给定错误
+func (f *Fake) FailNext(method string, errs ...error) {
+	responses := make([]FakeResponse, len(errs))
+	for i, err := range errs {
+		responses[i] = FakeResponse{Err: err}
+	}
+	f.Script(method, responses...)
+}
+
+// Calls 返回所有调用记录
+func (f *Fake) Calls() []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeCall(nil), f.calls...)
+}
+
+// CallsOf 返回指定方法的调用记录
+func (f *Fake) CallsOf(method string) []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var calls []FakeCall
+	for _, call := range f.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset 清空预设结果和调用记录
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scripts = make(map[string][]FakeResponse)
+	f.calls = nil
+}
+
+// record 记录调用并取出下一个预设结果
+func (f *Fake) record(call FakeCall) (FakeResponse, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+	queue := f.scripts[call.Method]
+	if len(queue) == 0 {
+		return FakeResponse{}, false
+	}
+	f.scripts[call.Method] = queue[1:]
+	return queue[0], true
+}
+
+// wait 等待预设的延迟
+func (f *Fake) wait(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *Fake) Chat(ctx context.Context, req ChatRequest) (string, error) {
+	resp, ok := f.record(FakeCall{Method: FakeMethodChat, System: req.System, Messages: req.Messages, Temperature: req.Temperature})
+	if err := f.wait(ctx, resp.Delay); err != nil {
+		return "", err
+	}
+	if resp.Err != nil {
+		return "", resp.Err
+	}
+	if !ok {
+		return fakeChatReply(req), nil
+	}
+	return resp.Text, nil
+}
+
+func (f *Fake) ChatStream(ctx context.Context, req ChatRequest) (<-chan StreamChunk, error) {
+	resp, ok := f.record(FakeCall{Method: FakeMethodChatStream, System: req.System, Messages: req.Messages, Temperature: req.Temperature})
+	if !ok {
+		resp.Text = fakeChatReply(req)
+	}
+	// 没有输出任何内容就失败时，和 Gemini 一样直接返回错误
+	if resp.Err != nil && resp.Text == "" {
+		if err := f.wait(ctx, resp.Delay); err != nil {
+			return nil, err
+		}
+		return nil, resp.Err
+	}
+
+	chunkSize := max(f.StreamChunkSize, 1)
+	ch := make(chan StreamChunk, 5)
+	go func() {
+		defer close(ch)
+		if err := f.wait(ctx, resp.Delay); err != nil {
+			return
+		}
+		runes := []rune(resp.Text)
+		for i := 0; i < len(runes); i += chunkSize {
+			if i > 0 {
+				if err := f.wait(ctx, f.StreamInterval); err != nil {
+					return
+				}
+			}
+			end := min(i+chunkSize, len(runes))
+			if !sendChunk(ctx, ch, StreamChunk{Text: string(runes[i:end])}) {
+				return
+			}
+		}
+		if resp.Err != nil {
+			sendChunk(ctx, ch, StreamChunk{Err: resp.Err})
+			return
+		}
+		sendChunk(ctx, ch, StreamChunk{Usage: fakeUsage(req, resp.Text)})
+	}()
+	return ch, nil
+}
+
+func (f *Fake) GenerateText(ctx context.Context, prompt string, temperature float32) (string, error) {
+	resp, ok := f.record(FakeCall{Method: FakeMethodText, Prompt: prompt, Temperature: temperature})
+	if err := f.wait(ctx, resp.Delay); err != nil {
+		return "", err
+	}
+	if resp.Err != nil {
+		return "", resp.Err
+	}
+	if !ok {
+		return fakeText(prompt), nil
+	}
+	return resp.Text, nil
+}
+
+func (f *Fake) GenerateImage(ctx context.Context, prompt string) (*Image, error) {
+	resp, ok := f.record(FakeCall{Method: FakeMethodImage, Prompt: prompt})
+	if err := f.wait(ctx, resp.Delay); err != nil {
+		return nil, err
+	}
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	if !ok || resp.Image == nil {
+		return fakeImage(prompt)
+	}
+	return resp.Image, nil
+}
+
+func (f *Fake) DescribeImage(ctx context.Context, prompt string, image *Image) (string, error) {
+	resp, ok := f.record(FakeCall{Method: FakeMethodVision, Prompt: prompt, Image: image})
+	if err := f.wait(ctx, resp.Delay); err != nil {
+		return "", err
+	}
+	if resp.Err != nil {
+		return "", resp.Err
+	}
+	if !ok {
+		return fmt.Sprintf("A generic person description (%s, %d bytes)", image.MIMEType, len(image.Data)), nil
+	}
+	return resp.Text, nil
+}
+
+// fakeChatReply 复述用户的最后一条消息
+func fakeChatReply(req ChatRequest) string {
+	var last string
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == RoleUser {
+			last = req.Messages[i].Text
+			break
+		}
+	}
+	return fmt.Sprintf("[fake reply] I got your message: %s", last)
+}
+
+// fakeUsage 按每 4 个字符一个 token 估算用量
+func fakeUsage(req ChatRequest, reply string) *Usage {
+	prompt := len(req.System)
+	for _, msg := range req.Messages {
+		prompt += len(msg.Text)
+	}
+	usage := &Usage{PromptTokens: (prompt + 3) / 4, CompletionTokens: (len(reply) + 3) / 4}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+// fakeText 生成 7 段以空行分隔的文本，满足报告解析的格式
+func fakeText(prompt string) string {
+	hash := fakeHash(prompt)
+	paragraphs := make([]string, 7)
+	for i := range paragraphs {
+		paragraphs[i] = fmt.Sprintf("Fake paragraph %d (%08x). This text is generated offline and stays the same for the same prompt.", i+1, hash)
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// fakeImage 生成由提示词决定颜色的渐变 PNG，可以正常解码和模糊处理
+func fakeImage(prompt string) (*Image, error) {
+	const size = 256
+	hash := fakeHash(prompt)
+	base := color.RGBA{R: uint8(hash >> 16), G: uint8(hash >> 8), B: uint8(hash), A: 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.Set(x, y, color.RGBA{
+				R: base.R ^ uint8(x),
+				G: base.G ^ uint8(y),
+				B: base.B,
+				A: 255,
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return &Image{Data: buf.Bytes(), MIMEType: "image/png"}, nil
+}
+
+func fakeHash(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
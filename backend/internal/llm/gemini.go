@@ -0,0 +1,178 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"google.golang.org/genai"
+)
+
+const (
+	// geminiTextModel 对话、文本生成和图片理解使用的模型
+	geminiTextModel = "gemini-2.0-flash"
+	// geminiImageModel 图片生成使用的模型
+	geminiImageModel = "gemini-2.5-flash-image"
+)
+
+// Gemini 基于 Google Gemini API 的模型实现
+type Gemini struct {
+	client *genai.Client
+}
+
+func NewGemini(apiKey string) (*Gemini, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("GEMINI_API_KEY not configured")
+	}
+
+	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+		APIKey: apiKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create Gemini client: %v", err)
+	}
+	return &Gemini{client: client}, nil
+}
+
+func (g *Gemini) Chat(ctx context.Context, req ChatRequest) (string, error) {
+	resp, err := g.client.Models.GenerateContent(ctx, geminiTextModel, chatContents(req), chatConfig(req))
+	if err != nil {
+		return "", err
+	}
+	return firstText(resp)
+}
+
+func (g *Gemini) ChatStream(ctx context.Context, req ChatRequest) (<-chan StreamChunk, error) {
+	iter := g.client.Models.GenerateContentStream(ctx, geminiTextModel, chatContents(req), chatConfig(req))
+
+	ch := make(chan StreamChunk, 10)
+	go func() {
+		defer close(ch)
+		// 每个响应都带有截至当前的累计用量，以最后一个为准
+		var usage *Usage
+		for resp, err := range iter {
+			if err != nil {
+				sendChunk(ctx, ch, StreamChunk{Err: err})
+				return
+			}
+			if resp.UsageMetadata != nil {
+				usage = geminiUsage(resp.UsageMetadata)
+			}
+			if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+				continue
+			}
+			for _, part := range resp.Candidates[0].Content.Parts {
+				if !sendChunk(ctx, ch, StreamChunk{Text: part.Text}) {
+					return
+				}
+			}
+		}
+		if usage != nil {
+			sendChunk(ctx, ch, StreamChunk{Usage: usage})
+		}
+	}()
+	return ch, nil
+}
+
+// geminiUsage 转换 token 用量，思考过程的 token 计入输出
+func geminiUsage(m *genai.GenerateContentResponseUsageMetadata) *Usage {
+	return &Usage{
+		PromptTokens:     int(m.PromptTokenCount),
+		CompletionTokens: int(m.CandidatesTokenCount + m.ThoughtsTokenCount),
+		TotalTokens:      int(m.TotalTokenCount),
+	}
+}
+
+func (g *Gemini) GenerateText(ctx context.Context, prompt string, temperature float32) (string, error) {
+	var cfg *genai.GenerateContentConfig
+	if temperature > 0 {
+		cfg = &genai.GenerateContentConfig{Temperature: genai.Ptr(temperature)}
+	}
+	resp, err := g.client.Models.GenerateContent(ctx, geminiTextModel, []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{Text: prompt}}},
+	}, cfg)
+	if err != nil {
+		return "", err
+	}
+	return firstText(resp)
+}
+
+func (g *Gemini) GenerateImage(ctx context.Context, prompt string) (*Image, error) {
+	resp, err := g.client.Models.GenerateContent(ctx, geminiImageModel, genai.Text(prompt), nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return nil, ErrEmptyResponse
+	}
+
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if part.InlineData != nil {
+			return &Image{Data: part.InlineData.Data, MIMEType: part.InlineData.MIMEType}, nil
+		}
+		if part.Text != "" {
+			log.Printf("[Gemini] 图片生成收到文本响应: %s", part.Text)
+		}
+	}
+	return nil, fmt.Errorf("image data not found in response")
+}
+
+func (g *Gemini) DescribeImage(ctx context.Context, prompt string, image *Image) (string, error) {
+	parts := []*genai.Part{
+		{Text: prompt},
+		{
+			InlineData: &genai.Blob{
+				MIMEType: image.MIMEType,
+				Data:     image.Data,
+			},
+		},
+	}
+	resp, err := g.client.Models.GenerateContent(ctx, geminiTextModel, []*genai.Content{{Parts: parts}}, nil)
+	if err != nil {
+		return "", err
+	}
+	return firstText(resp)
+}
+
+// chatContents 将对话消息转换为 Gemini 的 Content 列表
+func chatContents(req ChatRequest) []*genai.Content {
+	contents := make([]*genai.Content, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		contents = append(contents, &genai.Content{
+			Role:  string(msg.Role),
+			Parts: []*genai.Part{{Text: msg.Text}},
+		})
+	}
+	return contents
+}
+
+func chatConfig(req ChatRequest) *genai.GenerateContentConfig {
+	cfg := &genai.GenerateContentConfig{}
+	if req.System != "" {
+		cfg.SystemInstruction = &genai.Content{
+			Parts: []*genai.Part{{Text: req.System}},
+		}
+	}
+	if req.Temperature > 0 {
+		cfg.Temperature = genai.Ptr(req.Temperature)
+	}
+	return cfg
+}
+
+// firstText 返回第一个候选结果的第一段文本
+func firstText(resp *genai.GenerateContentResponse) (string, error) {
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
+		return "", ErrEmptyResponse
+	}
+	return resp.Candidates[0].Content.Parts[0].Text, nil
+}
+
+// sendChunk 向流式通道写入一段内容，ctx 取消时放弃并返回 false
+func sendChunk(ctx context.Context, ch chan<- StreamChunk, chunk StreamChunk) bool {
+	select {
+	case ch <- chunk:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,243 @@
+// Package llm 与厂商无关的 AI 模型接口（对话、文本、图片生成、图片理解）
+// 业务代码只依赖这些接口，具体实现为 Gemini、OpenAI 兼容接口或用于离线开发测试的 Fake
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"lauraai-backend/internal/config"
+)
+
+const (
+	ProviderGemini = "gemini"
+	ProviderOpenAI = "openai"
+	ProviderFake   = "fake"
+)
+
+// ErrEmptyResponse 模型没有返回任何内容
+var ErrEmptyResponse = errors.New("empty model response")
+
+// Role 对话消息的发送方
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleModel Role = "model"
+)
+
+// Message 一条对话消息
+type Message struct {
+	Role Role
+	Text string
+}
+
+// ChatRequest 对话请求
+type ChatRequest struct {
+	System      string    // 系统提示词
+	Messages    []Message // 按时间顺序排列，最后一条为用户的新消息
+	Temperature float32   // 0 表示使用模型默认值
+}
+
+// Usage 一次调用消耗的 token 数
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// StreamChunk 流式输出的一段内容，Err 非空时表示流异常结束，之后通道会关闭
+// 正常结束前的最后一段可能只携带 Usage（模型不返回用量时没有这一段）
+type StreamChunk struct {
+	Text  string
+	Usage *Usage
+	Err   error
+}
+
+// Image 图片数据
+type Image struct {
+	Data     []byte
+	MIMEType string
+}
+
+// ChatModel 多轮对话模型
+type ChatModel interface {
+	Chat(ctx context.Context, req ChatRequest) (string, error)
+	// ChatStream 返回的通道在输出结束、出错或 ctx 取消后关闭
+	ChatStream(ctx context.Context, req ChatRequest) (<-chan StreamChunk, error)
+}
+
+// TextModel 单轮文本生成模型
+type TextModel interface {
+	GenerateText(ctx context.Context, prompt string, temperature float32) (string, error)
+}
+
+// ImageModel 文生图模型
+type ImageModel interface {
+	GenerateImage(ctx context.Context, prompt string) (*Image, error)
+}
+
+// VisionModel 图片理解模型
+type VisionModel interface {
+	DescribeImage(ctx context.Context, prompt string, image *Image) (string, error)
+}
+
+// Models 各类模型的实现集合
+type Models struct {
+	Chat   ChatModel
+	Text   TextModel
+	Image  ImageModel
+	Vision VisionModel
+}
+
+// New 根据配置创建各功能使用的模型
+// 各功能的提供方为逗号分隔的有序列表，前一个不可用（限流、故障、熔断）时自动切换到下一个：
+// 默认列表由 LLM_PROVIDER 决定，未配置时有 GEMINI_API_KEY 使用 Gemini，开发模式下没有密钥使用 Fake；
+// 对话和报告可通过 CHAT_PROVIDER、REPORT_PROVIDER 单独指定（例如 gemini,openai），图片生成和识别使用默认列表
+// 没有可用提供方的功能对应字段为 nil，所有功能都没有提供方时返回错误
+func New() (*Models, error) {
+	defaultProviders := splitProviders(config.AppConfig.LLMProvider)
+	if len(defaultProviders) == 0 {
+		switch {
+		case config.AppConfig.GeminiAPIKey != "":
+			defaultProviders = []string{ProviderGemini}
+		case config.AppConfig.DevMode:
+			log.Println("开发模式: GEMINI_API_KEY 未配置，将使用 Fake 模型")
+			defaultProviders = []string{ProviderFake}
+		}
+	}
+	chatProviders := splitProviders(config.AppConfig.ChatProvider)
+	if len(chatProviders) == 0 {
+		chatProviders = defaultProviders
+	}
+	reportProviders := splitProviders(config.AppConfig.ReportProvider)
+	if len(reportProviders) == 0 {
+		reportProviders = defaultProviders
+	}
+	if len(defaultProviders) == 0 && len(chatProviders) == 0 && len(reportProviders) == 0 {
+		return nil, fmt.Errorf("GEMINI_API_KEY not configured")
+	}
+
+	// 同一提供方只创建一个实例
+	providers := make(map[string]any)
+	get := func(name string) (any, error) {
+		if p, ok := providers[name]; ok {
+			return p, nil
+		}
+		p, err := newProvider(name)
+		if err != nil {
+			return nil, err
+		}
+		providers[name] = p
+		return p, nil
+	}
+
+	policy := retryPolicyFromConfig()
+	chat, err := candidates[ChatModel](get, chatProviders, "chat")
+	if err != nil {
+		return nil, err
+	}
+	text, err := candidates[TextModel](get, reportProviders, "report")
+	if err != nil {
+		return nil, err
+	}
+	image, err := candidates[ImageModel](get, defaultProviders, "image")
+	if err != nil {
+		return nil, err
+	}
+	vision, err := candidates[VisionModel](get, defaultProviders, "vision")
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("AI 模型提供方: chat=%s report=%s image=%s vision=%s",
+		describeCandidates(chatProviders), describeCandidates(reportProviders),
+		describeCandidates(defaultProviders), describeCandidates(defaultProviders))
+	models := &Models{}
+	if len(chat) > 0 {
+		models.Chat = NewResilientChat(policy, chat...)
+	}
+	if len(text) > 0 {
+		models.Text = NewResilientText(policy, text...)
+	}
+	if len(image) > 0 {
+		models.Image = NewResilientImage(policy, image...)
+	}
+	if len(vision) > 0 {
+		models.Vision = NewResilientVision(policy, vision...)
+	}
+	return models, nil
+}
+
+// retryPolicyFromConfig 用配置覆盖默认重试策略
+func retryPolicyFromConfig() RetryPolicy {
+	policy := DefaultRetryPolicy
+	if config.AppConfig.AIRetryAttempts > 0 {
+		policy.Attempts = config.AppConfig.AIRetryAttempts
+	}
+	if config.AppConfig.AIBreakerThreshold > 0 {
+		policy.BreakerThreshold = config.AppConfig.AIBreakerThreshold
+	}
+	if config.AppConfig.AIBreakerCooldown > 0 {
+		policy.BreakerCooldown = config.AppConfig.AIBreakerCooldown
+	}
+	return policy
+}
+
+// splitProviders 解析逗号分隔的提供方列表
+func splitProviders(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// newProvider 创建提供方实例
+func newProvider(name string) (any, error) {
+	switch name {
+	case ProviderGemini:
+		return NewGemini(config.AppConfig.GeminiAPIKey)
+	case ProviderOpenAI:
+		return NewOpenAI(OpenAIConfig{
+			BaseURL:   config.AppConfig.OpenAIBaseURL,
+			APIKey:    config.AppConfig.OpenAIAPIKey,
+			ChatModel: config.AppConfig.OpenAIModel,
+			TextModel: config.AppConfig.OpenAIReportModel,
+		})
+	case ProviderFake:
+		return NewFake(), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider: %s", name)
+	}
+}
+
+// candidates 按顺序获取提供方并检查是否支持该功能
+func candidates[M any](get func(string) (any, error), names []string, feature string) ([]Candidate[M], error) {
+	list := make([]Candidate[M], 0, len(names))
+	for _, name := range names {
+		p, err := get(name)
+		if err != nil {
+			return nil, err
+		}
+		model, ok := p.(M)
+		if !ok {
+			return nil, fmt.Errorf("LLM provider %s does not support %s", name, feature)
+		}
+		list = append(list, Candidate[M]{Name: name + "/" + feature, Model: model})
+	}
+	return list, nil
+}
+
+// describeCandidates 用于日志
+func describeCandidates(names []string) string {
+	if len(names) == 0 {
+		return "未配置"
+	}
+	return strings.Join(names, "→")
+}
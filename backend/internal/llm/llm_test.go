@@ -0,0 +1,67 @@
+package llm
+
+import (
+	"testing"
+
+	"lauraai-backend/internal/config"
+)
+
+func TestNewProviders(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       config.Config
+		wantErr   bool
+		wantImage bool
+	}{
+		{
+			name:    "nothing configured",
+			cfg:     config.Config{},
+			wantErr: true,
+		},
+		{
+			name:      "dev mode falls back to fake",
+			cfg:       config.Config{DevMode: true},
+			wantImage: true,
+		},
+		// 对话和报告都使用 OpenAI 时不需要 Gemini 密钥，图片功能不可用
+		{
+			name: "openai chat and report without gemini key",
+			cfg:  config.Config{ChatProvider: ProviderOpenAI, ReportProvider: ProviderOpenAI, OpenAIBaseURL: "http://localhost/v1", OpenAIModel: "gpt"},
+		},
+		{
+			name:      "openai chat with gemini default",
+			cfg:       config.Config{GeminiAPIKey: "key", ChatProvider: ProviderOpenAI, OpenAIBaseURL: "http://localhost/v1", OpenAIModel: "gpt"},
+			wantImage: true,
+		},
+		{
+			name:    "openai cannot generate images",
+			cfg:     config.Config{LLMProvider: ProviderOpenAI, OpenAIBaseURL: "http://localhost/v1", OpenAIModel: "gpt"},
+			wantErr: true,
+		},
+	}
+
+	saved := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = saved })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			config.AppConfig = &cfg
+			models, err := New()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("New() succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if models.Chat == nil || models.Text == nil {
+				t.Errorf("chat or text model missing: %+v", models)
+			}
+			if got := models.Image != nil && models.Vision != nil; got != tt.wantImage {
+				t.Errorf("image models = %v, want %v", got, tt.wantImage)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OpenAIConfig OpenAI 兼容接口配置
+type OpenAIConfig struct {
+	// BaseURL 包含版本前缀，例如 https://api.openai.com/v1、http://localhost:11434/v1（Ollama）、http://vllm:8000/v1
+	BaseURL string
+	// APIKey 为空时不发送 Authorization（本地 Ollama、vLLM 通常不需要）
+	APIKey string
+	// ChatModel 角色对话使用的模型
+	ChatModel string
+	// TextModel 报告生成使用的模型，为空时与 ChatModel 相同
+	TextModel string
+}
+
+// OpenAI 基于 OpenAI 兼容 /chat/completions 接口的模型实现，支持对话（含流式）和文本生成
+type OpenAI struct {
+	baseURL    string
+	apiKey     string
+	chatModel  string
+	textModel  string
+	httpClient *http.Client
+}
+
+func NewOpenAI(cfg OpenAIConfig) (*OpenAI, error) {
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("OPENAI_BASE_URL not configured")
+	}
+	if cfg.ChatModel == "" {
+		return nil, fmt.Errorf("OPENAI_MODEL not configured")
+	}
+	if cfg.TextModel == "" {
+		cfg.TextModel = cfg.ChatModel
+	}
+	return &OpenAI{
+		baseURL:   strings.TrimRight(cfg.BaseURL, "/"),
+		apiKey:    cfg.APIKey,
+		chatModel: cfg.ChatModel,
+		textModel: cfg.TextModel,
+		// 不设置整体超时，流式响应可能持续较长时间，由调用方的 ctx 控制
+		httpClient: &http.Client{},
+	}, nil
+}
+
+// OpenAIError 接口返回的非 2xx 响应
+type OpenAIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *OpenAIError) Error() string {
+	return fmt.Sprintf("OpenAI API error %d: %s", e.StatusCode, e.Message)
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIRequest struct {
+	Model       string          `json:"model"`
+	Messages    []openAIMessage `json:"messages"`
+	Temperature *float32        `json:"temperature,omitempty"`
+	Stream      bool            `json:"stream,omitempty"`
+	// StreamOptions 流式输出时要求在最后返回 token 用量
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message openAIMessage `json:"message"`
+		Delta   openAIMessage `json:"delta"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+type openAIErrorBody struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (o *OpenAI) Chat(ctx context.Context, req ChatRequest) (string, error) {
+	return o.complete(ctx, o.chatRequest(req, false))
+}
+
+func (o *OpenAI) ChatStream(ctx context.Context, req ChatRequest) (<-chan StreamChunk, error) {
+	resp, err := o.post(ctx, o.chatRequest(req, true))
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan StreamChunk, 10)
+	go func() {
+		defer close(ch)
+		defer resp.Body.Close()
+
+		// SSE 格式：每个事件一行 "data: {json}"，以 "data: [DONE]" 结束
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			data, ok := strings.CutPrefix(line, "data:")
+			if !ok {
+				continue
+			}
+			data = strings.TrimSpace(data)
+			if data == "[DONE]" {
+				return
+			}
+
+			var event openAIResponse
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				sendChunk(ctx, ch, StreamChunk{Err: fmt.Errorf("invalid stream event: %v", err)})
+				return
+			}
+			// 用量在 [DONE] 之前单独的一个事件中返回，choices 为空
+			if event.Usage != nil {
+				if !sendChunk(ctx, ch, StreamChunk{Usage: event.Usage}) {
+					return
+				}
+			}
+			if len(event.Choices) == 0 || event.Choices[0].Delta.Content == "" {
+				continue
+			}
+			if !sendChunk(ctx, ch, StreamChunk{Text: event.Choices[0].Delta.Content}) {
+				return
+			}
+		}
+
+		// 连接在 [DONE] 之前断开
+		err := scanner.Err()
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		sendChunk(ctx, ch, StreamChunk{Err: err})
+	}()
+	return ch, nil
+}
+
+func (o *OpenAI) GenerateText(ctx context.Context, prompt string, temperature float32) (string, error) {
+	req := openAIRequest{
+		Model:    o.textModel,
+		Messages: []openAIMessage{{Role: "user", Content: prompt}},
+	}
+	if temperature > 0 {
+		req.Temperature = &temperature
+	}
+	return o.complete(ctx, req)
+}
+
+// chatRequest 将对话请求转换为 OpenAI 格式，model 角色对应 assistant
+func (o *OpenAI) chatRequest(req ChatRequest, stream bool) openAIRequest {
+	messages := make([]openAIMessage, 0, len(req.Messages)+1)
+	if req.System != "" {
+		messages = append(messages, openAIMessage{Role: "system", Content: req.System})
+	}
+	for _, msg := range req.Messages {
+		role := "user"
+		if msg.Role == RoleModel {
+			role = "assistant"
+		}
+		messages = append(messages, openAIMessage{Role: role, Content: msg.Text})
+	}
+
+	out := openAIRequest{Model: o.chatModel, Messages: messages, Stream: stream}
+	if stream {
+		out.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+	if req.Temperature > 0 {
+		temperature := req.Temperature
+		out.Temperature = &temperature
+	}
+	return out
+}
+
+// complete 发送非流式请求并返回第一个候选结果
+func (o *OpenAI) complete(ctx context.Context, req openAIRequest) (string, error) {
+	resp, err := o.post(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result openAIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode response: %v", err)
+	}
+	if len(result.Choices) == 0 || result.Choices[0].Message.Content == "" {
+		return "", ErrEmptyResponse
+	}
+	return result.Choices[0].Message.Content, nil
+}
+
+// post 调用 /chat/completions，非 2xx 响应转换为 OpenAIError
+func (o *OpenAI) post(ctx context.Context, body openAIRequest) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.baseURL+"/chat/completions", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if body.Stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		message := strings.TrimSpace(string(raw))
+		var errBody openAIErrorBody
+		if json.Unmarshal(raw, &errBody) == nil && errBody.Error.Message != "" {
+			message = errBody.Error.Message
+		}
+		return nil, &OpenAIError{StatusCode: resp.StatusCode, Message: message}
+	}
+	return resp, nil
+}
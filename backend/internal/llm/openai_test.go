@@ -0,0 +1,193 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newOpenAITestServer 启动模拟的 /chat/completions 接口，handler 收到解析后的请求体
+func newOpenAITestServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, body openAIRequest)) *OpenAI {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("request = %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("Authorization = %q", got)
+		}
+		var body openAIRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		handler(w, r, body)
+	}))
+	t.Cleanup(server.Close)
+
+	o, err := NewOpenAI(OpenAIConfig{BaseURL: server.URL + "/v1/", APIKey: "test-key", ChatModel: "chat-model", TextModel: "text-model"})
+	if err != nil {
+		t.Fatalf("NewOpenAI: %v", err)
+	}
+	return o
+}
+
+var testChatRequest = ChatRequest{
+	System: "You are Luna.",
+	Messages: []Message{
+		{Role: RoleUser, Text: "hi"},
+		{Role: RoleModel, Text: "hello"},
+		{Role: RoleUser, Text: "how are you?"},
+	},
+	Temperature: 0.7,
+}
+
+// readStream 读取流式输出直到通道关闭
+func readStream(t *testing.T, ch <-chan StreamChunk) (text string, usage *Usage, err error) {
+	t.Helper()
+	for chunk := range ch {
+		if chunk.Err != nil {
+			err = chunk.Err
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		text += chunk.Text
+	}
+	return text, usage, err
+}
+
+func TestOpenAIChat(t *testing.T) {
+	o := newOpenAITestServer(t, func(w http.ResponseWriter, r *http.Request, body openAIRequest) {
+		want := []openAIMessage{
+			{Role: "system", Content: "You are Luna."},
+			{Role: "user", Content: "hi"},
+			{Role: "assistant", Content: "hello"},
+			{Role: "user", Content: "how are you?"},
+		}
+		if body.Model != "chat-model" || body.Stream || body.Temperature == nil || *body.Temperature != 0.7 || fmt.Sprint(body.Messages) != fmt.Sprint(want) {
+			t.Errorf("body = %+v", body)
+		}
+		io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"I'm great!"}}]}`)
+	})
+
+	reply, err := o.Chat(context.Background(), testChatRequest)
+	if err != nil || reply != "I'm great!" {
+		t.Errorf("Chat = %q, %v", reply, err)
+	}
+}
+
+func TestOpenAIGenerateText(t *testing.T) {
+	responses := []string{
+		`{"choices":[{"message":{"role":"assistant","content":"report"}}]}`,
+		`{"choices":[]}`,
+	}
+	o := newOpenAITestServer(t, func(w http.ResponseWriter, r *http.Request, body openAIRequest) {
+		if body.Model != "text-model" || len(body.Messages) != 1 || body.Messages[0].Content != "write a report" {
+			t.Errorf("body = %+v", body)
+		}
+		io.WriteString(w, responses[0])
+		responses = responses[1:]
+	})
+
+	if text, err := o.GenerateText(context.Background(), "write a report", 0.5); err != nil || text != "report" {
+		t.Errorf("GenerateText = %q, %v", text, err)
+	}
+	if _, err := o.GenerateText(context.Background(), "write a report", 0); !errors.Is(err, ErrEmptyResponse) {
+		t.Errorf("GenerateText without choices = %v, want ErrEmptyResponse", err)
+	}
+}
+
+func TestOpenAIChatStream(t *testing.T) {
+	o := newOpenAITestServer(t, func(w http.ResponseWriter, r *http.Request, body openAIRequest) {
+		if !body.Stream || body.StreamOptions == nil || !body.StreamOptions.IncludeUsage || r.Header.Get("Accept") != "text/event-stream" {
+			t.Errorf("body = %+v", body)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, ": keep-alive\n\n")
+		io.WriteString(w, `data: {"choices":[{"delta":{"role":"assistant","content":""}}]}`+"\n\n")
+		io.WriteString(w, `data: {"choices":[{"delta":{"content":"I'm "}}]}`+"\n\n")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, `data:{"choices":[{"delta":{"content":"great!"}}]}`+"\n\n")
+		io.WriteString(w, `data: {"choices":[],"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15}}`+"\n\n")
+		io.WriteString(w, "data: [DONE]\n\n")
+		// [DONE] 之后的内容被忽略
+		io.WriteString(w, `data: {"choices":[{"delta":{"content":"ignored"}}]}`+"\n\n")
+	})
+
+	ch, err := o.ChatStream(context.Background(), testChatRequest)
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+	text, usage, err := readStream(t, ch)
+	if err != nil || text != "I'm great!" {
+		t.Errorf("stream = %q, %v", text, err)
+	}
+	if usage == nil || *usage != (Usage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15}) {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+func TestOpenAIChatStreamErrors(t *testing.T) {
+	t.Run("early EOF", func(t *testing.T) {
+		o := newOpenAITestServer(t, func(w http.ResponseWriter, r *http.Request, body openAIRequest) {
+			io.WriteString(w, `data: {"choices":[{"delta":{"content":"I was"}}]}`+"\n\n")
+		})
+		ch, err := o.ChatStream(context.Background(), testChatRequest)
+		if err != nil {
+			t.Fatalf("ChatStream: %v", err)
+		}
+		// 没有收到 [DONE] 就断开，已输出的内容保留
+		text, usage, err := readStream(t, ch)
+		if text != "I was" || usage != nil || !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("stream = %q, %+v, %v; want io.ErrUnexpectedEOF", text, usage, err)
+		}
+	})
+
+	t.Run("invalid event", func(t *testing.T) {
+		o := newOpenAITestServer(t, func(w http.ResponseWriter, r *http.Request, body openAIRequest) {
+			io.WriteString(w, "data: {not json}\n\ndata: [DONE]\n\n")
+		})
+		ch, err := o.ChatStream(context.Background(), testChatRequest)
+		if err != nil {
+			t.Fatalf("ChatStream: %v", err)
+		}
+		if _, _, err := readStream(t, ch); err == nil {
+			t.Error("invalid event accepted")
+		}
+	})
+}
+
+func TestOpenAIErrorResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		message string
+	}{
+		{"json error", http.StatusTooManyRequests, `{"error":{"message":"Rate limit reached","type":"rate_limit"}}`, "Rate limit reached"},
+		{"plain text", http.StatusBadGateway, "upstream unavailable\n", "upstream unavailable"},
+		{"empty json error", http.StatusUnauthorized, `{"error":{}}`, `{"error":{}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOpenAITestServer(t, func(w http.ResponseWriter, r *http.Request, body openAIRequest) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			})
+
+			_, chatErr := o.Chat(context.Background(), testChatRequest)
+			_, streamErr := o.ChatStream(context.Background(), testChatRequest)
+			for _, err := range []error{chatErr, streamErr} {
+				var apiErr *OpenAIError
+				if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status || apiErr.Message != tt.message {
+					t.Errorf("err = %v, want OpenAIError %d %q", err, tt.status, tt.message)
+				}
+			}
+		})
+	}
+}
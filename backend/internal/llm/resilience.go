@@ -0,0 +1,385 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// ErrCircuitOpen 所有候选模型的熔断器都处于打开状态
+var ErrCircuitOpen = errors.New("all AI models are temporarily unavailable")
+
+// RetryPolicy 重试、退避和熔断参数
+type RetryPolicy struct {
+	// Attempts 每个模型的最大尝试次数（含第一次）
+	Attempts int
+	// BaseDelay 第一次重试前的等待时间，之后每次翻倍
+	BaseDelay time.Duration
+	// MaxDelay 单次等待时间上限
+	MaxDelay time.Duration
+	// BreakerThreshold 连续失败多少次后熔断
+	BreakerThreshold int
+	// BreakerCooldown 熔断后多久允许一次试探请求
+	BreakerCooldown time.Duration
+}
+
+// DefaultRetryPolicy 默认策略：每个模型最多 3 次，2s 起退避，连续 5 次失败熔断 30 秒
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:         3,
+	BaseDelay:        2 * time.Second,
+	MaxDelay:         20 * time.Second,
+	BreakerThreshold: 5,
+	BreakerCooldown:  30 * time.Second,
+}
+
+// backoff 第 attempt 次失败后的等待时间，指数增长并带 50% 抖动，避免多个请求同时重试
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.MaxDelay)
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// sleepContext 等待 d，ctx 取消时提前返回
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// IsRetryable 判断错误是否为临时错误：限流、服务端错误、连接中断和超时
+// 请求参数错误、鉴权失败、内容被拒绝等重试也不会成功
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrEmptyResponse) {
+		return true
+	}
+
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		return retryableStatus(apiErr.Code)
+	}
+	var openAIErr *OpenAIError
+	if errors.As(err, &openAIErr) {
+		return retryableStatus(openAIErr.StatusCode)
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	// SDK 没有返回结构化错误时按错误信息判断
+	msg := err.Error()
+	for _, marker := range []string{"RESOURCE_EXHAUSTED", "UNAVAILABLE", "EOF", "connection reset", "timeout"} {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func retryableStatus(code int) bool {
+	return code == 408 || code == 429 || code >= 500
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// CircuitBreaker 单个模型的熔断器
+// 连续失败达到阈值后打开，冷却结束后放行一个试探请求，成功则恢复，失败则继续熔断
+type CircuitBreaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+func NewCircuitBreaker(name string, threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{name: name, threshold: max(threshold, 1), cooldown: cooldown}
+}
+
+// Allow 是否允许发起请求
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// 试探请求进行中，其他请求继续走后备模型
+		return false
+	default:
+		return true
+	}
+}
+
+// Success 记录一次成功
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != breakerClosed {
+		log.Printf("[AI] 模型 %s 已恢复", b.name)
+	}
+	b.state = breakerClosed
+	b.failures = 0
+}
+
+// Failure 记录一次临时错误导致的失败
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		if b.state != breakerOpen {
+			log.Printf("[AI] 模型 %s 连续失败 %d 次，熔断 %v", b.name, b.failures, b.cooldown)
+		}
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// Release 放弃本次请求（例如 ctx 取消），半开状态下允许下一个试探请求
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.state = breakerOpen
+		b.openedAt = time.Time{}
+	}
+}
+
+// Candidate 后备列表中的一个模型
+type Candidate[M any] struct {
+	Name  string
+	Model M
+}
+
+type candidate[M any] struct {
+	name    string
+	model   M
+	breaker *CircuitBreaker
+}
+
+// Resilient 按顺序尝试多个模型：临时错误按退避重试，重试用尽或熔断时切换到下一个模型
+type Resilient[M any] struct {
+	policy     RetryPolicy
+	candidates []*candidate[M]
+}
+
+func NewResilient[M any](policy RetryPolicy, candidates ...Candidate[M]) *Resilient[M] {
+	r := &Resilient[M]{policy: policy}
+	for _, c := range candidates {
+		r.candidates = append(r.candidates, &candidate[M]{
+			name:    c.Name,
+			model:   c.Model,
+			breaker: NewCircuitBreaker(c.Name, policy.BreakerThreshold, policy.BreakerCooldown),
+		})
+	}
+	return r
+}
+
+// Do 执行一次 AI 调用，op 用于日志
+func (r *Resilient[M]) Do(ctx context.Context, op string, fn func(ctx context.Context, model M) error) error {
+	var lastErr error
+	for _, c := range r.candidates {
+		if !c.breaker.Allow() {
+			continue
+		}
+
+		err := r.try(ctx, op, c, fn)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !IsRetryable(err) {
+			return err
+		}
+		lastErr = err
+		log.Printf("[AI] %s: 模型 %s 不可用，尝试下一个: %v", op, c.name, err)
+	}
+
+	if lastErr == nil {
+		return ErrCircuitOpen
+	}
+	return lastErr
+}
+
+// try 在单个模型上按策略重试
+func (r *Resilient[M]) try(ctx context.Context, op string, c *candidate[M], fn func(ctx context.Context, model M) error) error {
+	attempts := max(r.policy.Attempts, 1)
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx, c.model)
+		if err == nil {
+			c.breaker.Success()
+			return nil
+		}
+		if ctx.Err() != nil {
+			c.breaker.Release()
+			return err
+		}
+		if !IsRetryable(err) {
+			// 请求本身有问题，不代表模型不可用
+			c.breaker.Success()
+			return err
+		}
+
+		c.breaker.Failure()
+		if attempt >= attempts || !c.breaker.Allow() {
+			return err
+		}
+		wait := r.policy.backoff(attempt)
+		log.Printf("[AI] %s: 模型 %s 调用失败 (尝试 %d/%d): %v, 等待 %v 后重试", op, c.name, attempt, attempts, err, wait)
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// ResilientChat 带重试、熔断和后备模型的对话模型
+type ResilientChat struct{ r *Resilient[ChatModel] }
+
+func NewResilientChat(policy RetryPolicy, candidates ...Candidate[ChatModel]) *ResilientChat {
+	return &ResilientChat{r: NewResilient(policy, candidates...)}
+}
+
+func (m *ResilientChat) Chat(ctx context.Context, req ChatRequest) (string, error) {
+	var reply string
+	err := m.r.Do(ctx, "chat", func(ctx context.Context, model ChatModel) (err error) {
+		reply, err = model.Chat(ctx, req)
+		return err
+	})
+	return reply, err
+}
+
+// ChatStream 只在输出第一段内容之前重试和切换模型，已经开始输出后的错误原样传给调用方
+func (m *ResilientChat) ChatStream(ctx context.Context, req ChatRequest) (<-chan StreamChunk, error) {
+	var out <-chan StreamChunk
+	err := m.r.Do(ctx, "chat_stream", func(ctx context.Context, model ChatModel) error {
+		chunks, err := model.ChatStream(ctx, req)
+		if err != nil {
+			return err
+		}
+		// 部分实现（如 Gemini）在读取第一段时才返回连接错误
+		first, ok := <-chunks
+		if !ok {
+			// 没有输出任何内容就结束，按空响应重试
+			return ErrEmptyResponse
+		}
+		if first.Err != nil {
+			return first.Err
+		}
+		out = prependChunk(ctx, first, chunks)
+		return nil
+	})
+	return out, err
+}
+
+// prependChunk 把已读取的第一段放回流的开头
+func prependChunk(ctx context.Context, first StreamChunk, rest <-chan StreamChunk) <-chan StreamChunk {
+	ch := make(chan StreamChunk, 10)
+	go func() {
+		defer close(ch)
+		if !sendChunk(ctx, ch, first) {
+			return
+		}
+		for chunk := range rest {
+			if !sendChunk(ctx, ch, chunk) {
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// ResilientText 带重试、熔断和后备模型的文本模型
+type ResilientText struct{ r *Resilient[TextModel] }
+
+func NewResilientText(policy RetryPolicy, candidates ...Candidate[TextModel]) *ResilientText {
+	return &ResilientText{r: NewResilient(policy, candidates...)}
+}
+
+func (m *ResilientText) GenerateText(ctx context.Context, prompt string, temperature float32) (string, error) {
+	var text string
+	err := m.r.Do(ctx, "text", func(ctx context.Context, model TextModel) (err error) {
+		text, err = model.GenerateText(ctx, prompt, temperature)
+		return err
+	})
+	return text, err
+}
+
+// ResilientImage 带重试、熔断和后备模型的图片生成模型
+type ResilientImage struct{ r *Resilient[ImageModel] }
+
+func NewResilientImage(policy RetryPolicy, candidates ...Candidate[ImageModel]) *ResilientImage {
+	return &ResilientImage{r: NewResilient(policy, candidates...)}
+}
+
+func (m *ResilientImage) GenerateImage(ctx context.Context, prompt string) (*Image, error) {
+	var image *Image
+	err := m.r.Do(ctx, "image", func(ctx context.Context, model ImageModel) (err error) {
+		image, err = model.GenerateImage(ctx, prompt)
+		return err
+	})
+	return image, err
+}
+
+// ResilientVision 带重试、熔断和后备模型的图片理解模型
+type ResilientVision struct{ r *Resilient[VisionModel] }
+
+func NewResilientVision(policy RetryPolicy, candidates ...Candidate[VisionModel]) *ResilientVision {
+	return &ResilientVision{r: NewResilient(policy, candidates...)}
+}
+
+func (m *ResilientVision) DescribeImage(ctx context.Context, prompt string, image *Image) (string, error) {
+	var description string
+	err := m.r.Do(ctx, "vision", func(ctx context.Context, model VisionModel) (err error) {
+		description, err = model.DescribeImage(ctx, prompt, image)
+		return err
+	})
+	return description, err
+}
@@ -0,0 +1,249 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// textFunc 用函数实现 TextModel
+type textFunc func(ctx context.Context) (string, error)
+
+func (f textFunc) GenerateText(ctx context.Context, prompt string, temperature float32) (string, error) {
+	return f(ctx)
+}
+
+// countingText 记录调用次数，依次返回 errs，用完后返回 name
+func countingText(name string, calls *int, errs ...error) TextModel {
+	return textFunc(func(ctx context.Context) (string, error) {
+		*calls++
+		if *calls <= len(errs) {
+			return "", errs[*calls-1]
+		}
+		return name, nil
+	})
+}
+
+// testPolicy 不等待的重试策略
+var testPolicy = RetryPolicy{Attempts: 3, BreakerThreshold: 5, BreakerCooldown: time.Hour}
+
+var (
+	errUnavailable = &OpenAIError{StatusCode: 503, Message: "overloaded"}
+	errBadRequest  = &OpenAIError{StatusCode: 400, Message: "invalid prompt"}
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"canceled", context.Canceled, false},
+		{"deadline", fmt.Errorf("call: %w", context.DeadlineExceeded), true},
+		{"empty response", ErrEmptyResponse, true},
+		{"openai 429", &OpenAIError{StatusCode: 429}, true},
+		{"openai 500", &OpenAIError{StatusCode: 500}, true},
+		{"openai 400", &OpenAIError{StatusCode: 400}, false},
+		{"openai 401", &OpenAIError{StatusCode: 401}, false},
+		{"gemini 503", genai.APIError{Code: 503}, true},
+		{"gemini 403", genai.APIError{Code: 403}, false},
+		{"unexpected eof", fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{"net error", &net.OpError{Op: "dial", Err: errors.New("refused")}, true},
+		{"message marker", errors.New("rpc error: RESOURCE_EXHAUSTED"), true},
+		{"safety block", errors.New("response blocked by safety filters"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	b := NewCircuitBreaker("test", 2, 20*time.Millisecond)
+
+	// 未达到阈值时保持关闭
+	b.Failure()
+	if !b.Allow() {
+		t.Fatal("breaker opened before threshold")
+	}
+	b.Failure()
+	if b.Allow() {
+		t.Fatal("breaker closed after threshold")
+	}
+
+	// 冷却结束后只放行一个试探请求，失败后重新打开
+	time.Sleep(30 * time.Millisecond)
+	if !b.Allow() {
+		t.Fatal("probe not allowed after cooldown")
+	}
+	if b.Allow() {
+		t.Fatal("second request allowed while half-open")
+	}
+	b.Failure()
+	if b.Allow() {
+		t.Fatal("breaker not reopened after failed probe")
+	}
+
+	// 放弃的试探请求不影响下一次试探
+	time.Sleep(30 * time.Millisecond)
+	if !b.Allow() {
+		t.Fatal("probe not allowed after cooldown")
+	}
+	b.Release()
+	if !b.Allow() {
+		t.Fatal("probe not allowed after release")
+	}
+
+	// 试探成功后恢复
+	b.Success()
+	for i := 0; i < 3; i++ {
+		if !b.Allow() {
+			t.Fatalf("request %d rejected after recovery", i)
+		}
+	}
+}
+
+func TestResilientRetry(t *testing.T) {
+	tests := []struct {
+		name          string
+		primaryErrs   []error
+		want          string
+		wantErr       error
+		wantPrimary   int
+		wantSecondary int
+	}{
+		{"success", nil, "primary", nil, 1, 0},
+		{"retry then success", []error{errUnavailable, errUnavailable}, "primary", nil, 3, 0},
+		{"fallback after retries", []error{errUnavailable, errUnavailable, errUnavailable}, "secondary", nil, 3, 1},
+		// 非临时错误不重试也不切换模型
+		{"no retry", []error{errBadRequest}, "", errBadRequest, 1, 0},
+		{"no retry after retryable", []error{errUnavailable, errBadRequest}, "", errBadRequest, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var primary, secondary int
+			m := NewResilientText(testPolicy,
+				Candidate[TextModel]{Name: "primary", Model: countingText("primary", &primary, tt.primaryErrs...)},
+				Candidate[TextModel]{Name: "secondary", Model: countingText("secondary", &secondary)},
+			)
+			got, err := m.GenerateText(context.Background(), "prompt", 0)
+			if got != tt.want || !errors.Is(err, tt.wantErr) {
+				t.Errorf("GenerateText = %q, %v; want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+			if primary != tt.wantPrimary || secondary != tt.wantSecondary {
+				t.Errorf("calls = %d/%d, want %d/%d", primary, secondary, tt.wantPrimary, tt.wantSecondary)
+			}
+		})
+	}
+}
+
+func TestResilientBreakerSkipsModel(t *testing.T) {
+	policy := RetryPolicy{Attempts: 1, BreakerThreshold: 2, BreakerCooldown: time.Hour}
+	var primary, secondary int
+	failures := []error{errUnavailable, errUnavailable, errUnavailable}
+	m := NewResilientText(policy,
+		Candidate[TextModel]{Name: "primary", Model: countingText("primary", &primary, failures...)},
+		Candidate[TextModel]{Name: "secondary", Model: countingText("secondary", &secondary)},
+	)
+
+	// 连续失败达到阈值后直接使用后备模型
+	for i := 0; i < 4; i++ {
+		if got, err := m.GenerateText(context.Background(), "prompt", 0); got != "secondary" || err != nil {
+			t.Fatalf("call %d = %q, %v", i, got, err)
+		}
+	}
+	if primary != 2 || secondary != 4 {
+		t.Errorf("calls = %d/%d, want 2/4", primary, secondary)
+	}
+
+	// 所有模型都熔断
+	only := NewResilientText(policy, Candidate[TextModel]{Name: "only", Model: countingText("only", new(int), failures...)})
+	only.GenerateText(context.Background(), "prompt", 0)
+	only.GenerateText(context.Background(), "prompt", 0)
+	if _, err := only.GenerateText(context.Background(), "prompt", 0); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("err = %v, want ErrCircuitOpen", err)
+	}
+}
+
+func TestResilientCancelDuringBackoff(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour, BreakerThreshold: 5, BreakerCooldown: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	var primary, secondary int
+	m := NewResilientText(policy,
+		Candidate[TextModel]{Name: "primary", Model: textFunc(func(context.Context) (string, error) {
+			primary++
+			cancel()
+			return "", errUnavailable
+		})},
+		Candidate[TextModel]{Name: "secondary", Model: countingText("secondary", &secondary)},
+	)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.GenerateText(ctx, "prompt", 0)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("err = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("backoff ignored cancellation")
+	}
+	// 取消后不再重试也不切换模型
+	if primary != 1 || secondary != 0 {
+		t.Errorf("calls = %d/%d, want 1/0", primary, secondary)
+	}
+}
+
+// emptyStream 输出任何内容之前就关闭的流
+type emptyStream struct{ calls int }
+
+func (m *emptyStream) Chat(ctx context.Context, req ChatRequest) (string, error) {
+	return "", ErrEmptyResponse
+}
+
+func (m *emptyStream) ChatStream(ctx context.Context, req ChatRequest) (<-chan StreamChunk, error) {
+	m.calls++
+	ch := make(chan StreamChunk)
+	close(ch)
+	return ch, nil
+}
+
+func TestResilientChatStreamEmpty(t *testing.T) {
+	policy := RetryPolicy{Attempts: 2, BreakerThreshold: 5, BreakerCooldown: time.Hour}
+	empty := &emptyStream{}
+	m := NewResilientChat(policy, Candidate[ChatModel]{Name: "empty", Model: empty})
+	if _, err := m.ChatStream(context.Background(), testChatRequest); !errors.Is(err, ErrEmptyResponse) {
+		t.Errorf("err = %v, want ErrEmptyResponse", err)
+	}
+	if empty.calls != 2 {
+		t.Errorf("calls = %d, want 2", empty.calls)
+	}
+
+	// 有后备模型时切换
+	fake := NewFake()
+	fake.Script(FakeMethodChatStream, FakeResponse{Text: "hello"})
+	m = NewResilientChat(policy,
+		Candidate[ChatModel]{Name: "empty", Model: &emptyStream{}},
+		Candidate[ChatModel]{Name: "fake", Model: fake},
+	)
+	chunks, err := m.ChatStream(context.Background(), testChatRequest)
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+	if text, _, err := readStream(t, chunks); text != "hello" || err != nil {
+		t.Errorf("stream = %q, %v", text, err)
+	}
+}
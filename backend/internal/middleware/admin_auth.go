@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"lauraai-backend/internal/config"
+	"lauraai-backend/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuthMiddleware 校验管理接口密钥（X-Admin-Key）
+// 未配置 ADMIN_API_KEY 时拒绝所有请求
+func AdminAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := config.AppConfig.AdminAPIKey
+		got := c.GetHeader("X-Admin-Key")
+		if key == "" || subtle.ConstantTimeCompare([]byte(got), []byte(key)) != 1 {
+			response.ErrorWithStatus(c, 403, 403, "Forbidden")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+
+	"lauraai-backend/internal/ratelimit"
+	"lauraai-backend/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitMiddleware 按当前用户和分组限流，需要放在 TelegramAuthMiddleware 之后
+// 超出时返回 429 和 Retry-After（秒）；X-RateLimit-Limit、X-RateLimit-Remaining 为桶容量和剩余次数
+func RateLimitMiddleware(limiter *ratelimit.Limiter, group string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := GetUserFromContext(c)
+		if !exists || !limiter.Limit(group).Enabled() {
+			c.Next()
+			return
+		}
+
+		result := limiter.Allow(c.Request.Context(), group, user.ID)
+		SetRateLimitHeaders(c, limiter.Limit(group), result)
+		if !result.Allowed {
+			response.ErrorWithStatus(c, 429, 429, "Too many requests, please try again later")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// SetRateLimitHeaders 写入限流响应头
+func SetRateLimitHeaders(c *gin.Context, limit ratelimit.Limit, result ratelimit.Result) {
+	c.Header("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	if !result.Allowed {
+		c.Header("Retry-After", strconv.Itoa(RetryAfterSeconds(result)))
+	}
+}
+
+// RetryAfterSeconds 需要等待的秒数（向上取整，至少 1 秒）
+func RetryAfterSeconds(result ratelimit.Result) int {
+	return max(1, int(math.Ceil(result.RetryAfter.Seconds())))
+}
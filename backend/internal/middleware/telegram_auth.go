@@ -1,7 +1,9 @@
 package middleware
 
 import (
+	"encoding/base64"
 	"log"
+	"strings"
 
 	"lauraai-backend/internal/config"
 	"lauraai-backend/internal/model"
@@ -10,10 +12,15 @@ import (
 	"lauraai-backend/pkg/response"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 )
 
 const UserContextKey = "user"
 
+// WSAuthProtocol WebSocket 认证子协议：浏览器无法为 WebSocket 设置请求头，
+// 客户端使用 new WebSocket(url, ["tma-auth", base64url(initData)]) 在 Sec-WebSocket-Protocol 中传递 initData
+const WSAuthProtocol = "tma-auth"
+
 // 默认测试账号的 Telegram ID
 const DefaultTestTelegramID int64 = 999999999
 
@@ -51,12 +58,8 @@ func TelegramAuthMiddleware() gin.HandlerFunc {
 		}
 
 		// 生产模式：正常进行 Telegram 验证
-		// 从 Header 或 Query 获取 initData
 		log.Printf("TelegramAuth: 请求路径=%s, 方法=%s", c.Request.URL.Path, c.Request.Method)
-		initData := c.GetHeader("X-Telegram-Init-Data")
-		if initData == "" {
-			initData = c.Query("initData")
-		}
+		initData := telegramInitData(c)
 
 		if initData == "" {
 			log.Printf("TelegramAuth: 缺少 initData")
@@ -112,6 +115,26 @@ func TelegramAuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// telegramInitData 从请求头获取 initData，WebSocket 连接从子协议中获取
+// initData 不通过 URL 传递，避免写入访问日志
+func telegramInitData(c *gin.Context) string {
+	if initData := c.GetHeader("X-Telegram-Init-Data"); initData != "" {
+		return initData
+	}
+	protocols := websocket.Subprotocols(c.Request)
+	for i, protocol := range protocols {
+		if protocol != WSAuthProtocol || i+1 >= len(protocols) {
+			continue
+		}
+		initData, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(protocols[i+1], "="))
+		if err != nil {
+			return ""
+		}
+		return string(initData)
+	}
+	return ""
+}
+
 // GetUserFromContext 从上下文获取用户
 func GetUserFromContext(c *gin.Context) (*model.User, bool) {
 	user, exists := c.Get(UserContextKey)
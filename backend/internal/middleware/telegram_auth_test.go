@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTelegramInitData(t *testing.T) {
+	const initData = "query_id=AAH&user=%7B%22id%22%3A1%7D&auth_date=1700000000&hash=abc"
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(initData))
+
+	tests := []struct {
+		name     string
+		header   string
+		protocol string
+		query    string
+		want     string
+	}{
+		{name: "header", header: initData, want: initData},
+		{name: "websocket protocol", protocol: WSAuthProtocol + ", " + encoded, want: initData},
+		{name: "padded protocol", protocol: WSAuthProtocol + ", " + base64.URLEncoding.EncodeToString([]byte(initData)), want: initData},
+		{name: "header wins", header: initData, protocol: WSAuthProtocol + ", " + base64.RawURLEncoding.EncodeToString([]byte("other")), want: initData},
+		{name: "protocol without value", protocol: WSAuthProtocol},
+		{name: "invalid encoding", protocol: WSAuthProtocol + ", not*base64"},
+		// URL 中的 initData 会写入访问日志，不再接受
+		{name: "query ignored", query: "?initData=" + encoded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/ws"+tt.query, nil)
+			if tt.header != "" {
+				c.Request.Header.Set("X-Telegram-Init-Data", tt.header)
+			}
+			if tt.protocol != "" {
+				c.Request.Header.Set("Sec-WebSocket-Protocol", tt.protocol)
+			}
+			if got := telegramInitData(c); got != tt.want {
+				t.Errorf("telegramInitData() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
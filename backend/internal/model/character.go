@@ -80,11 +80,17 @@ type Character struct {
 	FullBlurImageURL string       `gorm:"type:text" json:"full_blur_image_url"` // 100% 模糊
 	HalfBlurImageURL string       `gorm:"type:text" json:"half_blur_image_url"` // 50% 模糊
 	ClearImageURL    string       `gorm:"type:text" json:"clear_image_url"`     // 清晰原图
+	// 图片在存储中的 key（/uploads/<key>），用于按图片精确查找所属角色
+	FullBlurImageKey string       `gorm:"type:varchar(255);index" json:"-"`
+	HalfBlurImageKey string       `gorm:"type:varchar(255);index" json:"-"`
+	ClearImageKey    string       `gorm:"type:varchar(255);index" json:"-"`
 	
 	// 解锁状态
 	UnlockStatus     UnlockStatus `gorm:"type:int;default:0" json:"unlock_status"` // 0=未解锁, 1=半解锁, 2=完全解锁
-	UnlockHelperID   *uint64      `gorm:"index" json:"unlock_helper_id,omitempty"`
+	UnlockHelperID   *uint64      `gorm:"index" json:"unlock_helper_id,omitempty"` // 首位助力者，全部助力记录见 unlock_helps
 	ShareCode        string       `gorm:"type:varchar(20);uniqueIndex" json:"share_code"`
+	// 所有者订阅有效时由 handler 设置，不落库；存储的 UnlockStatus 不变，订阅失效后自动回退
+	SubscriptionUnlocked bool     `gorm:"-" json:"-"`
 	
 	CreatedAt       time.Time     `json:"created_at"`
 	UpdatedAt       time.Time     `json:"updated_at"`
@@ -117,9 +123,17 @@ func (c *Character) GetDisplayImageURL() string {
 	}
 }
 
+// EffectiveUnlockStatus 返回展示用的解锁状态：订阅有效期内视为完全解锁
+func (c *Character) EffectiveUnlockStatus() UnlockStatus {
+	if c.SubscriptionUnlocked {
+		return UnlockStatusFullUnlocked
+	}
+	return c.UnlockStatus
+}
+
 // IsDescriptionVisible 性格报告是否可见（仅完全解锁时可见）
 func (c *Character) IsDescriptionVisible() bool {
-	return c.UnlockStatus == UnlockStatusFullUnlocked
+	return c.EffectiveUnlockStatus() == UnlockStatusFullUnlocked
 }
 
 // GetDescription 根据语言获取描述
@@ -228,12 +242,12 @@ func (c *Character) GetDistance(locale string) string {
 	return c.DistanceEn
 }
 
-// normalizeImageURL 将图片URL规范化：
+// NormalizeImageURL 将图片URL规范化：
 // - 如果是完整URL（http/https开头），提取相对路径部分
 // - 如果是base64（data:开头），直接返回
 // - 如果已经是相对路径，直接返回
 // - 如果是空字符串，返回空字符串
-func normalizeImageURL(url string) string {
+func NormalizeImageURL(url string) string {
 	if url == "" {
 		return ""
 	}
@@ -278,20 +292,25 @@ func (c *Character) ToSafeResponse(locale string) map[string]interface{} {
 		"ethnicity":     c.Ethnicity,
 		"compatibility": c.Compatibility,
 		"astro_sign":    c.AstroSign,
-		"unlock_status": c.UnlockStatus,
+		"unlock_status": c.EffectiveUnlockStatus(),
 		"share_code":    c.ShareCode,
 		"created_at":    c.CreatedAt,
 		"updated_at":    c.UpdatedAt,
 	}
 
+	if c.SubscriptionUnlocked {
+		result["subscription_unlocked"] = true
+	}
+
 	// 根据解锁状态决定返回哪些图片 URL
 	// 规范化URL：将完整URL转换为相对路径，兼容旧数据
-	switch c.UnlockStatus {
+	switch c.EffectiveUnlockStatus() {
 	case UnlockStatusFullUnlocked:
 		// 完全解锁：返回所有图片和报告（根据语言）
-		normalizedClear := normalizeImageURL(c.ClearImageURL)
-		normalizedFullBlur := normalizeImageURL(c.FullBlurImageURL)
-		normalizedHalfBlur := normalizeImageURL(c.HalfBlurImageURL)
+		// 清晰图和半模糊图需要由 handler 签名后才能访问，完全模糊图可公开访问
+		normalizedClear := NormalizeImageURL(c.ClearImageURL)
+		normalizedFullBlur := NormalizeImageURL(c.FullBlurImageURL)
+		normalizedHalfBlur := NormalizeImageURL(c.HalfBlurImageURL)
 		result["image_url"] = normalizedClear
 		result["full_blur_image_url"] = normalizedFullBlur
 		result["half_blur_image_url"] = normalizedHalfBlur
@@ -306,15 +325,15 @@ func (c *Character) ToSafeResponse(locale string) map[string]interface{} {
 		result["weakness"] = c.GetWeakness(locale)
 	case UnlockStatusHalfUnlocked:
 		// 半解锁：只返回模糊图，不返回清晰图和报告
-		normalizedHalfBlur := normalizeImageURL(c.HalfBlurImageURL)
-		normalizedFullBlur := normalizeImageURL(c.FullBlurImageURL)
+		normalizedHalfBlur := NormalizeImageURL(c.HalfBlurImageURL)
+		normalizedFullBlur := NormalizeImageURL(c.FullBlurImageURL)
 		result["image_url"] = normalizedHalfBlur
 		result["full_blur_image_url"] = normalizedFullBlur
 		result["half_blur_image_url"] = normalizedHalfBlur
 		// 不返回 clear_image_url 和报告内容
 	default:
 		// 未解锁：只返回完全模糊图
-		normalizedFullBlur := normalizeImageURL(c.FullBlurImageURL)
+		normalizedFullBlur := NormalizeImageURL(c.FullBlurImageURL)
 		result["image_url"] = normalizedFullBlur
 		result["full_blur_image_url"] = normalizedFullBlur
 		// 不返回 half_blur_image_url, clear_image_url 和报告内容
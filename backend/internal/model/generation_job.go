@@ -0,0 +1,76 @@
+package model
+
+import (
+	"time"
+)
+
+// GenerationJobStatus 生成任务状态
+type GenerationJobStatus string
+
+const (
+	GenerationJobPending   GenerationJobStatus = "pending"
+	GenerationJobRunning   GenerationJobStatus = "running"
+	GenerationJobCompleted GenerationJobStatus = "completed"
+	GenerationJobFailed    GenerationJobStatus = "failed"
+)
+
+// GenerationJobStage 生成任务当前阶段，按顺序推进
+type GenerationJobStage string
+
+const (
+	GenerationStageQueued   GenerationJobStage = "queued"
+	GenerationStageImage    GenerationJobStage = "image"     // 生成清晰图
+	GenerationStageBlur     GenerationJobStage = "blur"      // 生成模糊版本
+	GenerationStageReportEn GenerationJobStage = "report_en" // 生成英文报告
+	GenerationStageReportZh GenerationJobStage = "report_zh" // 翻译中文报告
+	GenerationStageReportRu GenerationJobStage = "report_ru" // 翻译俄文报告
+	GenerationStageDone     GenerationJobStage = "done"
+)
+
+// GenerationJobStages 阶段顺序，用于计算进度
+var GenerationJobStages = []GenerationJobStage{
+	GenerationStageQueued,
+	GenerationStageImage,
+	GenerationStageBlur,
+	GenerationStageReportEn,
+	GenerationStageReportZh,
+	GenerationStageReportRu,
+	GenerationStageDone,
+}
+
+// GenerationJob 角色图片和报告的异步生成任务
+// 任务完成前角色不会出现在角色列表中
+type GenerationJob struct {
+	ID          uint64              `gorm:"primaryKey" json:"id"`
+	UserID      uint64              `gorm:"index;not null" json:"user_id"`
+	CharacterID uint64              `gorm:"index;not null" json:"character_id"`
+	Status      GenerationJobStatus `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"`
+	Stage       GenerationJobStage  `gorm:"type:varchar(20);not null;default:'queued'" json:"stage"`
+	Error       string              `gorm:"type:text" json:"error,omitempty"`
+	StartedAt   *time.Time          `json:"started_at,omitempty"`
+	FinishedAt  *time.Time          `json:"finished_at,omitempty"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+}
+
+// IsFinished 任务是否已结束（成功或失败）
+func (j *GenerationJob) IsFinished() bool {
+	return j.Status == GenerationJobCompleted || j.Status == GenerationJobFailed
+}
+
+// Progress 按阶段估算的进度百分比
+func (j *GenerationJob) Progress() int {
+	if j.Status == GenerationJobCompleted {
+		return 100
+	}
+	for i, stage := range GenerationJobStages {
+		if stage == j.Stage {
+			return i * 100 / (len(GenerationJobStages) - 1)
+		}
+	}
+	return 0
+}
+
+func (GenerationJob) TableName() string {
+	return "generation_jobs"
+}
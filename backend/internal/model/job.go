@@ -0,0 +1,43 @@
+package model
+
+import (
+	"time"
+)
+
+// JobStatus 后台任务状态
+type JobStatus string
+
+const (
+	JobStatusPending   JobStatus = "pending"   // 等待执行（包括等待重试）
+	JobStatusRunning   JobStatus = "running"   // 已被 worker 领取
+	JobStatusSucceeded JobStatus = "succeeded" // 执行成功
+	JobStatusDead      JobStatus = "dead"      // 重试次数用尽或不可重试的错误，需要人工处理
+)
+
+// Job 持久化的后台任务，worker 通过 SELECT ... FOR UPDATE SKIP LOCKED 领取
+// DedupKey 相同的任务同一时间只能有一个未结束（pending/running），例如同一角色的报告生成
+type Job struct {
+	ID          uint64     `gorm:"primaryKey" json:"id"`
+	Type        string     `gorm:"type:varchar(50);not null;index" json:"type"`
+	Payload     string     `gorm:"type:text;not null" json:"payload"` // JSON
+	DedupKey    *string    `gorm:"type:varchar(100)" json:"dedup_key,omitempty"`
+	Status      JobStatus  `gorm:"type:varchar(20);not null;default:'pending';index:idx_jobs_status_run_at,priority:1" json:"status"`
+	RunAt       time.Time  `gorm:"not null;index:idx_jobs_status_run_at,priority:2" json:"run_at"` // 最早执行时间，重试时按退避时间推后
+	Attempts    int        `gorm:"type:int;not null;default:0" json:"attempts"`
+	MaxAttempts int        `gorm:"type:int;not null;default:5" json:"max_attempts"`
+	LockedAt    *time.Time `json:"locked_at,omitempty"`
+	LockedBy    string     `gorm:"type:varchar(100)" json:"locked_by,omitempty"`
+	LastError   string     `gorm:"type:text" json:"last_error,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// IsLastAttempt 当前是否是最后一次尝试（失败后将进入 dead 状态）
+func (j *Job) IsLastAttempt() bool {
+	return j.Attempts >= j.MaxAttempts
+}
+
+func (Job) TableName() string {
+	return "jobs"
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"time"
+)
+
+// ConversationSummary 角色与用户较早聊天记录的滚动摘要
+// 超出上下文窗口的消息会定期合并进摘要，两个游标记录已处理到的消息 ID
+type ConversationSummary struct {
+	ID          uint64 `gorm:"primaryKey" json:"id"`
+	UserID      uint64 `gorm:"index;not null" json:"user_id"`
+	CharacterID uint64 `gorm:"uniqueIndex;not null" json:"character_id"`
+	Summary     string `gorm:"type:text" json:"summary"`
+	// SummarizedUntilID 已合并进摘要的最后一条消息 ID
+	SummarizedUntilID uint64 `gorm:"default:0" json:"summarized_until_id"`
+	// FactsExtractedUntilID 已提取事实的最后一条消息 ID
+	FactsExtractedUntilID uint64    `gorm:"default:0" json:"facts_extracted_until_id"`
+	CreatedAt             time.Time `json:"created_at"`
+	UpdatedAt             time.Time `json:"updated_at"`
+}
+
+func (ConversationSummary) TableName() string {
+	return "conversation_summaries"
+}
+
+// MemoryFact 从聊天中提取的关于用户的长期事实（宠物名字、职业等）
+// 同一角色下 Key 唯一，新的事实会覆盖旧值
+type MemoryFact struct {
+	ID          uint64 `gorm:"primaryKey" json:"id"`
+	UserID      uint64 `gorm:"index;not null" json:"user_id"`
+	CharacterID uint64 `gorm:"uniqueIndex:idx_memory_facts_character_key;not null" json:"character_id"`
+	Key         string `gorm:"type:varchar(64);uniqueIndex:idx_memory_facts_character_key;not null" json:"key"`
+	Value       string `gorm:"type:text;not null" json:"value"`
+	// SourceMessageID 提取该事实时处理到的最后一条消息
+	SourceMessageID uint64    `json:"source_message_id"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+func (MemoryFact) TableName() string {
+	return "memory_facts"
+}
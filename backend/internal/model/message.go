@@ -19,6 +19,17 @@ type Message struct {
 	CharacterID uint64    `gorm:"index;not null" json:"character_id"`
 	SenderType  SenderType `gorm:"type:varchar(20);not null" json:"sender_type"`
 	Content     string    `gorm:"type:text;not null" json:"content"`
+	// Interrupted 生成过程中被取消或断开，内容只是部分回复
+	Interrupted bool `gorm:"not null;default:false" json:"interrupted"`
+	// PromptTokens、CompletionTokens 生成这条回复消耗的 token 数（只有角色回复有）
+	PromptTokens     int `gorm:"default:0" json:"prompt_tokens,omitempty"`
+	CompletionTokens int `gorm:"default:0" json:"completion_tokens,omitempty"`
+	// VersionGroupID 同一位置的多个版本（重新生成或编辑分支）共享的分组，等于第一个版本的 ID；0 表示只有一个版本
+	VersionGroupID uint64 `gorm:"index;default:0" json:"version_group_id,omitempty"`
+	// Inactive 不在当前对话分支上（被替换的版本或被隐藏的后续对话）
+	Inactive bool `gorm:"not null;default:false" json:"-"`
+	// BranchOf 切换版本时被隐藏的后续消息所属的版本 ID，切回该版本时恢复
+	BranchOf uint64 `gorm:"index;default:0" json:"-"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"time"
+)
+
+type PaymentMethod string
+
+const (
+	PaymentMethodStars PaymentMethod = "stars"
+	PaymentMethodTON   PaymentMethod = "ton"
+)
+
+type PaymentStatus string
+
+const (
+	PaymentStatusPending   PaymentStatus = "pending"   // 已创建发票/转账信息，等待支付
+	PaymentStatusSucceeded PaymentStatus = "succeeded" // 支付成功并已解锁
+	PaymentStatusRefunded  PaymentStatus = "refunded"  // 已退款
+	PaymentStatusFailed    PaymentStatus = "failed"    // 已扣款但无法完成解锁，等待人工处理
+)
+
+// Payment 支付流水，每次解锁都会记录一条
+// 不声明 User/Character 关联，避免外键约束导致删除账号时流水丢失
+type Payment struct {
+	ID          uint64        `gorm:"primaryKey" json:"id"`
+	UserID      uint64        `gorm:"index;not null" json:"user_id"`
+	CharacterID uint64        `gorm:"index;not null" json:"character_id"`
+	Method      PaymentMethod `gorm:"type:varchar(20);not null" json:"method"`
+	Amount      int64         `gorm:"not null" json:"amount"` // Stars 数量，或 nanoTON
+	// 外部交易号：Stars 为 telegram_payment_charge_id，TON 为交易 hash
+	ExternalTxID *string       `gorm:"type:varchar(128);uniqueIndex" json:"external_tx_id,omitempty"`
+	Payload      string        `gorm:"type:varchar(128);index" json:"-"` // Stars 发票 payload 或 TON 备注
+	Status       PaymentStatus `gorm:"type:varchar(20);index;not null" json:"status"`
+	PaidAt       *time.Time    `json:"paid_at,omitempty"`
+
+	// 支付前的解锁状态，退款时恢复到该状态
+	PreviousUnlockStatus UnlockStatus `gorm:"type:int;default:0" json:"previous_unlock_status"`
+	RefundedAt           *time.Time   `json:"refunded_at,omitempty"`
+	RefundReason         string       `gorm:"type:varchar(255)" json:"refund_reason,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Payment) TableName() string {
+	return "payments"
+}
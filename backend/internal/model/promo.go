@@ -0,0 +1,96 @@
+package model
+
+import (
+	"time"
+)
+
+type PromoDiscountType string
+
+const (
+	PromoDiscountPercent PromoDiscountType = "percent" // 按百分比折扣
+	PromoDiscountFixed   PromoDiscountType = "fixed"   // 固定金额减免
+)
+
+// PromoCode 优惠码
+type PromoCode struct {
+	ID            uint64            `gorm:"primaryKey" json:"id"`
+	Code          string            `gorm:"type:varchar(50);uniqueIndex;not null" json:"code"`
+	DiscountType  PromoDiscountType `gorm:"type:varchar(20);not null" json:"discount_type"`
+	PercentOff    int               `gorm:"type:int;default:0" json:"percent_off"` // percent 类型：1-100
+	FixedOffStars int64             `gorm:"default:0" json:"fixed_off_stars"`      // fixed 类型：减免的 Stars
+	FixedOffTON   int64             `gorm:"default:0" json:"fixed_off_ton"`        // fixed 类型：减免的 nanoTON
+
+	MaxRedemptions  int `gorm:"type:int;default:0" json:"max_redemptions"`  // 总次数上限，0 表示不限
+	PerUserLimit    int `gorm:"type:int;default:0" json:"per_user_limit"`   // 每个用户次数上限，0 表示不限
+	RedemptionCount int `gorm:"type:int;default:0" json:"redemption_count"` // 已使用次数（含待支付占用的次数）
+
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// 适用的角色类型，为空表示全部适用
+	CharacterTypes []CharacterType `gorm:"type:text;serializer:json" json:"character_types,omitempty"`
+	Active         bool            `gorm:"default:true" json:"active"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AppliesTo 优惠码是否适用于该角色类型
+func (p *PromoCode) AppliesTo(charType CharacterType) bool {
+	if len(p.CharacterTypes) == 0 {
+		return true
+	}
+	for _, t := range p.CharacterTypes {
+		if t == charType {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExpired 优惠码是否已过期
+func (p *PromoCode) IsExpired(now time.Time) bool {
+	return p.ExpiresAt != nil && !now.Before(*p.ExpiresAt)
+}
+
+// Discount 计算优惠金额（不超过原价）
+func (p *PromoCode) Discount(method PaymentMethod, amount int64) int64 {
+	var discount int64
+	switch p.DiscountType {
+	case PromoDiscountPercent:
+		discount = amount * int64(p.PercentOff) / 100
+	case PromoDiscountFixed:
+		if method == PaymentMethodTON {
+			discount = p.FixedOffTON
+		} else {
+			discount = p.FixedOffStars
+		}
+	}
+	if discount > amount {
+		discount = amount
+	}
+	if discount < 0 {
+		discount = 0
+	}
+	return discount
+}
+
+func (PromoCode) TableName() string {
+	return "promo_codes"
+}
+
+// PromoRedemption 优惠码使用记录，每笔支付最多使用一次
+// 创建待支付记录时写入并占用一次使用次数（ReservedAt 非空），支付失败、超时未支付或退款时释放
+type PromoRedemption struct {
+	ID          uint64     `gorm:"primaryKey" json:"id"`
+	PromoCodeID uint64     `gorm:"index;not null" json:"promo_code_id"`
+	UserID      uint64     `gorm:"index;not null" json:"user_id"`
+	CharacterID uint64     `gorm:"index;not null" json:"character_id"`
+	PaymentID   uint64     `gorm:"uniqueIndex;not null" json:"payment_id"`
+	Discount    int64      `gorm:"not null" json:"discount"`
+	ReservedAt  *time.Time `gorm:"index" json:"reserved_at,omitempty"` // 占用次数的时间，为空表示已释放
+	RedeemedAt  *time.Time `gorm:"index" json:"redeemed_at,omitempty"` // 支付成功时间，为空表示未支付或已退款
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func (PromoRedemption) TableName() string {
+	return "promo_redemptions"
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"time"
+)
+
+// ShareLink 角色分享链接（分享码），可设置有效期和最大使用次数，所有者可以撤销并重新生成
+// 角色当前使用的分享码同时保存在 Character.ShareCode 中
+type ShareLink struct {
+	ID          uint64     `gorm:"primaryKey" json:"id"`
+	CharacterID uint64     `gorm:"index;not null" json:"character_id"`
+	Code        string     `gorm:"type:varchar(20);uniqueIndex;not null" json:"code"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	MaxUses     int        `gorm:"type:int;default:0" json:"max_uses"`  // 最大助力次数，0 表示不限
+	UseCount    int        `gorm:"type:int;default:0" json:"use_count"` // 通过该链接完成的助力次数
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// IsRevoked 是否已被所有者撤销
+func (l *ShareLink) IsRevoked() bool {
+	return l.RevokedAt != nil
+}
+
+// IsExpired 是否已过期
+func (l *ShareLink) IsExpired(now time.Time) bool {
+	return l.ExpiresAt != nil && !now.Before(*l.ExpiresAt)
+}
+
+// IsExhausted 是否已达到最大使用次数
+func (l *ShareLink) IsExhausted() bool {
+	return l.MaxUses > 0 && l.UseCount >= l.MaxUses
+}
+
+func (ShareLink) TableName() string {
+	return "share_links"
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"time"
+)
+
+type SubscriptionPlan string
+
+const (
+	SubscriptionPlanPremium SubscriptionPlan = "premium" // 所有角色完全解锁 + AI 生成优先
+)
+
+type SubscriptionStatus string
+
+const (
+	SubscriptionStatusActive   SubscriptionStatus = "active"   // 有效期内，到期自动续费
+	SubscriptionStatusCanceled SubscriptionStatus = "canceled" // 已取消续费，到期前仍然有效
+	SubscriptionStatusRefunded SubscriptionStatus = "refunded" // 已退款，立即失效
+)
+
+// Subscription 用户订阅，每个用户一条，通过 Telegram Stars 订阅发票按月续费
+type Subscription struct {
+	ID        uint64             `gorm:"primaryKey" json:"id"`
+	UserID    uint64             `gorm:"uniqueIndex;not null" json:"user_id"`
+	Plan      SubscriptionPlan   `gorm:"type:varchar(20);not null" json:"plan"`
+	Status    SubscriptionStatus `gorm:"type:varchar(20);not null" json:"status"`
+	StartedAt time.Time          `json:"started_at"`
+	ExpiresAt time.Time          `gorm:"index" json:"expires_at"`
+	// 最近一次扣款的 telegram_payment_charge_id，取消续费时需要
+	LastChargeID string    `gorm:"type:varchar(128)" json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// IsActive 订阅是否在有效期内
+func (s *Subscription) IsActive(now time.Time) bool {
+	return s.Status != SubscriptionStatusRefunded && now.Before(s.ExpiresAt)
+}
+
+func (Subscription) TableName() string {
+	return "subscriptions"
+}
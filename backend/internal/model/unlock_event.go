@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+)
+
+// UnlockActorType 触发解锁状态变化的来源
+type UnlockActorType string
+
+const (
+	UnlockActorHelper   UnlockActorType = "helper"   // 好友助力
+	UnlockActorPayment  UnlockActorType = "payment"  // 用户付费
+	UnlockActorAdmin    UnlockActorType = "admin"    // 管理接口（例如退款）
+	UnlockActorTelegram UnlockActorType = "telegram" // Telegram 推送（例如 refunded_payment）
+)
+
+// UnlockEvent 解锁状态变化审计记录，每次状态转换写一条
+type UnlockEvent struct {
+	ID          uint64          `gorm:"primaryKey" json:"id"`
+	CharacterID uint64          `gorm:"index;not null" json:"character_id"`
+	FromStatus  UnlockStatus    `gorm:"type:int;not null" json:"from_status"`
+	ToStatus    UnlockStatus    `gorm:"type:int;not null" json:"to_status"`
+	ActorType   UnlockActorType `gorm:"type:varchar(20);not null" json:"actor_type"`
+	ActorID     *uint64         `json:"actor_id,omitempty"` // 助力者或付款用户 ID
+	Reason      string          `gorm:"type:varchar(255)" json:"reason"`
+	PaymentID   *uint64         `gorm:"index" json:"payment_id,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+func (UnlockEvent) TableName() string {
+	return "unlock_events"
+}
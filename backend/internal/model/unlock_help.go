@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+)
+
+// UnlockHelp 好友助力记录，一个角色可以有多个助力者
+// 同一个助力者只能帮助同一个用户一次（owner_id + helper_id 唯一）
+type UnlockHelp struct {
+	ID          uint64    `gorm:"primaryKey" json:"id"`
+	CharacterID uint64    `gorm:"index;not null" json:"character_id"`
+	OwnerID     uint64    `gorm:"uniqueIndex:idx_unlock_help_owner_helper;not null" json:"owner_id"`
+	HelperID    uint64    `gorm:"uniqueIndex:idx_unlock_help_owner_helper;not null" json:"helper_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (UnlockHelp) TableName() string {
+	return "unlock_helps"
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+)
+
+// ChatUsage 用户每天（UTC 日期）的对话用量，用于额度限制
+type ChatUsage struct {
+	ID     uint64    `gorm:"primaryKey" json:"-"`
+	UserID uint64    `gorm:"uniqueIndex:idx_chat_usage_user_day;not null" json:"user_id"`
+	Day    time.Time `gorm:"type:date;uniqueIndex:idx_chat_usage_user_day;not null" json:"day"`
+	// Messages 生成的回复条数（包括重新生成和被中断的回复）
+	Messages         int       `gorm:"not null;default:0" json:"messages"`
+	PromptTokens     int64     `gorm:"not null;default:0" json:"prompt_tokens"`
+	CompletionTokens int64     `gorm:"not null;default:0" json:"completion_tokens"`
+	CreatedAt        time.Time `json:"-"`
+	UpdatedAt        time.Time `json:"-"`
+}
+
+func (ChatUsage) TableName() string {
+	return "chat_usage"
+}
+
+// TotalTokens 当天消耗的 token 总数
+func (u *ChatUsage) TotalTokens() int64 {
+	return u.PromptTokens + u.CompletionTokens
+}
@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memorySweepInterval 清理已补满的空闲令牌桶的间隔
+const memorySweepInterval = time.Minute
+
+type memoryBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	expiresAt time.Time
+}
+
+// MemoryStore 进程内的令牌桶，只适用于单实例部署
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*memoryBucket)}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= memorySweepInterval {
+		for k, b := range s.buckets {
+			if now.After(b.expiresAt) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: float64(limit.Burst), updatedAt: now}
+		s.buckets[key] = b
+	}
+	var result Result
+	b.tokens, result = limit.take(b.tokens, b.updatedAt, now)
+	b.updatedAt = now
+	b.expiresAt = now.Add(limit.idleTTL())
+	return result, nil
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// postgresSweepInterval 清理已补满的空闲令牌桶的间隔（每个实例各自计时）
+const postgresSweepInterval = 10 * time.Minute
+
+// rateLimitBucket 令牌桶状态
+type rateLimitBucket struct {
+	BucketKey string    `gorm:"primaryKey;size:128"`
+	Tokens    float64   `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null;autoUpdateTime:false"`
+	// ExpiresAt 空闲到令牌补满的时间，之后可以删除；为空的是添加该字段前写入的行
+	ExpiresAt *time.Time `gorm:"index"`
+}
+
+func (rateLimitBucket) TableName() string {
+	return "rate_limit_buckets"
+}
+
+// PostgresStore 把令牌桶保存在 Postgres 中，多实例共享；每次请求在事务中锁定桶所在行
+type PostgresStore struct {
+	db *gorm.DB
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewPostgresStore 创建存储并建表
+func NewPostgresStore(db *gorm.DB) (*PostgresStore, error) {
+	if err := db.AutoMigrate(&rateLimitBucket{}); err != nil {
+		return nil, err
+	}
+	return &PostgresStore{db: db}, nil
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	s.sweep(ctx, now)
+
+	var result Result
+	expiresAt := now.Add(limit.idleTTL())
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		bucket := rateLimitBucket{BucketKey: key, Tokens: float64(limit.Burst), UpdatedAt: now, ExpiresAt: &expiresAt}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&bucket).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("bucket_key = ?", key).
+			First(&bucket).Error; err != nil {
+			return err
+		}
+
+		var tokens float64
+		tokens, result = limit.take(bucket.Tokens, bucket.UpdatedAt, now)
+		return tx.Model(&rateLimitBucket{}).
+			Where("bucket_key = ?", key).
+			Updates(map[string]interface{}{"tokens": tokens, "updated_at": now, "expires_at": expiresAt}).Error
+	})
+	return result, err
+}
+
+// sweep 定期删除已补满的空闲令牌桶，删除后再次请求时按满桶重新创建
+func (s *PostgresStore) sweep(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	if now.Sub(s.lastSweep) < postgresSweepInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastSweep = now
+	s.mu.Unlock()
+
+	result := s.db.WithContext(ctx).
+		Where("expires_at < ? OR expires_at IS NULL", now).
+		Delete(&rateLimitBucket{})
+	if result.Error != nil {
+		log.Printf("[RateLimit] 清理空闲令牌桶失败: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("[RateLimit] 清理了 %d 个空闲令牌桶", result.RowsAffected)
+	}
+}
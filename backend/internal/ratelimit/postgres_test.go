@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"lauraai-backend/internal/repository/repotest"
+)
+
+func newTestPostgresStore(t *testing.T) *PostgresStore {
+	t.Helper()
+	store, err := NewPostgresStore(repotest.Open(t))
+	if err != nil {
+		t.Fatalf("NewPostgresStore: %v", err)
+	}
+	return store
+}
+
+func TestPostgresStore(t *testing.T) {
+	testStore(t, newTestPostgresStore(t), nil)
+}
+
+func TestPostgresStoreSweep(t *testing.T) {
+	store := newTestPostgresStore(t)
+	ctx := context.Background()
+	limit := Limit{Rate: 1, Burst: 2}
+	now := time.Unix(1700000000, 0)
+
+	bucketKeys := func() []string {
+		var keys []string
+		store.db.Model(&rateLimitBucket{}).Order("bucket_key").Pluck("bucket_key", &keys)
+		return keys
+	}
+
+	store.Take(ctx, "user:1", limit, now)
+	store.Take(ctx, "user:2", limit, now.Add(time.Minute))
+	// 添加 expires_at 之前写入的行
+	store.db.Create(&rateLimitBucket{BucketKey: "legacy", Tokens: 1, UpdatedAt: now})
+
+	// 距上次清理不到间隔时不清理
+	store.Take(ctx, "user:3", limit, now.Add(postgresSweepInterval-time.Second))
+	if keys := bucketKeys(); len(keys) != 4 {
+		t.Fatalf("buckets before sweep = %v", keys)
+	}
+
+	// 到达间隔后删除已补满的空闲桶，保留仍在补充中的桶
+	store.Take(ctx, "user:4", limit, now.Add(postgresSweepInterval))
+	if keys := bucketKeys(); len(keys) != 2 || keys[0] != "user:3" || keys[1] != "user:4" {
+		t.Errorf("buckets after sweep = %v, want [user:3 user:4]", keys)
+	}
+
+	// 被清理的桶按满桶重新开始
+	if got, err := store.Take(ctx, "user:1", limit, now.Add(postgresSweepInterval)); err != nil || got != (Result{Allowed: true, Remaining: 1}) {
+		t.Errorf("take after sweep = %+v, %v", got, err)
+	}
+}
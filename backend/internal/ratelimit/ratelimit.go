@@ -0,0 +1,158 @@
+// Package ratelimit 按用户和接口分组的令牌桶限流，桶状态可以保存在内存、Postgres 或 Redis 兼容服务中
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"lauraai-backend/internal/config"
+	"lauraai-backend/internal/repository"
+)
+
+// 限流分组，同一分组的接口共用一个令牌桶
+const (
+	GroupChat          = "chat"           // 发送消息、重新生成（包括 WebSocket）
+	GroupGenerateImage = "generate_image" // 生成角色图片
+	GroupMiniMe        = "minime"         // 生成 Mini Me
+	GroupReportRetry   = "report_retry"   // 重新生成报告
+)
+
+// Limit 令牌桶参数：容量 Burst，每秒补充 Rate 个令牌
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseLimit 解析 "次数/时长" 格式（如 20/1m 表示每分钟 20 次，最多连续 20 次），空或 0 表示不限制
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return Limit{}, nil
+	}
+	countStr, periodStr, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected <count>/<duration>", s)
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(countStr))
+	if err != nil || count < 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit count %q", countStr)
+	}
+	period, err := time.ParseDuration(strings.TrimSpace(periodStr))
+	if err != nil || period <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit duration %q", periodStr)
+	}
+	if count == 0 {
+		return Limit{}, nil
+	}
+	return Limit{Rate: float64(count) / period.Seconds(), Burst: count}, nil
+}
+
+// Enabled 是否限流
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// idleTTL 桶空闲多久后会补满，之后可以丢弃
+func (l Limit) idleTTL() time.Duration {
+	return time.Duration(float64(l.Burst) / l.Rate * float64(time.Second))
+}
+
+// take 按 last 到 now 的时间补充令牌后尝试取出一个，返回新的令牌数
+func (l Limit) take(tokens float64, last time.Time, now time.Time) (float64, Result) {
+	if elapsed := now.Sub(last).Seconds(); elapsed > 0 {
+		tokens = math.Min(float64(l.Burst), tokens+elapsed*l.Rate)
+	}
+	if tokens >= 1 {
+		tokens--
+		return tokens, Result{Allowed: true, Remaining: int(tokens)}
+	}
+	wait := time.Duration((1 - tokens) / l.Rate * float64(time.Second))
+	return tokens, Result{Remaining: 0, RetryAfter: wait}
+}
+
+// Result 一次请求的限流结果，不允许时 RetryAfter 为需要等待的时间
+type Result struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// Store 令牌桶存储，Take 必须原子地补充并取出令牌
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// Limiter 按分组配置的限流器
+type Limiter struct {
+	store  Store
+	limits map[string]Limit
+}
+
+func NewLimiter(store Store, limits map[string]Limit) *Limiter {
+	return &Limiter{store: store, limits: limits}
+}
+
+// New 根据 RATE_LIMIT_* 配置创建限流器
+func New() (*Limiter, error) {
+	limits := make(map[string]Limit)
+	for group, value := range map[string]string{
+		GroupChat:          config.AppConfig.RateLimitChat,
+		GroupGenerateImage: config.AppConfig.RateLimitGenerateImage,
+		GroupMiniMe:        config.AppConfig.RateLimitMiniMe,
+		GroupReportRetry:   config.AppConfig.RateLimitReportRetry,
+	} {
+		limit, err := ParseLimit(value)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit %s: %w", group, err)
+		}
+		limits[group] = limit
+	}
+
+	var store Store
+	switch config.AppConfig.RateLimitStore {
+	case "", "memory":
+		store = NewMemoryStore()
+	case "postgres":
+		postgresStore, err := NewPostgresStore(repository.DB)
+		if err != nil {
+			return nil, err
+		}
+		store = postgresStore
+	case "redis":
+		redisStore, err := NewRedisStore(config.AppConfig.RateLimitRedisURL)
+		if err != nil {
+			return nil, err
+		}
+		store = redisStore
+	default:
+		return nil, fmt.Errorf("unknown RATE_LIMIT_STORE: %s", config.AppConfig.RateLimitStore)
+	}
+	log.Printf("限流存储后端: %s", config.AppConfig.RateLimitStore)
+	return NewLimiter(store, limits), nil
+}
+
+// Limit 返回分组的限流参数
+func (l *Limiter) Limit(group string) Limit {
+	return l.limits[group]
+}
+
+// Allow 为用户在分组中取出一个令牌
+// 存储出错时放行并记录日志，避免限流后端故障导致接口不可用
+func (l *Limiter) Allow(ctx context.Context, group string, userID uint64) Result {
+	limit := l.limits[group]
+	if !limit.Enabled() {
+		return Result{Allowed: true}
+	}
+	key := fmt.Sprintf("ratelimit:%s:%d", group, userID)
+	result, err := l.store.Take(ctx, key, limit, time.Now())
+	if err != nil {
+		log.Printf("[RateLimit] 读取令牌桶失败，放行请求: %v", err)
+		return Result{Allowed: true, Remaining: limit.Burst}
+	}
+	return result
+}
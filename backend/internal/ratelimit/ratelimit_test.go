@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{in: "", want: Limit{}},
+		{in: "0", want: Limit{}},
+		{in: "0/1m", want: Limit{}},
+		{in: "20/1m", want: Limit{Rate: 20.0 / 60, Burst: 20}},
+		{in: " 5 / 10s ", want: Limit{Rate: 0.5, Burst: 5}},
+		{in: "3/500ms", want: Limit{Rate: 6, Burst: 3}},
+		{in: "20", wantErr: true},
+		{in: "x/1m", wantErr: true},
+		{in: "-1/1m", wantErr: true},
+		{in: "20/forever", wantErr: true},
+		{in: "20/0s", wantErr: true},
+		{in: "20/-1m", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLimit(%q) = %+v, %v; want %+v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+		if err == nil && got.Enabled() != (got.Burst > 0) {
+			t.Errorf("ParseLimit(%q).Enabled() = %v", tt.in, got.Enabled())
+		}
+	}
+}
+
+func TestLimitTake(t *testing.T) {
+	limit := Limit{Rate: 1, Burst: 3} // 每秒 1 个，最多 3 个
+	now := time.Unix(1700000000, 0)
+
+	tokens, result := limit.take(3, now, now)
+	if tokens != 2 || result != (Result{Allowed: true, Remaining: 2}) {
+		t.Errorf("take from full bucket = %v, %+v", tokens, result)
+	}
+
+	// 不足一个令牌时拒绝，RetryAfter 为补足一个令牌的时间
+	tokens, result = limit.take(0.25, now, now)
+	if tokens != 0.25 || result.Allowed || result.Remaining != 0 || result.RetryAfter != 750*time.Millisecond {
+		t.Errorf("take from empty bucket = %v, %+v", tokens, result)
+	}
+
+	// 按经过的时间补充，不超过容量
+	tokens, result = limit.take(0.5, now, now.Add(1500*time.Millisecond))
+	if tokens != 1 || !result.Allowed || result.Remaining != 1 {
+		t.Errorf("take after refill = %v, %+v", tokens, result)
+	}
+	tokens, _ = limit.take(0, now, now.Add(time.Hour))
+	if tokens != 2 {
+		t.Errorf("take after long idle = %v, want burst-1", tokens)
+	}
+
+	// 时钟回拨时不补充
+	tokens, result = limit.take(0.5, now, now.Add(-time.Second))
+	if tokens != 0.5 || result.Allowed {
+		t.Errorf("take with clock skew = %v, %+v", tokens, result)
+	}
+
+	if ttl := limit.idleTTL(); ttl != 3*time.Second {
+		t.Errorf("idleTTL = %v", ttl)
+	}
+}
+
+// testStore 所有存储后端都要满足的令牌桶行为
+// 使用存储自身时钟的后端（Redis）通过 setClock 同步到测试时间，其他后端传 nil
+func testStore(t *testing.T, store Store, setClock func(time.Time)) {
+	ctx := context.Background()
+	limit := Limit{Rate: 2, Burst: 2}
+	now := time.Unix(1700000000, 0)
+	if setClock == nil {
+		setClock = func(time.Time) {}
+	}
+	setClock(now)
+
+	for i, want := range []Result{
+		{Allowed: true, Remaining: 1},
+		{Allowed: true, Remaining: 0},
+		{RetryAfter: 500 * time.Millisecond},
+	} {
+		got, err := store.Take(ctx, "user:1", limit, now)
+		if err != nil || got != want {
+			t.Fatalf("take %d = %+v, %v; want %+v", i, got, err, want)
+		}
+	}
+
+	// 不同 key 各自计数
+	if got, err := store.Take(ctx, "user:2", limit, now); err != nil || !got.Allowed {
+		t.Errorf("take other key = %+v, %v", got, err)
+	}
+
+	// 补充一个令牌后放行
+	setClock(now.Add(500 * time.Millisecond))
+	if got, err := store.Take(ctx, "user:1", limit, now.Add(500*time.Millisecond)); err != nil || got != (Result{Allowed: true, Remaining: 0}) {
+		t.Errorf("take after refill = %+v, %v", got, err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore(), nil)
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	return Result{}, errors.New("store down")
+}
+
+func TestLimiterAllow(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), map[string]Limit{GroupChat: {Rate: 1, Burst: 1}})
+	ctx := context.Background()
+
+	if result := limiter.Allow(ctx, GroupChat, 1); !result.Allowed {
+		t.Errorf("first request = %+v", result)
+	}
+	if result := limiter.Allow(ctx, GroupChat, 1); result.Allowed || result.RetryAfter <= 0 {
+		t.Errorf("second request = %+v", result)
+	}
+	// 每个用户单独计数，没有配置的分组不限流
+	if result := limiter.Allow(ctx, GroupChat, 2); !result.Allowed {
+		t.Errorf("other user = %+v", result)
+	}
+	if result := limiter.Allow(ctx, GroupMiniMe, 1); !result.Allowed {
+		t.Errorf("unlimited group = %+v", result)
+	}
+
+	// 存储出错时放行
+	limiter = NewLimiter(failingStore{}, map[string]Limit{GroupChat: {Rate: 1, Burst: 5}})
+	if result := limiter.Allow(ctx, GroupChat, 1); !result.Allowed || result.Remaining != 5 {
+		t.Errorf("store error = %+v", result)
+	}
+}
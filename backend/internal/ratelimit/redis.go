@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisTimeout 连接和单条命令的超时
+const redisTimeout = 2 * time.Second
+
+// redisTakeScript 原子地补充并取出令牌，与 Limit.take 的计算相同
+// 当前时间取 Redis 服务器的 TIME，多个实例之间的时钟偏差不会影响补充的令牌数
+// ARGV: 每秒补充数、容量、过期时间（毫秒）；返回 {是否允许, 剩余令牌数, 需要等待的毫秒数}
+var redisTakeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+if now > ts then
+  tokens = math.min(burst, tokens + (now - ts) / 1000 * rate)
+end
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = math.ceil((1 - tokens) / rate * 1000)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return {allowed, math.floor(tokens), wait}
+`)
+
+// RedisStore 把令牌桶保存在 Redis 协议兼容的服务中（Redis、Valkey、KeyDB、Dragonfly 等），多实例共享
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore 解析 redis://[:password@]host:port[/db] 或 rediss://（TLS）地址，并检查能否连接
+func NewRedisStore(rawURL string) (*RedisStore, error) {
+	if rawURL == "" {
+		return nil, errors.New("RATE_LIMIT_REDIS_URL is required for redis rate limit store")
+	}
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RATE_LIMIT_REDIS_URL: %w", err)
+	}
+	opts.DialTimeout = redisTimeout
+	opts.ReadTimeout = redisTimeout
+	opts.WriteTimeout = redisTimeout
+
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	return &RedisStore{client: client}, nil
+}
+
+// Take 不使用 now，以 Redis 服务器时间为准
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	// 先用 EVALSHA，脚本未缓存时自动改用 EVAL
+	values, err := redisTakeScript.Run(ctx, s.client, []string{key},
+		limit.Rate,
+		limit.Burst,
+		max(limit.idleTTL().Milliseconds(), 1000),
+	).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	if len(values) != 3 {
+		return Result{}, fmt.Errorf("redis: unexpected reply %v", values)
+	}
+	return Result{
+		Allowed:    values[0] == 1,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+	}, nil
+}
+
+// Close 关闭连接池
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestRedisStore(t *testing.T) (*RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	store, err := NewRedisStore("redis://" + server.Addr() + "/0")
+	if err != nil {
+		t.Fatalf("NewRedisStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store, server
+}
+
+func TestRedisStore(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	testStore(t, store, server.SetTime)
+}
+
+func TestRedisStoreExpiry(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	limit := Limit{Rate: 1, Burst: 2}
+
+	if _, err := store.Take(context.Background(), "user:1", limit, time.Now()); err != nil {
+		t.Fatalf("take: %v", err)
+	}
+	// 空闲到令牌补满后桶被删除，最短保留 1 秒
+	if ttl := server.TTL("user:1"); ttl != 2*time.Second {
+		t.Errorf("ttl = %v, want 2s", ttl)
+	}
+	server.FastForward(2 * time.Second)
+	if server.Exists("user:1") {
+		t.Error("idle bucket not expired")
+	}
+}
+
+func TestNewRedisStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireAuth("secret")
+
+	if _, err := NewRedisStore(""); err == nil {
+		t.Error("empty URL accepted")
+	}
+	if _, err := NewRedisStore("http://" + server.Addr()); err == nil {
+		t.Error("non-redis scheme accepted")
+	}
+	if _, err := NewRedisStore("redis://" + server.Addr()); err == nil {
+		t.Error("connected without password")
+	}
+	store, err := NewRedisStore("redis://:secret@" + server.Addr() + "/2")
+	if err != nil {
+		t.Fatalf("NewRedisStore with password: %v", err)
+	}
+	defer store.Close()
+
+	if _, err := store.Take(context.Background(), "user:1", Limit{Rate: 1, Burst: 1}, time.Now()); err != nil {
+		t.Fatalf("take: %v", err)
+	}
+	server.Select(2)
+	if !server.Exists("user:1") {
+		t.Error("bucket not stored in db 2")
+	}
+}
+
+func TestRedisStoreServerTime(t *testing.T) {
+	store, server := newTestRedisStore(t)
+	limit := Limit{Rate: 1, Burst: 1}
+	start := time.Unix(1700000000, 0)
+	server.SetTime(start)
+
+	ctx := context.Background()
+	store.Take(ctx, "user:1", limit, start)
+	if got, _ := store.Take(ctx, "user:1", limit, start); got.Allowed {
+		t.Fatalf("second take allowed: %+v", got)
+	}
+	// 按 Redis 服务器时间补充令牌，调用方传入的时间（例如时钟落后的实例）不影响结果
+	server.SetTime(start.Add(time.Second))
+	if got, err := store.Take(ctx, "user:1", limit, start.Add(-time.Hour)); err != nil || !got.Allowed {
+		t.Errorf("take after refill = %+v, %v", got, err)
+	}
+}
@@ -3,8 +3,10 @@ package repository
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"log"
 
 	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/storage"
 )
 
 type CharacterRepository struct{}
@@ -32,6 +34,16 @@ func (r *CharacterRepository) GetByUserID(userID uint64) ([]model.Character, err
 	return characters, err
 }
 
+// GetVisibleByUserID 获取用户的角色，不包括生成任务尚未完成的角色
+func (r *CharacterRepository) GetVisibleByUserID(userID uint64) ([]model.Character, error) {
+	var characters []model.Character
+	err := DB.Where("user_id = ?", userID).
+		Where("NOT EXISTS (SELECT 1 FROM generation_jobs j WHERE j.character_id = characters.id AND j.status IN ?)",
+			[]model.GenerationJobStatus{model.GenerationJobPending, model.GenerationJobRunning}).
+		Find(&characters).Error
+	return characters, err
+}
+
 func (r *CharacterRepository) GetByUserIDAndType(userID uint64, charType model.CharacterType) (*model.Character, error) {
 	var character model.Character
 	err := DB.Where("user_id = ? AND type = ?", userID, charType).First(&character).Error
@@ -45,6 +57,22 @@ func (r *CharacterRepository) Update(character *model.Character) error {
 	return DB.Save(character).Error
 }
 
+// reportColumns 多语言报告字段
+var reportColumns = []string{
+	"description_en", "description_zh", "description_ru",
+	"career_en", "career_zh", "career_ru",
+	"personality_en", "personality_zh", "personality_ru",
+	"meeting_time_en", "meeting_time_zh", "meeting_time_ru",
+	"distance_en", "distance_zh", "distance_ru",
+	"strength_en", "strength_zh", "strength_ru",
+	"weakness_en", "weakness_zh", "weakness_ru",
+}
+
+// UpdateReport 只更新报告字段，避免后台任务覆盖期间发生的解锁状态等变化
+func (r *CharacterRepository) UpdateReport(character *model.Character) error {
+	return DB.Model(character).Select(reportColumns).Updates(character).Error
+}
+
 func (r *CharacterRepository) Delete(id uint64) error {
 	return DB.Delete(&model.Character{}, id).Error
 }
@@ -60,25 +88,39 @@ func (r *CharacterRepository) DeleteEmptyByUserID(userID uint64) (int64, error)
 	return result.RowsAffected, result.Error
 }
 
-// GetByShareCode 通过分享码查找角色
-func (r *CharacterRepository) GetByShareCode(shareCode string) (*model.Character, error) {
+// GetByImageKey 通过图片在存储中的 key 查找所属角色
+func (r *CharacterRepository) GetByImageKey(key string) (*model.Character, error) {
 	var character model.Character
-	err := DB.Where("share_code = ?", shareCode).First(&character).Error
+	err := DB.Where("full_blur_image_key = ? OR half_blur_image_key = ? OR clear_image_key = ?", key, key, key).
+		First(&character).Error
 	if err != nil {
 		return nil, err
 	}
 	return &character, nil
 }
 
-// UpdateUnlockStatus 更新角色解锁状态
-func (r *CharacterRepository) UpdateUnlockStatus(characterID uint64, status model.UnlockStatus, helperID *uint64) error {
-	updates := map[string]interface{}{
-		"unlock_status": status,
+// BackfillImageKeys 根据图片 URL 为旧角色补齐图片 key（兼容存储了完整 URL 的旧数据）
+func BackfillImageKeys() error {
+	var characters []model.Character
+	err := DB.Where("clear_image_key = '' OR clear_image_key IS NULL").
+		Where("clear_image_url LIKE ?", "%"+storage.URLPrefix+"%").
+		Find(&characters).Error
+	if err != nil {
+		return err
 	}
-	if helperID != nil {
-		updates["unlock_helper_id"] = *helperID
+	for _, character := range characters {
+		if err := DB.Model(&character).UpdateColumns(map[string]interface{}{
+			"full_blur_image_key": storage.KeyFromURL(character.FullBlurImageURL),
+			"half_blur_image_key": storage.KeyFromURL(character.HalfBlurImageURL),
+			"clear_image_key":     storage.KeyFromURL(character.ClearImageURL),
+		}).Error; err != nil {
+			return err
+		}
 	}
-	return DB.Model(&model.Character{}).Where("id = ?", characterID).Updates(updates).Error
+	if len(characters) > 0 {
+		log.Printf("已为 %d 个角色补齐图片 key", len(characters))
+	}
+	return nil
 }
 
 // GenerateShareCode 生成唯一的分享码
@@ -87,15 +129,3 @@ func GenerateShareCode() string {
 	rand.Read(bytes)
 	return hex.EncodeToString(bytes)[:8]
 }
-
-// HasUserHelpedOwner 检查某用户是否曾经帮助过某个用户的任何角色解锁
-func (r *CharacterRepository) HasUserHelpedOwner(helperID uint64, ownerID uint64) (bool, error) {
-	var count int64
-	err := DB.Model(&model.Character{}).
-		Where("user_id = ? AND unlock_helper_id = ?", ownerID, helperID).
-		Count(&count).Error
-	if err != nil {
-		return false, err
-	}
-	return count > 0, nil
-}
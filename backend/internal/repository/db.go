@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"fmt"
 	"log"
 
 	"lauraai-backend/internal/config"
@@ -18,6 +19,8 @@ func InitDB() error {
 	
 	DB, err = gorm.Open(postgres.Open(config.AppConfig.PostgresDSN), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
+		// 将唯一键冲突等数据库错误转换为 gorm.ErrDuplicatedKey 等通用错误
+		TranslateError: true,
 	})
 	
 	if err != nil {
@@ -25,16 +28,30 @@ func InitDB() error {
 	}
 
 	// 自动迁移
-	err = DB.AutoMigrate(
-		&model.User{},
-		&model.Character{},
-		&model.Message{},
-	)
-	
-	if err != nil {
+	if err := AutoMigrate(); err != nil {
 		return err
 	}
 
+	// 迁移旧的单一助力者数据
+	if err := BackfillUnlockHelps(); err != nil {
+		log.Printf("迁移助力记录失败: %v", err)
+	}
+
+	// 任务去重索引，缺少时重复入队无法去重，不能继续启动
+	if err := EnsureJobIndexes(); err != nil {
+		return fmt.Errorf("创建任务去重索引失败: %w", err)
+	}
+
+	// 为旧角色补齐分享码和分享链接记录
+	if err := BackfillShareLinks(); err != nil {
+		log.Printf("迁移分享链接失败: %v", err)
+	}
+
+	// 为旧角色补齐图片 key
+	if err := BackfillImageKeys(); err != nil {
+		log.Printf("迁移图片 key 失败: %v", err)
+	}
+
 	// 强制修复 birth_time 字段类型
 	log.Println("正在修复 birth_time 字段类型...")
 	DB.Exec("ALTER TABLE users DROP COLUMN IF EXISTS birth_time")
@@ -49,3 +66,24 @@ func InitDB() error {
 	log.Println("数据库连接成功")
 	return nil
 }
+
+// AutoMigrate 创建或更新所有表结构
+func AutoMigrate() error {
+	return DB.AutoMigrate(
+		&model.User{},
+		&model.Character{},
+		&model.Message{},
+		&model.Payment{},
+		&model.PromoCode{},
+		&model.PromoRedemption{},
+		&model.Subscription{},
+		&model.UnlockEvent{},
+		&model.UnlockHelp{},
+		&model.ShareLink{},
+		&model.GenerationJob{},
+		&model.Job{},
+		&model.ConversationSummary{},
+		&model.MemoryFact{},
+		&model.ChatUsage{},
+	)
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"time"
+
+	"lauraai-backend/internal/model"
+)
+
+type GenerationJobRepository struct{}
+
+func NewGenerationJobRepository() *GenerationJobRepository {
+	return &GenerationJobRepository{}
+}
+
+func (r *GenerationJobRepository) Create(job *model.GenerationJob) error {
+	return DB.Create(job).Error
+}
+
+func (r *GenerationJobRepository) GetByID(id uint64) (*model.GenerationJob, error) {
+	var job model.GenerationJob
+	err := DB.First(&job, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetActiveByCharacterID 获取角色未结束的生成任务
+func (r *GenerationJobRepository) GetActiveByCharacterID(characterID uint64) (*model.GenerationJob, error) {
+	var job model.GenerationJob
+	err := DB.Where("character_id = ? AND status IN ?", characterID,
+		[]model.GenerationJobStatus{model.GenerationJobPending, model.GenerationJobRunning}).
+		Order("id DESC").First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// MarkRunning 标记任务开始执行
+func (r *GenerationJobRepository) MarkRunning(id uint64) error {
+	return DB.Model(&model.GenerationJob{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":     model.GenerationJobRunning,
+		"started_at": time.Now(),
+	}).Error
+}
+
+// UpdateStage 更新任务当前阶段
+func (r *GenerationJobRepository) UpdateStage(id uint64, stage model.GenerationJobStage) error {
+	return DB.Model(&model.GenerationJob{}).Where("id = ?", id).Update("stage", stage).Error
+}
+
+// MarkCompleted 标记任务成功
+func (r *GenerationJobRepository) MarkCompleted(id uint64) error {
+	return DB.Model(&model.GenerationJob{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      model.GenerationJobCompleted,
+		"stage":       model.GenerationStageDone,
+		"finished_at": time.Now(),
+	}).Error
+}
+
+// MarkFailed 标记任务失败并记录原因
+func (r *GenerationJobRepository) MarkFailed(id uint64, reason string) error {
+	return DB.Model(&model.GenerationJob{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      model.GenerationJobFailed,
+		"error":       reason,
+		"finished_at": time.Now(),
+	}).Error
+}
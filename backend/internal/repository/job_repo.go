@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"lauraai-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type JobRepository struct{}
+
+func NewJobRepository() *JobRepository {
+	return &JobRepository{}
+}
+
+// Enqueue 创建任务；DedupKey 相同的任务尚未结束时不重复创建，返回已有任务
+func (r *JobRepository) Enqueue(job *model.Job) (*model.Job, bool, error) {
+	err := DB.Create(job).Error
+	if err == nil {
+		return job, true, nil
+	}
+	if !errors.Is(err, gorm.ErrDuplicatedKey) || job.DedupKey == nil {
+		return nil, false, err
+	}
+
+	var existing model.Job
+	if err := DB.Where("dedup_key = ? AND finished_at IS NULL", *job.DedupKey).First(&existing).Error; err != nil {
+		return nil, false, err
+	}
+	return &existing, false, nil
+}
+
+func (r *JobRepository) GetByID(id uint64) (*model.Job, error) {
+	var job model.Job
+	err := DB.First(&job, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Claim 领取一个到期的待执行任务，多个 worker（包括多实例）并发领取时互不阻塞
+// 没有可执行的任务时返回 nil
+func (r *JobRepository) Claim(workerID string) (*model.Job, error) {
+	var job model.Job
+	err := DB.Raw(`UPDATE jobs SET status = ?, attempts = attempts + 1, locked_at = NOW(), locked_by = ?, updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = ? AND run_at <= NOW()
+			ORDER BY run_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`, model.JobStatusRunning, workerID, model.JobStatusPending).Scan(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	if job.ID == 0 {
+		return nil, nil
+	}
+	return &job, nil
+}
+
+// ErrJobLockLost 任务已不属于该 worker（锁过期被回收后重新领取，或已经结束）
+var ErrJobLockLost = errors.New("job lock lost")
+
+// updateLocked 只更新仍由 workerID 持有的运行中任务，锁已丢失时返回 ErrJobLockLost
+func updateLocked(id uint64, workerID string, values map[string]interface{}) error {
+	result := DB.Model(&model.Job{}).
+		Where("id = ? AND locked_by = ? AND status = ?", id, workerID, model.JobStatusRunning).
+		Updates(values)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrJobLockLost
+	}
+	return nil
+}
+
+// Heartbeat 刷新任务的 locked_at，长任务执行期间定期调用，避免被 RequeueStale 回收
+func (r *JobRepository) Heartbeat(id uint64, workerID string) error {
+	return updateLocked(id, workerID, map[string]interface{}{
+		"locked_at": time.Now(),
+	})
+}
+
+// Complete 标记任务成功
+func (r *JobRepository) Complete(id uint64, workerID string) error {
+	return updateLocked(id, workerID, map[string]interface{}{
+		"status":      model.JobStatusSucceeded,
+		"locked_at":   nil,
+		"finished_at": time.Now(),
+	})
+}
+
+// Retry 任务失败，在 runAt 之后重新执行
+func (r *JobRepository) Retry(id uint64, workerID string, reason string, runAt time.Time) error {
+	return updateLocked(id, workerID, map[string]interface{}{
+		"status":     model.JobStatusPending,
+		"run_at":     runAt,
+		"locked_at":  nil,
+		"locked_by":  "",
+		"last_error": reason,
+	})
+}
+
+// Bury 任务失败且不再重试，进入 dead 状态
+func (r *JobRepository) Bury(id uint64, workerID string, reason string) error {
+	return updateLocked(id, workerID, map[string]interface{}{
+		"status":      model.JobStatusDead,
+		"locked_at":   nil,
+		"last_error":  reason,
+		"finished_at": time.Now(),
+	})
+}
+
+// RequeueStale 将领取后超过 timeout 仍未结束的任务放回队列（worker 崩溃或实例重启）
+func (r *JobRepository) RequeueStale(timeout time.Duration) (int64, error) {
+	result := DB.Model(&model.Job{}).
+		Where("status = ? AND locked_at < ?", model.JobStatusRunning, time.Now().Add(-timeout)).
+		Updates(map[string]interface{}{
+			"status":     model.JobStatusPending,
+			"run_at":     time.Now(),
+			"locked_at":  nil,
+			"locked_by":  "",
+			"last_error": "worker lock expired",
+		})
+	return result.RowsAffected, result.Error
+}
+
+// EnsureJobIndexes 创建 AutoMigrate 无法表达的部分唯一索引：同一 dedup_key 只允许一个未结束的任务
+func EnsureJobIndexes() error {
+	return DB.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_dedup_active ON jobs (dedup_key) WHERE finished_at IS NULL`).Error
+}
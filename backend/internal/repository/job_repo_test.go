@@ -0,0 +1,88 @@
+package repository_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/repository/repotest"
+)
+
+// createRunningJob 创建一个已被 workerID 领取、lockedAt 时领取的任务
+func createRunningJob(t *testing.T, workerID string, lockedAt time.Time) *model.Job {
+	t.Helper()
+	job := &model.Job{
+		Type:        "test",
+		Payload:     "{}",
+		Status:      model.JobStatusRunning,
+		RunAt:       lockedAt,
+		Attempts:    1,
+		MaxAttempts: 3,
+		LockedAt:    &lockedAt,
+		LockedBy:    workerID,
+	}
+	if err := repository.DB.Create(job).Error; err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+	return job
+}
+
+func TestJobUpdatesRequireLock(t *testing.T) {
+	repotest.Open(t)
+	jobs := repository.NewJobRepository()
+	job := createRunningJob(t, "w1", time.Now())
+
+	if err := jobs.Complete(job.ID, "w2"); !errors.Is(err, repository.ErrJobLockLost) {
+		t.Errorf("Complete by another worker = %v, want ErrJobLockLost", err)
+	}
+	if err := jobs.Retry(job.ID, "w2", "boom", time.Now()); !errors.Is(err, repository.ErrJobLockLost) {
+		t.Errorf("Retry by another worker = %v, want ErrJobLockLost", err)
+	}
+	if err := jobs.Bury(job.ID, "w2", "boom"); !errors.Is(err, repository.ErrJobLockLost) {
+		t.Errorf("Bury by another worker = %v, want ErrJobLockLost", err)
+	}
+
+	if err := jobs.Complete(job.ID, "w1"); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	// 已结束的任务不能再被修改
+	if err := jobs.Bury(job.ID, "w1", "late"); !errors.Is(err, repository.ErrJobLockLost) {
+		t.Errorf("Bury after Complete = %v, want ErrJobLockLost", err)
+	}
+	finished, _ := jobs.GetByID(job.ID)
+	if finished.Status != model.JobStatusSucceeded {
+		t.Errorf("status = %s, want succeeded", finished.Status)
+	}
+}
+
+func TestJobHeartbeatPreventsRequeue(t *testing.T) {
+	repotest.Open(t)
+	jobs := repository.NewJobRepository()
+	stale := time.Now().Add(-time.Hour)
+	alive := createRunningJob(t, "w1", stale)
+	dead := createRunningJob(t, "w2", stale)
+
+	if err := jobs.Heartbeat(alive.ID, "w1"); err != nil {
+		t.Fatalf("Heartbeat: %v", err)
+	}
+	count, err := jobs.RequeueStale(10 * time.Minute)
+	if err != nil || count != 1 {
+		t.Fatalf("RequeueStale = %d, %v; want 1", count, err)
+	}
+	if job, _ := jobs.GetByID(alive.ID); job.Status != model.JobStatusRunning {
+		t.Errorf("job with heartbeat requeued: %s", job.Status)
+	}
+
+	// 被回收的任务的原 worker 心跳和结果都会被拒绝
+	if job, _ := jobs.GetByID(dead.ID); job.Status != model.JobStatusPending {
+		t.Errorf("stale job status = %s, want pending", job.Status)
+	}
+	if err := jobs.Heartbeat(dead.ID, "w2"); !errors.Is(err, repository.ErrJobLockLost) {
+		t.Errorf("Heartbeat after requeue = %v, want ErrJobLockLost", err)
+	}
+	if err := jobs.Complete(dead.ID, "w2"); !errors.Is(err, repository.ErrJobLockLost) {
+		t.Errorf("Complete after requeue = %v, want ErrJobLockLost", err)
+	}
+}
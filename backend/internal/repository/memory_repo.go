@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"errors"
+
+	"lauraai-backend/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type MemoryRepository struct{}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{}
+}
+
+// GetSummary 获取角色的聊天摘要，不存在时返回空摘要（未保存）
+func (r *MemoryRepository) GetSummary(userID uint64, characterID uint64) (*model.ConversationSummary, error) {
+	var summary model.ConversationSummary
+	err := DB.Where("character_id = ?", characterID).First(&summary).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &model.ConversationSummary{UserID: userID, CharacterID: characterID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// SaveSummary 创建或更新聊天摘要
+func (r *MemoryRepository) SaveSummary(summary *model.ConversationSummary) error {
+	return DB.Save(summary).Error
+}
+
+// ListFacts 获取角色记住的所有事实
+func (r *MemoryRepository) ListFacts(characterID uint64) ([]model.MemoryFact, error) {
+	var facts []model.MemoryFact
+	err := DB.Where("character_id = ?", characterID).Order("id ASC").Find(&facts).Error
+	return facts, err
+}
+
+// UpsertFacts 写入事实，同一角色下 key 相同时覆盖旧值
+func (r *MemoryRepository) UpsertFacts(facts []model.MemoryFact) error {
+	if len(facts) == 0 {
+		return nil
+	}
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "character_id"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "source_message_id", "updated_at"}),
+	}).Create(&facts).Error
+}
+
+// DeleteFact 删除一条事实，返回是否存在
+func (r *MemoryRepository) DeleteFact(characterID uint64, factID uint64) (bool, error) {
+	result := DB.Where("id = ? AND character_id = ?", factID, characterID).Delete(&model.MemoryFact{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Forget 清空角色的记忆：删除所有事实并清空摘要
+// 摘要游标保持不变，已遗忘的旧消息不会被重新总结
+func (r *MemoryRepository) Forget(characterID uint64) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("character_id = ?", characterID).Delete(&model.MemoryFact{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.ConversationSummary{}).Where("character_id = ?", characterID).Update("summary", "").Error
+	})
+}
@@ -1,7 +1,11 @@
 package repository
 
 import (
+	"slices"
+
 	"lauraai-backend/internal/model"
+
+	"gorm.io/gorm"
 )
 
 type MessageRepository struct{}
@@ -10,13 +14,38 @@ func NewMessageRepository() *MessageRepository {
 	return &MessageRepository{}
 }
 
+// activeMessages 角色当前对话分支上的消息
+func activeMessages(db *gorm.DB, characterID uint64) *gorm.DB {
+	return db.Model(&model.Message{}).Where("character_id = ? AND inactive = ?", characterID, false)
+}
+
 func (r *MessageRepository) Create(message *model.Message) error {
 	return DB.Create(message).Error
 }
 
+// GetByID 获取角色的一条消息（包括不在当前分支上的版本）
+func (r *MessageRepository) GetByID(characterID uint64, id uint64) (*model.Message, error) {
+	var message model.Message
+	err := DB.Where("id = ? AND character_id = ?", id, characterID).First(&message).Error
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// GetLatest 获取当前分支上的最后一条消息，没有消息时返回 gorm.ErrRecordNotFound
+func (r *MessageRepository) GetLatest(characterID uint64) (*model.Message, error) {
+	var message model.Message
+	err := activeMessages(DB, characterID).Order("id DESC").First(&message).Error
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
 func (r *MessageRepository) GetByCharacterID(characterID uint64, limit int) ([]model.Message, error) {
 	var messages []model.Message
-	query := DB.Where("character_id = ?", characterID).Order("created_at ASC")
+	query := activeMessages(DB, characterID).Order("id ASC")
 	if limit > 0 {
 		query = query.Limit(limit)
 	}
@@ -24,11 +53,140 @@ func (r *MessageRepository) GetByCharacterID(characterID uint64, limit int) ([]m
 	return messages, err
 }
 
+// GetRecentByCharacterID 获取最近 limit 条消息，按时间正序（最早的在前）
 func (r *MessageRepository) GetRecentByCharacterID(characterID uint64, limit int) ([]model.Message, error) {
+	messages, _, err := r.ListPage(characterID, 0, 0, limit)
+	return messages, err
+}
+
+// ListPage 按消息 ID 游标分页当前分支上的消息，结果始终按 id 正序
+// afterID > 0 时返回 afterID 之后最早的 limit 条；否则返回 beforeID 之前最近的 limit 条（beforeID 为 0 表示从最新开始）
+// hasMore 表示沿翻页方向是否还有更多消息
+func (r *MessageRepository) ListPage(characterID uint64, beforeID uint64, afterID uint64, limit int) (messages []model.Message, hasMore bool, err error) {
+	query := activeMessages(DB, characterID)
+	if afterID > 0 {
+		query = query.Where("id > ?", afterID).Order("id ASC")
+	} else {
+		if beforeID > 0 {
+			query = query.Where("id < ?", beforeID)
+		}
+		query = query.Order("id DESC")
+	}
+
+	// 多取一条用于判断是否还有更多
+	if err := query.Limit(limit + 1).Find(&messages).Error; err != nil {
+		return nil, false, err
+	}
+	if len(messages) > limit {
+		hasMore = true
+		messages = messages[:limit]
+	}
+	if afterID == 0 {
+		slices.Reverse(messages)
+	}
+	return messages, hasMore, nil
+}
+
+// GetBetweenIDs 获取当前分支上 afterID < id < beforeID 的消息，按 id 正序；beforeID 为 0 表示不限
+func (r *MessageRepository) GetBetweenIDs(characterID uint64, afterID uint64, beforeID uint64, limit int) ([]model.Message, error) {
 	var messages []model.Message
-	err := DB.Where("character_id = ?", characterID).
-		Order("created_at DESC").
-		Limit(limit).
-		Find(&messages).Error
+	query := activeMessages(DB, characterID).Where("id > ?", afterID)
+	if beforeID > 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Order("id ASC").Find(&messages).Error
 	return messages, err
 }
+
+// ListVersions 获取消息所在位置的所有版本，按创建顺序
+func (r *MessageRepository) ListVersions(message *model.Message) ([]model.Message, error) {
+	if message.VersionGroupID == 0 {
+		return []model.Message{*message}, nil
+	}
+	var versions []model.Message
+	err := DB.Where("character_id = ? AND version_group_id = ?", message.CharacterID, message.VersionGroupID).
+		Order("id ASC").
+		Find(&versions).Error
+	return versions, err
+}
+
+// AddVersion 为当前分支上的消息 current 新增一个版本并切换过去
+// current 之后的对话被隐藏，切回 current 时恢复
+func (r *MessageRepository) AddVersion(current *model.Message, version *model.Message) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if current.VersionGroupID == 0 {
+			current.VersionGroupID = current.ID
+			if err := tx.Model(current).Update("version_group_id", current.ID).Error; err != nil {
+				return err
+			}
+		}
+		if err := hideVersion(tx, current); err != nil {
+			return err
+		}
+
+		version.VersionGroupID = current.VersionGroupID
+		version.Inactive = false
+		return tx.Create(version).Error
+	})
+}
+
+// SelectVersion 把分支切换到 target 所在位置的版本 target，current 为该位置当前的版本
+func (r *MessageRepository) SelectVersion(current *model.Message, target *model.Message) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := hideVersion(tx, current); err != nil {
+			return err
+		}
+		// 恢复 target 及之前切走时隐藏的后续对话
+		return tx.Model(&model.Message{}).
+			Where("character_id = ? AND (id = ? OR branch_of = ?)", target.CharacterID, target.ID, target.ID).
+			Updates(map[string]interface{}{"inactive": false, "branch_of": 0}).Error
+	})
+}
+
+// hideVersion 把 current 移出当前分支，并把它之后的对话标记为属于 current
+func hideVersion(tx *gorm.DB, current *model.Message) error {
+	if err := activeMessages(tx, current.CharacterID).
+		Where("id > ?", current.ID).
+		Updates(map[string]interface{}{"inactive": true, "branch_of": current.ID}).Error; err != nil {
+		return err
+	}
+	current.Inactive = true
+	return tx.Model(current).Updates(map[string]interface{}{"inactive": true, "branch_of": 0}).Error
+}
+
+// Rewrite 修改消息内容，并删除当前分支上这条消息之后的所有对话及其其他版本
+func (r *MessageRepository) Rewrite(message *model.Message, content string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var groupIDs []uint64
+		if err := activeMessages(tx, message.CharacterID).
+			Where("id > ? AND version_group_id <> 0", message.ID).
+			Pluck("version_group_id", &groupIDs).Error; err != nil {
+			return err
+		}
+		if len(groupIDs) > 0 {
+			if err := tx.Where("character_id = ? AND version_group_id IN ?", message.CharacterID, groupIDs).
+				Delete(&model.Message{}).Error; err != nil {
+				return err
+			}
+		}
+		if err := activeMessages(tx, message.CharacterID).Where("id > ?", message.ID).
+			Delete(&model.Message{}).Error; err != nil {
+			return err
+		}
+
+		message.Content = content
+		return tx.Model(message).Update("content", content).Error
+	})
+}
+
+// Delete 删除消息：当前分支上的消息连同其所有版本一起删除，其他版本只删除自己
+func (r *MessageRepository) Delete(message *model.Message) error {
+	if message.Inactive || message.VersionGroupID == 0 {
+		return DB.Delete(message).Error
+	}
+	return DB.Where("character_id = ? AND version_group_id = ?", message.CharacterID, message.VersionGroupID).
+		Delete(&model.Message{}).Error
+}
@@ -0,0 +1,123 @@
+package repository_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/repository/repotest"
+)
+
+// createMessages 为角色依次创建 n 条消息，返回 ID；另一个角色的消息和已隐藏的版本穿插其中
+func createMessages(t *testing.T, characterID uint64, n int) []uint64 {
+	t.Helper()
+	messages := repository.NewMessageRepository()
+	var ids []uint64
+	for i := 0; i < n; i++ {
+		msg := &model.Message{UserID: 1, CharacterID: characterID, SenderType: model.SenderTypeUser, Content: fmt.Sprintf("message %d", i)}
+		other := &model.Message{UserID: 1, CharacterID: characterID + 1, SenderType: model.SenderTypeUser, Content: "other character"}
+		hidden := &model.Message{UserID: 1, CharacterID: characterID, SenderType: model.SenderTypeCharacter, Content: "replaced version", Inactive: true}
+		for _, m := range []*model.Message{msg, other, hidden} {
+			if err := messages.Create(m); err != nil {
+				t.Fatalf("create message: %v", err)
+			}
+		}
+		ids = append(ids, msg.ID)
+	}
+	return ids
+}
+
+func messageIDs(messages []model.Message) []uint64 {
+	ids := make([]uint64, len(messages))
+	for i, m := range messages {
+		ids[i] = m.ID
+	}
+	return ids
+}
+
+func TestListPage(t *testing.T) {
+	repotest.Open(t)
+	messages := repository.NewMessageRepository()
+	ids := createMessages(t, 10, 7)
+
+	tests := []struct {
+		name     string
+		before   uint64
+		after    uint64
+		limit    int
+		want     []uint64
+		wantMore bool
+	}{
+		{"latest", 0, 0, 3, ids[4:], true},
+		{"latest all", 0, 0, 7, ids, false},
+		{"latest more than all", 0, 0, 10, ids, false},
+		{"before", ids[4], 0, 3, ids[1:4], true},
+		{"before exact remainder", ids[3], 0, 3, ids[:3], false},
+		{"before first", ids[0], 0, 3, nil, false},
+		{"after", 0, ids[1], 3, ids[2:5], true},
+		{"after exact remainder", 0, ids[3], 3, ids[4:], false},
+		{"after last", 0, ids[6], 3, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, hasMore, err := messages.ListPage(10, tt.before, tt.after, tt.limit)
+			if err != nil {
+				t.Fatalf("ListPage: %v", err)
+			}
+			// 结果不论翻页方向都按 id 正序，不包含其他角色和已隐藏的消息
+			if got := messageIDs(page); !slices.Equal(got, tt.want) || hasMore != tt.wantMore {
+				t.Errorf("ListPage = %v, %v; want %v, %v", got, hasMore, tt.want, tt.wantMore)
+			}
+		})
+	}
+}
+
+func TestListPageWalk(t *testing.T) {
+	repotest.Open(t)
+	messages := repository.NewMessageRepository()
+	ids := createMessages(t, 10, 10)
+
+	// 向前翻页拼接出完整的历史，没有重复和遗漏
+	var older []uint64
+	var before uint64
+	for {
+		page, hasMore, err := messages.ListPage(10, before, 0, 3)
+		if err != nil {
+			t.Fatalf("ListPage: %v", err)
+		}
+		older = append(messageIDs(page), older...)
+		if !hasMore {
+			break
+		}
+		before = page[0].ID
+	}
+	if !slices.Equal(older, ids) {
+		t.Errorf("backward walk = %v, want %v", older, ids)
+	}
+
+	// 向后翻页同样完整
+	var newer []uint64
+	after := ids[0]
+	for {
+		page, hasMore, err := messages.ListPage(10, 0, after, 4)
+		if err != nil {
+			t.Fatalf("ListPage: %v", err)
+		}
+		newer = append(newer, messageIDs(page)...)
+		if !hasMore {
+			break
+		}
+		after = page[len(page)-1].ID
+	}
+	if !slices.Equal(newer, ids[1:]) {
+		t.Errorf("forward walk = %v, want %v", newer, ids[1:])
+	}
+
+	// 对话上下文按时间正序
+	recent, err := messages.GetRecentByCharacterID(10, 4)
+	if err != nil || !slices.Equal(messageIDs(recent), ids[6:]) {
+		t.Errorf("recent = %v, %v; want %v", messageIDs(recent), err, ids[6:])
+	}
+}
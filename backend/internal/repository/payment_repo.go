@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"lauraai-backend/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrPaymentNotRefundable 支付不是可退款状态
+var ErrPaymentNotRefundable = errors.New("payment not refundable")
+
+type PaymentRepository struct{}
+
+func NewPaymentRepository() *PaymentRepository {
+	return &PaymentRepository{}
+}
+
+func (r *PaymentRepository) Create(payment *model.Payment) error {
+	return DB.Create(payment).Error
+}
+
+func (r *PaymentRepository) GetByID(id uint64) (*model.Payment, error) {
+	var payment model.Payment
+	err := DB.First(&payment, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// GetByExternalTxID 通过外部交易号查找支付记录
+func (r *PaymentRepository) GetByExternalTxID(externalTxID string) (*model.Payment, error) {
+	var payment model.Payment
+	err := DB.Where("external_tx_id = ?", externalTxID).First(&payment).Error
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// GetPendingByPayload 查找 payload 对应的待支付记录
+func (r *PaymentRepository) GetPendingByPayload(payload string) (*model.Payment, error) {
+	var payment model.Payment
+	err := DB.Where("payload = ? AND status = ?", payload, model.PaymentStatusPending).
+		Order("id DESC").
+		First(&payment).Error
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// GetLatestPending 获取用户某个角色最近一条指定方式的待支付记录
+func (r *PaymentRepository) GetLatestPending(userID, characterID uint64, method model.PaymentMethod) (*model.Payment, error) {
+	var payment model.Payment
+	err := DB.Where("user_id = ? AND character_id = ? AND method = ? AND status = ?",
+		userID, characterID, method, model.PaymentStatusPending).
+		Order("id DESC").
+		First(&payment).Error
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// GetByUserID 获取用户的支付记录（最新在前）
+func (r *PaymentRepository) GetByUserID(userID uint64) ([]model.Payment, error) {
+	var payments []model.Payment
+	err := DB.Where("user_id = ?", userID).Order("id DESC").Find(&payments).Error
+	return payments, err
+}
+
+// SetPayload 更新支付记录的 payload
+func (r *PaymentRepository) SetPayload(id uint64, payload string) error {
+	return DB.Model(&model.Payment{}).Where("id = ?", id).Update("payload", payload).Error
+}
+
+// Settle 将待支付记录标记为终态并写入外部交易号
+// 使用行锁保证同一笔支付只会被结算一次；已结算过时返回 settled=false 和当前记录
+func (r *PaymentRepository) Settle(id uint64, externalTxID string, status model.PaymentStatus) (payment *model.Payment, settled bool, err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var p model.Payment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&p, id).Error; err != nil {
+			return err
+		}
+		payment = &p
+		if p.Status != model.PaymentStatusPending {
+			return nil
+		}
+
+		now := time.Now()
+		p.ExternalTxID = &externalTxID
+		p.Status = status
+		p.PaidAt = &now
+		if err := tx.Save(&p).Error; err != nil {
+			return err
+		}
+		// 支付成功时核销优惠码，失败时释放待支付记录占用的次数
+		if status == model.PaymentStatusSucceeded {
+			if err := RedeemPromoTx(tx, p.ID); err != nil {
+				return err
+			}
+		} else if err := ReleasePromoTx(tx, p.ID); err != nil {
+			return err
+		}
+		settled = true
+		return nil
+	})
+	if err != nil && errors.Is(err, gorm.ErrDuplicatedKey) {
+		// 交易号已被其他记录使用（重放），返回原记录
+		existing, getErr := r.GetByExternalTxID(externalTxID)
+		if getErr != nil {
+			return nil, false, err
+		}
+		return existing, false, nil
+	}
+	return payment, settled, err
+}
@@ -0,0 +1,75 @@
+package repository_test
+
+import (
+	"testing"
+
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/repository/repotest"
+)
+
+// createPayment 创建 100 Stars 的待支付记录
+func createPayment(t *testing.T, userID, characterID uint64) *model.Payment {
+	t.Helper()
+	payment := &model.Payment{
+		UserID:      userID,
+		CharacterID: characterID,
+		Method:      model.PaymentMethodStars,
+		Amount:      100,
+		Status:      model.PaymentStatusPending,
+	}
+	if err := repository.NewPaymentRepository().Create(payment); err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+	return payment
+}
+
+func TestSettleOnce(t *testing.T) {
+	repotest.Open(t)
+	payments := repository.NewPaymentRepository()
+	payment := createPayment(t, 1, 10)
+
+	settled, ok, err := payments.Settle(payment.ID, "charge-1", model.PaymentStatusSucceeded)
+	if err != nil || !ok {
+		t.Fatalf("Settle = %v, %v", ok, err)
+	}
+	if settled.Status != model.PaymentStatusSucceeded || settled.PaidAt == nil || *settled.ExternalTxID != "charge-1" {
+		t.Errorf("settled = %+v", settled)
+	}
+
+	// 重复结算不改变已结算的记录
+	again, ok, err := payments.Settle(payment.ID, "charge-2", model.PaymentStatusFailed)
+	if err != nil || ok {
+		t.Fatalf("second Settle = %v, %v; want not settled", ok, err)
+	}
+	if again.Status != model.PaymentStatusSucceeded || *again.ExternalTxID != "charge-1" {
+		t.Errorf("second Settle changed payment: %+v", again)
+	}
+}
+
+func TestSettleDuplicateExternalTxID(t *testing.T) {
+	repotest.Open(t)
+	payments := repository.NewPaymentRepository()
+	first := createPayment(t, 1, 10)
+	second := createPayment(t, 1, 20)
+
+	if _, ok, err := payments.Settle(first.ID, "charge-1", model.PaymentStatusSucceeded); err != nil || !ok {
+		t.Fatalf("Settle = %v, %v", ok, err)
+	}
+
+	// 同一个外部交易号不能结算第二笔支付，返回原来的记录
+	existing, ok, err := payments.Settle(second.ID, "charge-1", model.PaymentStatusSucceeded)
+	if err != nil || ok {
+		t.Fatalf("replayed Settle = %v, %v; want not settled", ok, err)
+	}
+	if existing.ID != first.ID {
+		t.Errorf("replayed Settle returned payment %d, want %d", existing.ID, first.ID)
+	}
+	reloaded, err := payments.GetByID(second.ID)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if reloaded.Status != model.PaymentStatusPending || reloaded.ExternalTxID != nil {
+		t.Errorf("replayed charge settled another payment: %+v", reloaded)
+	}
+}
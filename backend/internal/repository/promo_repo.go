@@ -0,0 +1,319 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"lauraai-backend/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 优惠码校验错误
+var (
+	ErrPromoInvalid       = errors.New("promo code invalid")
+	ErrPromoExpired       = errors.New("promo code expired")
+	ErrPromoExhausted     = errors.New("promo code fully redeemed")
+	ErrPromoUserLimit     = errors.New("promo code per-user limit reached")
+	ErrPromoNotApplicable = errors.New("promo code not applicable to this character")
+)
+
+// promoReservationTTL 待支付记录占用优惠码次数的最长时间，超时未支付时释放给其他用户
+const promoReservationTTL = 30 * time.Minute
+
+type PromoRepository struct{}
+
+func NewPromoRepository() *PromoRepository {
+	return &PromoRepository{}
+}
+
+// NormalizePromoCode 优惠码不区分大小写
+func NormalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func (r *PromoRepository) Create(promo *model.PromoCode) error {
+	promo.Code = NormalizePromoCode(promo.Code)
+	return DB.Create(promo).Error
+}
+
+func (r *PromoRepository) GetByCode(code string) (*model.PromoCode, error) {
+	var promo model.PromoCode
+	err := DB.Where("code = ?", NormalizePromoCode(code)).First(&promo).Error
+	if err != nil {
+		return nil, err
+	}
+	return &promo, nil
+}
+
+// CountUserRedemptions 统计用户占用的使用次数（待支付和已支付成功的）
+func (r *PromoRepository) CountUserRedemptions(promoID, userID uint64) (int64, error) {
+	return countUserRedemptions(DB, promoID, userID)
+}
+
+func countUserRedemptions(db *gorm.DB, promoID, userID uint64) (int64, error) {
+	var count int64
+	err := db.Model(&model.PromoRedemption{}).
+		Where("promo_code_id = ? AND user_id = ? AND reserved_at IS NOT NULL", promoID, userID).
+		Count(&count).Error
+	return count, err
+}
+
+// GetRedemptionByPaymentID 获取支付使用的优惠码记录
+func (r *PromoRepository) GetRedemptionByPaymentID(paymentID uint64) (*model.PromoRedemption, error) {
+	var redemption model.PromoRedemption
+	err := DB.Where("payment_id = ?", paymentID).First(&redemption).Error
+	if err != nil {
+		return nil, err
+	}
+	return &redemption, nil
+}
+
+// CheckPromo 校验优惠码对该用户和角色类型是否可用（不加锁，用于报价预览）
+func (r *PromoRepository) CheckPromo(code string, userID uint64, charType model.CharacterType) (*model.PromoCode, error) {
+	return checkPromo(DB, code, userID, charType, false)
+}
+
+// CheckRedemption 支付前重新校验待支付记录使用的优惠码仍然可用（停用或过期时拒绝）
+// 占用的次数已超时释放时重新占用，次数已用完则拒绝；支付记录未使用优惠码时返回 nil
+func (r *PromoRepository) CheckRedemption(paymentID uint64, userID uint64, charType model.CharacterType) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var redemption model.PromoRedemption
+		err := tx.Where("payment_id = ?", paymentID).First(&redemption).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var code string
+		if err := tx.Model(&model.PromoCode{}).Where("id = ?", redemption.PromoCodeID).Pluck("code", &code).Error; err != nil {
+			return err
+		}
+		promo, err := findPromo(tx, code, charType, true)
+		if err != nil {
+			return err
+		}
+		if err := releaseStaleReservationsTx(tx, promo); err != nil {
+			return err
+		}
+		return reserveRedemptionTx(tx, promo, &redemption, userID)
+	})
+}
+
+// checkPromo 校验优惠码可用且用户还有剩余次数
+func checkPromo(db *gorm.DB, code string, userID uint64, charType model.CharacterType, lock bool) (*model.PromoCode, error) {
+	promo, err := findPromo(db, code, charType, lock)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPromoLimits(db, promo, userID); err != nil {
+		return nil, err
+	}
+	return promo, nil
+}
+
+// findPromo 查找优惠码并校验已启用、未过期且适用于该角色类型，lock 时锁定优惠码行
+func findPromo(db *gorm.DB, code string, charType model.CharacterType, lock bool) (*model.PromoCode, error) {
+	query := db.Where("code = ?", NormalizePromoCode(code))
+	if lock {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+
+	var promo model.PromoCode
+	if err := query.First(&promo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPromoInvalid
+		}
+		return nil, err
+	}
+
+	if !promo.Active {
+		return nil, ErrPromoInvalid
+	}
+	if promo.IsExpired(time.Now()) {
+		return nil, ErrPromoExpired
+	}
+	if !promo.AppliesTo(charType) {
+		return nil, ErrPromoNotApplicable
+	}
+	return &promo, nil
+}
+
+// checkPromoLimits 校验总次数和每用户次数上限，待支付记录占用的次数同样计入
+func checkPromoLimits(db *gorm.DB, promo *model.PromoCode, userID uint64) error {
+	if promo.MaxRedemptions > 0 && promo.RedemptionCount >= promo.MaxRedemptions {
+		return ErrPromoExhausted
+	}
+	if promo.PerUserLimit > 0 {
+		used, err := countUserRedemptions(db, promo.ID, userID)
+		if err != nil {
+			return err
+		}
+		if used >= int64(promo.PerUserLimit) {
+			return ErrPromoUserLimit
+		}
+	}
+	return nil
+}
+
+// releaseStaleReservationsTx 释放超过 promoReservationTTL 仍未支付的待支付记录占用的次数
+// 调用方需已锁定优惠码行，释放后同步更新 promo.RedemptionCount
+func releaseStaleReservationsTx(tx *gorm.DB, promo *model.PromoCode) error {
+	result := tx.Model(&model.PromoRedemption{}).
+		Where("promo_code_id = ? AND redeemed_at IS NULL AND reserved_at < ?", promo.ID, time.Now().Add(-promoReservationTTL)).
+		Update("reserved_at", nil)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	promo.RedemptionCount = max(promo.RedemptionCount-int(result.RowsAffected), 0)
+	return tx.Model(promo).Update("redemption_count", promo.RedemptionCount).Error
+}
+
+// reserveRedemptionTx 为复用的使用记录占用次数：仍在占用时只刷新占用时间，已释放时重新校验上限后占用
+// 调用方需已锁定优惠码行
+func reserveRedemptionTx(tx *gorm.DB, promo *model.PromoCode, redemption *model.PromoRedemption, userID uint64) error {
+	now := time.Now()
+	if redemption.ReservedAt != nil {
+		redemption.ReservedAt = &now
+		return tx.Model(redemption).Update("reserved_at", now).Error
+	}
+	if err := checkPromoLimits(tx, promo, userID); err != nil {
+		return err
+	}
+	redemption.ReservedAt = &now
+	if err := tx.Model(redemption).Update("reserved_at", now).Error; err != nil {
+		return err
+	}
+	promo.RedemptionCount++
+	return tx.Model(promo).Update("redemption_count", gorm.Expr("redemption_count + 1")).Error
+}
+
+// RedeemWithPayment 在同一事务中锁定优惠码、校验可用性、创建支付记录并写入使用记录
+// payment.Amount 传入原价，返回时已扣除优惠金额。
+// 创建待支付记录时即占用一次使用次数，并发请求和未支付的记录都不会超出上限：
+// 支付失败或退款时由 ReleasePromoTx 释放，超过 promoReservationTTL 未支付的在下次核销时释放。
+// 用户对同一角色已有使用该优惠码的待支付记录时直接复用，复用前同样重新校验优惠码。
+func (r *PromoRepository) RedeemWithPayment(code string, charType model.CharacterType, payment *model.Payment) (*model.PromoRedemption, error) {
+	var redemption model.PromoRedemption
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定优惠码行，串行化同一优惠码的并发核销；停用、过期时不再复用旧的待支付记录
+		promo, err := findPromo(tx, code, charType, true)
+		if err != nil {
+			return err
+		}
+		if err := releaseStaleReservationsTx(tx, promo); err != nil {
+			return err
+		}
+		discount := promo.Discount(payment.Method, payment.Amount)
+
+		// 复用未支付的同一次核销
+		var existing model.Payment
+		err = tx.Joins("JOIN promo_redemptions ON promo_redemptions.payment_id = payments.id").
+			Where("promo_redemptions.promo_code_id = ? AND payments.user_id = ? AND payments.character_id = ? AND payments.method = ? AND payments.status = ? AND payments.previous_unlock_status = ?",
+				promo.ID, payment.UserID, payment.CharacterID, payment.Method, model.PaymentStatusPending, payment.PreviousUnlockStatus).
+			Order("payments.id DESC").
+			First(&existing).Error
+		if err == nil {
+			if err := tx.Where("payment_id = ?", existing.ID).First(&redemption).Error; err != nil {
+				return err
+			}
+			if err := reserveRedemptionTx(tx, promo, &redemption, payment.UserID); err != nil {
+				return err
+			}
+			// 报价变化（例如促销开始/结束）时按新价格更新金额，旧发票在支付前校验时会被拒绝
+			if existing.Amount != payment.Amount-discount {
+				existing.Amount = payment.Amount - discount
+				redemption.Discount = discount
+				if err := tx.Model(&existing).Update("amount", existing.Amount).Error; err != nil {
+					return err
+				}
+				if err := tx.Model(&redemption).Update("discount", discount).Error; err != nil {
+					return err
+				}
+			}
+			*payment = existing
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if err := checkPromoLimits(tx, promo, payment.UserID); err != nil {
+			return err
+		}
+		payment.Amount -= discount
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		redemption = model.PromoRedemption{
+			PromoCodeID: promo.ID,
+			UserID:      payment.UserID,
+			CharacterID: payment.CharacterID,
+			PaymentID:   payment.ID,
+			Discount:    discount,
+			ReservedAt:  &now,
+		}
+		if err := tx.Create(&redemption).Error; err != nil {
+			return err
+		}
+		return tx.Model(promo).Update("redemption_count", gorm.Expr("redemption_count + 1")).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &redemption, nil
+}
+
+// RedeemPromoTx 支付成功时在结算事务中核销支付使用的优惠码，重复调用不会重复计数
+// 占用已超时释放后才完成支付时重新计入次数：用户已经付款，此时即使超出上限也照常核销
+func RedeemPromoTx(tx *gorm.DB, paymentID uint64) error {
+	var redemption model.PromoRedemption
+	err := tx.Where("payment_id = ?", paymentID).First(&redemption).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	updates := map[string]any{"redeemed_at": now}
+	if redemption.ReservedAt == nil {
+		updates["reserved_at"] = now
+	}
+	result := tx.Model(&model.PromoRedemption{}).
+		Where("id = ? AND redeemed_at IS NULL", redemption.ID).
+		Updates(updates)
+	if result.Error != nil || result.RowsAffected == 0 || redemption.ReservedAt != nil {
+		return result.Error
+	}
+	return tx.Model(&model.PromoCode{}).Where("id = ?", redemption.PromoCodeID).
+		Update("redemption_count", gorm.Expr("redemption_count + 1")).Error
+}
+
+// ReleasePromoTx 支付失败或退款时在同一事务中释放支付占用的优惠码次数，重复调用不会重复释放
+func ReleasePromoTx(tx *gorm.DB, paymentID uint64) error {
+	var redemption model.PromoRedemption
+	err := tx.Where("payment_id = ?", paymentID).First(&redemption).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	result := tx.Model(&model.PromoRedemption{}).
+		Where("id = ? AND reserved_at IS NOT NULL", redemption.ID).
+		Updates(map[string]any{"reserved_at": nil, "redeemed_at": nil})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	return tx.Model(&model.PromoCode{}).Where("id = ? AND redemption_count > 0", redemption.PromoCodeID).
+		Update("redemption_count", gorm.Expr("redemption_count - 1")).Error
+}
@@ -0,0 +1,227 @@
+package repository_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/repository/repotest"
+
+	"gorm.io/gorm"
+)
+
+func createPromo(t *testing.T, promo *model.PromoCode) *model.PromoCode {
+	t.Helper()
+	promo.Active = true
+	if err := repository.NewPromoRepository().Create(promo); err != nil {
+		t.Fatalf("create promo: %v", err)
+	}
+	return promo
+}
+
+// redeem 以 100 Stars 原价为用户的角色创建使用优惠码的待支付记录
+func redeem(code string, userID, characterID uint64) (*model.Payment, error) {
+	payment := &model.Payment{
+		UserID:      userID,
+		CharacterID: characterID,
+		Method:      model.PaymentMethodStars,
+		Amount:      100,
+		Status:      model.PaymentStatusPending,
+	}
+	_, err := repository.NewPromoRepository().RedeemWithPayment(code, model.CharacterTypeSoulmate, payment)
+	return payment, err
+}
+
+func redemptionCount(t *testing.T, id uint64) int {
+	t.Helper()
+	var promo model.PromoCode
+	if err := repository.DB.First(&promo, id).Error; err != nil {
+		t.Fatalf("reload promo: %v", err)
+	}
+	return promo.RedemptionCount
+}
+
+func TestPromoReservedOnRedeem(t *testing.T) {
+	repotest.Open(t)
+	promos := repository.NewPromoRepository()
+	payments := repository.NewPaymentRepository()
+	promo := createPromo(t, &model.PromoCode{Code: "once", DiscountType: model.PromoDiscountPercent, PercentOff: 50, MaxRedemptions: 1})
+
+	// 创建待支付记录时即占用次数
+	first, err := redeem("ONCE", 1, 10)
+	if err != nil {
+		t.Fatalf("first redeem: %v", err)
+	}
+	if first.Amount != 50 {
+		t.Errorf("amount = %d, want 50", first.Amount)
+	}
+	if got := redemptionCount(t, promo.ID); got != 1 {
+		t.Fatalf("redemption_count = %d, want 1", got)
+	}
+	if _, err := redeem("once", 2, 20); !errors.Is(err, repository.ErrPromoExhausted) {
+		t.Fatalf("second redeem while first is pending = %v, want ErrPromoExhausted", err)
+	}
+	// 同一用户同一角色复用自己的待支付记录
+	if again, err := redeem("once", 1, 10); err != nil || again.ID != first.ID {
+		t.Fatalf("reuse own pending payment: %v (id %d, want %d)", err, again.ID, first.ID)
+	}
+	if err := promos.CheckRedemption(first.ID, 1, model.CharacterTypeSoulmate); err != nil {
+		t.Errorf("CheckRedemption of reserved payment = %v", err)
+	}
+
+	// 支付成功不重复计数
+	if _, _, err := payments.Settle(first.ID, "charge-1", model.PaymentStatusSucceeded); err != nil {
+		t.Fatalf("settle: %v", err)
+	}
+	payments.Settle(first.ID, "charge-1", model.PaymentStatusSucceeded)
+	if got := redemptionCount(t, promo.ID); got != 1 {
+		t.Fatalf("redemption_count after settle = %d, want 1", got)
+	}
+
+	// 退款释放次数，重复释放不会重复扣减
+	for range 2 {
+		err = repository.DB.Transaction(func(tx *gorm.DB) error {
+			return repository.ReleasePromoTx(tx, first.ID)
+		})
+		if err != nil {
+			t.Fatalf("release: %v", err)
+		}
+	}
+	if got := redemptionCount(t, promo.ID); got != 0 {
+		t.Errorf("redemption_count after refund = %d, want 0", got)
+	}
+	if _, err := redeem("once", 2, 20); err != nil {
+		t.Errorf("redeem after refund: %v", err)
+	}
+}
+
+func TestPromoFailedPaymentReleased(t *testing.T) {
+	repotest.Open(t)
+	promo := createPromo(t, &model.PromoCode{Code: "user1", DiscountType: model.PromoDiscountFixed, FixedOffStars: 10, PerUserLimit: 1})
+
+	payment, err := redeem("user1", 1, 10)
+	if err != nil {
+		t.Fatalf("redeem: %v", err)
+	}
+	// 每用户上限同样计入待支付的记录，不能同时为多个角色使用
+	if _, err := redeem("user1", 1, 11); !errors.Is(err, repository.ErrPromoUserLimit) {
+		t.Errorf("redeem for another character while pending = %v, want ErrPromoUserLimit", err)
+	}
+
+	if _, _, err := repository.NewPaymentRepository().Settle(payment.ID, "charge-failed", model.PaymentStatusFailed); err != nil {
+		t.Fatalf("settle: %v", err)
+	}
+	if got := redemptionCount(t, promo.ID); got != 0 {
+		t.Errorf("failed payment still counted: %d", got)
+	}
+	if _, err := redeem("user1", 1, 11); err != nil {
+		t.Errorf("redeem after failed payment: %v", err)
+	}
+}
+
+func TestPromoStaleReservationReleased(t *testing.T) {
+	repotest.Open(t)
+	promos := repository.NewPromoRepository()
+	promo := createPromo(t, &model.PromoCode{Code: "stale", DiscountType: model.PromoDiscountPercent, PercentOff: 50, MaxRedemptions: 1})
+
+	stale, err := redeem("stale", 1, 10)
+	if err != nil {
+		t.Fatalf("redeem: %v", err)
+	}
+	repository.DB.Model(&model.PromoRedemption{}).Where("payment_id = ?", stale.ID).
+		Update("reserved_at", time.Now().Add(-time.Hour))
+
+	// 超时未支付的记录让出次数
+	fresh, err := redeem("stale", 2, 20)
+	if err != nil {
+		t.Fatalf("redeem after reservation expired: %v", err)
+	}
+	if got := redemptionCount(t, promo.ID); got != 1 {
+		t.Errorf("redemption_count = %d, want 1", got)
+	}
+	if err := promos.CheckRedemption(stale.ID, 1, model.CharacterTypeSoulmate); !errors.Is(err, repository.ErrPromoExhausted) {
+		t.Errorf("CheckRedemption of released payment = %v, want ErrPromoExhausted", err)
+	}
+
+	// 已释放的记录最终仍然支付成功时照常计数
+	if _, _, err := repository.NewPaymentRepository().Settle(stale.ID, "charge-late", model.PaymentStatusSucceeded); err != nil {
+		t.Fatalf("settle: %v", err)
+	}
+	if got := redemptionCount(t, promo.ID); got != 2 {
+		t.Errorf("redemption_count after late payment = %d, want 2", got)
+	}
+	if err := promos.CheckRedemption(fresh.ID, 2, model.CharacterTypeSoulmate); err != nil {
+		t.Errorf("CheckRedemption of fresh payment = %v", err)
+	}
+}
+
+func TestPromoConcurrentRedeem(t *testing.T) {
+	repotest.Open(t)
+	const limit, attempts = 3, 20
+	promo := createPromo(t, &model.PromoCode{Code: "rush", DiscountType: model.PromoDiscountPercent, PercentOff: 10, MaxRedemptions: limit})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var succeeded, exhausted int
+	for i := range attempts {
+		wg.Add(1)
+		go func(userID uint64) {
+			defer wg.Done()
+			_, err := redeem("rush", userID, userID*10)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case errors.Is(err, repository.ErrPromoExhausted):
+				exhausted++
+			default:
+				t.Errorf("redeem: %v", err)
+			}
+		}(uint64(i + 1))
+	}
+	wg.Wait()
+
+	if succeeded != limit || exhausted != attempts-limit {
+		t.Errorf("succeeded = %d, exhausted = %d; want %d and %d", succeeded, exhausted, limit, attempts-limit)
+	}
+	if got := redemptionCount(t, promo.ID); got != limit {
+		t.Errorf("redemption_count = %d, want %d", got, limit)
+	}
+	var pending int64
+	repository.DB.Model(&model.Payment{}).Where("status = ?", model.PaymentStatusPending).Count(&pending)
+	if pending != limit {
+		t.Errorf("pending payments = %d, want %d", pending, limit)
+	}
+}
+
+func TestPromoReuseRevalidated(t *testing.T) {
+	repotest.Open(t)
+	promo := createPromo(t, &model.PromoCode{Code: "reuse", DiscountType: model.PromoDiscountPercent, PercentOff: 20})
+
+	first, err := redeem("reuse", 1, 10)
+	if err != nil {
+		t.Fatalf("redeem: %v", err)
+	}
+	again, err := redeem("reuse", 1, 10)
+	if err != nil || again.ID != first.ID {
+		t.Fatalf("pending payment not reused: %v (id %d, want %d)", err, again.ID, first.ID)
+	}
+
+	expired := time.Now().Add(-time.Minute)
+	repository.DB.Model(promo).Update("expires_at", expired)
+	if _, err := redeem("reuse", 1, 10); !errors.Is(err, repository.ErrPromoExpired) {
+		t.Errorf("reuse after expiry = %v, want ErrPromoExpired", err)
+	}
+
+	repository.DB.Model(promo).Updates(map[string]any{"expires_at": nil, "active": false})
+	if _, err := redeem("reuse", 1, 10); !errors.Is(err, repository.ErrPromoInvalid) {
+		t.Errorf("reuse after deactivation = %v, want ErrPromoInvalid", err)
+	}
+	if err := repository.NewPromoRepository().CheckRedemption(first.ID, 1, model.CharacterTypeSoulmate); !errors.Is(err, repository.ErrPromoInvalid) {
+		t.Errorf("CheckRedemption after deactivation = %v, want ErrPromoInvalid", err)
+	}
+}
@@ -0,0 +1,81 @@
+// Package repotest 为测试准备独立的数据库
+// 设置 TEST_POSTGRES_DSN 时每个测试使用 Postgres 中单独的 schema，否则使用内存中的 SQLite
+package repotest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"testing"
+
+	"lauraai-backend/internal/config"
+	"lauraai-backend/internal/repository"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Open 加载默认配置，创建空数据库并设置为 repository.DB，测试结束后恢复
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+	config.LoadConfig()
+
+	name := "test_" + randomSuffix()
+	gormConfig := &gorm.Config{
+		Logger:         logger.Default.LogMode(logger.Silent),
+		TranslateError: true,
+	}
+
+	var db *gorm.DB
+	var err error
+	if dsn := os.Getenv("TEST_POSTGRES_DSN"); dsn != "" {
+		admin, err := gorm.Open(postgres.Open(dsn), gormConfig)
+		if err != nil {
+			t.Fatalf("connect to postgres: %v", err)
+		}
+		if err := admin.Exec("CREATE SCHEMA " + name).Error; err != nil {
+			t.Fatalf("create schema: %v", err)
+		}
+		t.Cleanup(func() {
+			admin.Exec("DROP SCHEMA " + name + " CASCADE")
+			if sqlDB, err := admin.DB(); err == nil {
+				sqlDB.Close()
+			}
+		})
+		db, err = gorm.Open(postgres.Open(dsn+" search_path="+name), gormConfig)
+		if err != nil {
+			t.Fatalf("connect to postgres: %v", err)
+		}
+	} else {
+		db, err = gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared&_pragma=busy_timeout(5000)", name)), gormConfig)
+		if err != nil {
+			t.Fatalf("open sqlite: %v", err)
+		}
+		// 内存数据库在最后一个连接关闭时销毁；单连接避免 SQLite 的表锁冲突
+		sqlDB, _ := db.DB()
+		sqlDB.SetMaxOpenConns(1)
+	}
+
+	previous := repository.DB
+	repository.DB = db
+	t.Cleanup(func() {
+		repository.DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if err := repository.AutoMigrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func randomSuffix() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"lauraai-backend/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 分享链接不可用的原因
+var (
+	ErrShareRevoked   = errors.New("share link revoked")
+	ErrShareExpired   = errors.New("share link expired")
+	ErrShareExhausted = errors.New("share link max uses reached")
+)
+
+type ShareLinkRepository struct{}
+
+func NewShareLinkRepository() *ShareLinkRepository {
+	return &ShareLinkRepository{}
+}
+
+func (r *ShareLinkRepository) GetByCode(code string) (*model.ShareLink, error) {
+	var link model.ShareLink
+	err := DB.Where("code = ?", code).First(&link).Error
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// Resolve 通过分享码查找分享链接
+// 旧数据只有 Character.ShareCode 没有分享链接记录时，自动补建一条不限期的记录
+func (r *ShareLinkRepository) Resolve(code string) (*model.ShareLink, error) {
+	link, err := r.GetByCode(code)
+	if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) {
+		return link, err
+	}
+
+	var character model.Character
+	if err := DB.Where("share_code = ?", code).First(&character).Error; err != nil {
+		return nil, err
+	}
+	link = &model.ShareLink{CharacterID: character.ID, Code: code}
+	if err := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(link).Error; err != nil {
+		return nil, err
+	}
+	return r.GetByCode(code)
+}
+
+// CheckShareLinkActive 检查分享链接是否仍然有效（未撤销、未过期），用于查看分享页
+func CheckShareLinkActive(link *model.ShareLink) error {
+	switch {
+	case link.IsRevoked():
+		return ErrShareRevoked
+	case link.IsExpired(time.Now()):
+		return ErrShareExpired
+	}
+	return nil
+}
+
+// CheckShareLinkUsable 检查分享链接是否可用于助力，除有效外还不能达到使用次数上限
+func CheckShareLinkUsable(link *model.ShareLink) error {
+	if err := CheckShareLinkActive(link); err != nil {
+		return err
+	}
+	if link.IsExhausted() {
+		return ErrShareExhausted
+	}
+	return nil
+}
+
+// Rotate 撤销角色的所有有效分享链接并生成新的分享码，同时更新 Character.ShareCode
+func (r *ShareLinkRepository) Rotate(characterID uint64, expiresAt *time.Time, maxUses int) (*model.ShareLink, error) {
+	link := &model.ShareLink{
+		CharacterID: characterID,
+		Code:        GenerateShareCode(),
+		ExpiresAt:   expiresAt,
+		MaxUses:     maxUses,
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var character model.Character
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&character, characterID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&model.ShareLink{}).
+			Where("character_id = ? AND revoked_at IS NULL", characterID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		// 旧分享码还没有记录时补一条已撤销的记录，避免被当作“不存在”
+		if character.ShareCode != "" {
+			now := time.Now()
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.ShareLink{
+				CharacterID: characterID,
+				Code:        character.ShareCode,
+				RevokedAt:   &now,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(link).Error; err != nil {
+			return err
+		}
+		return tx.Model(&character).Update("share_code", link.Code).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+// ConsumeUse 原子地占用一次使用次数，链接不可用时返回对应错误
+func (r *ShareLinkRepository) ConsumeUse(linkID uint64) error {
+	result := DB.Model(&model.ShareLink{}).
+		Where("id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?) AND (max_uses = 0 OR use_count < max_uses)",
+			linkID, time.Now()).
+		Update("use_count", gorm.Expr("use_count + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	var link model.ShareLink
+	if err := DB.First(&link, linkID).Error; err != nil {
+		return err
+	}
+	if err := CheckShareLinkUsable(&link); err != nil {
+		return err
+	}
+	return ErrShareExhausted
+}
+
+// ReleaseUse 助力失败时归还占用的使用次数
+func (r *ShareLinkRepository) ReleaseUse(linkID uint64) error {
+	return DB.Model(&model.ShareLink{}).
+		Where("id = ? AND use_count > 0", linkID).
+		Update("use_count", gorm.Expr("use_count - 1")).Error
+}
+
+// BackfillShareLinks 为没有分享码的旧角色生成分享码，并为已有分享码补建分享链接记录
+func BackfillShareLinks() error {
+	var characters []model.Character
+	if err := DB.Where("share_code = '' OR share_code IS NULL").Find(&characters).Error; err != nil {
+		return err
+	}
+	for _, character := range characters {
+		if err := DB.Model(&character).Update("share_code", GenerateShareCode()).Error; err != nil {
+			return err
+		}
+	}
+
+	return DB.Exec(`INSERT INTO share_links (character_id, code, max_uses, use_count, created_at)
+		SELECT id, share_code, 0, 0, created_at FROM characters
+		WHERE share_code <> '' AND deleted_at IS NULL
+		ON CONFLICT DO NOTHING`).Error
+}
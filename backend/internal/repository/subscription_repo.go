@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"lauraai-backend/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SubscriptionRepository struct{}
+
+func NewSubscriptionRepository() *SubscriptionRepository {
+	return &SubscriptionRepository{}
+}
+
+func (r *SubscriptionRepository) GetByUserID(userID uint64) (*model.Subscription, error) {
+	var subscription model.Subscription
+	err := DB.Where("user_id = ?", userID).First(&subscription).Error
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// IsActive 用户当前是否有有效订阅
+func (r *SubscriptionRepository) IsActive(userID uint64) bool {
+	subscription, err := r.GetByUserID(userID)
+	if err != nil {
+		return false
+	}
+	return subscription.IsActive(time.Now())
+}
+
+// Renew 记录一次订阅扣款（首次订阅或自动续费），将有效期设置为 expiresAt
+// 同一笔扣款重复投递时有效期不变，可以安全重放
+func (r *SubscriptionRepository) Renew(userID uint64, plan model.SubscriptionPlan, chargeID string, expiresAt time.Time) (*model.Subscription, error) {
+	var subscription model.Subscription
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", userID).First(&subscription).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			subscription = model.Subscription{
+				UserID:    userID,
+				Plan:      plan,
+				Status:    model.SubscriptionStatusActive,
+				StartedAt: time.Now(),
+				ExpiresAt: expiresAt,
+
+				LastChargeID: chargeID,
+			}
+			return tx.Create(&subscription).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		// 已失效的订阅重新开始计算
+		if !subscription.IsActive(time.Now()) {
+			subscription.StartedAt = time.Now()
+		}
+		subscription.Plan = plan
+		subscription.Status = model.SubscriptionStatusActive
+		if expiresAt.After(subscription.ExpiresAt) {
+			subscription.ExpiresAt = expiresAt
+		}
+		subscription.LastChargeID = chargeID
+		return tx.Save(&subscription).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// SetStatus 更新订阅状态
+func (r *SubscriptionRepository) SetStatus(userID uint64, status model.SubscriptionStatus) error {
+	return DB.Model(&model.Subscription{}).Where("user_id = ?", userID).Update("status", status).Error
+}
+
+// RefundCharge 退款的扣款是最近一次扣款时订阅立即失效
+func (r *SubscriptionRepository) RefundCharge(chargeID string) (bool, error) {
+	result := DB.Model(&model.Subscription{}).
+		Where("last_charge_id = ?", chargeID).
+		Updates(map[string]interface{}{
+			"status":     model.SubscriptionStatusRefunded,
+			"expires_at": time.Now(),
+		})
+	return result.RowsAffected > 0, result.Error
+}
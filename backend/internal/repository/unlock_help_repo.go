@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"lauraai-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type UnlockHelpRepository struct{}
+
+func NewUnlockHelpRepository() *UnlockHelpRepository {
+	return &UnlockHelpRepository{}
+}
+
+// CountByCharacterID 统计角色收到的助力次数
+func (r *UnlockHelpRepository) CountByCharacterID(characterID uint64) (int64, error) {
+	return CountUnlockHelpsTx(DB, characterID)
+}
+
+// HasHelpedOwner 检查某用户是否曾经帮助过某个用户的任何角色解锁
+func (r *UnlockHelpRepository) HasHelpedOwner(helperID uint64, ownerID uint64) (bool, error) {
+	return HasHelpedOwnerTx(DB, helperID, ownerID)
+}
+
+// CountUnlockHelpsTx 在指定事务中统计角色的助力次数
+func CountUnlockHelpsTx(tx *gorm.DB, characterID uint64) (int64, error) {
+	var count int64
+	err := tx.Model(&model.UnlockHelp{}).Where("character_id = ?", characterID).Count(&count).Error
+	return count, err
+}
+
+// HasHelpedOwnerTx 在指定事务中检查助力记录（用于解锁状态转换时加锁校验）
+func HasHelpedOwnerTx(tx *gorm.DB, helperID uint64, ownerID uint64) (bool, error) {
+	var count int64
+	err := tx.Model(&model.UnlockHelp{}).
+		Where("owner_id = ? AND helper_id = ?", ownerID, helperID).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// BackfillUnlockHelps 将旧的单一助力者字段 unlock_helper_id 迁移到 unlock_helps 表
+func BackfillUnlockHelps() error {
+	return DB.Exec(`INSERT INTO unlock_helps (character_id, owner_id, helper_id, created_at)
+		SELECT id, user_id, unlock_helper_id, updated_at FROM characters
+		WHERE unlock_helper_id IS NOT NULL AND deleted_at IS NULL
+		ON CONFLICT DO NOTHING`).Error
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"lauraai-backend/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type UsageRepository struct{}
+
+func NewUsageRepository() *UsageRepository {
+	return &UsageRepository{}
+}
+
+// GetDay 获取用户某天的用量，没有记录时返回零用量
+func (r *UsageRepository) GetDay(userID uint64, day time.Time) (*model.ChatUsage, error) {
+	var usage model.ChatUsage
+	err := DB.Where("user_id = ? AND day = ?", userID, day).First(&usage).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &model.ChatUsage{UserID: userID, Day: day}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// Add 累加用户某天的用量
+func (r *UsageRepository) Add(userID uint64, day time.Time, messages int, promptTokens int64, completionTokens int64) error {
+	usage := &model.ChatUsage{
+		UserID:           userID,
+		Day:              day,
+		Messages:         messages,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+	}
+	return DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"messages":          gorm.Expr("chat_usage.messages + EXCLUDED.messages"),
+			"prompt_tokens":     gorm.Expr("chat_usage.prompt_tokens + EXCLUDED.prompt_tokens"),
+			"completion_tokens": gorm.Expr("chat_usage.completion_tokens + EXCLUDED.completion_tokens"),
+			"updated_at":        gorm.Expr("EXCLUDED.updated_at"),
+		}),
+	}).Create(usage).Error
+}
+
+// Reserve 占用用户某天的一条回复额度，limit 为 0 表示不限制
+// 条件 UPDATE 在一条语句内完成检查和累加，并发请求不会超出条数上限；额度已用完时返回 false
+func (r *UsageRepository) Reserve(userID uint64, day time.Time, messageLimit int, tokenLimit int64) (bool, error) {
+	err := DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "day"}},
+		DoNothing: true,
+	}).Create(&model.ChatUsage{UserID: userID, Day: day}).Error
+	if err != nil {
+		return false, err
+	}
+
+	query := DB.Model(&model.ChatUsage{}).Where("user_id = ? AND day = ?", userID, day)
+	if messageLimit > 0 {
+		query = query.Where("messages < ?", messageLimit)
+	}
+	if tokenLimit > 0 {
+		query = query.Where("prompt_tokens + completion_tokens < ?", tokenLimit)
+	}
+	result := query.Updates(map[string]interface{}{
+		"messages":   gorm.Expr("messages + 1"),
+		"updated_at": time.Now(),
+	})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Release 退回一条占用的回复额度
+func (r *UsageRepository) Release(userID uint64, day time.Time) error {
+	return DB.Model(&model.ChatUsage{}).
+		Where("user_id = ? AND day = ? AND messages > 0", userID, day).
+		Updates(map[string]interface{}{
+			"messages":   gorm.Expr("messages - 1"),
+			"updated_at": time.Now(),
+		}).Error
+}
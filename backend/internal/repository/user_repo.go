@@ -55,6 +55,17 @@ func (r *UserRepository) Delete(id uint64) error {
 		if err := tx.Model(&model.User{}).Where("inviter_id = ?", id).Update("inviter_id", nil).Error; err != nil {
 			return err
 		}
+		// 删除对话用量
+		if err := tx.Where("user_id = ?", id).Delete(&model.ChatUsage{}).Error; err != nil {
+			return err
+		}
+		// 删除角色记忆
+		if err := tx.Where("user_id = ?", id).Delete(&model.MemoryFact{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&model.ConversationSummary{}).Error; err != nil {
+			return err
+		}
 		// 硬删除用户消息
 		if err := tx.Unscoped().Where("user_id = ?", id).Delete(&model.Message{}).Error; err != nil {
 			return err
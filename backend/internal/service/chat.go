@@ -0,0 +1,122 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"lauraai-backend/internal/i18n"
+	"lauraai-backend/internal/llm"
+	"lauraai-backend/internal/model"
+)
+
+// ChatService 角色对话
+type ChatService struct {
+	model llm.ChatModel
+}
+
+func NewChatService(model llm.ChatModel) *ChatService {
+	return &ChatService{model: model}
+}
+
+func (s *ChatService) Chat(ctx context.Context, character *model.Character, messages []model.Message, userMessage string, locale i18n.Locale, memory *ConversationMemory) (string, error) {
+	reply, err := s.model.Chat(ctx, s.buildRequest(character, messages, userMessage, locale, memory))
+	if err != nil {
+		return "", fmt.Errorf("Failed to generate response: %v", err)
+	}
+	return reply, nil
+}
+
+// ChatStream 流式生成回复，通道中的错误和 token 用量原样交给调用方处理
+func (s *ChatService) ChatStream(ctx context.Context, character *model.Character, messages []model.Message, userMessage string, locale i18n.Locale, memory *ConversationMemory) (<-chan llm.StreamChunk, error) {
+	return s.model.ChatStream(ctx, s.buildRequest(character, messages, userMessage, locale, memory))
+}
+
+// buildRequest 将历史消息和用户的新消息组装为对话请求
+// 历史消息按 ID 排成时间正序，用户的新消息放在最后
+func (s *ChatService) buildRequest(character *model.Character, messages []model.Message, userMessage string, locale i18n.Locale, memory *ConversationMemory) llm.ChatRequest {
+	ordered := slices.SortedFunc(slices.Values(messages), func(a, b model.Message) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	history := make([]llm.Message, 0, len(ordered)+1)
+	for _, msg := range ordered {
+		role := llm.RoleUser
+		if msg.SenderType != model.SenderTypeUser {
+			role = llm.RoleModel
+		}
+		history = append(history, llm.Message{Role: role, Text: msg.Content})
+	}
+	history = append(history, llm.Message{Role: llm.RoleUser, Text: userMessage})
+
+	return llm.ChatRequest{
+		System:      s.buildSystemPrompt(character, locale, memory),
+		Messages:    history,
+		Temperature: 0.7,
+	}
+}
+
+// getLanguageInstruction 获取语言指令
+func getLanguageInstruction(locale i18n.Locale) string {
+	switch locale {
+	case i18n.LocaleZh:
+		return "IMPORTANT: You MUST respond in Simplified Chinese (简体中文). All your responses should be in Chinese."
+	case i18n.LocaleRu:
+		return "IMPORTANT: You MUST respond in Russian (Русский). All your responses should be in Russian."
+	default:
+		return "IMPORTANT: You MUST respond in English. All your responses should be in English."
+	}
+}
+
+// buildSystemPrompt 角色设定 + 语言指令 + 长期记忆（用户事实和早期聊天摘要）
+func (s *ChatService) buildSystemPrompt(character *model.Character, locale i18n.Locale, memory *ConversationMemory) string {
+	prompt := s.buildPersonaPrompt(character, locale)
+	if section := memory.promptSection(); section != "" {
+		prompt += "\n\n" + section
+	}
+	return prompt
+}
+
+func (s *ChatService) buildPersonaPrompt(character *model.Character, locale i18n.Locale) string {
+	if character.PersonalityPrompt != "" {
+		// 即使有自定义 prompt，也添加语言指令
+		return character.PersonalityPrompt + "\n\n" + getLanguageInstruction(locale)
+	}
+
+	var ageDescription string
+	switch character.Type {
+	case model.CharacterTypeFutureBaby:
+		ageDescription = "an infant"
+	case model.CharacterTypeSoulmate, model.CharacterTypeBoyfriend, model.CharacterTypeGirlfriend:
+		ageDescription = "a young adult in their 20s"
+	case model.CharacterTypeFutureHusband, model.CharacterTypeFutureWife:
+		ageDescription = "a mature adult in their late 20s or early 30s"
+	case model.CharacterTypeWiseMentor:
+		ageDescription = "a wise elder with decades of experience"
+	default:
+		ageDescription = "an adult"
+	}
+
+	languageInstruction := getLanguageInstruction(locale)
+
+	prompt := fmt.Sprintf(`You are %s, a vivid and engaging AI character. 
+	Your identity: %s.
+	Your astrological sign: %s.
+	Your age: You should act as %s.
+	
+	%s
+	
+	Guidelines for your personality and communication style:
+	1. Stay strictly in character at all times. Never mention you are an AI or a language model.
+	2. Be warm, empathetic, and deeply interested in the user.
+	3. Use a natural, conversational tone. Avoid long, robotic paragraphs.
+	4. If you are a 'Soulmate', 'Husband', or 'Wife', be romantic, supportive, and affectionate.
+	5. If you are a 'Friend', be loyal, fun, and casual.
+	6. Use emojis occasionally to express emotion, but don't overdo it.
+	7. Remember details the user shares and reference them to build a stronger bond.
+	8. Your goal is to make the user feel seen, understood, and special.`,
+		character.Title, character.DescriptionEn, character.AstroSign, ageDescription, languageInstruction)
+
+	return prompt
+}
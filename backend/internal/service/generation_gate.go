@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"sync"
+)
+
+// GenerationPriority AI 生成排队优先级
+type GenerationPriority int
+
+const (
+	GenerationPriorityNormal GenerationPriority = iota
+	GenerationPriorityHigh                      // 订阅用户
+)
+
+// GenerationGate 限制同时进行的 AI 生成请求数量
+// 名额占满时按优先级排队：释放的名额先分给高优先级（订阅用户），同优先级先到先得
+type GenerationGate struct {
+	mu      sync.Mutex
+	slots   int
+	inUse   int
+	waiters [2][]chan struct{}
+}
+
+// NewGenerationGate slots <= 0 表示不限制并发
+func NewGenerationGate(slots int) *GenerationGate {
+	return &GenerationGate{slots: slots}
+}
+
+// Acquire 占用一个名额，返回的 release 必须调用且只能调用一次
+func (g *GenerationGate) Acquire(ctx context.Context, priority GenerationPriority) (release func(), err error) {
+	if g == nil || g.slots <= 0 {
+		return func() {}, nil
+	}
+	if priority != GenerationPriorityHigh {
+		priority = GenerationPriorityNormal
+	}
+
+	g.mu.Lock()
+	if g.inUse < g.slots {
+		g.inUse++
+		g.mu.Unlock()
+		return g.releaseFunc(), nil
+	}
+	ready := make(chan struct{})
+	g.waiters[priority] = append(g.waiters[priority], ready)
+	g.mu.Unlock()
+
+	select {
+	case <-ready:
+		return g.releaseFunc(), nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.removeWaiter(priority, ready) {
+			return nil, ctx.Err()
+		}
+		// 取消的同时已经分到名额，交还给下一个等待者
+		g.handOff()
+		return nil, ctx.Err()
+	}
+}
+
+func (g *GenerationGate) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			g.handOff()
+		})
+	}
+}
+
+// handOff 把一个名额直接转交给等待者，没有等待者时归还，调用方需持有锁
+func (g *GenerationGate) handOff() {
+	for p := GenerationPriorityHigh; p >= GenerationPriorityNormal; p-- {
+		if len(g.waiters[p]) > 0 {
+			next := g.waiters[p][0]
+			g.waiters[p] = g.waiters[p][1:]
+			close(next)
+			return
+		}
+	}
+	g.inUse--
+}
+
+func (g *GenerationGate) removeWaiter(priority GenerationPriority, ready chan struct{}) bool {
+	queue := g.waiters[priority]
+	for i, ch := range queue {
+		if ch == ready {
+			g.waiters[priority] = append(queue[:i], queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+)
+
+// generationJobTimeout 单个生成任务的最长执行时间（含排队）
+const generationJobTimeout = 5 * time.Minute
+
+type progressKey struct{}
+
+// ProgressFunc 生成阶段变化回调
+type ProgressFunc func(stage model.GenerationJobStage)
+
+// WithProgress 在 context 中附加阶段回调，图片和报告生成会在进入各阶段时调用
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// reportStage 通知当前阶段，context 中没有回调时忽略
+func reportStage(ctx context.Context, stage model.GenerationJobStage) {
+	if fn, ok := ctx.Value(progressKey{}).(ProgressFunc); ok && fn != nil {
+		fn(stage)
+	}
+}
+
+// JobTypeCharacterImage 生成角色图片和报告
+const JobTypeCharacterImage = "character_image"
+
+// imageJobPayload 图片任务参数
+type imageJobPayload struct {
+	GenerationJobID uint64 `json:"generation_job_id"`
+}
+
+// GenerationJobRunner 通过任务队列执行角色图片和报告生成
+// GenerationJob 记录面向用户的进度，队列任务负责持久化、重试和去重
+// 角色的图片和报告只在任务全部完成后一次性写入
+type GenerationJobRunner struct {
+	queue            *JobQueue
+	jobRepo          *repository.GenerationJobRepository
+	characterRepo    *repository.CharacterRepository
+	userRepo         *repository.UserRepository
+	subscriptionRepo *repository.SubscriptionRepository
+	imagenService    *ImagenService
+	reportService    *ReportService
+	generationGate   *GenerationGate
+	notifier         *Notifier
+}
+
+func NewGenerationJobRunner(queue *JobQueue, imagenService *ImagenService, reportService *ReportService, generationGate *GenerationGate, notifier *Notifier) *GenerationJobRunner {
+	r := &GenerationJobRunner{
+		queue:            queue,
+		jobRepo:          repository.NewGenerationJobRepository(),
+		characterRepo:    repository.NewCharacterRepository(),
+		userRepo:         repository.NewUserRepository(),
+		subscriptionRepo: repository.NewSubscriptionRepository(),
+		imagenService:    imagenService,
+		reportService:    reportService,
+		generationGate:   generationGate,
+		notifier:         notifier,
+	}
+	queue.Register(JobTypeCharacterImage, r.handle)
+	return r
+}
+
+// Enqueue 创建生成任务并加入队列
+func (r *GenerationJobRunner) Enqueue(userID uint64, characterID uint64) (*model.GenerationJob, error) {
+	job := &model.GenerationJob{
+		UserID:      userID,
+		CharacterID: characterID,
+		Status:      model.GenerationJobPending,
+		Stage:       model.GenerationStageQueued,
+	}
+	if err := r.jobRepo.Create(job); err != nil {
+		return nil, err
+	}
+	queued, err := r.queue.Enqueue(JobTypeCharacterImage, imageJobPayload{GenerationJobID: job.ID}, EnqueueOptions{
+		DedupKey:    fmt.Sprintf("image:%d", characterID),
+		MaxAttempts: 3,
+	})
+	if err != nil {
+		r.jobRepo.MarkFailed(job.ID, err.Error())
+		return nil, err
+	}
+
+	// 并发请求时同一角色已有进行中的队列任务，返回它对应的生成任务
+	var payload imageJobPayload
+	if err := DecodePayload(queued, &payload); err == nil && payload.GenerationJobID != job.ID {
+		r.jobRepo.MarkFailed(job.ID, "duplicate generation request")
+		return r.jobRepo.GetByID(payload.GenerationJobID)
+	}
+	return job, nil
+}
+
+func (r *GenerationJobRunner) handle(ctx context.Context, queued *model.Job) error {
+	var payload imageJobPayload
+	if err := DecodePayload(queued, &payload); err != nil {
+		return err
+	}
+
+	job, err := r.jobRepo.GetByID(payload.GenerationJobID)
+	if err != nil {
+		return PermanentError(fmt.Errorf("generation job %d not found: %v", payload.GenerationJobID, err))
+	}
+	if job.IsFinished() {
+		return nil
+	}
+
+	if err := r.execute(ctx, job); err != nil {
+		// 还有重试机会时保持任务未结束，角色继续对列表隐藏
+		var permanent *permanentError
+		if queued.IsLastAttempt() || errors.As(err, &permanent) {
+			if markErr := r.jobRepo.MarkFailed(job.ID, err.Error()); markErr != nil {
+				log.Printf("[GenerationJob] 更新任务 %d 状态失败: %v", job.ID, markErr)
+			}
+		} else if stageErr := r.jobRepo.UpdateStage(job.ID, model.GenerationStageQueued); stageErr != nil {
+			log.Printf("[GenerationJob] 更新任务 %d 阶段失败: %v", job.ID, stageErr)
+		}
+		return err
+	}
+
+	if err := r.jobRepo.MarkCompleted(job.ID); err != nil {
+		return err
+	}
+	log.Printf("[GenerationJob] 任务 %d 完成（角色 %d）", job.ID, job.CharacterID)
+
+	if r.notifier != nil {
+		if err := r.notifier.Notify(job.UserID, "Your portrait is ready! Open the app to meet them.", fmt.Sprintf("image_ready:%d", job.CharacterID)); err != nil {
+			log.Printf("[GenerationJob] 发送通知失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// execute 依次执行 图片 → 模糊 → 报告（英 → 中 → 俄），最后写入角色
+func (r *GenerationJobRunner) execute(ctx context.Context, job *model.GenerationJob) error {
+	if r.imagenService == nil {
+		return fmt.Errorf("image generation service not available")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, generationJobTimeout)
+	defer cancel()
+	ctx = WithProgress(ctx, func(stage model.GenerationJobStage) {
+		if err := r.jobRepo.UpdateStage(job.ID, stage); err != nil {
+			log.Printf("[GenerationJob] 更新任务 %d 阶段失败: %v", job.ID, err)
+		}
+	})
+
+	// 占用 AI 生成名额，订阅用户优先
+	priority := GenerationPriorityNormal
+	if r.subscriptionRepo.IsActive(job.UserID) {
+		priority = GenerationPriorityHigh
+	}
+	release, err := r.generationGate.Acquire(ctx, priority)
+	if err != nil {
+		return fmt.Errorf("timed out waiting for generation slot: %v", err)
+	}
+	defer release()
+
+	if err := r.jobRepo.MarkRunning(job.ID); err != nil {
+		return err
+	}
+
+	character, err := r.characterRepo.GetByID(job.CharacterID)
+	if err != nil {
+		return PermanentError(fmt.Errorf("character not found: %v", err))
+	}
+
+	// 生成图片（会同时生成3张：清晰、半模糊、完全模糊）
+	reportStage(ctx, model.GenerationStageImage)
+	if _, err := r.imagenService.GenerateImage(ctx, character); err != nil {
+		return fmt.Errorf("failed to generate image: %v", err)
+	}
+
+	// 生成 AI 多语言报告（一次生成三种语言，确保内容一致）
+	// 报告生成失败不影响图片，留空后由 UnlockHandler 在解锁时补生成
+	if r.reportService != nil {
+		user, err := r.userRepo.GetByID(job.UserID)
+		if err != nil {
+			log.Printf("[GenerationJob] 获取用户信息失败: %v", err)
+		} else if report, err := r.reportService.GenerateMultiLangReport(ctx, user, character); err != nil {
+			log.Printf("[GenerationJob] 生成报告失败: %v (将在解锁时重试)", err)
+		} else {
+			report.ApplyTo(character)
+		}
+	}
+
+	// 设置 ImageURL 为当前应显示的图片（根据解锁状态）
+	character.ImageURL = character.GetDisplayImageURL()
+	if err := r.characterRepo.Update(character); err != nil {
+		return fmt.Errorf("failed to update character: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log"
+	"mime"
+	"time"
+
+	"lauraai-backend/internal/config"
+	"lauraai-backend/internal/llm"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/storage"
+
+	"github.com/disintegration/imaging"
+)
+
+// ImagenService 角色图片生成
+type ImagenService struct {
+	model llm.ImageModel
+}
+
+func NewImagenService(model llm.ImageModel) *ImagenService {
+	return &ImagenService{model: model}
+}
+
+// GenerateMiniMeImage 生成 Mini Me 图片（带模糊版本，用于解锁流程）
+func (s *ImagenService) GenerateMiniMeImage(ctx context.Context, description string, character *model.Character) (string, error) {
+	prompt := fmt.Sprintf("A cute 'Mini-Me' 3D chibi-style character avatar based on these features: %s. The style should be adorable low-age mini style (Chibi), with a large head and small body, big expressive soulful eyes, and simplified but high-quality 3D textures. Modern 3D animation aesthetic (like a high-end toy or a stylized game character). Soft cinematic studio lighting, vibrant colors, solid neutral background. 8k resolution, masterpiece, extremely cute, clean lines, sharp focus.", description)
+
+	// 使用与其他角色相同的流程：生成清晰图+模糊版本
+	return s.doGenerateImageWithBlurVersions(ctx, prompt, character)
+}
+
+func (s *ImagenService) GenerateImage(ctx context.Context, character *model.Character) (string, error) {
+	prompt := s.buildImagePrompt(character)
+	return s.doGenerateImageWithBlurVersions(ctx, prompt, character)
+}
+
+// doGenerateImageWithBlurVersions 生成清晰图片后，创建模糊版本
+func (s *ImagenService) doGenerateImageWithBlurVersions(ctx context.Context, prompt string, character *model.Character) (string, error) {
+	log.Printf("[Imagen] 开始生成图片，提示词: %s", prompt)
+
+	// 生成清晰图片（重试和后备模型由 llm 层处理）
+	generated, err := s.model.GenerateImage(ctx, prompt)
+	if err != nil {
+		return "", fmt.Errorf("Failed to generate image: %v", err)
+	}
+	imageData := generated.Data
+
+	// 解码图片
+	img, _, err := image.Decode(bytes.NewReader(imageData))
+	if err != nil {
+		// 如果解码失败，尝试使用 imaging 库解码（支持更多格式）
+		log.Printf("[Imagen] 标准解码失败，尝试 imaging 库: %v", err)
+		img, err = imaging.Decode(bytes.NewReader(imageData))
+		if err != nil {
+			// 无法生成模糊版本时不能用原图代替，否则未解锁的用户会看到清晰图
+			return "", fmt.Errorf("Failed to decode generated image: %v", err)
+		}
+	}
+
+	// 保存清晰图片
+	clearURL, err := s.saveImage(img)
+	if err != nil {
+		return "", fmt.Errorf("Failed to save clear image: %v", err)
+	}
+
+	reportStage(ctx, model.GenerationStageBlur)
+
+	// 生成完全模糊版本（未解锁阶段，默认 sigma=30）
+	fullBlurImg := imaging.Blur(img, config.AppConfig.BlurSigmaLocked)
+	fullBlurURL, err := s.saveImage(fullBlurImg)
+	if err != nil {
+		s.deleteImages(clearURL)
+		return "", fmt.Errorf("Failed to save full blur image: %v", err)
+	}
+
+	// 生成半模糊版本（半解锁阶段，默认 sigma=6, 约20%模糊）
+	halfBlurImg := imaging.Blur(img, config.AppConfig.BlurSigmaHalf)
+	halfBlurURL, err := s.saveImage(halfBlurImg)
+	if err != nil {
+		s.deleteImages(clearURL, fullBlurURL)
+		return "", fmt.Errorf("Failed to save half blur image: %v", err)
+	}
+
+	// 设置角色的图片字段
+	setCharacterImages(character, clearURL, fullBlurURL, halfBlurURL)
+	character.ShareCode = repository.GenerateShareCode()
+	character.UnlockStatus = model.UnlockStatusLocked
+
+	log.Printf("[Imagen] 成功生成3张图片: 清晰, 半模糊, 完全模糊")
+
+	// 返回模糊图片作为默认显示（未解锁状态）
+	return fullBlurURL, nil
+}
+
+// setCharacterImages 设置角色的三张图片 URL 及对应的存储 key
+func setCharacterImages(character *model.Character, clearURL, fullBlurURL, halfBlurURL string) {
+	character.ClearImageURL = clearURL
+	character.FullBlurImageURL = fullBlurURL
+	character.HalfBlurImageURL = halfBlurURL
+	character.ClearImageKey = storage.KeyFromURL(clearURL)
+	character.FullBlurImageKey = storage.KeyFromURL(fullBlurURL)
+	character.HalfBlurImageKey = storage.KeyFromURL(halfBlurURL)
+}
+
+// deleteImages 生成失败时删除已经保存的图片
+func (s *ImagenService) deleteImages(urls ...string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, url := range urls {
+		if err := storage.Images.Delete(ctx, storage.KeyFromURL(url)); err != nil {
+			log.Printf("[Imagen] 删除图片 %s 失败: %v", url, err)
+		}
+	}
+}
+
+// generateSecureFilename 生成加密安全的随机文件名
+func generateSecureFilename(ext string) string {
+	// 使用 32 字节（256 位）的加密随机数，生成 64 字符的十六进制字符串
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		// 如果加密随机失败，使用时间戳作为后备
+		return fmt.Sprintf("fallback_%d.%s", time.Now().UnixNano(), ext)
+	}
+	return fmt.Sprintf("%s.%s", hex.EncodeToString(bytes), ext)
+}
+
+// saveImage 编码为 JPEG 并写入图片存储，返回访问路径
+func (s *ImagenService) saveImage(img image.Image) (string, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		return "", err
+	}
+	return s.saveImageBytes(buf.Bytes(), "jpg")
+}
+
+// saveImageBytes 保存图片字节到图片存储并返回访问路径
+func (s *ImagenService) saveImageBytes(data []byte, ext string) (string, error) {
+	filename := generateSecureFilename(ext)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := storage.Images.Put(ctx, filename, data, mime.TypeByExtension("."+ext)); err != nil {
+		return "", err
+	}
+
+	// 只返回相对路径，让前端根据当前环境拼接完整URL
+	// 这样可以避免BaseURL变化导致旧图片无法加载的问题
+	imageURL := storage.Images.URL(filename)
+	log.Printf("[Imagen] 保存图片，相对路径: %s, BaseURL: %s, filename: %s", imageURL, config.AppConfig.BaseURL, filename)
+	return imageURL, nil
+}
+
+func (s *ImagenService) doGenerateImageWithPrompt(ctx context.Context, prompt string) (string, error) {
+	log.Printf("[Imagen] 开始生成图片，提示词: %s", prompt)
+
+	generated, err := s.model.GenerateImage(ctx, prompt)
+	if err != nil {
+		return "", fmt.Errorf("Failed to generate image: %v", err)
+	}
+
+	// 保存图片
+	url, err := s.saveImageBytes(generated.Data, "jpg")
+	if err != nil {
+		// 如果保存失败，回退到 Base64 (虽然不推荐用于分享，但至少能显示)
+		encoded := base64.StdEncoding.EncodeToString(generated.Data)
+		return fmt.Sprintf("data:%s;base64,%s", generated.MIMEType, encoded), nil
+	}
+	return url, nil
+}
+
+func (s *ImagenService) buildImagePrompt(character *model.Character) string {
+	var stylePrompt string
+	var agePrompt string
+
+	// 1. 根据角色类型确定基础风格和年龄段描述
+	switch character.Type {
+	case model.CharacterTypeSoulmate:
+		stylePrompt = "A breathtakingly beautiful portrait of a soulmate, "
+		agePrompt = "young adult (20-30 years old), "
+	case model.CharacterTypeFutureHusband:
+		stylePrompt = "A realistic and romantic wedding-style portrait of a future husband, "
+		agePrompt = "mature young man (25-35 years old), "
+	case model.CharacterTypeFutureWife:
+		stylePrompt = "A realistic and romantic wedding-style portrait of a future wife, "
+		agePrompt = "elegant young woman (23-33 years old), "
+	case model.CharacterTypeFutureBaby:
+		stylePrompt = "A cute and adorable portrait of a future baby, "
+		agePrompt = "infant (0-1 year old), "
+	case model.CharacterTypeBoyfriend:
+		stylePrompt = "A charming and handsome portrait of a boyfriend, "
+		agePrompt = "young man (18-28 years old), "
+	case model.CharacterTypeGirlfriend:
+		stylePrompt = "A sweet and beautiful portrait of a girlfriend, "
+		agePrompt = "young woman (18-28 years old), "
+	case model.CharacterTypeBestFriend:
+		stylePrompt = "A friendly and relatable portrait of a best friend, "
+		agePrompt = "young adult (same age as user), "
+	case model.CharacterTypeWiseMentor:
+		stylePrompt = "A dignified and knowledgeable portrait of a wise mentor, "
+		agePrompt = "distinguished older person (50-70 years old), "
+	default:
+		stylePrompt = "A high-quality professional portrait of a character, "
+		agePrompt = "adult, "
+	}
+
+	// 2. 组合提示词
+	prompt := fmt.Sprintf("%s%s %s person, %s ethnicity, ", stylePrompt, agePrompt, character.Gender, character.Ethnicity)
+
+	if character.DescriptionEn != "" {
+		prompt += fmt.Sprintf("with these traits: %s, ", character.DescriptionEn)
+	}
+
+	if character.AstroSign != "" {
+		prompt += fmt.Sprintf("reflecting the aura of %s zodiac sign, ", character.AstroSign)
+	}
+
+	prompt += "hyper-realistic, highly detailed facial features, soft cinematic lighting, professional photography, 8k resolution, masterpiece, natural skin texture, expressive eyes."
+
+	return prompt
+}
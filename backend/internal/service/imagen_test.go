@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"image"
+	"testing"
+
+	"lauraai-backend/internal/config"
+	"lauraai-backend/internal/llm"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/storage"
+)
+
+// useTestImageStore 把图片存储替换为临时目录，测试结束后恢复
+func useTestImageStore(t *testing.T) storage.ImageStore {
+	t.Helper()
+	config.LoadConfig()
+	store, err := storage.NewLocalImageStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("image store: %v", err)
+	}
+	previous := storage.Images
+	storage.Images = store
+	t.Cleanup(func() { storage.Images = previous })
+	return store
+}
+
+func TestGenerateImage(t *testing.T) {
+	store := useTestImageStore(t)
+	fake := llm.NewFake()
+	character := &model.Character{Type: model.CharacterTypeSoulmate, Gender: "female", Ethnicity: "Asian"}
+
+	url, err := NewImagenService(fake).GenerateImage(context.Background(), character)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if calls := fake.CallsOf(llm.FakeMethodImage); len(calls) != 1 || calls[0].Prompt == "" {
+		t.Fatalf("calls = %+v", calls)
+	}
+	// 返回完全模糊图，三张图分别保存
+	if url != character.FullBlurImageURL || character.UnlockStatus != model.UnlockStatusLocked || character.ShareCode == "" {
+		t.Errorf("character = %+v", character)
+	}
+	keys := []string{character.ClearImageKey, character.HalfBlurImageKey, character.FullBlurImageKey}
+	if keys[0] == "" || keys[0] == keys[1] || keys[1] == keys[2] || keys[0] == keys[2] {
+		t.Fatalf("keys = %q", keys)
+	}
+	for _, key := range keys {
+		reader, info, err := store.Get(context.Background(), key)
+		if err != nil {
+			t.Fatalf("get %s: %v", key, err)
+		}
+		_, format, err := image.Decode(reader)
+		reader.Close()
+		if err != nil || format != "jpeg" || info.Size == 0 {
+			t.Errorf("image %s: format %q, %v", key, format, err)
+		}
+	}
+}
+
+func TestGenerateImageFailure(t *testing.T) {
+	useTestImageStore(t)
+	fake := llm.NewFake()
+	fake.FailNext(llm.FakeMethodImage, llm.ErrFakeRateLimited)
+	character := &model.Character{Type: model.CharacterTypeSoulmate}
+
+	if _, err := NewImagenService(fake).GenerateImage(context.Background(), character); err == nil {
+		t.Fatal("generate succeeded, want error")
+	}
+	if character.ClearImageKey != "" || character.ShareCode != "" {
+		t.Errorf("character changed on failure: %+v", character)
+	}
+
+	// 模型返回无法解码的数据时无法生成模糊版本，整个生成失败而不是用原图代替
+	fake.Script(llm.FakeMethodImage, llm.FakeResponse{Image: &llm.Image{Data: []byte("not an image"), MIMEType: "image/png"}})
+	if _, err := NewImagenService(fake).GenerateImage(context.Background(), character); err == nil {
+		t.Fatal("generate with undecodable image succeeded, want error")
+	}
+	if character.ClearImageKey != "" || character.FullBlurImageKey != "" || character.ShareCode != "" {
+		t.Errorf("character changed on failure: %+v", character)
+	}
+}
+
+// failingPutStore 前 n 次写入成功，之后的写入失败
+type failingPutStore struct {
+	storage.ImageStore
+	n int
+}
+
+func (s *failingPutStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if s.n == 0 {
+		return errors.New("disk full")
+	}
+	s.n--
+	return s.ImageStore.Put(ctx, key, data, contentType)
+}
+
+func TestGenerateImageBlurSaveFailure(t *testing.T) {
+	store := useTestImageStore(t)
+	// 清晰图保存成功，完全模糊图保存失败
+	storage.Images = &failingPutStore{ImageStore: store, n: 1}
+	character := &model.Character{Type: model.CharacterTypeSoulmate}
+
+	if _, err := NewImagenService(llm.NewFake()).GenerateImage(context.Background(), character); err == nil {
+		t.Fatal("generate succeeded, want error")
+	}
+	if character.ClearImageKey != "" || character.FullBlurImageKey != "" {
+		t.Errorf("character changed on failure: %+v", character)
+	}
+	// 已保存的清晰图被删除
+	if n, err := store.DeleteAll(context.Background()); err != nil || n != 0 {
+		t.Errorf("left %d images behind (%v)", n, err)
+	}
+}
@@ -0,0 +1,272 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+)
+
+const (
+	// jobPollInterval 队列为空时 worker 轮询的间隔
+	jobPollInterval = time.Second
+	// jobLockTimeout 任务超过该时间没有心跳，视为 worker 已崩溃，放回队列
+	jobLockTimeout = 10 * time.Minute
+	// jobHeartbeatInterval 任务执行期间刷新 locked_at 的间隔，远小于 jobLockTimeout
+	jobHeartbeatInterval = jobLockTimeout / 5
+	// jobRetryBaseDelay 第一次重试的等待时间，之后每次翻倍
+	jobRetryBaseDelay = 10 * time.Second
+	// jobRetryMaxDelay 重试等待时间上限
+	jobRetryMaxDelay = 10 * time.Minute
+	// defaultJobMaxAttempts 默认最大尝试次数
+	defaultJobMaxAttempts = 5
+)
+
+// JobHandlerFunc 任务处理函数，返回错误时按退避时间重试
+// 返回 PermanentError 包装的错误时不再重试，直接进入 dead 状态
+type JobHandlerFunc func(ctx context.Context, job *model.Job) error
+
+// EnqueueOptions 入队选项
+type EnqueueOptions struct {
+	DedupKey    string        // 去重键，相同键的任务同时只能存在一个未结束的
+	MaxAttempts int           // 最大尝试次数，0 使用默认值
+	Delay       time.Duration // 延迟执行
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// PermanentError 标记不可重试的错误（例如数据已被删除）
+func PermanentError(err error) error {
+	return &permanentError{err: err}
+}
+
+// JobQueue 基于 Postgres jobs 表的持久化任务队列
+// 任务在服务重启后不会丢失，失败按指数退避重试，多实例部署时通过 SKIP LOCKED 分配任务
+type JobQueue struct {
+	repo     *repository.JobRepository
+	handlers map[string]JobHandlerFunc
+	mu       sync.RWMutex
+	wake     chan struct{}
+	workerID string
+}
+
+func NewJobQueue() *JobQueue {
+	hostname, _ := os.Hostname()
+	return &JobQueue{
+		repo:     repository.NewJobRepository(),
+		handlers: make(map[string]JobHandlerFunc),
+		wake:     make(chan struct{}, 1),
+		workerID: fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+	}
+}
+
+// Register 注册任务类型的处理函数，需要在 Start 之前调用
+func (q *JobQueue) Register(jobType string, handler JobHandlerFunc) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = handler
+}
+
+// Enqueue 创建任务，payload 会编码为 JSON
+// 设置了 DedupKey 且已有未结束的同键任务时返回已有任务
+func (q *JobQueue) Enqueue(jobType string, payload interface{}, opts EnqueueOptions) (*model.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job payload: %v", err)
+	}
+
+	job := &model.Job{
+		Type:        jobType,
+		Payload:     string(data),
+		Status:      model.JobStatusPending,
+		RunAt:       time.Now().Add(opts.Delay),
+		MaxAttempts: opts.MaxAttempts,
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = defaultJobMaxAttempts
+	}
+	if opts.DedupKey != "" {
+		job.DedupKey = &opts.DedupKey
+	}
+
+	job, created, err := q.repo.Enqueue(job)
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		log.Printf("[JobQueue] 任务 %d 已入队（%s）", job.ID, jobType)
+		q.notify()
+	} else {
+		log.Printf("[JobQueue] 已有未完成的任务 %d（%s, %s），跳过重复入队", job.ID, jobType, opts.DedupKey)
+	}
+	return job, nil
+}
+
+// DecodePayload 解析任务 payload
+func DecodePayload(job *model.Job, v interface{}) error {
+	if err := json.Unmarshal([]byte(job.Payload), v); err != nil {
+		return PermanentError(fmt.Errorf("invalid job payload: %v", err))
+	}
+	return nil
+}
+
+// Start 启动 workers 个 worker 和过期锁回收，ctx 取消时停止领取新任务
+func (q *JobQueue) Start(ctx context.Context, workers int) {
+	if workers <= 0 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go q.work(ctx, fmt.Sprintf("%s/%d", q.workerID, i))
+	}
+	go q.reapStale(ctx)
+	log.Printf("[JobQueue] 已启动 %d 个 worker", workers)
+}
+
+// notify 唤醒一个空闲 worker
+func (q *JobQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *JobQueue) work(ctx context.Context, workerID string) {
+	for {
+		job, err := q.repo.Claim(workerID)
+		if err != nil {
+			log.Printf("[JobQueue] 领取任务失败: %v", err)
+		}
+		if job != nil {
+			q.process(ctx, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-time.After(jobPollInterval):
+		}
+	}
+}
+
+func (q *JobQueue) process(ctx context.Context, job *model.Job) {
+	q.mu.RLock()
+	handler, ok := q.handlers[job.Type]
+	q.mu.RUnlock()
+	if !ok {
+		q.bury(job, fmt.Sprintf("no handler registered for job type %q", job.Type))
+		return
+	}
+	// 过期锁回收后重新领取时尝试次数可能已超过上限
+	if job.Attempts > job.MaxAttempts {
+		q.bury(job, "max attempts exceeded: "+job.LastError)
+		return
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	go q.heartbeat(runCtx, cancel, job)
+	err := q.run(runCtx, handler, job)
+	cancel()
+	if err == nil {
+		q.finish(job, q.repo.Complete(job.ID, job.LockedBy))
+		return
+	}
+
+	var permanent *permanentError
+	if errors.As(err, &permanent) || job.IsLastAttempt() {
+		q.bury(job, err.Error())
+		return
+	}
+
+	delay := retryDelay(job.Attempts)
+	log.Printf("[JobQueue] 任务 %d（%s）第 %d 次执行失败，%v 后重试: %v", job.ID, job.Type, job.Attempts, delay, err)
+	q.finish(job, q.repo.Retry(job.ID, job.LockedBy, err.Error(), time.Now().Add(delay)))
+}
+
+// heartbeat 任务执行期间定期刷新 locked_at；锁已被回收（任务可能已由其他 worker 重新领取）时取消执行
+func (q *JobQueue) heartbeat(ctx context.Context, cancel context.CancelFunc, job *model.Job) {
+	ticker := time.NewTicker(jobHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := q.repo.Heartbeat(job.ID, job.LockedBy)
+		if errors.Is(err, repository.ErrJobLockLost) {
+			log.Printf("[JobQueue] 任务 %d（%s）的锁已被回收，停止执行", job.ID, job.Type)
+			cancel()
+			return
+		}
+		if err != nil {
+			log.Printf("[JobQueue] 刷新任务 %d 心跳失败: %v", job.ID, err)
+		}
+	}
+}
+
+// finish 记录更新任务结果时的错误，锁已丢失时结果以重新领取的 worker 为准
+func (q *JobQueue) finish(job *model.Job, err error) {
+	if errors.Is(err, repository.ErrJobLockLost) {
+		log.Printf("[JobQueue] 任务 %d（%s）已不属于 %s，忽略本次执行结果", job.ID, job.Type, job.LockedBy)
+	} else if err != nil {
+		log.Printf("[JobQueue] 更新任务 %d 状态失败: %v", job.ID, err)
+	}
+}
+
+// run 执行处理函数，panic 视为一次失败
+func (q *JobQueue) run(ctx context.Context, handler JobHandlerFunc, job *model.Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+func (q *JobQueue) bury(job *model.Job, reason string) {
+	log.Printf("[JobQueue] 任务 %d（%s）进入 dead 状态: %s", job.ID, job.Type, reason)
+	q.finish(job, q.repo.Bury(job.ID, job.LockedBy, reason))
+}
+
+// reapStale 定期回收过期的任务锁
+func (q *JobQueue) reapStale(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		count, err := q.repo.RequeueStale(jobLockTimeout)
+		if err != nil {
+			log.Printf("[JobQueue] 回收过期任务失败: %v", err)
+		} else if count > 0 {
+			log.Printf("[JobQueue] 回收了 %d 个过期任务", count)
+			q.notify()
+		}
+	}
+}
+
+// retryDelay 第 attempt 次失败后的等待时间：10s、20s、40s ... 最多 10 分钟
+func retryDelay(attempt int) time.Duration {
+	delay := jobRetryBaseDelay
+	for i := 1; i < attempt && delay < jobRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, jobRetryMaxDelay)
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/repository/repotest"
+)
+
+// claimedJob 创建一个已被 workerID 领取的任务，模拟 Claim 的结果
+func claimedJob(t *testing.T, workerID string) *model.Job {
+	t.Helper()
+	now := time.Now()
+	job := &model.Job{
+		Type:        "test",
+		Payload:     "{}",
+		Status:      model.JobStatusRunning,
+		RunAt:       now,
+		Attempts:    1,
+		MaxAttempts: 3,
+		LockedAt:    &now,
+		LockedBy:    workerID,
+	}
+	if err := repository.DB.Create(job).Error; err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+	return job
+}
+
+func reloadJob(t *testing.T, id uint64) *model.Job {
+	t.Helper()
+	job, err := repository.NewJobRepository().GetByID(id)
+	if err != nil {
+		t.Fatalf("reload job: %v", err)
+	}
+	return job
+}
+
+func TestJobQueueProcess(t *testing.T) {
+	repotest.Open(t)
+	q := NewJobQueue()
+	q.Register("test", func(ctx context.Context, job *model.Job) error { return nil })
+
+	job := claimedJob(t, "w1")
+	q.process(context.Background(), job)
+	if got := reloadJob(t, job.ID); got.Status != model.JobStatusSucceeded || got.FinishedAt == nil {
+		t.Errorf("job = %+v, want succeeded", got)
+	}
+
+	q.Register("test", func(ctx context.Context, job *model.Job) error { return errors.New("boom") })
+	job = claimedJob(t, "w1")
+	q.process(context.Background(), job)
+	if got := reloadJob(t, job.ID); got.Status != model.JobStatusPending || got.LastError != "boom" || got.LockedBy != "" {
+		t.Errorf("job = %+v, want pending for retry", got)
+	}
+
+	q.Register("test", func(ctx context.Context, job *model.Job) error { return PermanentError(errors.New("gone")) })
+	job = claimedJob(t, "w1")
+	q.process(context.Background(), job)
+	if got := reloadJob(t, job.ID); got.Status != model.JobStatusDead {
+		t.Errorf("job = %+v, want dead", got)
+	}
+}
+
+func TestJobQueueProcessLockLost(t *testing.T) {
+	repotest.Open(t)
+	q := NewJobQueue()
+	job := claimedJob(t, "w1")
+
+	// 执行期间锁被回收并由另一个 worker 重新领取
+	q.Register("test", func(ctx context.Context, running *model.Job) error {
+		return repository.DB.Model(&model.Job{}).Where("id = ?", running.ID).
+			Updates(map[string]interface{}{"locked_by": "w2", "attempts": 2}).Error
+	})
+	q.process(context.Background(), job)
+
+	got := reloadJob(t, job.ID)
+	if got.Status != model.JobStatusRunning || got.LockedBy != "w2" {
+		t.Errorf("job = %+v, result of the stale worker must be ignored", got)
+	}
+}
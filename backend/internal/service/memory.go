@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"lauraai-backend/internal/llm"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// ChatHistoryWindow 每次对话直接发给模型的最近消息条数，更早的消息通过摘要记住
+	ChatHistoryWindow = 20
+	// memorySummaryBatch 窗口外至少积累多少条消息才更新一次摘要
+	memorySummaryBatch = 20
+	// memoryFactBatch 至少积累多少条新消息才提取一次事实
+	memoryFactBatch = 6
+	// memoryMaxBatch 单次处理的消息上限，积压更多时分多次处理
+	memoryMaxBatch = 100
+	// memoryMaxFactValue 单条事实的最大长度
+	memoryMaxFactValue = 500
+)
+
+// JobTypeConversationMemory 更新角色的聊天摘要和用户事实
+const JobTypeConversationMemory = "conversation_memory"
+
+// memoryJobPayload 记忆任务参数
+type memoryJobPayload struct {
+	CharacterID uint64 `json:"character_id"`
+}
+
+var factKeyPattern = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+
+// ConversationMemory 注入到系统提示词的长期记忆
+type ConversationMemory struct {
+	Summary string
+	Facts   []model.MemoryFact
+}
+
+// promptSection 生成系统提示词中的记忆段落，没有记忆时返回空字符串
+func (m *ConversationMemory) promptSection() string {
+	if m == nil || (m.Summary == "" && len(m.Facts) == 0) {
+		return ""
+	}
+
+	var b strings.Builder
+	if len(m.Facts) > 0 {
+		b.WriteString("Things you remember about the user (use them naturally, never list them):\n")
+		for _, fact := range m.Facts {
+			fmt.Fprintf(&b, "- %s: %s\n", strings.ReplaceAll(fact.Key, "_", " "), fact.Value)
+		}
+	}
+	if m.Summary != "" {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("Summary of your earlier conversations with the user:\n")
+		b.WriteString(m.Summary)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// MemoryService 角色的长期记忆：把超出上下文窗口的聊天记录滚动总结为摘要，并提取关于用户的长期事实
+// 每次对话后通过任务队列在后台更新，同一角色同时只有一个更新任务
+type MemoryService struct {
+	queue            *JobQueue
+	model            llm.TextModel
+	memoryRepo       *repository.MemoryRepository
+	messageRepo      *repository.MessageRepository
+	characterRepo    *repository.CharacterRepository
+	subscriptionRepo *repository.SubscriptionRepository
+	generationGate   *GenerationGate
+}
+
+func NewMemoryService(queue *JobQueue, model llm.TextModel, generationGate *GenerationGate) *MemoryService {
+	s := &MemoryService{
+		queue:            queue,
+		model:            model,
+		memoryRepo:       repository.NewMemoryRepository(),
+		messageRepo:      repository.NewMessageRepository(),
+		characterRepo:    repository.NewCharacterRepository(),
+		subscriptionRepo: repository.NewSubscriptionRepository(),
+		generationGate:   generationGate,
+	}
+	queue.Register(JobTypeConversationMemory, s.handle)
+	return s
+}
+
+// Load 获取注入到对话中的记忆
+func (s *MemoryService) Load(userID uint64, characterID uint64) (*ConversationMemory, error) {
+	summary, err := s.memoryRepo.GetSummary(userID, characterID)
+	if err != nil {
+		return nil, err
+	}
+	facts, err := s.memoryRepo.ListFacts(characterID)
+	if err != nil {
+		return nil, err
+	}
+	return &ConversationMemory{Summary: summary.Summary, Facts: facts}, nil
+}
+
+// Schedule 安排一次记忆更新
+func (s *MemoryService) Schedule(characterID uint64) error {
+	_, err := s.queue.Enqueue(JobTypeConversationMemory, memoryJobPayload{CharacterID: characterID}, EnqueueOptions{
+		DedupKey:    fmt.Sprintf("memory:%d", characterID),
+		MaxAttempts: 3,
+	})
+	return err
+}
+
+func (s *MemoryService) handle(ctx context.Context, job *model.Job) error {
+	var payload memoryJobPayload
+	if err := DecodePayload(job, &payload); err != nil {
+		return err
+	}
+
+	character, err := s.characterRepo.GetByID(payload.CharacterID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return PermanentError(fmt.Errorf("character %d not found", payload.CharacterID))
+	}
+	if err != nil {
+		return err
+	}
+
+	summary, err := s.memoryRepo.GetSummary(character.UserID, character.ID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, generationJobTimeout)
+	defer cancel()
+
+	// 占用 AI 生成名额，订阅用户优先
+	priority := GenerationPriorityNormal
+	if s.subscriptionRepo.IsActive(character.UserID) {
+		priority = GenerationPriorityHigh
+	}
+	release, err := s.generationGate.Acquire(ctx, priority)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := s.extractFacts(ctx, character, summary); err != nil {
+		return err
+	}
+	return s.summarize(ctx, character, summary)
+}
+
+// extractFacts 从上次提取之后的新消息中提取用户事实
+func (s *MemoryService) extractFacts(ctx context.Context, character *model.Character, summary *model.ConversationSummary) error {
+	messages, err := s.messageRepo.GetBetweenIDs(character.ID, summary.FactsExtractedUntilID, 0, memoryMaxBatch)
+	if err != nil {
+		return err
+	}
+	if len(messages) < memoryFactBatch {
+		return nil
+	}
+
+	known, err := s.memoryRepo.ListFacts(character.ID)
+	if err != nil {
+		return err
+	}
+
+	var knownLines strings.Builder
+	for _, fact := range known {
+		fmt.Fprintf(&knownLines, "- %s: %s\n", fact.Key, fact.Value)
+	}
+	if knownLines.Len() == 0 {
+		knownLines.WriteString("(none)\n")
+	}
+
+	prompt := fmt.Sprintf(`Extract durable facts about the USER from the chat below between the user and %s.
+Durable facts stay true for a long time: their name or nickname, job, pets and pet names, family members, where they live, hobbies, likes and dislikes, important dates and goals.
+Ignore temporary states (today's mood, what they are doing right now) and anything said only about %s.
+
+Known facts:
+%s
+Chat:
+%s
+Respond with ONLY a JSON array like [{"key": "pet_name", "value": "a corgi called Mochi"}].
+Keys are short snake_case labels; reuse a known key when a fact changes. Return [] if there is nothing new.`,
+		character.Title, character.Title, knownLines.String(), formatTranscript(character, messages))
+
+	text, err := s.model.GenerateText(ctx, prompt, 0.2)
+	if err != nil {
+		return fmt.Errorf("failed to extract memory facts: %v", err)
+	}
+
+	lastID := messages[len(messages)-1].ID
+	facts := parseMemoryFacts(text)
+	for i := range facts {
+		facts[i].UserID = character.UserID
+		facts[i].CharacterID = character.ID
+		facts[i].SourceMessageID = lastID
+	}
+	if err := s.memoryRepo.UpsertFacts(facts); err != nil {
+		return err
+	}
+
+	summary.FactsExtractedUntilID = lastID
+	if err := s.memoryRepo.SaveSummary(summary); err != nil {
+		return err
+	}
+	log.Printf("[Memory] 角色 %d 提取了 %d 条事实", character.ID, len(facts))
+	return nil
+}
+
+// summarize 把超出上下文窗口的旧消息合并进摘要，积压较多时分批处理
+func (s *MemoryService) summarize(ctx context.Context, character *model.Character, summary *model.ConversationSummary) error {
+	// 最近 ChatHistoryWindow 条消息会直接发给模型，不需要总结
+	recent, err := s.messageRepo.GetRecentByCharacterID(character.ID, ChatHistoryWindow)
+	if err != nil {
+		return err
+	}
+	if len(recent) < ChatHistoryWindow {
+		return nil
+	}
+	windowStartID := recent[0].ID
+
+	for {
+		messages, err := s.messageRepo.GetBetweenIDs(character.ID, summary.SummarizedUntilID, windowStartID, memoryMaxBatch)
+		if err != nil {
+			return err
+		}
+		if len(messages) < memorySummaryBatch {
+			return nil
+		}
+
+		previous := summary.Summary
+		if previous == "" {
+			previous = "(none yet)"
+		}
+		prompt := fmt.Sprintf(`You keep the long-term memory of %s, a companion character chatting with a user.
+Update the summary of their conversation with the new messages below. Keep what matters for the relationship: events in the user's life, feelings they shared, plans, promises and recurring topics. Drop small talk.
+Write in English, in third person ("The user ..."), at most 200 words. Output ONLY the updated summary.
+
+Current summary:
+%s
+
+New messages:
+%s`, character.Title, previous, formatTranscript(character, messages))
+
+		text, err := s.model.GenerateText(ctx, prompt, 0.3)
+		if err != nil {
+			return fmt.Errorf("failed to summarize conversation: %v", err)
+		}
+
+		summary.Summary = strings.TrimSpace(text)
+		summary.SummarizedUntilID = messages[len(messages)-1].ID
+		if err := s.memoryRepo.SaveSummary(summary); err != nil {
+			return err
+		}
+		log.Printf("[Memory] 角色 %d 的摘要已更新（合并 %d 条消息）", character.ID, len(messages))
+
+		if len(messages) < memoryMaxBatch {
+			return nil
+		}
+	}
+}
+
+// formatTranscript 将消息格式化为对话文本
+func formatTranscript(character *model.Character, messages []model.Message) string {
+	var b strings.Builder
+	for _, msg := range messages {
+		speaker := "User"
+		if msg.SenderType != model.SenderTypeUser {
+			speaker = character.Title
+		}
+		fmt.Fprintf(&b, "%s: %s\n", speaker, msg.Content)
+	}
+	return b.String()
+}
+
+// parseMemoryFacts 解析模型返回的 JSON 数组，忽略格式不正确的条目
+func parseMemoryFacts(text string) []model.MemoryFact {
+	start := strings.Index(text, "[")
+	end := strings.LastIndex(text, "]")
+	if start < 0 || end <= start {
+		log.Printf("[Memory] 事实提取结果不是 JSON 数组，已忽略")
+		return nil
+	}
+
+	var items []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal([]byte(text[start:end+1]), &items); err != nil {
+		log.Printf("[Memory] 解析事实提取结果失败: %v", err)
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var facts []model.MemoryFact
+	for _, item := range items {
+		key := strings.ToLower(strings.TrimSpace(item.Key))
+		value := strings.TrimSpace(item.Value)
+		if !factKeyPattern.MatchString(key) || value == "" || seen[key] {
+			continue
+		}
+		if runes := []rune(value); len(runes) > memoryMaxFactValue {
+			value = string(runes[:memoryMaxFactValue])
+		}
+		seen[key] = true
+		facts = append(facts, model.MemoryFact{Key: key, Value: value})
+	}
+	return facts
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"lauraai-backend/internal/llm"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/repository/repotest"
+)
+
+// newMemoryTestService 使用 llm.Fake 的记忆服务和一个没有消息的角色
+func newMemoryTestService(t *testing.T) (*MemoryService, *llm.Fake, *model.Character) {
+	t.Helper()
+	repotest.Open(t)
+	fake := llm.NewFake()
+	return NewMemoryService(NewJobQueue(), fake, NewGenerationGate(1)), fake, createUnlockTestCharacter(t, model.UnlockStatusLocked)
+}
+
+// addMessages 追加 n 条交替发送的消息，内容为 msg-<序号>，返回新消息的 ID
+func addMessages(t *testing.T, character *model.Character, from, n int) []uint64 {
+	t.Helper()
+	ids := make([]uint64, 0, n)
+	for i := from; i < from+n; i++ {
+		sender := model.SenderTypeUser
+		if i%2 == 1 {
+			sender = model.SenderTypeCharacter
+		}
+		msg := &model.Message{UserID: character.UserID, CharacterID: character.ID, SenderType: sender, Content: fmt.Sprintf("msg-%03d", i)}
+		if err := repository.NewMessageRepository().Create(msg); err != nil {
+			t.Fatalf("create message: %v", err)
+		}
+		ids = append(ids, msg.ID)
+	}
+	return ids
+}
+
+// runMemoryJob 执行一次记忆更新任务
+func runMemoryJob(t *testing.T, s *MemoryService, character *model.Character) {
+	t.Helper()
+	job := &model.Job{Type: JobTypeConversationMemory, Payload: fmt.Sprintf(`{"character_id":%d}`, character.ID)}
+	if err := s.handle(context.Background(), job); err != nil {
+		t.Fatalf("memory job: %v", err)
+	}
+}
+
+// summaryPrompts 返回所有摘要请求的提示词
+func summaryPrompts(fake *llm.Fake) []string {
+	var prompts []string
+	for _, call := range fake.CallsOf(llm.FakeMethodText) {
+		if strings.Contains(call.Prompt, "Update the summary") {
+			prompts = append(prompts, call.Prompt)
+		}
+	}
+	return prompts
+}
+
+func TestMemorySummaryRollover(t *testing.T) {
+	s, fake, character := newMemoryTestService(t)
+	ids := addMessages(t, character, 0, 30)
+
+	// 窗口外只有 10 条，不足一批，不总结
+	fake.Script(llm.FakeMethodText, llm.FakeResponse{Text: "[]"})
+	runMemoryJob(t, s, character)
+	summary, _ := s.memoryRepo.GetSummary(character.UserID, character.ID)
+	if summary.Summary != "" || summary.SummarizedUntilID != 0 || len(summaryPrompts(fake)) != 0 {
+		t.Fatalf("summary = %+v, prompts = %d", summary, len(summaryPrompts(fake)))
+	}
+
+	// 窗口外积累到 30 条，合并进摘要
+	ids = append(ids, addMessages(t, character, 30, 20)...)
+	fake.Script(llm.FakeMethodText, llm.FakeResponse{Text: "[]"}, llm.FakeResponse{Text: " The user has a dog. "})
+	runMemoryJob(t, s, character)
+	summary, _ = s.memoryRepo.GetSummary(character.UserID, character.ID)
+	if summary.Summary != "The user has a dog." || summary.SummarizedUntilID != ids[29] {
+		t.Fatalf("summary = %+v, want until %d", summary, ids[29])
+	}
+	prompts := summaryPrompts(fake)
+	if len(prompts) != 1 || !strings.Contains(prompts[0], "(none yet)") ||
+		!strings.Contains(prompts[0], "msg-000") || !strings.Contains(prompts[0], "msg-029") || strings.Contains(prompts[0], "msg-030") {
+		t.Fatalf("first summary prompt = %q", prompts)
+	}
+
+	// 再积累一批时在旧摘要的基础上更新，只发送新消息
+	ids = append(ids, addMessages(t, character, 50, 25)...)
+	fake.Script(llm.FakeMethodText, llm.FakeResponse{Text: "[]"}, llm.FakeResponse{Text: "The user has a dog and a new job."})
+	runMemoryJob(t, s, character)
+	summary, _ = s.memoryRepo.GetSummary(character.UserID, character.ID)
+	if summary.Summary != "The user has a dog and a new job." || summary.SummarizedUntilID != ids[54] {
+		t.Fatalf("summary = %+v, want until %d", summary, ids[54])
+	}
+	prompts = summaryPrompts(fake)
+	if len(prompts) != 2 || !strings.Contains(prompts[1], "The user has a dog.") ||
+		strings.Contains(prompts[1], "msg-029") || !strings.Contains(prompts[1], "msg-030") || !strings.Contains(prompts[1], "msg-054") ||
+		strings.Contains(prompts[1], "msg-055") {
+		t.Fatalf("rolled summary prompt = %q", prompts)
+	}
+
+	memory, err := s.Load(character.UserID, character.ID)
+	if err != nil || !strings.Contains(memory.promptSection(), "The user has a dog and a new job.") {
+		t.Errorf("memory = %+v, %v", memory, err)
+	}
+}
+
+func TestMemorySummaryBacklog(t *testing.T) {
+	s, fake, character := newMemoryTestService(t)
+	ids := addMessages(t, character, 0, 250)
+
+	// 窗口外 230 条分三批（100、100、30）总结，每批基于上一批的结果
+	fake.Script(llm.FakeMethodText,
+		llm.FakeResponse{Text: "[]"},
+		llm.FakeResponse{Text: "first"},
+		llm.FakeResponse{Text: "second"},
+		llm.FakeResponse{Text: "third"},
+	)
+	runMemoryJob(t, s, character)
+
+	prompts := summaryPrompts(fake)
+	if len(prompts) != 3 {
+		t.Fatalf("summary calls = %d, want 3", len(prompts))
+	}
+	if !strings.Contains(prompts[1], "first") || !strings.Contains(prompts[1], "msg-100") || strings.Contains(prompts[1], "msg-099") ||
+		!strings.Contains(prompts[2], "second") || !strings.Contains(prompts[2], "msg-229") || strings.Contains(prompts[2], "msg-230") {
+		t.Errorf("batch prompts = %q", prompts)
+	}
+	summary, _ := s.memoryRepo.GetSummary(character.UserID, character.ID)
+	if summary.Summary != "third" || summary.SummarizedUntilID != ids[229] {
+		t.Errorf("summary = %+v, want third until %d", summary, ids[229])
+	}
+}
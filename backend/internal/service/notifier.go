@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// JobTypeTelegramNotification 发送 Telegram 通知
+const JobTypeTelegramNotification = "telegram_notification"
+
+// notificationPayload 通知任务参数
+type notificationPayload struct {
+	UserID uint64 `json:"user_id"`
+	Text   string `json:"text"`
+}
+
+// Notifier 通过任务队列向用户发送 Telegram 消息，发送失败时自动重试
+type Notifier struct {
+	queue     *JobQueue
+	userRepo  *repository.UserRepository
+	botClient *TelegramBotClient
+}
+
+func NewNotifier(queue *JobQueue) *Notifier {
+	n := &Notifier{
+		queue:     queue,
+		userRepo:  repository.NewUserRepository(),
+		botClient: NewTelegramBotClient(),
+	}
+	queue.Register(JobTypeTelegramNotification, n.handle)
+	return n
+}
+
+// Notify 将通知加入队列；dedupKey 非空时同一通知不会重复发送
+func (n *Notifier) Notify(userID uint64, text string, dedupKey string) error {
+	_, err := n.queue.Enqueue(JobTypeTelegramNotification, notificationPayload{UserID: userID, Text: text}, EnqueueOptions{
+		DedupKey:    dedupKey,
+		MaxAttempts: 3,
+	})
+	return err
+}
+
+func (n *Notifier) handle(ctx context.Context, job *model.Job) error {
+	var payload notificationPayload
+	if err := DecodePayload(job, &payload); err != nil {
+		return err
+	}
+
+	user, err := n.userRepo.GetByID(payload.UserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return PermanentError(fmt.Errorf("user %d not found", payload.UserID))
+	}
+	if err != nil {
+		return err
+	}
+	return n.botClient.SendMessage(ctx, user.TelegramID, payload.Text)
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"lauraai-backend/internal/config"
+	"lauraai-backend/internal/model"
+)
+
+// PriceTier 解锁价格档位
+type PriceTier string
+
+const (
+	PriceTierFull PriceTier = "full" // 未解锁，全价
+	PriceTierHalf PriceTier = "half" // 好友助力后半解锁，折扣价
+)
+
+// ErrNoPrice 角色已完全解锁或价格表中缺少对应价格
+var ErrNoPrice = errors.New("no price available")
+
+// PriceTable 每种货币的价格，金额使用最小单位（Stars 数量 / nanoTON）
+type PriceTable map[model.PaymentMethod]int64
+
+// Sale 限时促销
+type Sale struct {
+	Name       string    `json:"name"`
+	StartsAt   time.Time `json:"starts_at"`
+	EndsAt     time.Time `json:"ends_at"`
+	PercentOff int       `json:"percent_off"`
+	// 为空表示对所有角色类型/档位生效
+	CharacterTypes []model.CharacterType `json:"character_types,omitempty"`
+	Tiers          []PriceTier           `json:"tiers,omitempty"`
+}
+
+// PricingCatalog 价格目录，可通过 PRICING_FILE 指定 JSON 文件覆盖默认值
+type PricingCatalog struct {
+	Default        map[PriceTier]PriceTable                         `json:"default"`
+	CharacterTypes map[model.CharacterType]map[PriceTier]PriceTable `json:"character_types,omitempty"`
+	Sales          []Sale                                           `json:"sales,omitempty"`
+	// 订阅每个周期（30 天）的 Stars 价格
+	Subscriptions map[model.SubscriptionPlan]int64 `json:"subscriptions,omitempty"`
+}
+
+// PriceQuote 一次报价结果
+type PriceQuote struct {
+	Tier       PriceTier           `json:"tier"`
+	Currency   model.PaymentMethod `json:"currency"`
+	Amount     int64               `json:"amount"`      // 实际应付金额
+	BaseAmount int64               `json:"base_amount"` // 促销前金额
+	Sale       string              `json:"sale,omitempty"`
+}
+
+// DefaultPricingCatalog 默认价格：全价 300 Stars / 3 TON，半价 100 Stars / 1 TON，订阅 1000 Stars/月
+func DefaultPricingCatalog() *PricingCatalog {
+	return &PricingCatalog{
+		Default: map[PriceTier]PriceTable{
+			PriceTierFull: {model.PaymentMethodStars: 300, model.PaymentMethodTON: 3 * NanoTonPerTon},
+			PriceTierHalf: {model.PaymentMethodStars: 100, model.PaymentMethodTON: 1 * NanoTonPerTon},
+		},
+		Subscriptions: map[model.SubscriptionPlan]int64{
+			model.SubscriptionPlanPremium: 1000,
+		},
+	}
+}
+
+// PricingService 统一的报价入口，报价接口和实际扣款都从这里取价
+type PricingService struct {
+	catalog *PricingCatalog
+	now     func() time.Time
+}
+
+func NewPricingService() (*PricingService, error) {
+	catalog := DefaultPricingCatalog()
+
+	if path := config.AppConfig.PricingFile; path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pricing file: %v", err)
+		}
+		catalog = &PricingCatalog{}
+		if err := json.Unmarshal(data, catalog); err != nil {
+			return nil, fmt.Errorf("failed to parse pricing file: %v", err)
+		}
+		log.Printf("[Pricing] 已从 %s 加载价格目录", path)
+
+		// 价格文件未配置订阅价格时使用默认值
+		if catalog.Subscriptions == nil {
+			catalog.Subscriptions = DefaultPricingCatalog().Subscriptions
+		}
+	}
+
+	if err := catalog.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &PricingService{catalog: catalog, now: time.Now}, nil
+}
+
+// Validate 检查价格目录是否完整
+func (c *PricingCatalog) Validate() error {
+	for _, tier := range []PriceTier{PriceTierFull, PriceTierHalf} {
+		for _, currency := range []model.PaymentMethod{model.PaymentMethodStars, model.PaymentMethodTON} {
+			if c.Default[tier][currency] <= 0 {
+				return fmt.Errorf("pricing: missing default %s price for %s", currency, tier)
+			}
+		}
+	}
+	for plan, price := range c.Subscriptions {
+		if price <= 0 {
+			return fmt.Errorf("pricing: subscription %s price must be positive", plan)
+		}
+	}
+	for _, sale := range c.Sales {
+		if sale.PercentOff <= 0 || sale.PercentOff >= 100 {
+			return fmt.Errorf("pricing: sale %q percent_off must be between 1 and 99", sale.Name)
+		}
+		if !sale.EndsAt.After(sale.StartsAt) {
+			return fmt.Errorf("pricing: sale %q ends before it starts", sale.Name)
+		}
+	}
+	return nil
+}
+
+// TierForStatus 根据解锁状态返回价格档位
+func TierForStatus(status model.UnlockStatus) (PriceTier, bool) {
+	switch status {
+	case model.UnlockStatusLocked:
+		return PriceTierFull, true
+	case model.UnlockStatusHalfUnlocked:
+		return PriceTierHalf, true
+	default:
+		return "", false
+	}
+}
+
+// Quote 计算角色在当前解锁状态下使用某种货币的价格
+func (s *PricingService) Quote(charType model.CharacterType, status model.UnlockStatus, currency model.PaymentMethod) (*PriceQuote, error) {
+	tier, ok := TierForStatus(status)
+	if !ok {
+		return nil, ErrNoPrice
+	}
+
+	base := s.catalog.Default[tier][currency]
+	if override, ok := s.catalog.CharacterTypes[charType][tier][currency]; ok && override > 0 {
+		base = override
+	}
+	if base <= 0 {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoPrice, tier, currency)
+	}
+
+	quote := &PriceQuote{Tier: tier, Currency: currency, Amount: base, BaseAmount: base}
+	if sale := s.activeSale(charType, tier); sale != nil {
+		quote.Amount = base * int64(100-sale.PercentOff) / 100
+		if quote.Amount < 1 {
+			quote.Amount = 1
+		}
+		quote.Sale = sale.Name
+	}
+	return quote, nil
+}
+
+// SubscriptionPrice 订阅每个周期的 Stars 价格
+func (s *PricingService) SubscriptionPrice(plan model.SubscriptionPlan) (int64, error) {
+	price, ok := s.catalog.Subscriptions[plan]
+	if !ok || price <= 0 {
+		return 0, fmt.Errorf("%w: subscription %s", ErrNoPrice, plan)
+	}
+	return price, nil
+}
+
+// activeSale 返回当前生效且折扣最大的促销
+func (s *PricingService) activeSale(charType model.CharacterType, tier PriceTier) *Sale {
+	now := s.now()
+	var best *Sale
+	for i := range s.catalog.Sales {
+		sale := &s.catalog.Sales[i]
+		if now.Before(sale.StartsAt) || !now.Before(sale.EndsAt) {
+			continue
+		}
+		if len(sale.CharacterTypes) > 0 && !containsCharacterType(sale.CharacterTypes, charType) {
+			continue
+		}
+		if len(sale.Tiers) > 0 && !containsTier(sale.Tiers, tier) {
+			continue
+		}
+		if best == nil || sale.PercentOff > best.PercentOff {
+			best = sale
+		}
+	}
+	return best
+}
+
+func containsCharacterType(types []model.CharacterType, t model.CharacterType) bool {
+	for _, item := range types {
+		if item == t {
+			return true
+		}
+	}
+	return false
+}
+
+func containsTier(tiers []PriceTier, t PriceTier) bool {
+	for _, item := range tiers {
+		if item == t {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatTON 将 nanoTON 转换为 TON 数值，用于展示
+func FormatTON(amountNano int64) float64 {
+	return float64(amountNano) / float64(NanoTonPerTon)
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"lauraai-backend/internal/model"
+)
+
+var pricingNow = time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestPricing 使用固定时间的价格服务：默认价格，future_baby 全价覆盖为 500 Stars
+func newTestPricing(sales ...Sale) *PricingService {
+	catalog := DefaultPricingCatalog()
+	catalog.CharacterTypes = map[model.CharacterType]map[PriceTier]PriceTable{
+		model.CharacterTypeFutureBaby: {PriceTierFull: {model.PaymentMethodStars: 500}},
+	}
+	catalog.Sales = sales
+	return &PricingService{catalog: catalog, now: func() time.Time { return pricingNow }}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name       string
+		charType   model.CharacterType
+		status     model.UnlockStatus
+		currency   model.PaymentMethod
+		wantTier   PriceTier
+		wantAmount int64
+	}{
+		{"full stars", model.CharacterTypeSoulmate, model.UnlockStatusLocked, model.PaymentMethodStars, PriceTierFull, 300},
+		{"half stars", model.CharacterTypeSoulmate, model.UnlockStatusHalfUnlocked, model.PaymentMethodStars, PriceTierHalf, 100},
+		{"full ton", model.CharacterTypeSoulmate, model.UnlockStatusLocked, model.PaymentMethodTON, PriceTierFull, 3 * NanoTonPerTon},
+		{"type override", model.CharacterTypeFutureBaby, model.UnlockStatusLocked, model.PaymentMethodStars, PriceTierFull, 500},
+		// 覆盖只对配置了的档位和货币生效
+		{"override falls back to default", model.CharacterTypeFutureBaby, model.UnlockStatusLocked, model.PaymentMethodTON, PriceTierFull, 3 * NanoTonPerTon},
+		{"override other tier", model.CharacterTypeFutureBaby, model.UnlockStatusHalfUnlocked, model.PaymentMethodStars, PriceTierHalf, 100},
+	}
+	s := newTestPricing()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quote, err := s.Quote(tt.charType, tt.status, tt.currency)
+			if err != nil {
+				t.Fatalf("Quote: %v", err)
+			}
+			if quote.Tier != tt.wantTier || quote.Amount != tt.wantAmount || quote.BaseAmount != tt.wantAmount || quote.Sale != "" {
+				t.Errorf("quote = %+v, want %s %d", quote, tt.wantTier, tt.wantAmount)
+			}
+		})
+	}
+
+	if _, err := s.Quote(model.CharacterTypeSoulmate, model.UnlockStatusFullUnlocked, model.PaymentMethodStars); !errors.Is(err, ErrNoPrice) {
+		t.Errorf("full unlocked quote err = %v, want ErrNoPrice", err)
+	}
+}
+
+func TestQuoteBestSale(t *testing.T) {
+	s := newTestPricing(
+		Sale{Name: "spring", StartsAt: pricingNow.Add(-time.Hour), EndsAt: pricingNow.Add(time.Hour), PercentOff: 10},
+		Sale{Name: "flash", StartsAt: pricingNow.Add(-time.Hour), EndsAt: pricingNow.Add(time.Hour), PercentOff: 50},
+		// 只对其他角色类型或档位生效的促销不参与比较
+		Sale{Name: "babies", StartsAt: pricingNow.Add(-time.Hour), EndsAt: pricingNow.Add(time.Hour), PercentOff: 90,
+			CharacterTypes: []model.CharacterType{model.CharacterTypeFutureBaby}},
+		Sale{Name: "half only", StartsAt: pricingNow.Add(-time.Hour), EndsAt: pricingNow.Add(time.Hour), PercentOff: 80,
+			Tiers: []PriceTier{PriceTierHalf}},
+	)
+
+	quote, err := s.Quote(model.CharacterTypeSoulmate, model.UnlockStatusLocked, model.PaymentMethodStars)
+	if err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+	if quote.Sale != "flash" || quote.Amount != 150 || quote.BaseAmount != 300 {
+		t.Errorf("quote = %+v, want flash 150", quote)
+	}
+
+	quote, _ = s.Quote(model.CharacterTypeFutureBaby, model.UnlockStatusLocked, model.PaymentMethodStars)
+	if quote.Sale != "babies" || quote.Amount != 50 || quote.BaseAmount != 500 {
+		t.Errorf("future_baby quote = %+v, want babies 50", quote)
+	}
+	quote, _ = s.Quote(model.CharacterTypeSoulmate, model.UnlockStatusHalfUnlocked, model.PaymentMethodStars)
+	if quote.Sale != "half only" || quote.Amount != 20 {
+		t.Errorf("half quote = %+v, want half only 20", quote)
+	}
+}
+
+func TestQuoteSaleWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		starts   time.Time
+		ends     time.Time
+		wantSale bool
+	}{
+		{"starts now", pricingNow, pricingNow.Add(time.Hour), true},
+		{"ends now", pricingNow.Add(-time.Hour), pricingNow, false},
+		{"not started", pricingNow.Add(time.Second), pricingNow.Add(time.Hour), false},
+		{"ended", pricingNow.Add(-2 * time.Hour), pricingNow.Add(-time.Hour), false},
+		{"ends in a second", pricingNow.Add(-time.Hour), pricingNow.Add(time.Second), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestPricing(Sale{Name: "sale", StartsAt: tt.starts, EndsAt: tt.ends, PercentOff: 50})
+			quote, err := s.Quote(model.CharacterTypeSoulmate, model.UnlockStatusLocked, model.PaymentMethodStars)
+			if err != nil {
+				t.Fatalf("Quote: %v", err)
+			}
+			if got := quote.Sale != ""; got != tt.wantSale {
+				t.Errorf("quote = %+v, want sale %v", quote, tt.wantSale)
+			}
+		})
+	}
+}
+
+func TestQuoteSaleMinimumAmount(t *testing.T) {
+	s := newTestPricing(Sale{Name: "sale", StartsAt: pricingNow.Add(-time.Hour), EndsAt: pricingNow.Add(time.Hour), PercentOff: 99})
+	s.catalog.Default[PriceTierHalf][model.PaymentMethodStars] = 50
+
+	// 折扣后不足 1 时按 1 收取
+	quote, _ := s.Quote(model.CharacterTypeSoulmate, model.UnlockStatusHalfUnlocked, model.PaymentMethodStars)
+	if quote.Amount != 1 {
+		t.Errorf("amount = %d, want 1", quote.Amount)
+	}
+}
+
+func TestPricingCatalogValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(c *PricingCatalog)
+		wantErr string
+	}{
+		{name: "default"},
+		{
+			name:    "missing default price",
+			mutate:  func(c *PricingCatalog) { delete(c.Default[PriceTierHalf], model.PaymentMethodTON) },
+			wantErr: "missing default ton price for half",
+		},
+		{
+			name:    "missing tier",
+			mutate:  func(c *PricingCatalog) { delete(c.Default, PriceTierFull) },
+			wantErr: "missing default stars price for full",
+		},
+		{
+			name:    "subscription price",
+			mutate:  func(c *PricingCatalog) { c.Subscriptions[model.SubscriptionPlanPremium] = 0 },
+			wantErr: "price must be positive",
+		},
+		{
+			name: "sale percent",
+			mutate: func(c *PricingCatalog) {
+				c.Sales = []Sale{{Name: "free", StartsAt: pricingNow, EndsAt: pricingNow.Add(time.Hour), PercentOff: 100}}
+			},
+			wantErr: "percent_off must be between 1 and 99",
+		},
+		{
+			name: "sale window",
+			mutate: func(c *PricingCatalog) {
+				c.Sales = []Sale{{Name: "backwards", StartsAt: pricingNow, EndsAt: pricingNow, PercentOff: 10}}
+			},
+			wantErr: "ends before it starts",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			catalog := DefaultPricingCatalog()
+			if tt.mutate != nil {
+				tt.mutate(catalog)
+			}
+			err := catalog.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
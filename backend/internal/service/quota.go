@@ -0,0 +1,131 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"lauraai-backend/internal/config"
+	"lauraai-backend/internal/llm"
+	"lauraai-backend/internal/repository"
+)
+
+// ErrorCodeQuotaExceeded 超出每日对话额度的错误码，HTTP 和 WebSocket 使用相同的错误码
+const ErrorCodeQuotaExceeded = "QUOTA_EXCEEDED"
+
+// 额度等级
+const (
+	QuotaTierFree    = "free"
+	QuotaTierPremium = "premium" // 订阅用户
+)
+
+// QuotaStatus 用户当天的对话用量和额度，limit 为 0 表示不限制
+type QuotaStatus struct {
+	Tier             string    `json:"tier"`
+	Messages         int       `json:"messages"`
+	MessageLimit     int       `json:"message_limit"`
+	PromptTokens     int64     `json:"prompt_tokens"`
+	CompletionTokens int64     `json:"completion_tokens"`
+	Tokens           int64     `json:"tokens"`
+	TokenLimit       int64     `json:"token_limit"`
+	ResetAt          time.Time `json:"reset_at"`
+}
+
+// Exceeded 是否已用完当天的回复条数或 token 额度
+func (s *QuotaStatus) Exceeded() bool {
+	return (s.MessageLimit > 0 && s.Messages >= s.MessageLimit) ||
+		(s.TokenLimit > 0 && s.Tokens >= s.TokenLimit)
+}
+
+// QuotaExceededError 超出每日额度，Status 含额度重置时间
+type QuotaExceededError struct {
+	Status *QuotaStatus
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("daily chat quota exceeded, resets at %s", e.Status.ResetAt.Format(time.RFC3339))
+}
+
+// QuotaService 按 UTC 自然日统计每个用户的回复条数和 token 用量，并按订阅等级限制
+type QuotaService struct {
+	usageRepo        *repository.UsageRepository
+	subscriptionRepo *repository.SubscriptionRepository
+}
+
+func NewQuotaService() *QuotaService {
+	return &QuotaService{
+		usageRepo:        repository.NewUsageRepository(),
+		subscriptionRepo: repository.NewSubscriptionRepository(),
+	}
+}
+
+// quotaDay 返回 t 所在的 UTC 日期
+func quotaDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// Status 获取用户当天的用量和额度
+func (s *QuotaService) Status(userID uint64) (*QuotaStatus, error) {
+	return s.status(userID, quotaDay(time.Now()))
+}
+
+func (s *QuotaService) status(userID uint64, day time.Time) (*QuotaStatus, error) {
+	usage, err := s.usageRepo.GetDay(userID, day)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &QuotaStatus{
+		Tier:             QuotaTierFree,
+		Messages:         usage.Messages,
+		MessageLimit:     config.AppConfig.ChatDailyMessagesFree,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		Tokens:           usage.TotalTokens(),
+		TokenLimit:       config.AppConfig.ChatDailyTokensFree,
+		ResetAt:          day.Add(24 * time.Hour),
+	}
+	if s.subscriptionRepo.IsActive(userID) {
+		status.Tier = QuotaTierPremium
+		status.MessageLimit = config.AppConfig.ChatDailyMessagesPremium
+		status.TokenLimit = config.AppConfig.ChatDailyTokensPremium
+	}
+	return status, nil
+}
+
+// QuotaReservation 为一条回复预留的额度，生成结束后用 Commit 记录 token 用量，没有保存回复时用 Release 退回
+type QuotaReservation struct {
+	UserID uint64
+	Day    time.Time
+}
+
+// Reserve 原子地占用当天的一条回复额度，已用完时返回 *QuotaExceededError
+// 回复条数在生成前占用，并发请求不会超出条数上限；token 在回复保存后才计入
+func (s *QuotaService) Reserve(userID uint64) (*QuotaReservation, error) {
+	day := quotaDay(time.Now())
+	status, err := s.status(userID, day)
+	if err != nil {
+		return nil, err
+	}
+	reserved, err := s.usageRepo.Reserve(userID, day, status.MessageLimit, status.TokenLimit)
+	if err != nil {
+		return nil, err
+	}
+	if !reserved {
+		// 重新读取，返回占用失败时的实际用量
+		if latest, err := s.status(userID, day); err == nil {
+			status = latest
+		}
+		return nil, &QuotaExceededError{Status: status}
+	}
+	return &QuotaReservation{UserID: userID, Day: day}, nil
+}
+
+// Commit 记录预留的回复实际使用的 token，计入预留时的日期
+func (s *QuotaService) Commit(reservation *QuotaReservation, usage llm.Usage) error {
+	return s.usageRepo.Add(reservation.UserID, reservation.Day, 0, int64(usage.PromptTokens), int64(usage.CompletionTokens))
+}
+
+// Release 退回没有用上的回复额度
+func (s *QuotaService) Release(reservation *QuotaReservation) error {
+	return s.usageRepo.Release(reservation.UserID, reservation.Day)
+}
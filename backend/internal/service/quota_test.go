@@ -0,0 +1,81 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"lauraai-backend/internal/config"
+	"lauraai-backend/internal/llm"
+	"lauraai-backend/internal/repository/repotest"
+)
+
+func TestQuotaReserveConcurrent(t *testing.T) {
+	repotest.Open(t)
+	config.AppConfig.ChatDailyMessagesFree = 3
+	config.AppConfig.ChatDailyTokensFree = 0
+	s := NewQuotaService()
+
+	// 同时发起的请求只有额度内的能占用成功
+	var reserved, exceeded atomic.Int32
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Reserve(1)
+			var quotaErr *QuotaExceededError
+			switch {
+			case err == nil:
+				reserved.Add(1)
+			case errors.As(err, &quotaErr):
+				exceeded.Add(1)
+			default:
+				t.Errorf("reserve: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if reserved.Load() != 3 || exceeded.Load() != 7 {
+		t.Errorf("reserved %d, exceeded %d; want 3 and 7", reserved.Load(), exceeded.Load())
+	}
+	if status, _ := s.Status(1); status.Messages != 3 || !status.Exceeded() {
+		t.Errorf("status = %+v", status)
+	}
+}
+
+func TestQuotaCommitAndRelease(t *testing.T) {
+	repotest.Open(t)
+	config.AppConfig.ChatDailyMessagesFree = 0
+	config.AppConfig.ChatDailyTokensFree = 100
+	s := NewQuotaService()
+
+	first, err := s.Reserve(1)
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	second, err := s.Reserve(1)
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	// 没有保存回复的预留退回条数
+	if err := s.Release(second); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	// 保存回复后按实际 token 对账，用完 token 额度后不能再预留
+	if err := s.Commit(first, llm.Usage{PromptTokens: 60, CompletionTokens: 40, TotalTokens: 100}); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	status, _ := s.Status(1)
+	if status.Messages != 1 || status.PromptTokens != 60 || status.CompletionTokens != 40 {
+		t.Errorf("status = %+v", status)
+	}
+	var quotaErr *QuotaExceededError
+	if _, err := s.Reserve(1); !errors.As(err, &quotaErr) || quotaErr.Status.Tokens != 100 {
+		t.Errorf("reserve over token limit = %v", err)
+	}
+	if status, _ := s.Status(1); status.Messages != 1 {
+		t.Errorf("failed reservation counted: %+v", status)
+	}
+}
@@ -0,0 +1,390 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"lauraai-backend/internal/i18n"
+	"lauraai-backend/internal/llm"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+)
+
+// 回复生成失败的错误码，SSE 和 WebSocket 使用相同的错误码
+const (
+	ReplyErrorCanceled          = "canceled"           // 生成被取消
+	ReplyErrorModelUnavailable  = "model_unavailable"  // 所有模型暂时不可用
+	ReplyErrorGenerationFailed  = "generation_failed"  // 模型调用失败
+	ReplyErrorStreamInterrupted = "stream_interrupted" // 输出过程中断开
+	ReplyErrorSaveFailed        = "save_failed"        // 回复保存失败
+)
+
+// replyRetention 生成结束后保留输出的时间，断线的客户端在此期间可以取回结果
+const replyRetention = 2 * time.Minute
+
+// ReplyRequest 生成一条角色回复所需的内容
+type ReplyRequest struct {
+	Character *model.Character
+	// History 用户消息之前的历史消息
+	History []model.Message
+	// Prompt 要回复的用户消息
+	Prompt *model.Message
+	Locale i18n.Locale
+	// Save 保存完整回复，为空时作为新消息保存
+	Save func(reply *model.Message) error
+	// Quota 生成前预留的额度，保存回复后计入 token 用量，没有保存回复时退回；为空时不记录用量
+	Quota *QuotaReservation
+}
+
+// ReplyResult 生成结束的结果，ErrCode 为空表示回复已保存
+// 取消或中途断开时已生成的部分回复也会保存，此时 Interrupted 为 true，Reason 为原因（ReplyErrorCanceled 或 ReplyErrorStreamInterrupted）
+type ReplyResult struct {
+	MessageID      uint64     `json:"message_id,omitempty"`
+	VersionGroupID uint64     `json:"version_group_id,omitempty"`
+	Interrupted    bool       `json:"interrupted,omitempty"`
+	Reason         string     `json:"reason,omitempty"`
+	Usage          *llm.Usage `json:"usage"`
+	ErrCode        string     `json:"code,omitempty"`
+	ErrMessage     string     `json:"message,omitempty"`
+}
+
+// ReplyGeneration 一次回复生成，输出缓存在内存中，可以从任意位置开始读取（用于断线续传）
+type ReplyGeneration struct {
+	ID            string
+	UserID        uint64
+	CharacterID   uint64
+	UserMessageID uint64
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu      sync.Mutex
+	text    []rune
+	changed chan struct{} // 有新内容或结束时关闭并替换
+	result  *ReplyResult
+}
+
+// Next 返回 offset（字符数）之后的输出和新的 offset
+// 没有新内容时阻塞到有新内容、生成结束或 ctx 结束；生成结束且内容已全部读完时返回结果
+func (g *ReplyGeneration) Next(ctx context.Context, offset int) (text string, next int, result *ReplyResult, err error) {
+	for {
+		g.mu.Lock()
+		offset = min(max(offset, 0), len(g.text))
+		if offset < len(g.text) {
+			text, next = string(g.text[offset:]), len(g.text)
+			g.mu.Unlock()
+			return text, next, nil, nil
+		}
+		if g.result != nil {
+			result = g.result
+			g.mu.Unlock()
+			return "", offset, result, nil
+		}
+		wait := g.changed
+		g.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return "", offset, nil, ctx.Err()
+		}
+	}
+}
+
+// Cancel 停止生成
+func (g *ReplyGeneration) Cancel() {
+	g.cancel()
+}
+
+// Done 生成结束（成功、失败或取消）后关闭
+func (g *ReplyGeneration) Done() <-chan struct{} {
+	return g.done
+}
+
+func (g *ReplyGeneration) append(text string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.text = append(g.text, []rune(text)...)
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
+
+func (g *ReplyGeneration) finish(result ReplyResult) {
+	g.mu.Lock()
+	g.result = &result
+	close(g.changed)
+	g.changed = make(chan struct{})
+	g.mu.Unlock()
+	close(g.done)
+}
+
+// ReplyService 生成角色回复：排队占用生成名额、流式调用模型、保存回复并安排记忆更新
+// 进行中和刚结束的生成按 ID 登记，供断线续传和取消使用
+type ReplyService struct {
+	chatService      *ChatService
+	memoryService    *MemoryService
+	generationGate   *GenerationGate
+	quotaService     *QuotaService
+	messageRepo      *repository.MessageRepository
+	subscriptionRepo *repository.SubscriptionRepository
+
+	mu          sync.Mutex
+	generations map[string]*ReplyGeneration
+}
+
+func NewReplyService(chatService *ChatService, memoryService *MemoryService, generationGate *GenerationGate, quotaService *QuotaService) *ReplyService {
+	return &ReplyService{
+		chatService:      chatService,
+		memoryService:    memoryService,
+		generationGate:   generationGate,
+		quotaService:     quotaService,
+		messageRepo:      repository.NewMessageRepository(),
+		subscriptionRepo: repository.NewSubscriptionRepository(),
+		generations:      make(map[string]*ReplyGeneration),
+	}
+}
+
+// ReserveQuota 占用用户当天的一条回复额度，超出时返回 *QuotaExceededError
+// 应在保存用户消息之前调用，避免留下没有回复的消息；预留的额度通过 ReplyRequest.Quota 交给 Start
+func (s *ReplyService) ReserveQuota(userID uint64) (*QuotaReservation, error) {
+	return s.quotaService.Reserve(userID)
+}
+
+// ReleaseQuota 退回预留后没有开始生成的额度（例如保存用户消息失败）
+func (s *ReplyService) ReleaseQuota(reservation *QuotaReservation) {
+	if err := s.quotaService.Release(reservation); err != nil {
+		log.Printf("[Reply] 退回对话额度失败: %v", err)
+	}
+}
+
+// Start 在后台开始生成回复，ctx 结束时停止生成
+func (s *ReplyService) Start(ctx context.Context, req ReplyRequest) *ReplyGeneration {
+	ctx, cancel := context.WithCancel(ctx)
+	g := &ReplyGeneration{
+		ID:            newReplyID(),
+		UserID:        req.Character.UserID,
+		CharacterID:   req.Character.ID,
+		UserMessageID: req.Prompt.ID,
+		cancel:        cancel,
+		done:          make(chan struct{}),
+		changed:       make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	s.generations[g.ID] = g
+	s.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		result := s.generate(ctx, g, req)
+		s.settleQuota(req.Quota, result)
+		g.finish(result)
+
+		// 保留一段时间供断线的客户端取回结果
+		time.AfterFunc(replyRetention, func() {
+			s.mu.Lock()
+			delete(s.generations, g.ID)
+			s.mu.Unlock()
+		})
+	}()
+	return g
+}
+
+// Get 获取用户的一次生成
+func (s *ReplyService) Get(userID uint64, id string) (*ReplyGeneration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.generations[id]
+	if !ok || g.UserID != userID {
+		return nil, false
+	}
+	return g, true
+}
+
+// Active 获取用户进行中的生成
+func (s *ReplyService) Active(userID uint64) []*ReplyGeneration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var active []*ReplyGeneration
+	for _, g := range s.generations {
+		if g.UserID != userID {
+			continue
+		}
+		select {
+		case <-g.done:
+		default:
+			active = append(active, g)
+		}
+	}
+	return active
+}
+
+// CancelCharacter 取消用户与角色之间进行中的生成，返回是否有生成被取消
+func (s *ReplyService) CancelCharacter(userID uint64, characterID uint64) bool {
+	canceled := false
+	for _, g := range s.Active(userID) {
+		if g.CharacterID == characterID {
+			g.Cancel()
+			canceled = true
+		}
+	}
+	return canceled
+}
+
+func (s *ReplyService) generate(ctx context.Context, g *ReplyGeneration, req ReplyRequest) ReplyResult {
+	character := req.Character
+
+	var memory *ConversationMemory
+	if s.memoryService != nil {
+		var err error
+		if memory, err = s.memoryService.Load(character.UserID, character.ID); err != nil {
+			log.Printf("[Reply] 加载角色记忆失败: %v", err)
+		}
+	}
+
+	// 占用 AI 生成名额，订阅用户优先
+	priority := GenerationPriorityNormal
+	if s.subscriptionRepo.IsActive(character.UserID) {
+		priority = GenerationPriorityHigh
+	}
+	release, err := s.generationGate.Acquire(ctx, priority)
+	if err != nil {
+		return ReplyResult{ErrCode: ReplyErrorCanceled, ErrMessage: "Request canceled while waiting for generation"}
+	}
+	defer release()
+
+	chunks, err := s.chatService.ChatStream(ctx, character, req.History, req.Prompt.Content, req.Locale, memory)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ReplyResult{ErrCode: ReplyErrorCanceled, ErrMessage: "Generation canceled"}
+		}
+		log.Printf("[Reply] 生成回复失败: %v", err)
+		if errors.Is(err, llm.ErrCircuitOpen) {
+			return ReplyResult{ErrCode: ReplyErrorModelUnavailable, ErrMessage: "Failed to generate response"}
+		}
+		return ReplyResult{ErrCode: ReplyErrorGenerationFailed, ErrMessage: "Failed to generate response"}
+	}
+
+	// 取消时不再等待通道关闭，生产者在 ctx 结束后自行退出
+	var usage *llm.Usage
+	interrupted := ""
+read:
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				// 生产者因取消提前关闭通道
+				if ctx.Err() != nil {
+					interrupted = ReplyErrorCanceled
+				}
+				break read
+			}
+			if chunk.Err != nil {
+				interrupted = ReplyErrorCanceled
+				if ctx.Err() == nil {
+					log.Printf("[Reply] 流式响应中断: %v", chunk.Err)
+					interrupted = ReplyErrorStreamInterrupted
+				}
+				break read
+			}
+			if chunk.Usage != nil {
+				usage = chunk.Usage
+			}
+			if chunk.Text != "" {
+				g.append(chunk.Text)
+			}
+		case <-ctx.Done():
+			interrupted = ReplyErrorCanceled
+			break read
+		}
+	}
+
+	g.mu.Lock()
+	content := string(g.text)
+	g.mu.Unlock()
+	if content == "" {
+		switch interrupted {
+		case ReplyErrorCanceled:
+			return ReplyResult{ErrCode: ReplyErrorCanceled, ErrMessage: "Generation canceled"}
+		case ReplyErrorStreamInterrupted:
+			return ReplyResult{ErrCode: ReplyErrorStreamInterrupted, ErrMessage: "Response stream was interrupted"}
+		}
+		return ReplyResult{ErrCode: ReplyErrorGenerationFailed, ErrMessage: "Empty response"}
+	}
+
+	// 模型没有返回用量（例如被中断）时按字数估算
+	if usage == nil {
+		usage = estimateUsage(req, content)
+	}
+
+	// 保存角色回复，被中断的部分回复也保存并标记
+	reply := &model.Message{
+		UserID:           character.UserID,
+		CharacterID:      character.ID,
+		SenderType:       model.SenderTypeCharacter,
+		Content:          content,
+		Interrupted:      interrupted != "",
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+	}
+	save := req.Save
+	if save == nil {
+		save = s.messageRepo.Create
+	}
+	if err := save(reply); err != nil {
+		log.Printf("[Reply] 保存回复失败: %v", err)
+		return ReplyResult{ErrCode: ReplyErrorSaveFailed, ErrMessage: "Failed to save response"}
+	}
+	// 后台更新聊天摘要和用户事实
+	if s.memoryService != nil {
+		if err := s.memoryService.Schedule(character.ID); err != nil {
+			log.Printf("[Reply] 安排记忆更新失败: %v", err)
+		}
+	}
+
+	return ReplyResult{
+		MessageID:      reply.ID,
+		VersionGroupID: reply.VersionGroupID,
+		Interrupted:    reply.Interrupted,
+		Reason:         interrupted,
+		Usage:          usage,
+	}
+}
+
+// settleQuota 回复已保存时计入 token 用量，否则退回预留的额度
+func (s *ReplyService) settleQuota(reservation *QuotaReservation, result ReplyResult) {
+	if reservation == nil {
+		return
+	}
+	if result.ErrCode != "" {
+		s.ReleaseQuota(reservation)
+		return
+	}
+	if err := s.quotaService.Commit(reservation, *result.Usage); err != nil {
+		log.Printf("[Reply] 记录对话用量失败: %v", err)
+	}
+}
+
+// estimateUsage 按每 4 个字符（rune，而非字节）一个 token 估算用量（不含角色设定和记忆）
+func estimateUsage(req ReplyRequest, reply string) *llm.Usage {
+	prompt := utf8.RuneCountInString(req.Prompt.Content)
+	for _, msg := range req.History {
+		prompt += utf8.RuneCountInString(msg.Content)
+	}
+	usage := &llm.Usage{PromptTokens: (prompt + 3) / 4, CompletionTokens: (utf8.RuneCountInString(reply) + 3) / 4}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+// newReplyID 生成随机的生成 ID
+func newReplyID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"lauraai-backend/internal/i18n"
+	"lauraai-backend/internal/llm"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/repository/repotest"
+)
+
+// newReplyTestService 使用 llm.Fake 的回复服务，流式输出不等待
+func newReplyTestService(t *testing.T) (*ReplyService, *llm.Fake) {
+	t.Helper()
+	repotest.Open(t)
+	fake := llm.NewFake()
+	fake.StreamInterval = 0
+	return NewReplyService(NewChatService(fake), nil, NewGenerationGate(1), NewQuotaService()), fake
+}
+
+func newReplyRequest() ReplyRequest {
+	return ReplyRequest{
+		Character: &model.Character{ID: 7, UserID: 42, Title: "Soulmate", Type: model.CharacterTypeSoulmate},
+		Prompt:    &model.Message{ID: 1, UserID: 42, CharacterID: 7, SenderType: model.SenderTypeUser, Content: "hello there"},
+		Locale:    i18n.LocaleEn,
+	}
+}
+
+// reserveReply 预留一条额度的回复请求
+func reserveReply(t *testing.T, s *ReplyService) ReplyRequest {
+	t.Helper()
+	req := newReplyRequest()
+	quota, err := s.ReserveQuota(req.Character.UserID)
+	if err != nil {
+		t.Fatalf("reserve quota: %v", err)
+	}
+	req.Quota = quota
+	return req
+}
+
+// readReply 读取生成的全部输出和结果
+func readReply(t *testing.T, g *ReplyGeneration) (string, *ReplyResult) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var text string
+	offset := 0
+	for {
+		chunk, next, result, err := g.Next(ctx, offset)
+		if err != nil {
+			t.Fatalf("next: %v", err)
+		}
+		text += chunk
+		offset = next
+		if result != nil {
+			return text, result
+		}
+	}
+}
+
+func TestReplyStream(t *testing.T) {
+	s, fake := newReplyTestService(t)
+	fake.Script(llm.FakeMethodChatStream, llm.FakeResponse{Text: "Nice to meet you, traveler."})
+
+	text, result := readReply(t, s.Start(context.Background(), reserveReply(t, s)))
+	if text != "Nice to meet you, traveler." {
+		t.Errorf("text = %q", text)
+	}
+	if result.ErrCode != "" || result.Interrupted || result.MessageID == 0 {
+		t.Fatalf("result = %+v", result)
+	}
+	if result.Usage == nil || result.Usage.CompletionTokens == 0 {
+		t.Errorf("usage = %+v", result.Usage)
+	}
+
+	calls := fake.CallsOf(llm.FakeMethodChatStream)
+	if len(calls) != 1 || calls[0].Messages[len(calls[0].Messages)-1].Text != "hello there" {
+		t.Errorf("calls = %+v", calls)
+	}
+
+	reply, err := repository.NewMessageRepository().GetByID(7, result.MessageID)
+	if err != nil {
+		t.Fatalf("reload reply: %v", err)
+	}
+	if reply.Content != text || reply.SenderType != model.SenderTypeCharacter || reply.CompletionTokens != result.Usage.CompletionTokens {
+		t.Errorf("reply = %+v", reply)
+	}
+	status, _ := s.quotaService.Status(42)
+	if status.Messages != 1 || status.Tokens != int64(result.Usage.TotalTokens) {
+		t.Errorf("quota = %+v", status)
+	}
+}
+
+func TestReplyStreamInterrupted(t *testing.T) {
+	s, fake := newReplyTestService(t)
+	fake.Script(llm.FakeMethodChatStream, llm.FakeResponse{Text: "I was about to say", Err: llm.ErrFakeEOF})
+
+	text, result := readReply(t, s.Start(context.Background(), newReplyRequest()))
+	if text != "I was about to say" {
+		t.Errorf("text = %q", text)
+	}
+	// 中途断开时保存已生成的部分并按字数估算用量
+	if result.ErrCode != "" || !result.Interrupted || result.Reason != ReplyErrorStreamInterrupted {
+		t.Fatalf("result = %+v", result)
+	}
+	if result.Usage == nil || result.Usage.CompletionTokens != (len(text)+3)/4 {
+		t.Errorf("usage = %+v", result.Usage)
+	}
+	reply, err := repository.NewMessageRepository().GetByID(7, result.MessageID)
+	if err != nil || !reply.Interrupted || reply.Content != text {
+		t.Errorf("reply = %+v (%v)", reply, err)
+	}
+}
+
+func TestEstimateUsage(t *testing.T) {
+	req := newReplyRequest()
+	req.Prompt.Content = "你好，最近怎么样？"
+	req.History = []model.Message{{Content: "hello"}}
+
+	// 按字符计数：提示 9+5 个字符，回复 6 个字符
+	usage := estimateUsage(req, "我很好，谢谢")
+	if usage.PromptTokens != 4 || usage.CompletionTokens != 2 || usage.TotalTokens != 6 {
+		t.Errorf("usage = %+v, want 4/2/6", usage)
+	}
+}
+
+func TestReplyStreamFailure(t *testing.T) {
+	s, fake := newReplyTestService(t)
+	fake.FailNext(llm.FakeMethodChatStream, llm.ErrFakeRateLimited, llm.ErrFakeEOF)
+
+	// 没有输出任何内容就失败，两次都不保存回复
+	for range 2 {
+		text, result := readReply(t, s.Start(context.Background(), reserveReply(t, s)))
+		if text != "" || result.ErrCode != ReplyErrorGenerationFailed || result.MessageID != 0 {
+			t.Errorf("text = %q, result = %+v, want generation_failed", text, result)
+		}
+	}
+	// 失败的生成退回预留的额度
+	if status, _ := s.quotaService.Status(42); status.Messages != 0 {
+		t.Errorf("failed replies counted: %+v", status)
+	}
+
+	// 预设的错误用完后恢复正常
+	if _, result := readReply(t, s.Start(context.Background(), newReplyRequest())); result.ErrCode != "" {
+		t.Errorf("result after failures = %+v", result)
+	}
+	if got := len(fake.CallsOf(llm.FakeMethodChatStream)); got != 3 {
+		t.Errorf("calls = %d, want 3", got)
+	}
+}
+
+func TestReplyCanceled(t *testing.T) {
+	s, fake := newReplyTestService(t)
+	fake.Script(llm.FakeMethodChatStream, llm.FakeResponse{Text: "never sent", Delay: time.Minute})
+
+	g := s.Start(context.Background(), newReplyRequest())
+	g.Cancel()
+	_, result := readReply(t, g)
+	if result.ErrCode != ReplyErrorCanceled {
+		t.Errorf("result = %+v, want canceled", result)
+	}
+	if _, err := repository.NewMessageRepository().GetLatest(7); err == nil {
+		t.Errorf("canceled reply saved")
+	}
+}
+
+func TestReplyCanceledAfterOutput(t *testing.T) {
+	s, fake := newReplyTestService(t)
+	fake.StreamChunkSize = 6
+	fake.StreamInterval = time.Minute
+	fake.Script(llm.FakeMethodChatStream, llm.FakeResponse{Text: "Once upon a time"})
+
+	g := s.Start(context.Background(), reserveReply(t, s))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	first, offset, result, err := g.Next(ctx, 0)
+	if err != nil || first != "Once u" || result != nil {
+		t.Fatalf("first chunk = %q, %+v, %v", first, result, err)
+	}
+
+	// 输出过程中取消，保存已生成的部分并标记为 interrupted
+	if !s.CancelCharacter(42, 7) {
+		t.Fatal("CancelCharacter found no generation")
+	}
+	_, result = readReply(t, g)
+	if result.ErrCode != "" || !result.Interrupted || result.Reason != ReplyErrorCanceled || result.MessageID == 0 {
+		t.Fatalf("result = %+v", result)
+	}
+	reply, err := repository.NewMessageRepository().GetByID(7, result.MessageID)
+	if err != nil || !reply.Interrupted || reply.Content != first || offset != len(first) {
+		t.Errorf("reply = %+v (%v)", reply, err)
+	}
+	if result.Usage == nil || reply.CompletionTokens != result.Usage.CompletionTokens || reply.CompletionTokens == 0 {
+		t.Errorf("usage = %+v, reply tokens %d", result.Usage, reply.CompletionTokens)
+	}
+	// 部分回复计入当日额度
+	if status, _ := s.quotaService.Status(42); status.Messages != 1 {
+		t.Errorf("quota = %+v, want 1 message", status)
+	}
+	<-g.Done()
+	if active := s.Active(42); len(active) != 0 {
+		t.Errorf("active generations = %d after cancel", len(active))
+	}
+}
+
+func TestReplySaveFailure(t *testing.T) {
+	s, _ := newReplyTestService(t)
+	req := newReplyRequest()
+	req.Save = func(reply *model.Message) error { return errors.New("disk full") }
+
+	if _, result := readReply(t, s.Start(context.Background(), req)); result.ErrCode != ReplyErrorSaveFailed {
+		t.Errorf("result = %+v, want save_failed", result)
+	}
+}
@@ -5,12 +5,9 @@ import (
 	"fmt"
 	"log"
 	"strings"
-	"time"
 
-	"lauraai-backend/internal/config"
+	"lauraai-backend/internal/llm"
 	"lauraai-backend/internal/model"
-
-	"google.golang.org/genai"
 )
 
 // getBirthTimeString 安全获取出生时间字符串
@@ -53,39 +50,45 @@ type MultiLangReport struct {
 	WeaknessRu string
 }
 
-type GeminiReportService struct {
-	client *genai.Client
+// ApplyTo 将 7 项多语言报告内容写入角色
+func (report *MultiLangReport) ApplyTo(char *model.Character) {
+	char.DescriptionEn = report.DescriptionEn
+	char.DescriptionZh = report.DescriptionZh
+	char.DescriptionRu = report.DescriptionRu
+	char.CareerEn = report.CareerEn
+	char.CareerZh = report.CareerZh
+	char.CareerRu = report.CareerRu
+	char.PersonalityEn = report.PersonalityEn
+	char.PersonalityZh = report.PersonalityZh
+	char.PersonalityRu = report.PersonalityRu
+	char.MeetingTimeEn = report.MeetingTimeEn
+	char.MeetingTimeZh = report.MeetingTimeZh
+	char.MeetingTimeRu = report.MeetingTimeRu
+	char.DistanceEn = report.DistanceEn
+	char.DistanceZh = report.DistanceZh
+	char.DistanceRu = report.DistanceRu
+	char.StrengthEn = report.StrengthEn
+	char.StrengthZh = report.StrengthZh
+	char.StrengthRu = report.StrengthRu
+	char.WeaknessEn = report.WeaknessEn
+	char.WeaknessZh = report.WeaknessZh
+	char.WeaknessRu = report.WeaknessRu
 }
 
-func NewGeminiReportService() (*GeminiReportService, error) {
-	if config.AppConfig.GeminiAPIKey == "" {
-		if config.AppConfig.DevMode {
-			log.Println("开发模式: GEMINI_API_KEY 未配置，将使用模拟报告生成")
-			return &GeminiReportService{client: nil}, nil
-		}
-		return nil, fmt.Errorf("GEMINI_API_KEY not configured")
-	}
-
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey: config.AppConfig.GeminiAPIKey,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("Failed to create Gemini client: %v", err)
-	}
+// ReportService 角色多语言报告生成
+type ReportService struct {
+	model llm.TextModel
+}
 
-	return &GeminiReportService{client: client}, nil
+func NewReportService(model llm.TextModel) *ReportService {
+	return &ReportService{model: model}
 }
 
 // GenerateMultiLangReport 生成多语言报告
 // 策略：先生成英文版，再翻译成其他语言，提高稳定性
-func (s *GeminiReportService) GenerateMultiLangReport(ctx context.Context, user *model.User, character *model.Character) (*MultiLangReport, error) {
-	if s.client == nil {
-		log.Println("开发模式: 返回模拟多语言报告")
-		return s.getMockMultiLangReport(character), nil
-	}
-
+func (s *ReportService) GenerateMultiLangReport(ctx context.Context, user *model.User, character *model.Character) (*MultiLangReport, error) {
 	// 第一步：生成英文报告
+	reportStage(ctx, model.GenerationStageReportEn)
 	log.Println("[Report] 步骤1: 生成英文报告...")
 	englishReport, err := s.generateEnglishReport(ctx, user, character)
 	if err != nil {
@@ -95,6 +98,7 @@ func (s *GeminiReportService) GenerateMultiLangReport(ctx context.Context, user
 	log.Printf("[Report] 英文报告生成成功")
 
 	// 第二步：翻译成中文
+	reportStage(ctx, model.GenerationStageReportZh)
 	log.Println("[Report] 步骤2: 翻译成中文...")
 	zhReport, err := s.translateReport(ctx, englishReport, "Chinese (Simplified). Use very casual, down-to-earth, and plain language (大白话). Avoid formal or poetic words.")
 	if err != nil {
@@ -105,6 +109,7 @@ func (s *GeminiReportService) GenerateMultiLangReport(ctx context.Context, user
 	}
 
 	// 第三步：翻译成俄文
+	reportStage(ctx, model.GenerationStageReportRu)
 	log.Println("[Report] 步骤3: 翻译成俄文...")
 	ruReport, err := s.translateReport(ctx, englishReport, "Russian")
 	if err != nil {
@@ -151,8 +156,7 @@ type EnglishReport struct {
 }
 
 // generateEnglishReport 生成英文报告（纯文本，不要求 JSON）
-// 包含重试机制处理 429 错误
-func (s *GeminiReportService) generateEnglishReport(ctx context.Context, user *model.User, character *model.Character) (*EnglishReport, error) {
+func (s *ReportService) generateEnglishReport(ctx context.Context, user *model.User, character *model.Character) (*EnglishReport, error) {
 	prompt := fmt.Sprintf(`You are an expert astrologer, relationship counselor, and fortune teller. Generate a personalized compatibility report for a mystical app that predicts soulmates.
 
 User: %s, born on %s at %s in %s
@@ -192,41 +196,18 @@ IMPORTANT:
 		character.Gender, character.Type, character.Ethnicity, character.AstroSign,
 		character.Compatibility)
 
-	// 重试机制：最多重试3次，每次等待递增
-	var lastErr error
-	for attempt := 1; attempt <= 3; attempt++ {
-		resp, err := s.client.Models.GenerateContent(ctx, "gemini-2.0-flash", []*genai.Content{
-			{Role: "user", Parts: []*genai.Part{{Text: prompt}}},
-		}, &genai.GenerateContentConfig{Temperature: genai.Ptr(float32(0.85))})
-
-		if err != nil {
-			lastErr = err
-			// 检查是否是 429 错误
-			if strings.Contains(err.Error(), "429") || strings.Contains(err.Error(), "RESOURCE_EXHAUSTED") {
-				waitTime := time.Duration(attempt*5) * time.Second
-				log.Printf("[Report] API 限流，等待 %v 后重试 (尝试 %d/3)", waitTime, attempt)
-				time.Sleep(waitTime)
-				continue
-			}
-			return nil, fmt.Errorf("AI call failed: %v", err)
-		}
-
-		if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-			return nil, fmt.Errorf("empty response")
-		}
-
-		text := resp.Candidates[0].Content.Parts[0].Text
-		log.Printf("[Report] 英文原文长度: %d 字符", len(text))
-
-		// 解析7段文本
-		return s.parseEnglishReport(text), nil
+	text, err := s.model.GenerateText(ctx, prompt, 0.85)
+	if err != nil {
+		return nil, fmt.Errorf("AI call failed: %v", err)
 	}
+	log.Printf("[Report] 英文原文长度: %d 字符", len(text))
 
-	return nil, fmt.Errorf("AI call failed after 3 retries: %v", lastErr)
+	// 解析7段文本
+	return s.parseEnglishReport(text), nil
 }
 
 // parseEnglishReport 解析英文报告（按段落分割，支持7项）
-func (s *GeminiReportService) parseEnglishReport(text string) *EnglishReport {
+func (s *ReportService) parseEnglishReport(text string) *EnglishReport {
 	// 按空行分割
 	parts := strings.Split(text, "\n\n")
 
@@ -308,8 +289,7 @@ func (s *GeminiReportService) parseEnglishReport(text string) *EnglishReport {
 }
 
 // translateReport 翻译报告到目标语言（支持7项）
-// 包含重试机制处理 429 错误
-func (s *GeminiReportService) translateReport(ctx context.Context, english *EnglishReport, targetLang string) (*EnglishReport, error) {
+func (s *ReportService) translateReport(ctx context.Context, english *EnglishReport, targetLang string) (*EnglishReport, error) {
 	prompt := fmt.Sprintf(`Translate the following seven paragraphs to %s. Keep the same mystical tone and meaning. Output ONLY the translations, separated by blank lines. Do not include any labels or numbers.
 
 Paragraph 1 (Soul Connection Overview):
@@ -335,37 +315,15 @@ Paragraph 7 (Growth Opportunities):
 		english.Description, english.Career, english.Personality,
 		english.MeetingTime, english.Distance, english.Strength, english.Weakness)
 
-	// 重试机制
-	var lastErr error
-	for attempt := 1; attempt <= 3; attempt++ {
-		resp, err := s.client.Models.GenerateContent(ctx, "gemini-2.0-flash", []*genai.Content{
-			{Role: "user", Parts: []*genai.Part{{Text: prompt}}},
-		}, &genai.GenerateContentConfig{Temperature: genai.Ptr(float32(0.3))})
-
-		if err != nil {
-			lastErr = err
-			if strings.Contains(err.Error(), "429") || strings.Contains(err.Error(), "RESOURCE_EXHAUSTED") {
-				waitTime := time.Duration(attempt*3) * time.Second
-				log.Printf("[Report] 翻译API限流，等待 %v 后重试", waitTime)
-				time.Sleep(waitTime)
-				continue
-			}
-			return nil, fmt.Errorf("translation failed: %v", err)
-		}
-
-		if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-			return nil, fmt.Errorf("empty translation response")
-		}
-
-		text := resp.Candidates[0].Content.Parts[0].Text
-		return s.parseEnglishReport(text), nil
+	text, err := s.model.GenerateText(ctx, prompt, 0.3)
+	if err != nil {
+		return nil, fmt.Errorf("translation failed: %v", err)
 	}
-
-	return nil, fmt.Errorf("translation failed after 3 retries: %v", lastErr)
+	return s.parseEnglishReport(text), nil
 }
 
 // getMockTranslation 获取模拟翻译（7项）
-func (s *GeminiReportService) getMockTranslation(english *EnglishReport, lang string) *EnglishReport {
+func (s *ReportService) getMockTranslation(english *EnglishReport, lang string) *EnglishReport {
 	switch lang {
 	case "zh":
 		return &EnglishReport{
@@ -392,7 +350,7 @@ func (s *GeminiReportService) getMockTranslation(english *EnglishReport, lang st
 	}
 }
 
-func (s *GeminiReportService) getMockMultiLangReport(character *model.Character) *MultiLangReport {
+func (s *ReportService) getMockMultiLangReport(character *model.Character) *MultiLangReport {
 	return &MultiLangReport{
 		DescriptionEn: fmt.Sprintf("Based on your birth chart analysis, there is a deep soul resonance between you and this %s. Your energies create a beautiful harmony on a cosmic level, as if destined to meet.", character.AstroSign),
 		DescriptionZh: fmt.Sprintf("根据你的星盘分析，你与这位%s之间存在着深厚的灵魂共鸣。你们的能量在宇宙层面产生了美妙的和谐，仿佛命中注定的相遇。", character.AstroSign),
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+// JobTypeCharacterReport 生成角色的多语言报告
+const JobTypeCharacterReport = "character_report"
+
+// reportJobPayload 报告任务参数
+type reportJobPayload struct {
+	CharacterID uint64 `json:"character_id"`
+	UserID      uint64 `json:"user_id"`
+	Tag         string `json:"tag"` // 触发来源，用于日志
+}
+
+// ReportJobs 通过任务队列生成角色报告（解锁后补生成、手动重试）
+// 同一角色同时只会有一个报告任务
+type ReportJobs struct {
+	queue            *JobQueue
+	characterRepo    *repository.CharacterRepository
+	userRepo         *repository.UserRepository
+	subscriptionRepo *repository.SubscriptionRepository
+	reportService    *ReportService
+	generationGate   *GenerationGate
+	notifier         *Notifier
+}
+
+func NewReportJobs(queue *JobQueue, reportService *ReportService, generationGate *GenerationGate, notifier *Notifier) *ReportJobs {
+	r := &ReportJobs{
+		queue:            queue,
+		characterRepo:    repository.NewCharacterRepository(),
+		userRepo:         repository.NewUserRepository(),
+		subscriptionRepo: repository.NewSubscriptionRepository(),
+		reportService:    reportService,
+		generationGate:   generationGate,
+		notifier:         notifier,
+	}
+	queue.Register(JobTypeCharacterReport, r.handle)
+	return r
+}
+
+// Enqueue 将角色的报告生成加入队列
+func (r *ReportJobs) Enqueue(characterID uint64, userID uint64, tag string) error {
+	_, err := r.queue.Enqueue(JobTypeCharacterReport, reportJobPayload{
+		CharacterID: characterID,
+		UserID:      userID,
+		Tag:         tag,
+	}, EnqueueOptions{DedupKey: fmt.Sprintf("report:%d", characterID)})
+	return err
+}
+
+func (r *ReportJobs) handle(ctx context.Context, job *model.Job) error {
+	var payload reportJobPayload
+	if err := DecodePayload(job, &payload); err != nil {
+		return err
+	}
+	tag := payload.Tag
+
+	if r.reportService == nil {
+		return fmt.Errorf("report service not available")
+	}
+
+	// 重新获取最新数据
+	char, err := r.characterRepo.GetByID(payload.CharacterID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return PermanentError(fmt.Errorf("character %d not found", payload.CharacterID))
+	}
+	if err != nil {
+		return err
+	}
+
+	user, err := r.userRepo.GetByID(payload.UserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return PermanentError(fmt.Errorf("user %d not found", payload.UserID))
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, generationJobTimeout)
+	defer cancel()
+
+	// 占用 AI 生成名额，订阅用户优先
+	priority := GenerationPriorityNormal
+	if r.subscriptionRepo.IsActive(payload.UserID) {
+		priority = GenerationPriorityHigh
+	}
+	release, err := r.generationGate.Acquire(ctx, priority)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	log.Printf("[%s] 开始为角色 %d 生成报告...", tag, payload.CharacterID)
+	report, err := r.reportService.GenerateMultiLangReport(ctx, user, char)
+	if err != nil {
+		return err
+	}
+
+	report.ApplyTo(char)
+	if err := r.characterRepo.UpdateReport(char); err != nil {
+		return fmt.Errorf("failed to save report: %v", err)
+	}
+	log.Printf("[%s] 报告生成成功", tag)
+
+	if r.notifier != nil {
+		text := fmt.Sprintf("Your %s report is ready! Open the app to read it.", char.Title)
+		if err := r.notifier.Notify(char.UserID, text, fmt.Sprintf("report_ready:%d", char.ID)); err != nil {
+			log.Printf("[%s] 发送通知失败: %v", tag, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"lauraai-backend/internal/llm"
+	"lauraai-backend/internal/model"
+)
+
+func newReportTestInput() (*model.User, *model.Character) {
+	user := &model.User{Name: "Alice", BirthPlace: "Paris"}
+	character := &model.Character{Type: model.CharacterTypeSoulmate, Gender: "male", AstroSign: "Leo", Compatibility: 92}
+	return user, character
+}
+
+func TestGenerateMultiLangReport(t *testing.T) {
+	fake := llm.NewFake()
+	user, character := newReportTestInput()
+
+	report, err := NewReportService(fake).GenerateMultiLangReport(context.Background(), user, character)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	// 先生成英文，再分别翻译成中文和俄文
+	calls := fake.CallsOf(llm.FakeMethodText)
+	if len(calls) != 3 {
+		t.Fatalf("calls = %d, want 3", len(calls))
+	}
+	if !strings.Contains(calls[0].Prompt, "Alice") || !strings.Contains(calls[1].Prompt, "Chinese") || !strings.Contains(calls[2].Prompt, "Russian") {
+		t.Errorf("prompts = %q", []string{calls[0].Prompt, calls[1].Prompt, calls[2].Prompt})
+	}
+	if !strings.Contains(calls[1].Prompt, report.DescriptionEn) {
+		t.Errorf("translation prompt does not contain the English report")
+	}
+	if !strings.HasPrefix(report.DescriptionEn, "Fake paragraph 1") || !strings.HasPrefix(report.WeaknessEn, "Fake paragraph 7") {
+		t.Errorf("english report = %q / %q", report.DescriptionEn, report.WeaknessEn)
+	}
+	if report.DescriptionZh == report.DescriptionEn || report.DescriptionRu == report.DescriptionZh {
+		t.Errorf("translations = %q / %q", report.DescriptionZh, report.DescriptionRu)
+	}
+}
+
+func TestGenerateMultiLangReportFallback(t *testing.T) {
+	user, character := newReportTestInput()
+
+	// 英文报告生成失败时整份使用模拟报告，不再翻译
+	fake := llm.NewFake()
+	fake.FailNext(llm.FakeMethodText, llm.ErrFakeRateLimited)
+	report, err := NewReportService(fake).GenerateMultiLangReport(context.Background(), user, character)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if got := len(fake.CallsOf(llm.FakeMethodText)); got != 1 {
+		t.Errorf("calls = %d, want 1", got)
+	}
+	if !strings.Contains(report.DescriptionEn, "Leo") {
+		t.Errorf("mock report = %q", report.DescriptionEn)
+	}
+
+	// 某种语言翻译失败时只有该语言使用模拟翻译
+	fake = llm.NewFake()
+	fake.Script(llm.FakeMethodText, llm.FakeResponse{Text: "One.\n\nTwo.\n\nThree.\n\nFour.\n\nFive.\n\nSix.\n\nSeven."}, llm.FakeResponse{Err: llm.ErrFakeEOF})
+	report, err = NewReportService(fake).GenerateMultiLangReport(context.Background(), user, character)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if report.DescriptionEn != "One." || report.WeaknessEn != "Seven." {
+		t.Errorf("english report = %+v", report)
+	}
+	if mock := NewReportService(nil).getMockTranslation(&EnglishReport{}, "zh"); report.DescriptionZh != mock.Description {
+		t.Errorf("zh = %q, want mock translation", report.DescriptionZh)
+	}
+	if !strings.HasPrefix(report.DescriptionRu, "Fake paragraph 1") {
+		t.Errorf("ru = %q", report.DescriptionRu)
+	}
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"lauraai-backend/internal/config"
+)
+
+// StarsCurrency Telegram Stars 的货币代码
+const StarsCurrency = "XTR"
+
+// TelegramBotClient 封装 Telegram Bot API 调用
+// baseURL 可配置，测试时可以指向本地模拟的 Bot API 服务器
+type TelegramBotClient struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+func NewTelegramBotClient() *TelegramBotClient {
+	token := strings.TrimSpace(config.AppConfig.TelegramBotToken)
+	token = strings.Trim(token, `"'`)
+
+	return &TelegramBotClient{
+		baseURL:    strings.TrimRight(config.AppConfig.TelegramAPIBaseURL, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// LabeledPrice 价格条目（Stars 支付只允许一项）
+type LabeledPrice struct {
+	Label  string `json:"label"`
+	Amount int    `json:"amount"`
+}
+
+// InvoiceLinkRequest createInvoiceLink 请求参数
+type InvoiceLinkRequest struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Payload     string         `json:"payload"`
+	Currency    string         `json:"currency"`
+	Prices      []LabeledPrice `json:"prices"`
+	// Stars 支付时 provider_token 必须为空字符串
+	ProviderToken string `json:"provider_token"`
+	// 订阅周期（秒），目前 Telegram 只支持 30 天；为 0 表示一次性支付
+	SubscriptionPeriod int `json:"subscription_period,omitempty"`
+}
+
+// StarSubscriptionPeriod Stars 订阅的固定周期（30 天）
+const StarSubscriptionPeriod = 30 * 24 * 60 * 60
+
+// botAPIResponse Bot API 统一响应结构
+type botAPIResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	ErrorCode   int             `json:"error_code,omitempty"`
+	Description string          `json:"description,omitempty"`
+}
+
+// call 调用 Bot API 方法，result 为 nil 时忽略返回值
+func (c *TelegramBotClient) call(ctx context.Context, method string, payload interface{}, result interface{}) error {
+	if c.token == "" {
+		return fmt.Errorf("TELEGRAM_BOT_TOKEN not configured")
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s request: %v", method, err)
+	}
+
+	url := fmt.Sprintf("%s/bot%s/%s", c.baseURL, c.token, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %v", method, err)
+	}
+	defer resp.Body.Close()
+
+	var apiResp botAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return fmt.Errorf("failed to decode %s response (status %d): %v", method, resp.StatusCode, err)
+	}
+	if !apiResp.OK {
+		return fmt.Errorf("%s failed: %d %s", method, apiResp.ErrorCode, apiResp.Description)
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(apiResp.Result, result); err != nil {
+			return fmt.Errorf("failed to decode %s result: %v", method, err)
+		}
+	}
+	return nil
+}
+
+// CreateInvoiceLink 创建支付链接，前端通过 WebApp.openInvoice 打开
+func (c *TelegramBotClient) CreateInvoiceLink(ctx context.Context, req InvoiceLinkRequest) (string, error) {
+	var link string
+	if err := c.call(ctx, "createInvoiceLink", req, &link); err != nil {
+		return "", err
+	}
+	return link, nil
+}
+
+// AnswerPreCheckoutQuery 响应支付前确认，必须在 10 秒内完成
+func (c *TelegramBotClient) AnswerPreCheckoutQuery(ctx context.Context, queryID string, ok bool, errorMessage string) error {
+	payload := map[string]interface{}{
+		"pre_checkout_query_id": queryID,
+		"ok":                    ok,
+	}
+	if !ok {
+		payload["error_message"] = errorMessage
+	}
+	return c.call(ctx, "answerPreCheckoutQuery", payload, nil)
+}
+
+// AnswerInlineQuery 发送 inline query 响应
+func (c *TelegramBotClient) AnswerInlineQuery(ctx context.Context, queryID string, results []interface{}, cacheTime int, isPersonal bool) error {
+	payload := map[string]interface{}{
+		"inline_query_id": queryID,
+		"results":         results,
+		"cache_time":      cacheTime,
+		"is_personal":     isPersonal,
+	}
+	return c.call(ctx, "answerInlineQuery", payload, nil)
+}
+
+// RefundStarPayment 退还一笔 Stars 支付
+func (c *TelegramBotClient) RefundStarPayment(ctx context.Context, userTelegramID int64, chargeID string) error {
+	payload := map[string]interface{}{
+		"user_id":                    userTelegramID,
+		"telegram_payment_charge_id": chargeID,
+	}
+	return c.call(ctx, "refundStarPayment", payload, nil)
+}
+
+// EditUserStarSubscription 取消或恢复用户的 Stars 订阅自动续费
+func (c *TelegramBotClient) EditUserStarSubscription(ctx context.Context, userTelegramID int64, chargeID string, isCanceled bool) error {
+	payload := map[string]interface{}{
+		"user_id":                    userTelegramID,
+		"telegram_payment_charge_id": chargeID,
+		"is_canceled":                isCanceled,
+	}
+	return c.call(ctx, "editUserStarSubscription", payload, nil)
+}
+
+// SendMessage 向用户发送文本消息（用户需要先与 Bot 开始过对话）
+func (c *TelegramBotClient) SendMessage(ctx context.Context, chatID int64, text string) error {
+	payload := map[string]interface{}{
+		"chat_id": chatID,
+		"text":    text,
+	}
+	return c.call(ctx, "sendMessage", payload, nil)
+}
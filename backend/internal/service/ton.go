@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"lauraai-backend/internal/config"
+)
+
+// NanoTonPerTon 1 TON = 10^9 nanoTON
+const NanoTonPerTon int64 = 1_000_000_000
+
+// ErrTonPaymentNotFound 在链上没有找到匹配的转账
+var ErrTonPaymentNotFound = errors.New("ton payment not found")
+
+// tonScanSlack 向前多扫描的时间，容忍服务器与链上时间的偏差
+const tonScanSlack = 10 * time.Minute
+
+// TonTransaction 钱包的一笔链上交易，Source 为空表示不是外部转入（例如转出）
+type TonTransaction struct {
+	Hash      string
+	LT        string
+	Utime     int64
+	Source    string
+	ValueNano int64
+	Comment   string
+}
+
+// TonChainAPI 查询链上交易的接口
+// 生产环境使用 ToncenterClient，测试时可以替换为本地模拟实现
+type TonChainAPI interface {
+	// GetTransactions 返回地址的交易（按时间倒序）
+	// lt、hash 为空时从最新的交易开始，否则从该交易（包含）开始向更早的交易翻页
+	GetTransactions(ctx context.Context, address string, limit int, lt string, hash string) ([]TonTransaction, error)
+}
+
+// ToncenterClient toncenter v2 兼容的 HTTP API 客户端
+type ToncenterClient struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+func NewToncenterClient() *ToncenterClient {
+	return &ToncenterClient{
+		baseURL:    strings.TrimRight(config.AppConfig.TonAPIBaseURL, "/"),
+		apiKey:     config.AppConfig.TonAPIKey,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// toncenterTransactionsResponse getTransactions 响应结构
+type toncenterTransactionsResponse struct {
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+	Result []struct {
+		Utime         int64 `json:"utime"`
+		TransactionID struct {
+			LT   string `json:"lt"`
+			Hash string `json:"hash"`
+		} `json:"transaction_id"`
+		InMsg *struct {
+			Source  string `json:"source"`
+			Value   string `json:"value"`
+			Message string `json:"message"`
+		} `json:"in_msg"`
+	} `json:"result"`
+}
+
+func (c *ToncenterClient) GetTransactions(ctx context.Context, address string, limit int, lt string, hash string) ([]TonTransaction, error) {
+	query := url.Values{}
+	query.Set("address", address)
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("archival", "true")
+	if lt != "" && hash != "" {
+		query.Set("lt", lt)
+		query.Set("hash", hash)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/getTransactions?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("getTransactions request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var apiResp toncenterTransactionsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return nil, fmt.Errorf("failed to decode getTransactions response (status %d): %v", resp.StatusCode, err)
+	}
+	if !apiResp.OK {
+		return nil, fmt.Errorf("getTransactions failed: %s", apiResp.Error)
+	}
+
+	// 保留所有交易作为翻页游标，只有外部钱包转入的消息才填写转账信息
+	transactions := make([]TonTransaction, 0, len(apiResp.Result))
+	for _, tx := range apiResp.Result {
+		transaction := TonTransaction{
+			Hash:  tx.TransactionID.Hash,
+			LT:    tx.TransactionID.LT,
+			Utime: tx.Utime,
+		}
+		if tx.InMsg != nil && tx.InMsg.Source != "" {
+			if value, err := strconv.ParseInt(tx.InMsg.Value, 10, 64); err == nil {
+				transaction.Source = tx.InMsg.Source
+				transaction.ValueNano = value
+				transaction.Comment = strings.TrimSpace(tx.InMsg.Message)
+			}
+		}
+		transactions = append(transactions, transaction)
+	}
+	return transactions, nil
+}
+
+// TonPaymentVerifier 通过备注(comment)和金额匹配钱包收到的转账
+type TonPaymentVerifier struct {
+	chain      TonChainAPI
+	wallet     string
+	memoSecret string
+	scanLimit  int // 每页交易数
+}
+
+func NewTonPaymentVerifier(chain TonChainAPI) *TonPaymentVerifier {
+	return &TonPaymentVerifier{
+		chain:      chain,
+		wallet:     strings.TrimSpace(config.AppConfig.TonWalletAddress),
+		memoSecret: config.AppConfig.TonMemoSecret,
+		scanLimit:  50,
+	}
+}
+
+// Enabled 是否配置了收款钱包
+func (v *TonPaymentVerifier) Enabled() bool {
+	return v.wallet != ""
+}
+
+// Wallet 收款钱包地址
+func (v *TonPaymentVerifier) Wallet() string {
+	return v.wallet
+}
+
+// PaymentMemo 生成某笔支付专属的转账备注，备注保存在支付记录中，更换密钥不影响已创建的支付
+func (v *TonPaymentVerifier) PaymentMemo(paymentID uint64) string {
+	data := fmt.Sprintf("ton-payment:%d", paymentID)
+	sum := hmacSHA256([]byte(data), []byte(v.memoSecret))
+	return "LAURA-" + strings.ToUpper(hex.EncodeToString(sum)[:10])
+}
+
+// PaymentLink 生成 ton:// 转账链接，钱包打开后自动填写金额和备注
+func (v *TonPaymentVerifier) PaymentLink(memo string, amountNano int64) string {
+	query := url.Values{}
+	query.Set("amount", strconv.FormatInt(amountNano, 10))
+	query.Set("text", memo)
+	return fmt.Sprintf("ton://transfer/%s?%s", v.wallet, query.Encode())
+}
+
+// FindPayment 从最新的交易向前翻页，查找备注匹配且金额足够的转账，扫描到 since（支付创建时间）之前为止
+func (v *TonPaymentVerifier) FindPayment(ctx context.Context, memo string, amountNano int64, since time.Time) (*TonTransaction, error) {
+	if !v.Enabled() {
+		return nil, fmt.Errorf("TON_WALLET_ADDRESS not configured")
+	}
+
+	oldest := since.Add(-tonScanSlack).Unix()
+	var lt, hash string
+	for {
+		transactions, err := v.chain.GetTransactions(ctx, v.wallet, v.scanLimit, lt, hash)
+		if err != nil {
+			return nil, err
+		}
+		// 从游标开始的一页包含游标交易本身
+		if lt != "" && len(transactions) > 0 && transactions[0].LT == lt && transactions[0].Hash == hash {
+			transactions = transactions[1:]
+		}
+		if len(transactions) == 0 {
+			return nil, ErrTonPaymentNotFound
+		}
+
+		for _, tx := range transactions {
+			if tx.Source != "" && tx.Comment == memo && tx.ValueNano >= amountNano {
+				found := tx
+				return &found, nil
+			}
+		}
+
+		last := transactions[len(transactions)-1]
+		if last.Utime < oldest {
+			return nil, ErrTonPaymentNotFound
+		}
+		lt, hash = last.LT, last.Hash
+	}
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"lauraai-backend/internal/config"
+)
+
+// stubChain 按时间倒序保存交易的模拟链，按 toncenter 的游标语义翻页
+type stubChain struct {
+	transactions []TonTransaction
+	pages        int
+}
+
+func (s *stubChain) GetTransactions(ctx context.Context, address string, limit int, lt string, hash string) ([]TonTransaction, error) {
+	s.pages++
+	start := 0
+	if lt != "" {
+		start = -1
+		for i, tx := range s.transactions {
+			if tx.LT == lt && tx.Hash == hash {
+				start = i
+				break
+			}
+		}
+		if start < 0 {
+			return nil, fmt.Errorf("unknown cursor %s:%s", lt, hash)
+		}
+	}
+	end := min(start+limit, len(s.transactions))
+	return s.transactions[start:end], nil
+}
+
+// newStubChain 生成 n 笔按时间倒序、每分钟一笔的普通转入交易
+func newStubChain(n int, newest time.Time) *stubChain {
+	chain := &stubChain{}
+	for i := 0; i < n; i++ {
+		chain.transactions = append(chain.transactions, TonTransaction{
+			Hash:      fmt.Sprintf("hash-%d", i),
+			LT:        strconv.Itoa(1_000_000 - i),
+			Utime:     newest.Add(-time.Duration(i) * time.Minute).Unix(),
+			Source:    "EQsender",
+			ValueNano: NanoTonPerTon,
+			Comment:   fmt.Sprintf("other-%d", i),
+		})
+	}
+	return chain
+}
+
+func newTestVerifier(chain TonChainAPI) *TonPaymentVerifier {
+	config.LoadConfig()
+	config.AppConfig.TonWalletAddress = "EQwallet"
+	config.AppConfig.TonMemoSecret = "memo-secret"
+	verifier := NewTonPaymentVerifier(chain)
+	verifier.scanLimit = 10
+	return verifier
+}
+
+func TestFindPaymentPaginates(t *testing.T) {
+	now := time.Now()
+	chain := newStubChain(120, now)
+	// 目标转账在第 8 页，早于最近 50 笔
+	chain.transactions[75].Comment = "LAURA-MEMO"
+	chain.transactions[75].ValueNano = 2 * NanoTonPerTon
+
+	verifier := newTestVerifier(chain)
+	since := time.Unix(chain.transactions[80].Utime, 0)
+	tx, err := verifier.FindPayment(context.Background(), "LAURA-MEMO", 2*NanoTonPerTon, since)
+	if err != nil {
+		t.Fatalf("FindPayment: %v", err)
+	}
+	if tx.Hash != "hash-75" {
+		t.Errorf("found %s, want hash-75", tx.Hash)
+	}
+}
+
+func TestFindPaymentStopsAtCreationTime(t *testing.T) {
+	now := time.Now()
+	chain := newStubChain(200, now)
+	// 支付创建之前的同名备注不算（不应该翻到那么早）
+	chain.transactions[150].Comment = "LAURA-MEMO"
+
+	verifier := newTestVerifier(chain)
+	since := now.Add(-30 * time.Minute)
+	_, err := verifier.FindPayment(context.Background(), "LAURA-MEMO", 1, since)
+	if !errors.Is(err, ErrTonPaymentNotFound) {
+		t.Fatalf("err = %v, want ErrTonPaymentNotFound", err)
+	}
+	// 30 分钟加上 10 分钟余量约 40 笔，每页 10 笔（翻页后 9 笔新交易）
+	if chain.pages > 6 {
+		t.Errorf("scanned %d pages, should stop shortly after creation time", chain.pages)
+	}
+}
+
+func TestFindPaymentMatching(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name  string
+		tx    TonTransaction
+		found bool
+	}{
+		{name: "exact", tx: TonTransaction{Source: "EQsender", ValueNano: 100, Comment: "LAURA-MEMO"}, found: true},
+		{name: "overpaid", tx: TonTransaction{Source: "EQsender", ValueNano: 150, Comment: "LAURA-MEMO"}, found: true},
+		{name: "underpaid", tx: TonTransaction{Source: "EQsender", ValueNano: 99, Comment: "LAURA-MEMO"}},
+		{name: "wrong memo", tx: TonTransaction{Source: "EQsender", ValueNano: 100, Comment: "LAURA-OTHER"}},
+		{name: "outgoing", tx: TonTransaction{ValueNano: 100, Comment: "LAURA-MEMO"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.tx.Hash, tt.tx.LT, tt.tx.Utime = "h", "1", now.Unix()
+			verifier := newTestVerifier(&stubChain{transactions: []TonTransaction{tt.tx}})
+			_, err := verifier.FindPayment(context.Background(), "LAURA-MEMO", 100, now)
+			if found := err == nil; found != tt.found {
+				t.Fatalf("found = %v (err %v), want %v", found, err, tt.found)
+			}
+		})
+	}
+}
+
+func TestPaymentMemoUsesDedicatedSecret(t *testing.T) {
+	verifier := newTestVerifier(nil)
+	memo := verifier.PaymentMemo(42)
+	if memo != verifier.PaymentMemo(42) || memo == verifier.PaymentMemo(43) {
+		t.Fatalf("memo must be stable per payment and unique across payments")
+	}
+
+	config.AppConfig.TelegramBotToken = "another-token"
+	if again := NewTonPaymentVerifier(nil).PaymentMemo(42); again != memo {
+		t.Errorf("memo depends on bot token")
+	}
+	config.AppConfig.TonMemoSecret = "rotated"
+	if rotated := NewTonPaymentVerifier(nil).PaymentMemo(42); rotated == memo {
+		t.Errorf("memo does not depend on TON_MEMO_SECRET")
+	}
+}
+
+func TestToncenterGetTransactions(t *testing.T) {
+	var gotQuery map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/getTransactions" || r.Header.Get("X-API-Key") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"ok":false,"error":"unauthorized"}`)
+			return
+		}
+		gotQuery = map[string]string{}
+		for k := range r.URL.Query() {
+			gotQuery[k] = r.URL.Query().Get(k)
+		}
+		io.WriteString(w, `{"ok":true,"result":[
+			{"utime":1700000100,"transaction_id":{"lt":"200","hash":"in"},"in_msg":{"source":"EQsender","value":"1500000000","message":" LAURA-MEMO "}},
+			{"utime":1700000000,"transaction_id":{"lt":"100","hash":"out"},"in_msg":{"source":"","value":"0","message":""}}
+		]}`)
+	}))
+	defer server.Close()
+
+	config.LoadConfig()
+	config.AppConfig.TonAPIBaseURL = server.URL
+	config.AppConfig.TonAPIKey = "key"
+	client := NewToncenterClient()
+
+	transactions, err := client.GetTransactions(context.Background(), "EQwallet", 10, "300", "cursor")
+	if err != nil {
+		t.Fatalf("GetTransactions: %v", err)
+	}
+	if gotQuery["lt"] != "300" || gotQuery["hash"] != "cursor" || gotQuery["limit"] != "10" || gotQuery["address"] != "EQwallet" {
+		t.Errorf("query = %v", gotQuery)
+	}
+	if len(transactions) != 2 {
+		t.Fatalf("got %d transactions, want 2 (outgoing kept as cursor)", len(transactions))
+	}
+	in, out := transactions[0], transactions[1]
+	if in.Comment != "LAURA-MEMO" || in.ValueNano != 1_500_000_000 || in.Source != "EQsender" {
+		t.Errorf("incoming = %+v", in)
+	}
+	if out.Source != "" || out.LT != "100" || out.Hash != "out" {
+		t.Errorf("outgoing = %+v", out)
+	}
+
+	if _, err := client.GetTransactions(context.Background(), "EQwallet", 10, "", ""); err != nil {
+		t.Fatalf("first page: %v", err)
+	}
+	if _, ok := gotQuery["lt"]; ok {
+		t.Errorf("first page should not send a cursor: %v", gotQuery)
+	}
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"lauraai-backend/internal/config"
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidUnlockTransition 当前解锁状态不允许转换到目标状态
+var ErrInvalidUnlockTransition = errors.New("invalid unlock transition")
+
+// ErrAlreadyHelped 助力者已经帮助过该用户
+var ErrAlreadyHelped = errors.New("already helped this owner")
+
+// allowedUnlockTransitions 允许的解锁状态转换
+// 退款时从完全解锁回退到支付前的状态（未解锁或半解锁）
+var allowedUnlockTransitions = map[model.UnlockStatus][]model.UnlockStatus{
+	model.UnlockStatusLocked:       {model.UnlockStatusHalfUnlocked, model.UnlockStatusFullUnlocked},
+	model.UnlockStatusHalfUnlocked: {model.UnlockStatusFullUnlocked},
+	model.UnlockStatusFullUnlocked: {model.UnlockStatusLocked, model.UnlockStatusHalfUnlocked},
+}
+
+// CanTransition 是否允许从 from 转换到 to
+func CanTransition(from, to model.UnlockStatus) bool {
+	for _, allowed := range allowedUnlockTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// UnlockTransition 一次解锁状态转换请求
+type UnlockTransition struct {
+	CharacterID uint64
+	To          model.UnlockStatus
+	ActorType   model.UnlockActorType
+	ActorID     *uint64
+	Reason      string
+	PaymentID   *uint64
+	// 助力解锁时记录首位助力者
+	HelperID *uint64
+}
+
+// UnlockStateMachine 角色解锁状态的唯一修改入口
+// 每次转换都在事务中锁定角色行、校验转换是否合法并写入 UnlockEvent
+type UnlockStateMachine struct{}
+
+func NewUnlockStateMachine() *UnlockStateMachine {
+	return &UnlockStateMachine{}
+}
+
+// Transition 在新事务中执行状态转换
+func (m *UnlockStateMachine) Transition(t UnlockTransition) (*model.Character, error) {
+	var character *model.Character
+	err := repository.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		character, err = m.TransitionTx(tx, t)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return character, nil
+}
+
+// TransitionTx 在调用方的事务中执行状态转换
+func (m *UnlockStateMachine) TransitionTx(tx *gorm.DB, t UnlockTransition) (*model.Character, error) {
+	var character model.Character
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&character, t.CharacterID).Error; err != nil {
+		return nil, err
+	}
+	if err := m.applyTransition(tx, &character, t); err != nil {
+		return nil, err
+	}
+	return &character, nil
+}
+
+// applyTransition 对已加锁的角色执行状态转换并写入审计记录
+func (m *UnlockStateMachine) applyTransition(tx *gorm.DB, character *model.Character, t UnlockTransition) error {
+	from := character.UnlockStatus
+	if !CanTransition(from, t.To) {
+		return fmt.Errorf("%w: character %d from %d to %d", ErrInvalidUnlockTransition, character.ID, from, t.To)
+	}
+
+	character.UnlockStatus = t.To
+	character.ImageURL = character.GetDisplayImageURL()
+	updates := map[string]interface{}{
+		"unlock_status": character.UnlockStatus,
+		"image_url":     character.ImageURL,
+	}
+	if t.HelperID != nil && character.UnlockHelperID == nil {
+		character.UnlockHelperID = t.HelperID
+		updates["unlock_helper_id"] = *t.HelperID
+	}
+	if err := tx.Model(character).Updates(updates).Error; err != nil {
+		return err
+	}
+
+	event := &model.UnlockEvent{
+		CharacterID: character.ID,
+		FromStatus:  from,
+		ToStatus:    t.To,
+		ActorType:   t.ActorType,
+		ActorID:     t.ActorID,
+		Reason:      t.Reason,
+		PaymentID:   t.PaymentID,
+	}
+	return tx.Create(event).Error
+}
+
+// HelpUnlockPolicy 好友助力解锁阈值
+type HelpUnlockPolicy struct {
+	HalfThreshold int // 达到该人数半解锁
+	FullThreshold int // 达到该人数完全解锁，0 表示助力不能完全解锁
+}
+
+// DefaultHelpUnlockPolicy 从配置读取助力阈值
+func DefaultHelpUnlockPolicy() HelpUnlockPolicy {
+	return HelpUnlockPolicy{
+		HalfThreshold: config.AppConfig.HelpHalfThreshold,
+		FullThreshold: config.AppConfig.HelpFullThreshold,
+	}
+}
+
+// StatusForHelpers 助力人数对应的解锁状态
+func (p HelpUnlockPolicy) StatusForHelpers(helpers int64) model.UnlockStatus {
+	switch {
+	case p.FullThreshold > 0 && helpers >= int64(p.FullThreshold):
+		return model.UnlockStatusFullUnlocked
+	case helpers >= int64(p.HalfThreshold):
+		return model.UnlockStatusHalfUnlocked
+	default:
+		return model.UnlockStatusLocked
+	}
+}
+
+// Required 助力能达到的最终阶段所需人数
+func (p HelpUnlockPolicy) Required() int {
+	if p.FullThreshold > 0 {
+		return p.FullThreshold
+	}
+	return p.HalfThreshold
+}
+
+// HelpResult 一次助力的结果
+type HelpResult struct {
+	Character *model.Character
+	Helpers   int64 // 包括本次在内的助力人数
+	Changed   bool  // 本次助力是否推进了解锁阶段
+}
+
+// ApplyHelp 记录一次好友助力，助力人数达到阈值时推进解锁状态
+// 在角色行锁内检查并写入助力记录，并发助力不会重复计数或跳过阶段
+func (m *UnlockStateMachine) ApplyHelp(characterID, helperID uint64, policy HelpUnlockPolicy) (*HelpResult, error) {
+	result := &HelpResult{}
+	err := repository.DB.Transaction(func(tx *gorm.DB) error {
+		var character model.Character
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&character, characterID).Error; err != nil {
+			return err
+		}
+		result.Character = &character
+
+		if character.UnlockStatus == model.UnlockStatusFullUnlocked {
+			return fmt.Errorf("%w: character %d already fully unlocked", ErrInvalidUnlockTransition, character.ID)
+		}
+
+		helped, err := repository.HasHelpedOwnerTx(tx, helperID, character.UserID)
+		if err != nil {
+			return err
+		}
+		if helped {
+			return ErrAlreadyHelped
+		}
+
+		help := &model.UnlockHelp{CharacterID: character.ID, OwnerID: character.UserID, HelperID: helperID}
+		if err := tx.Create(help).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return ErrAlreadyHelped
+			}
+			return err
+		}
+
+		result.Helpers, err = repository.CountUnlockHelpsTx(tx, character.ID)
+		if err != nil {
+			return err
+		}
+
+		target := policy.StatusForHelpers(result.Helpers)
+		if target <= character.UnlockStatus {
+			return nil
+		}
+		result.Changed = true
+		return m.applyTransition(tx, &character, UnlockTransition{
+			To:        target,
+			ActorType: model.UnlockActorHelper,
+			ActorID:   &helperID,
+			Reason:    fmt.Sprintf("friend help %d/%d", result.Helpers, policy.Required()),
+			HelperID:  &helperID,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Refund 将已成功的支付标记为退款，并在同一事务中把角色恢复到支付前的解锁状态
+// refundFn 在事务外调用（例如调用 Telegram 退款接口），不在持有行锁时等待外部请求，返回错误则不做任何修改；
+// 为 nil 表示退款已在外部完成（例如 Telegram 推送的 refunded_payment）
+func (m *UnlockStateMachine) Refund(paymentID uint64, reason string, actorType model.UnlockActorType, refundFn func(payment *model.Payment) error) (*model.Payment, *model.Character, error) {
+	if refundFn != nil {
+		payment, err := repository.NewPaymentRepository().GetByID(paymentID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if payment.Status != model.PaymentStatusSucceeded {
+			return nil, nil, fmt.Errorf("%w: payment %d is %s", repository.ErrPaymentNotRefundable, payment.ID, payment.Status)
+		}
+		if err := refundFn(payment); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var payment model.Payment
+	var character *model.Character
+	err := repository.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, paymentID).Error; err != nil {
+			return err
+		}
+		// 外部退款期间 Telegram 推送的 refunded_payment 已经记录了这次退款
+		if refundFn != nil && payment.Status == model.PaymentStatusRefunded {
+			character = &model.Character{}
+			return tx.First(character, payment.CharacterID).Error
+		}
+		if payment.Status != model.PaymentStatusSucceeded {
+			return fmt.Errorf("%w: payment %d is %s", repository.ErrPaymentNotRefundable, payment.ID, payment.Status)
+		}
+
+		now := time.Now()
+		payment.Status = model.PaymentStatusRefunded
+		payment.RefundedAt = &now
+		payment.RefundReason = reason
+		if err := tx.Save(&payment).Error; err != nil {
+			return err
+		}
+		if err := repository.ReleasePromoTx(tx, payment.ID); err != nil {
+			return err
+		}
+
+		// 只回退由这笔支付带来的完全解锁
+		paymentRef := payment.ID
+		var err error
+		character, err = m.TransitionTx(tx, UnlockTransition{
+			CharacterID: payment.CharacterID,
+			To:          payment.PreviousUnlockStatus,
+			ActorType:   actorType,
+			Reason:      "refund: " + reason,
+			PaymentID:   &paymentRef,
+		})
+		if errors.Is(err, ErrInvalidUnlockTransition) {
+			// 角色已不是完全解锁状态，只记录退款
+			character = &model.Character{}
+			return tx.First(character, payment.CharacterID).Error
+		}
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &payment, character, nil
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"lauraai-backend/internal/model"
+	"lauraai-backend/internal/repository"
+	"lauraai-backend/internal/repository/repotest"
+)
+
+// createUnlockTestCharacter 创建用户和指定解锁状态的角色
+func createUnlockTestCharacter(t *testing.T, status model.UnlockStatus) *model.Character {
+	t.Helper()
+	owner := createUnlockTestUser(t, 1)
+	character := &model.Character{UserID: owner.ID, Type: model.CharacterTypeSoulmate, Title: "Soulmate", UnlockStatus: status}
+	if err := repository.DB.Create(character).Error; err != nil {
+		t.Fatalf("create character: %v", err)
+	}
+	return character
+}
+
+func createUnlockTestUser(t *testing.T, telegramID int64) *model.User {
+	t.Helper()
+	user := &model.User{TelegramID: telegramID, Name: fmt.Sprintf("user%d", telegramID), InviteCode: repository.GenerateInviteCode()}
+	if err := repository.DB.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+// unlockEvents 按顺序返回角色的解锁审计记录
+func unlockEvents(t *testing.T, characterID uint64) []model.UnlockEvent {
+	t.Helper()
+	var events []model.UnlockEvent
+	if err := repository.DB.Where("character_id = ?", characterID).Order("id").Find(&events).Error; err != nil {
+		t.Fatalf("load events: %v", err)
+	}
+	return events
+}
+
+func TestCanTransition(t *testing.T) {
+	locked, half, full := model.UnlockStatusLocked, model.UnlockStatusHalfUnlocked, model.UnlockStatusFullUnlocked
+	tests := []struct {
+		from, to model.UnlockStatus
+		want     bool
+	}{
+		{locked, locked, false},
+		{locked, half, true},
+		{locked, full, true},
+		{half, locked, false},
+		{half, half, false},
+		{half, full, true},
+		// 退款回退到支付前的状态
+		{full, locked, true},
+		{full, half, true},
+		{full, full, false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%d, %d) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestTransition(t *testing.T) {
+	repotest.Open(t)
+	m := NewUnlockStateMachine()
+	character := createUnlockTestCharacter(t, model.UnlockStatusLocked)
+	paymentID := uint64(99)
+
+	updated, err := m.Transition(UnlockTransition{
+		CharacterID: character.ID,
+		To:          model.UnlockStatusFullUnlocked,
+		ActorType:   model.UnlockActorPayment,
+		Reason:      "paid",
+		PaymentID:   &paymentID,
+	})
+	if err != nil {
+		t.Fatalf("Transition: %v", err)
+	}
+	if updated.UnlockStatus != model.UnlockStatusFullUnlocked {
+		t.Errorf("unlock status = %d", updated.UnlockStatus)
+	}
+	events := unlockEvents(t, character.ID)
+	if len(events) != 1 || events[0].FromStatus != model.UnlockStatusLocked || events[0].ToStatus != model.UnlockStatusFullUnlocked ||
+		events[0].ActorType != model.UnlockActorPayment || events[0].PaymentID == nil || *events[0].PaymentID != paymentID {
+		t.Errorf("events = %+v", events)
+	}
+
+	// 不允许的转换不修改状态也不写审计记录
+	_, err = m.Transition(UnlockTransition{CharacterID: character.ID, To: model.UnlockStatusFullUnlocked, ActorType: model.UnlockActorPayment})
+	if !errors.Is(err, ErrInvalidUnlockTransition) {
+		t.Errorf("repeated transition err = %v, want ErrInvalidUnlockTransition", err)
+	}
+	if events := unlockEvents(t, character.ID); len(events) != 1 {
+		t.Errorf("rejected transition wrote an event: %+v", events)
+	}
+}
+
+func TestApplyHelpConcurrentSameHelper(t *testing.T) {
+	repotest.Open(t)
+	m := NewUnlockStateMachine()
+	character := createUnlockTestCharacter(t, model.UnlockStatusLocked)
+	helper := createUnlockTestUser(t, 2)
+	policy := HelpUnlockPolicy{HalfThreshold: 1, FullThreshold: 0}
+
+	// 同一位好友并发助力多次，只记录一次
+	const attempts = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, attempts)
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.ApplyHelp(character.ID, helper.ID, policy)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrAlreadyHelped):
+			t.Errorf("ApplyHelp: %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("succeeded = %d, want 1", succeeded)
+	}
+	var helps int64
+	repository.DB.Model(&model.UnlockHelp{}).Where("character_id = ?", character.ID).Count(&helps)
+	if helps != 1 {
+		t.Errorf("helps = %d, want 1", helps)
+	}
+	if events := unlockEvents(t, character.ID); len(events) != 1 || events[0].ToStatus != model.UnlockStatusHalfUnlocked {
+		t.Errorf("events = %+v, want one transition to half unlocked", events)
+	}
+}
+
+func TestApplyHelpConcurrentHelpers(t *testing.T) {
+	repotest.Open(t)
+	m := NewUnlockStateMachine()
+	character := createUnlockTestCharacter(t, model.UnlockStatusLocked)
+	policy := HelpUnlockPolicy{HalfThreshold: 2, FullThreshold: 4}
+
+	// 不同好友同时助力：每人记录一次，每个阶段只转换一次且不跳过半解锁
+	const helpers = 6
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	changed := 0
+	for i := range helpers {
+		helper := createUnlockTestUser(t, int64(100+i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := m.ApplyHelp(character.ID, helper.ID, policy)
+			if errors.Is(err, ErrInvalidUnlockTransition) {
+				// 已完全解锁后的助力被拒绝
+				return
+			}
+			if err != nil {
+				t.Errorf("ApplyHelp: %v", err)
+				return
+			}
+			if result.Changed {
+				mu.Lock()
+				changed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	var helps int64
+	repository.DB.Model(&model.UnlockHelp{}).Where("character_id = ?", character.ID).Count(&helps)
+	if helps != int64(policy.FullThreshold) {
+		t.Errorf("helps = %d, want %d", helps, policy.FullThreshold)
+	}
+	events := unlockEvents(t, character.ID)
+	if changed != 2 || len(events) != 2 ||
+		events[0].FromStatus != model.UnlockStatusLocked || events[0].ToStatus != model.UnlockStatusHalfUnlocked ||
+		events[1].FromStatus != model.UnlockStatusHalfUnlocked || events[1].ToStatus != model.UnlockStatusFullUnlocked {
+		t.Errorf("changed = %d, events = %+v; want locked->half->full", changed, events)
+	}
+}
+
+// createSucceededPayment 把角色从 from 付费完全解锁，返回成功的支付记录
+func createSucceededPayment(t *testing.T, m *UnlockStateMachine, from model.UnlockStatus) (*model.Payment, *model.Character) {
+	t.Helper()
+	character := createUnlockTestCharacter(t, from)
+	payment := &model.Payment{
+		UserID:      character.UserID,
+		CharacterID: character.ID,
+		Method:      model.PaymentMethodStars,
+		Amount:      100,
+		Status:      model.PaymentStatusPending,
+
+		PreviousUnlockStatus: from,
+	}
+	if err := repository.NewPaymentRepository().Create(payment); err != nil {
+		t.Fatalf("create payment: %v", err)
+	}
+	payment, _, err := repository.NewPaymentRepository().Settle(payment.ID, "charge-1", model.PaymentStatusSucceeded)
+	if err != nil {
+		t.Fatalf("settle: %v", err)
+	}
+	if _, err := m.Transition(UnlockTransition{CharacterID: character.ID, To: model.UnlockStatusFullUnlocked, ActorType: model.UnlockActorPayment, PaymentID: &payment.ID}); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	return payment, character
+}
+
+func TestRefundCallsOutsideTransaction(t *testing.T) {
+	repotest.Open(t)
+	m := NewUnlockStateMachine()
+	payment, character := createSucceededPayment(t, m, model.UnlockStatusHalfUnlocked)
+
+	// 测试数据库只有一个连接：在事务内调用时这里的查询会一直等待
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := m.Refund(payment.ID, "test", model.UnlockActorAdmin, func(p *model.Payment) error {
+			var current model.Payment
+			return repository.DB.First(&current, p.ID).Error
+		})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Refund: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("refundFn blocked on the payment row lock")
+	}
+
+	var reloaded model.Character
+	repository.DB.First(&reloaded, character.ID)
+	if reloaded.UnlockStatus != model.UnlockStatusHalfUnlocked {
+		t.Errorf("unlock status = %d, want half unlocked", reloaded.UnlockStatus)
+	}
+}
+
+func TestRefundExternalFailure(t *testing.T) {
+	repotest.Open(t)
+	m := NewUnlockStateMachine()
+	payment, character := createSucceededPayment(t, m, model.UnlockStatusLocked)
+
+	// 外部退款失败时不修改支付和角色
+	failure := errors.New("telegram unavailable")
+	if _, _, err := m.Refund(payment.ID, "test", model.UnlockActorAdmin, func(*model.Payment) error { return failure }); !errors.Is(err, failure) {
+		t.Fatalf("Refund err = %v, want %v", err, failure)
+	}
+	reloaded, _ := repository.NewPaymentRepository().GetByID(payment.ID)
+	if reloaded.Status != model.PaymentStatusSucceeded {
+		t.Errorf("payment status = %s, want succeeded", reloaded.Status)
+	}
+	var current model.Character
+	repository.DB.First(&current, character.ID)
+	if current.UnlockStatus != model.UnlockStatusFullUnlocked {
+		t.Errorf("unlock status = %d, want full unlocked", current.UnlockStatus)
+	}
+
+	// 外部退款期间已由 refunded_payment 记录的退款不报错
+	if _, _, err := m.Refund(payment.ID, "webhook", model.UnlockActorTelegram, nil); err != nil {
+		t.Fatalf("webhook refund: %v", err)
+	}
+	if _, _, err := m.Refund(payment.ID, "admin", model.UnlockActorAdmin, func(*model.Payment) error { return nil }); !errors.Is(err, repository.ErrPaymentNotRefundable) {
+		t.Errorf("refund of refunded payment = %v, want ErrPaymentNotRefundable", err)
+	}
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"lauraai-backend/internal/llm"
+)
+
+// VisionService 照片外貌分析
+type VisionService struct {
+	model llm.VisionModel
+}
+
+func NewVisionService(model llm.VisionModel) *VisionService {
+	return &VisionService{model: model}
+}
+
+func (s *VisionService) AnalyzeImage(ctx context.Context, imageData []byte, mimeType string) (string, error) {
+	prompt := `Analyze this person's appearance for creating a high-quality 3D character avatar. 
+	Please provide a detailed description including:
+	1. Gender and approximate age.
+	2. Ethnicity/Race: Identify the person's ethnic background (e.g., East Asian, Caucasian, African, Hispanic, South Asian, etc.).
+	3. Hair: style, length, color, and texture.
+	4. Eyes: color, shape, and expression.
+	5. Facial Features: face shape, skin tone, any distinctive marks, glasses, or facial hair.
+	6. Clothing: style, color, and any visible accessories.
+	7. Overall Vibe: personality traits reflected in their expression (e.g., warm, mysterious, confident).
+	Keep the description vivid but concise, optimized for a text-to-image AI prompt.`
+
+	description, err := s.model.DescribeImage(ctx, prompt, &llm.Image{Data: imageData, MIMEType: mimeType})
+	if err != nil {
+		return "", fmt.Errorf("Failed to generate description: %v", err)
+	}
+	return description, nil
+}
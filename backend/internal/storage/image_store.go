@@ -0,0 +1,78 @@
+// Package storage 生成图片的存储后端（本地目录或 S3 兼容对象存储）
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"lauraai-backend/internal/config"
+)
+
+// ErrImageNotFound 图片不存在
+var ErrImageNotFound = errors.New("image not found")
+
+// URLPrefix 图片访问路径前缀，存储在角色上的 URL 为 URLPrefix + key，由 UploadsHandler 读取存储后端返回
+const URLPrefix = "/uploads/"
+
+// ImageInfo 图片元信息
+type ImageInfo struct {
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// ImageStore 图片存储后端
+type ImageStore interface {
+	// Put 写入图片，key 为文件名
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get 读取图片，调用方负责关闭返回的 Reader；不存在时返回 ErrImageNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, *ImageInfo, error)
+	// Delete 删除图片，不存在时不报错
+	Delete(ctx context.Context, key string) error
+	// URL 返回图片的访问路径
+	URL(key string) string
+	// DeleteAll 删除所有图片，返回删除数量（仅用于调试清空数据）
+	DeleteAll(ctx context.Context) (int, error)
+}
+
+// Images 全局图片存储，由 InitImageStore 根据配置初始化
+var Images ImageStore
+
+// InitImageStore 根据 IMAGE_STORE 配置初始化图片存储（local 或 s3）
+func InitImageStore() error {
+	var err error
+	switch config.AppConfig.ImageStore {
+	case "", "local":
+		Images, err = NewLocalImageStore(config.AppConfig.UploadsDir)
+	case "s3":
+		Images, err = NewS3ImageStore(S3Config{
+			Endpoint:  config.AppConfig.S3Endpoint,
+			AccessKey: config.AppConfig.S3AccessKey,
+			SecretKey: config.AppConfig.S3SecretKey,
+			Bucket:    config.AppConfig.S3Bucket,
+			Region:    config.AppConfig.S3Region,
+			UseSSL:    config.AppConfig.S3UseSSL,
+		})
+	default:
+		return fmt.Errorf("unknown IMAGE_STORE: %s", config.AppConfig.ImageStore)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("图片存储后端: %s", config.AppConfig.ImageStore)
+	return nil
+}
+
+// KeyFromURL 从图片 URL（/uploads/<key> 或包含该路径的完整 URL）中提取 key，非存储图片返回空字符串
+func KeyFromURL(url string) string {
+	idx := strings.Index(url, URLPrefix)
+	if idx < 0 {
+		return ""
+	}
+	return url[idx+len(URLPrefix):]
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// testImageStore 所有存储后端都要满足的行为
+func testImageStore(t *testing.T, store ImageStore) {
+	ctx := context.Background()
+	data := []byte("\x89PNG fake image data")
+
+	if _, _, err := store.Get(ctx, "missing.png"); !errors.Is(err, ErrImageNotFound) {
+		t.Fatalf("Get missing = %v, want ErrImageNotFound", err)
+	}
+
+	before := time.Now().Add(-time.Minute)
+	if err := store.Put(ctx, "a.png", data, "image/png"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := store.Put(ctx, "b.jpg", []byte("jpeg"), "image/jpeg"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	reader, info, err := store.Get(ctx, "a.png")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Get content = %q (%v), want %q", got, err, data)
+	}
+	if info.Size != int64(len(data)) || info.ContentType != "image/png" || info.LastModified.Before(before) {
+		t.Errorf("info = %+v", info)
+	}
+
+	if url := store.URL("a.png"); url != "/uploads/a.png" || KeyFromURL(url) != "a.png" {
+		t.Errorf("URL = %q", url)
+	}
+
+	if err := store.Delete(ctx, "b.jpg"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, _, err := store.Get(ctx, "b.jpg"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("Get after Delete = %v", err)
+	}
+	if err := store.Delete(ctx, "b.jpg"); err != nil {
+		t.Errorf("Delete missing: %v", err)
+	}
+
+	store.Put(ctx, "c.png", data, "image/png")
+	deleted, err := store.DeleteAll(ctx)
+	if err != nil || deleted != 2 {
+		t.Fatalf("DeleteAll = %d, %v; want 2", deleted, err)
+	}
+	if _, _, err := store.Get(ctx, "a.png"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("Get after DeleteAll = %v", err)
+	}
+}
+
+func TestLocalImageStore(t *testing.T) {
+	dir := t.TempDir() + "/uploads"
+	store, err := NewLocalImageStore(dir)
+	if err != nil {
+		t.Fatalf("NewLocalImageStore: %v", err)
+	}
+	testImageStore(t, store)
+
+	// DeleteAll 不删除存储目录本身
+	if stat, err := os.Stat(dir); err != nil || !stat.IsDir() {
+		t.Errorf("uploads dir removed: %v", err)
+	}
+}
+
+// TestS3ImageStore 需要 S3 兼容服务，例如本地 MinIO：
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//	TEST_S3_ENDPOINT=localhost:9000 go test ./internal/storage/
+//
+// 访问密钥默认为 minioadmin，可通过 TEST_S3_ACCESS_KEY、TEST_S3_SECRET_KEY 覆盖
+func TestS3ImageStore(t *testing.T) {
+	endpoint := os.Getenv("TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("TEST_S3_ENDPOINT not set, skipping S3 image store test")
+	}
+	accessKey, secretKey := os.Getenv("TEST_S3_ACCESS_KEY"), os.Getenv("TEST_S3_SECRET_KEY")
+	if accessKey == "" {
+		accessKey, secretKey = "minioadmin", "minioadmin"
+	}
+
+	// 每次使用新的存储桶，DeleteAll 不会影响其他数据
+	store, err := NewS3ImageStore(S3Config{
+		Endpoint:  endpoint,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		Bucket:    fmt.Sprintf("lauraai-test-%d", time.Now().UnixNano()),
+		Region:    "us-east-1",
+		UseSSL:    os.Getenv("TEST_S3_USE_SSL") == "true",
+	})
+	if err != nil {
+		t.Fatalf("NewS3ImageStore: %v", err)
+	}
+	t.Cleanup(func() {
+		store.DeleteAll(context.Background())
+		store.client.RemoveBucket(context.Background(), store.bucket)
+	})
+	testImageStore(t, store)
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+// LocalImageStore 本地目录存储（单实例部署，需要持久化磁盘）
+type LocalImageStore struct {
+	dir string
+}
+
+func NewLocalImageStore(dir string) (*LocalImageStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalImageStore{dir: dir}, nil
+}
+
+func (s *LocalImageStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	return os.WriteFile(filepath.Join(s.dir, key), data, 0644)
+}
+
+func (s *LocalImageStore) Get(ctx context.Context, key string) (io.ReadCloser, *ImageInfo, error) {
+	file, err := os.Open(filepath.Join(s.dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, ErrImageNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, &ImageInfo{
+		Size:         stat.Size(),
+		ContentType:  mime.TypeByExtension(filepath.Ext(key)),
+		LastModified: stat.ModTime(),
+	}, nil
+}
+
+func (s *LocalImageStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(filepath.Join(s.dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalImageStore) URL(key string) string {
+	return URLPrefix + key
+}
+
+func (s *LocalImageStore) DeleteAll(ctx context.Context) (int, error) {
+	deleted := 0
+	err := filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// 只删除文件，不删除目录
+		if path == s.dir || info.IsDir() {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		deleted++
+		return nil
+	})
+	return deleted, err
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config S3 兼容对象存储配置（AWS S3、MinIO、R2 等）
+type S3Config struct {
+	Endpoint  string // 例如 s3.amazonaws.com、localhost:9000
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	Region    string
+	UseSSL    bool
+}
+
+// S3ImageStore S3 兼容对象存储，多实例部署时共享图片
+// 存储桶保持私有，图片统一通过 /uploads/<key> 读取，由 UploadsHandler 做签名和解锁状态校验
+type S3ImageStore struct {
+	client *minio.Client
+	bucket string
+}
+
+func NewS3ImageStore(cfg S3Config) (*S3ImageStore, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required for s3 image store")
+	}
+
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %v", err)
+	}
+
+	// 存储桶不存在时自动创建（便于本地 MinIO 测试）
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check S3 bucket: %v", err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+			return nil, fmt.Errorf("failed to create S3 bucket: %v", err)
+		}
+	}
+
+	return &S3ImageStore{client: client, bucket: cfg.Bucket}, nil
+}
+
+func (s *S3ImageStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	return err
+}
+
+func (s *S3ImageStore) Get(ctx context.Context, key string) (io.ReadCloser, *ImageInfo, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	// GetObject 不会立即请求，通过 Stat 确认对象存在
+	stat, err := object.Stat()
+	if err != nil {
+		object.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, nil, ErrImageNotFound
+		}
+		return nil, nil, err
+	}
+	return object, &ImageInfo{
+		Size:         stat.Size,
+		ContentType:  stat.ContentType,
+		LastModified: stat.LastModified,
+	}, nil
+}
+
+func (s *S3ImageStore) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3ImageStore) URL(key string) string {
+	return URLPrefix + key
+}
+
+func (s *S3ImageStore) DeleteAll(ctx context.Context) (int, error) {
+	deleted := 0
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Recursive: true}) {
+		if object.Err != nil {
+			return deleted, object.Err
+		}
+		if err := s.Delete(ctx, object.Key); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
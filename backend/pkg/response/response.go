@@ -82,3 +82,13 @@ func ErrorWithCodeI18n(c *gin.Context, locale i18n.Locale, code int, errorCode s
 		ErrorCode: errorCode,
 	})
 }
+
+// ErrorWithCodeData 返回带错误码和附加数据的错误响应
+func ErrorWithCodeData(c *gin.Context, code int, errorCode string, message string, data interface{}) {
+	c.JSON(http.StatusOK, Response{
+		Code:      code,
+		Message:   message,
+		ErrorCode: errorCode,
+		Data:      data,
+	})
+}
@@ -63,10 +63,9 @@ export default function ChatWindow({ characterId, characterTitle = 'Soulmate', c
     if (!characterId) return
     
     try {
-      const history = await apiClient.getMessages(characterId, 50) as any[]
-      // 后端返回的是 DESC 顺序（最新在前），需要反转为 ASC（最新在后）
-      const reversedHistory = [...history].reverse()
-      setMessages(reversedHistory.map((msg, idx) => ({
+      // 后端按时间正序返回（最新在后）
+      const { messages: history } = await apiClient.getMessages(characterId, 50)
+      setMessages(history.map((msg, idx) => ({
         id: idx + 1,
         type: msg.sender_type === 'user' ? 'user' : 'character',
         text: msg.content,
@@ -143,6 +142,12 @@ export default function ChatWindow({ characterId, characterTitle = 'Soulmate', c
         throw new Error(`发送消息失败: ${response.status}`)
       }
 
+      // 开始生成之前的错误（例如超出每日额度 QUOTA_EXCEEDED）返回普通 JSON
+      if (response.headers.get('Content-Type')?.includes('application/json')) {
+        const result = await response.json()
+        throw new Error(`发送消息失败: ${result.error_code || result.message}`)
+      }
+
       // 读取 SSE 流
       const reader = response.body?.getReader()
       const decoder = new TextDecoder()
@@ -157,32 +162,39 @@ export default function ChatWindow({ characterId, characterTitle = 'Soulmate', c
       }])
 
       if (reader) {
-        while (true) {
+        // 事件以空行分隔：event: <类型>\ndata: <JSON>；以冒号开头的行是心跳注释
+        let buffer = ''
+        let finished = false
+        while (!finished) {
           const { done, value } = await reader.read()
           if (done) break
 
-          const chunk = decoder.decode(value)
-          const lines = chunk.split('\n')
+          buffer += decoder.decode(value, { stream: true })
+          const events = buffer.split('\n\n')
+          buffer = events.pop() ?? ''
+
+          for (const raw of events) {
+            let event = 'message'
+            let data = ''
+            for (const line of raw.split('\n')) {
+              if (line.startsWith('event: ')) event = line.slice(7)
+              else if (line.startsWith('data: ')) data += line.slice(6)
+            }
+            if (!data) continue
 
-          for (const line of lines) {
-            if (line.startsWith('data: ')) {
-              const data = line.slice(6)
-              if (data === '[DONE]') continue
-              
-              try {
-                const parsed = JSON.parse(data)
-                if (parsed.chunk) {
-                  characterResponse += parsed.chunk
-                  // 更新角色消息
-                  setMessages(prev => prev.map(msg => 
-                    msg.id === characterMessageId 
-                      ? { ...msg, text: characterResponse }
-                      : msg
-                  ))
-                }
-              } catch (e) {
-                // 忽略解析错误
-              }
+            const payload = JSON.parse(data)
+            if (event === 'delta') {
+              characterResponse += payload.text
+              // 更新角色消息
+              setMessages(prev => prev.map(msg => 
+                msg.id === characterMessageId 
+                  ? { ...msg, text: characterResponse }
+                  : msg
+              ))
+            } else if (event === 'error') {
+              throw new Error(`生成回复失败: ${payload.code}`)
+            } else if (event === 'message_end') {
+              finished = true
             }
           }
         }
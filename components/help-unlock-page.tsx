@@ -67,7 +67,7 @@ export default function HelpUnlockPage({
       fetch('http://127.0.0.1:7242/ingest/91080ee1-2ffe-4745-8552-767fa721acb6',{method:'POST',headers:{'Content-Type':'application/json'},body:JSON.stringify({location:'help-unlock-page.tsx:handleHelpUnlock',message:'调用helpUnlock前',data:{characterId:characterData.id,hasInitData:!!initData,initDataLen:initData?.length||0},timestamp:Date.now(),sessionId:'debug-session',hypothesisId:'E'})}).catch(()=>{});
       // #endregion
       
-      await apiClient.helpUnlock(characterData.id.toString())
+      await apiClient.helpUnlock(characterData.id.toString(), shareCode)
       
       // #region agent log
       fetch('http://127.0.0.1:7242/ingest/91080ee1-2ffe-4745-8552-767fa721acb6',{method:'POST',headers:{'Content-Type':'application/json'},body:JSON.stringify({location:'help-unlock-page.tsx:handleHelpUnlock',message:'helpUnlock成功',data:{characterId:characterData.id},timestamp:Date.now(),sessionId:'debug-session',hypothesisId:'success'})}).catch(()=>{});
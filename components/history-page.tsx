@@ -36,13 +36,14 @@ export default function HistoryPage({ onClose, onSelectCharacter }: HistoryPageP
         const charactersWithLastMsg = await Promise.all(
           unlockedChars.map(async (char) => {
             try {
-              const messages = await apiClient.getMessages(char.id.toString(), 1) as any[]
+              const { messages } = await apiClient.getMessages(char.id.toString(), 1)
+              const last = messages[messages.length - 1]
               return {
                 id: char.id.toString(),
                 title: char.title,
                 image_url: char.clear_image_url || char.image_url,
-                last_message: messages.length > 0 ? messages[0].content : '',
-                last_message_time: messages.length > 0 ? new Date(messages[0].created_at).toLocaleDateString() : ''
+                last_message: last ? last.content : '',
+                last_message_time: last ? new Date(last.created_at).toLocaleDateString() : ''
               }
             } catch (e) {
               return {
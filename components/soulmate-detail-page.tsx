@@ -303,15 +303,46 @@ export default function SoulmateDetailPage({
     onUnlockSuccess?.()
   }
 
+  // 打开 Telegram Stars 发票，返回支付结果：paid / cancelled / failed / pending
+  const openInvoice = (link: string) => new Promise<string>((resolve) => {
+    const webApp = (window as any).Telegram?.WebApp
+    if (!webApp?.openInvoice) {
+      resolve('failed')
+      return
+    }
+    webApp.openInvoice(link, (status: string) => resolve(status))
+  })
+
+  // 支付：后端返回发票或转账信息，用户完成支付后等待后端确认到账再显示解锁成功
   const handlePay = async (method: 'stars' | 'ton') => {
     if (!character?.id) return
-    
-    const result = await apiClient.unlockCharacter(character.id.toString(), method)
-    
-    // 更新本地 character 数据（如果有需要）
+    const characterId = character.id.toString()
+
+    let result: any = await apiClient.unlockCharacter(characterId, method)
+
+    // 优惠码全额抵扣时已直接解锁，否则需要先完成支付
+    if (result.status === 'pending') {
+      if (method === 'stars') {
+        const status = await openInvoice(result.invoice_link)
+        if (status !== 'paid' && status !== 'pending') {
+          throw new Error(`Stars payment ${status}`)
+        }
+        result = await apiClient.waitForUnlock(characterId)
+      } else {
+        const webApp = (window as any).Telegram?.WebApp
+        if (webApp?.openLink) {
+          webApp.openLink(result.payment_link)
+        } else {
+          window.open(result.payment_link, '_blank')
+        }
+        result = await apiClient.waitForTonPayment(characterId, result.payment_id)
+      }
+    }
+
+    // 更新本地 character 数据
     if (character) {
       character.unlock_status = result.unlock_status
-      character.clear_image_url = result.image_url
+      character.clear_image_url = result.clear_image_url
     }
   }
 
@@ -41,6 +41,25 @@ interface ApiResponse<T> {
   data?: T
 }
 
+// 付费解锁接口的响应：待支付时带发票链接或转账信息，已解锁时为角色数据
+export interface UnlockPaymentResponse {
+  status?: 'pending'
+  payment_id: number
+  payment_status?: string
+  unlock_status: number
+  price?: number | string
+  currency: string
+  invoice_link?: string
+  payment_link?: string
+  wallet?: string
+  amount_nano?: string
+  memo?: string
+  promo_code?: string
+  promo_discount?: number | string
+  image_url?: string
+  clear_image_url?: string
+}
+
 // 自定义错误类，包含 error_code
 class ApiError extends Error {
   error_code?: string
@@ -222,15 +241,83 @@ class ApiClient {
     return new EventSource(url.replace('/chat', '/chat?message=' + encodeURIComponent(message)))
   }
 
-  async getMessages(characterId: string, limit: number = 50) {
-    return this.request(`/characters/${characterId}/messages?limit=${limit}`)
+  // 停止角色正在生成的回复，已生成的部分会保存并标记为 interrupted
+  async cancelChat(characterId: string) {
+    return this.request<{ canceled: boolean }>(`/characters/${characterId}/chat/cancel`, {
+      method: 'POST',
+    })
+  }
+
+  // 今天（UTC）的对话用量和额度，limit 为 0 表示不限制
+  async getUsage() {
+    return this.request<{
+      tier: 'free' | 'premium'
+      messages: number
+      message_limit: number
+      prompt_tokens: number
+      completion_tokens: number
+      tokens: number
+      token_limit: number
+      reset_at: string
+    }>('/usage')
+  }
+
+  // 聊天历史按时间正序返回；传 beforeId 加载更早的消息，传 afterId 加载之后的新消息
+  async getMessages(characterId: string, limit: number = 50, cursor: { beforeId?: number; afterId?: number } = {}) {
+    const params = new URLSearchParams({ limit: String(limit) })
+    if (cursor.beforeId) params.set('before_id', String(cursor.beforeId))
+    if (cursor.afterId) params.set('after_id', String(cursor.afterId))
+    return this.request<{ messages: any[]; has_more: boolean }>(`/characters/${characterId}/messages?${params}`)
+  }
+
+  // 修改用户消息：truncate 删除之后的对话，branch 保留原消息和之后的对话作为可切换的版本
+  async editMessage(characterId: string, messageId: number, message: string, mode: 'truncate' | 'branch' = 'truncate') {
+    return this.request(`/characters/${characterId}/messages/${messageId}`, {
+      method: 'PATCH',
+      body: JSON.stringify({ message, mode }),
+    })
+  }
+
+  async deleteMessage(characterId: string, messageId: number) {
+    return this.request(`/characters/${characterId}/messages/${messageId}`, {
+      method: 'DELETE',
+    })
+  }
+
+  // 消息所在位置的所有版本（重新生成的回复、分支编辑的消息）
+  async getMessageVersions(characterId: string, messageId: number) {
+    return this.request<{ versions: any[]; active_id: number }>(`/characters/${characterId}/messages/${messageId}/versions`)
+  }
+
+  async selectMessageVersion(characterId: string, messageId: number) {
+    return this.request(`/characters/${characterId}/messages/${messageId}/select`, {
+      method: 'POST',
+    })
   }
 
-  // 图片生成（使用更长的超时时间，因为生成需要时间）
+  // 图片生成：后端创建异步任务后立即返回，这里轮询任务直到完成，返回生成好的角色
   async generateImage(characterId: string) {
-    return this.request(`/characters/${characterId}/generate-image`, {
+    const job = await this.request<any>(`/characters/${characterId}/generate-image`, {
       method: 'POST',
-    }, 60000) // 60秒超时
+    })
+
+    const deadline = Date.now() + 5 * 60 * 1000 // 最多等待5分钟
+    while (Date.now() < deadline) {
+      const result = await this.getJob(job.job_id)
+      if (result.status === 'completed') {
+        return result.character
+      }
+      if (result.status === 'failed') {
+        throw new ApiError(result.error || '图片生成失败')
+      }
+      await new Promise((resolve) => setTimeout(resolve, 2000))
+    }
+    throw new ApiError('图片生成超时')
+  }
+
+  // 生成任务状态
+  async getJob(jobId: number | string) {
+    return this.request<any>(`/jobs/${jobId}`)
   }
 
   // Mini Me 生成
@@ -318,31 +405,62 @@ class ApiClient {
     return this.request(`/share/${shareCode}`)
   }
 
-  // 帮助解锁
-  async helpUnlock(characterId: string): Promise<{ message: string; unlock_status: number; image_url: string }> {
+  // 帮助解锁，shareCode 为打开的分享码
+  async helpUnlock(characterId: string, shareCode: string): Promise<{ message: string; unlock_status: number; image_url: string }> {
     return this.request(`/characters/${characterId}/help-unlock`, {
       method: 'POST',
+      body: JSON.stringify({ share_code: shareCode }),
     })
   }
 
-  // 付费解锁
-  async unlockCharacter(characterId: string, paymentMethod: 'stars' | 'ton', transactionId?: string): Promise<{
-    message: string
-    unlock_status: number
-    image_url: string
-    description: string
-    price_paid: number
-    currency: string
-  }> {
+  // 付费解锁：返回待支付的发票（Stars）或转账信息（TON），支付结果由后端确认后更新解锁状态
+  // 优惠码全额抵扣时直接解锁，返回 payment_status 为 succeeded 的角色数据
+  async unlockCharacter(characterId: string, paymentMethod: 'stars' | 'ton', promoCode?: string): Promise<UnlockPaymentResponse> {
     return this.request(`/characters/${characterId}/unlock`, {
       method: 'POST',
       body: JSON.stringify({
         payment_method: paymentMethod,
-        transaction_id: transactionId || '',
+        promo_code: promoCode || '',
       }),
     })
   }
 
+  // 支付完成后轮询角色直到完全解锁（Stars 由 Webhook 确认到账），返回最新的角色
+  async waitForUnlock(characterId: string) {
+    const deadline = Date.now() + 2 * 60 * 1000 // 最多等待2分钟
+    while (Date.now() < deadline) {
+      const character = await this.getCharacter(characterId) as any
+      if (character.unlock_status === 2) { // 完全解锁
+        return character
+      }
+      await new Promise((resolve) => setTimeout(resolve, 2000))
+    }
+    throw new ApiError('支付确认超时')
+  }
+
+  // 确认 TON 转账是否到账，到账后返回解锁后的角色；未到账时抛出 error_code 为 PAYMENT_PENDING 的错误
+  async verifyTonPayment(characterId: string, paymentId: number) {
+    return this.request<any>(`/characters/${characterId}/unlock/ton/verify?payment_id=${paymentId}`, {
+      method: 'POST',
+    })
+  }
+
+  // TON 转账后轮询确认接口直到到账（链上确认通常需要几十秒）
+  async waitForTonPayment(characterId: string, paymentId: number) {
+    const deadline = Date.now() + 5 * 60 * 1000 // 最多等待5分钟
+    while (Date.now() < deadline) {
+      try {
+        return await this.verifyTonPayment(characterId, paymentId)
+      } catch (error) {
+        if (!(error instanceof ApiError) || error.error_code !== 'PAYMENT_PENDING') {
+          throw error
+        }
+      }
+      await new Promise((resolve) => setTimeout(resolve, 3000))
+    }
+    throw new ApiError('支付确认超时')
+  }
+
   // 获取解锁价格
   async getUnlockPrice(characterId: string): Promise<{
     unlock_status: number